@@ -127,8 +127,8 @@ func ProcessTopUpApproval(c *gin.Context) {
 		}
 
 	} else if req.Status == "rejected" {
-		// Use the same RejectTopUp function that bot uses
-		err = service.RejectTopUp(req.TransactionID, 0)
+		// Use the same RejectTopUp function that bot uses; the admin note is the reason sent to the user
+		err = service.RejectTopUp(req.TransactionID, 0, req.AdminNote)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
@@ -136,19 +136,6 @@ func ProcessTopUpApproval(c *gin.Context) {
 			})
 			return
 		}
-
-		// Send rejection notification with admin note
-		service.TxMutex.RLock()
-		transaction, exists := service.Transactions[req.TransactionID]
-		service.TxMutex.RUnlock()
-
-		if exists {
-			rejectionMessage := fmt.Sprintf("❌ Top up Anda sebesar Rp %s ditolak.", formatAmount(transaction.Amount))
-			if req.AdminNote != "" {
-				rejectionMessage += fmt.Sprintf(" Alasan: %s", req.AdminNote)
-			}
-			service.NotifyAdminError(transaction.UserID, "Top Up Rejected", rejectionMessage)
-		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -227,16 +214,17 @@ func GetAllTransactions(c *gin.Context) {
 	var apiTransactions []gin.H
 	for _, tx := range paginatedTransactions {
 		apiTransactions = append(apiTransactions, gin.H{
-			"id":          tx.ID,
-			"user_id":     tx.UserID,
-			"username":    tx.Username,
-			"amount":      tx.Amount,
-			"status":      tx.Status,
-			"qris_code":   tx.QRISCode,
-			"created_at":  tx.CreatedAt,
-			"expired_at":  tx.ExpiredAt,
-			"approved_by": tx.ApprovedBy,
-			"approved_at": tx.ApprovedAt,
+			"id":            tx.ID,
+			"user_id":       tx.UserID,
+			"username":      tx.Username,
+			"amount":        tx.Amount,
+			"status":        tx.Status,
+			"qris_code":     tx.QRISCode,
+			"created_at":    tx.CreatedAt,
+			"expired_at":    tx.ExpiredAt,
+			"approved_by":   tx.ApprovedBy,
+			"approved_at":   tx.ApprovedAt,
+			"reject_reason": tx.RejectReason,
 		})
 	}
 
@@ -347,9 +335,10 @@ func parseIntDefault(s string, defaultVal int) int {
 // CreateTopUpTransaction creates a new topup transaction via API
 func CreateTopUpTransaction(c *gin.Context) {
 	var req struct {
-		UserID   int64  `json:"user_id" binding:"required"`
-		Username string `json:"username" binding:"required"`
-		Amount   int64  `json:"amount" binding:"required"`
+		UserID      int64  `json:"user_id" binding:"required"`
+		Username    string `json:"username" binding:"required"`
+		Amount      int64  `json:"amount" binding:"required"`
+		VoucherCode string `json:"voucher_code"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -378,7 +367,7 @@ func CreateTopUpTransaction(c *gin.Context) {
 	}
 
 	// Create topup transaction using the same service function
-	topUpResp, err := service.CreateTopUpTransaction(req.UserID, req.Username, req.Amount)
+	topUpResp, err := service.CreateTopUpTransaction(req.UserID, req.Username, req.Amount, req.VoucherCode)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
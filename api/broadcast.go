@@ -0,0 +1,288 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// BroadcastRequest is the body of POST /admin/broadcasts
+type BroadcastRequest struct {
+	Message     string                    `json:"message"`    // text, or the caption of the media
+	ParseMode   string                    `json:"parse_mode"` // "Markdown" (default), "MarkdownV2", "HTML" or "none"
+	MediaType   string                    `json:"media_type"` // "", "photo" or "document"
+	Media       string                    `json:"media"`      // URL or Telegram file_id
+	Buttons     []service.BroadcastButton `json:"buttons"`
+	Segment     service.BroadcastSegment  `json:"segment"`      // empty for every user
+	ScheduledAt *time.Time                `json:"scheduled_at"` // send later instead of now
+	Repeat      string                    `json:"repeat"`       // "", "daily" or "weekly"; needs scheduled_at
+}
+
+// BroadcastTestRequest is the body of POST /admin/broadcasts/test
+type BroadcastTestRequest struct {
+	BroadcastRequest
+	ChatID int64 `json:"chat_id"` // defaults to ADMIN_CHAT_ID
+}
+
+// content validates the parse mode and returns what the broadcast sends
+func (r BroadcastRequest) content() (service.BroadcastContent, error) {
+	parseMode := r.ParseMode
+	switch parseMode {
+	case "":
+		parseMode = service.ParseModeMarkdown
+	case "none":
+		parseMode = ""
+	case service.ParseModeMarkdown, service.ParseModeMarkdownV2, service.ParseModeHTML:
+	default:
+		return service.BroadcastContent{}, fmt.Errorf("invalid parse_mode")
+	}
+
+	content := service.BroadcastContent{
+		Message:   r.Message,
+		ParseMode: parseMode,
+		MediaType: r.MediaType,
+		Media:     r.Media,
+		Buttons:   r.Buttons,
+	}
+	return content, content.Validate()
+}
+
+// Get the latest broadcast jobs with their progress
+func GetBroadcasts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	jobs, err := service.GetBroadcastJobs(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    jobs,
+		"count":   len(jobs),
+	})
+}
+
+// Queue a broadcast to every user or a segment, now or at scheduled_at; the worker sends
+// it in the background
+func CreateBroadcast(c *gin.Context) {
+	var req BroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	content, err := req.content()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	segment, err := service.ParseBroadcastSegment(req.Segment.String())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var job *models.BroadcastJob
+	switch {
+	case req.ScheduledAt != nil:
+		job, err = service.ScheduleBroadcastJob(content, 0, segment, *req.ScheduledAt, req.Repeat)
+	case req.Repeat != "":
+		err = fmt.Errorf("repeat needs scheduled_at")
+	default:
+		job, err = service.CreateSegmentBroadcastJob(content, 0, segment)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// Send a broadcast to one chat only, by default the admin's, to check how it looks
+func SendTestBroadcast(c *gin.Context) {
+	var req BroadcastTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	content, err := req.content()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	chatID := req.ChatID
+	if chatID == 0 {
+		chatID = config.GetAdminChatID()
+	}
+	if chatID == 0 || config.BotInstance == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "No chat to send the preview to",
+		})
+		return
+	}
+
+	if err := service.SendBroadcastPreview(config.BotInstance, chatID, content); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Preview sent",
+	})
+}
+
+// Count the users a broadcast to a segment would reach, without sending anything
+func PreviewBroadcastSegment(c *gin.Context) {
+	var req service.BroadcastSegment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	segment, err := service.ParseBroadcastSegment(req.String())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	count, err := service.CountBroadcastSegment(segment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"segment":     segment,
+			"description": segment.Describe(),
+			"count":       count,
+		},
+	})
+}
+
+// Get one broadcast job
+func GetBroadcast(c *gin.Context) {
+	id, ok := broadcastID(c)
+	if !ok {
+		return
+	}
+
+	job, err := service.GetBroadcastJob(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// Pause a queued or running broadcast
+func PauseBroadcast(c *gin.Context) {
+	changeBroadcast(c, service.PauseBroadcastJob)
+}
+
+// Resume a paused broadcast
+func ResumeBroadcast(c *gin.Context) {
+	changeBroadcast(c, service.ResumeBroadcastJob)
+}
+
+// Cancel a broadcast that has not finished
+func CancelBroadcast(c *gin.Context) {
+	changeBroadcast(c, service.CancelBroadcastJob)
+}
+
+func changeBroadcast(c *gin.Context, change func(uint) error) {
+	id, ok := broadcastID(c)
+	if !ok {
+		return
+	}
+
+	if err := change(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if config.BotInstance != nil {
+		service.RefreshBroadcastProgress(config.BotInstance, id)
+	}
+	job, _ := service.GetBroadcastJob(id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    job,
+	})
+}
+
+func broadcastID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid broadcast ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
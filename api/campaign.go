@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// Get conversion reports for all campaigns
+func GetCampaignReports(c *gin.Context) {
+	reports, err := service.GetCampaignReports()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load campaign reports: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reports,
+		"count":   len(reports),
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// CatalogOverrideRequest is the payload for setting a package override.
+// Omitted fields keep their current value.
+type CatalogOverrideRequest struct {
+	Hidden      *bool   `json:"hidden"`
+	DisplayName *string `json:"display_name"`
+	SortWeight  *int    `json:"sort_weight"`
+	Category    *string `json:"category"`
+	Featured    *bool   `json:"featured"`
+}
+
+// Get the full catalog with overrides applied, including hidden packages
+func GetAdminCatalog(c *gin.Context) {
+	entries, err := service.GetCatalogEntries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load catalog: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"count":   len(entries),
+	})
+}
+
+// Get the storefront categories
+func GetCatalogCategories(c *gin.Context) {
+	categories, err := service.GetStorefrontCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load categories: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    categories,
+	})
+}
+
+// Get all catalog overrides
+func GetCatalogOverrides(c *gin.Context) {
+	overrides, err := service.GetCatalogOverrides()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load overrides: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    overrides,
+		"count":   len(overrides),
+	})
+}
+
+// Create or update the override of a package
+func SetCatalogOverride(c *gin.Context) {
+	packageCode := c.Param("code")
+
+	var req CatalogOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	override, err := service.UpdateCatalogOverride(packageCode, func(o *models.CatalogOverride) {
+		if req.Hidden != nil {
+			o.Hidden = *req.Hidden
+		}
+		if req.DisplayName != nil {
+			o.DisplayName = *req.DisplayName
+		}
+		if req.SortWeight != nil {
+			o.SortWeight = *req.SortWeight
+		}
+		if req.Category != nil {
+			o.Category = *req.Category
+		}
+		if req.Featured != nil {
+			o.Featured = *req.Featured
+		}
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    override,
+	})
+}
+
+// Remove the override of a package
+func DeleteCatalogOverride(c *gin.Context) {
+	if err := service.DeleteCatalogOverride(c.Param("code")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Catalog override deleted successfully",
+	})
+}
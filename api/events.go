@@ -0,0 +1,171 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// adminEventHeartbeat keeps idle streams open through proxies
+const adminEventHeartbeat = 25 * time.Second
+
+// AdminTokenAuth authenticates admin requests by ADMIN_API_TOKEN, sent as a bearer token
+// or, for EventSource which cannot set headers, as the token query parameter
+func AdminTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := config.GetAdminAPIToken()
+		if expected == "" {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"success": false,
+				"error":   "ADMIN_API_TOKEN is not configured",
+			})
+			return
+		}
+
+		token := bearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			token = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   "Invalid admin token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an Authorization header; the scheme is case-insensitive
+func bearerToken(header string) string {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// RequestLogger is gin's request log with the token query parameter redacted, so the
+// ADMIN_API_TOKEN that EventSource clients send in the URL never reaches the logs
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			var statusColor, methodColor, resetColor string
+			if param.IsOutputColor() {
+				statusColor = param.StatusCodeColor()
+				methodColor = param.MethodColor()
+				resetColor = param.ResetColor()
+			}
+
+			if param.Latency > time.Minute {
+				param.Latency = param.Latency.Truncate(time.Second)
+			}
+			return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				statusColor, param.StatusCode, resetColor,
+				param.Latency,
+				param.ClientIP,
+				methodColor, param.Method, resetColor,
+				RedactTokenQuery(param.Path),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+// RedactTokenQuery masks the token query parameter of a request path
+func RedactTokenQuery(path string) string {
+	base, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Leave nothing readable when the query cannot be parsed
+		return base + "?REDACTED"
+	}
+	if !query.Has("token") {
+		return path
+	}
+	query.Set("token", "REDACTED")
+	return base + "?" + query.Encode()
+}
+
+// StreamAdminEvents streams the admin feed as Server-Sent Events. A client resuming with
+// Last-Event-ID (or last_event_id) first gets the buffered events it missed, or a reset
+// event when they are no longer buffered.
+func StreamAdminEvents(c *gin.Context) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid Last-Event-ID",
+			})
+			return
+		}
+		lastID = id
+	}
+
+	sub := service.SubscribeAdminEvents(lastID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Reset {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range sub.Backlog {
+		writeAdminEvent(w, event)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(adminEventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				// Dropped for lagging behind; the client reconnects with Last-Event-ID
+				return
+			}
+			writeAdminEvent(w, event)
+			w.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		}
+	}
+}
+
+func writeAdminEvent(w gin.ResponseWriter, event service.AdminEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		data = []byte("{}")
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
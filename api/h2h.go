@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+const partnerContextKey = "partner"
+
+// H2HPurchaseRequest is the payload of a host-to-host purchase
+type H2HPurchaseRequest struct {
+	RefID         string `json:"ref_id" binding:"required"` // partner's own order ID, used for idempotency
+	PackageCode   string `json:"package_code" binding:"required"`
+	PaymentMethod string `json:"payment_method"` // defaults to BALANCE
+}
+
+// PartnerAuth authenticates H2H requests by the X-API-Key header and the partner's IP allowlist
+func PartnerAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		partner, err := service.AuthenticatePartner(c.GetHeader("X-API-Key"), c.ClientIP())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.Set(partnerContextKey, partner)
+		c.Next()
+	}
+}
+
+func currentPartner(c *gin.Context) *models.Partner {
+	return c.MustGet(partnerContextKey).(*models.Partner)
+}
+
+// Get the storefront with the partner's prices
+func GetH2HCatalog(c *gin.Context) {
+	items, err := service.GetPartnerCatalog(currentPartner(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load catalog: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    items,
+		"count":   len(items),
+	})
+}
+
+// Get the partner's balance
+func GetH2HBalance(c *gin.Context) {
+	partner := currentPartner(c)
+	balance := service.GetUserBalance(partner.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"balance": balance.Balance,
+		},
+	})
+}
+
+// Buy a package; repeating a ref_id returns the original order
+func CreateH2HPurchase(c *gin.Context) {
+	var req H2HPurchaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	order, duplicate, err := service.PartnerPurchase(currentPartner(c), req.RefID, req.PackageCode, req.PaymentMethod)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	status := http.StatusCreated
+	if duplicate {
+		status = http.StatusOK
+	}
+
+	c.JSON(status, gin.H{
+		"success":   order.Status != service.PartnerOrderFailed,
+		"duplicate": duplicate,
+		"data":      order,
+	})
+}
+
+// Get the status of an order by ref_id, checking upstream while it is pending
+func GetH2HStatus(c *gin.Context) {
+	order, err := service.GetPartnerOrder(currentPartner(c).ID, c.Param("ref_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "Order not found",
+		})
+		return
+	}
+
+	if err := service.RefreshPartnerOrder(order); err != nil {
+		// The stored status is still valid; the worker keeps polling
+		c.Header("Warning", "199 - status check failed, showing last known status")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    order,
+	})
+}
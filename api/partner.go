@@ -0,0 +1,208 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// PartnerRequest is the payload for creating or updating an H2H partner.
+// On update, omitted fields keep their current value.
+type PartnerRequest struct {
+	Name        *string `json:"name"`
+	UserID      *int64  `json:"user_id"`
+	CallbackURL *string `json:"callback_url"`
+	AllowedIPs  *string `json:"allowed_ips"` // comma separated IPs or CIDRs
+	Active      *bool   `json:"active"`      // defaults to true on create
+}
+
+// Get all H2H partners
+func GetPartners(c *gin.Context) {
+	partners, err := service.GetPartners()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load partners: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    partners,
+		"count":   len(partners),
+	})
+}
+
+// Create a partner; the API key and callback secret are only returned here
+func CreatePartner(c *gin.Context) {
+	var req PartnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	partner := models.Partner{Active: true}
+	applyPartnerRequest(&partner, req)
+
+	apiKey, secret, err := service.CreatePartner(&partner)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":         true,
+		"data":            partner,
+		"api_key":         apiKey,
+		"callback_secret": secret,
+	})
+}
+
+// Update a partner
+func UpdatePartner(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid partner ID",
+		})
+		return
+	}
+
+	var req PartnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	partner, err := service.UpdatePartner(uint(id), func(p *models.Partner) {
+		applyPartnerRequest(p, req)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    partner,
+	})
+}
+
+// Issue a new API key and callback secret, invalidating the old ones
+func RotatePartnerKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid partner ID",
+		})
+		return
+	}
+
+	apiKey, secret, err := service.RotatePartnerKey(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"api_key":         apiKey,
+		"callback_secret": secret,
+	})
+}
+
+// Get a partner's latest orders
+func GetPartnerOrders(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid partner ID",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	orders, err := service.GetPartnerOrders(uint(id), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load orders: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    orders,
+		"count":   len(orders),
+	})
+}
+
+// Queue the callback of a finished order again
+func ResendPartnerCallback(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("order_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid order ID",
+		})
+		return
+	}
+
+	if err := service.ResendPartnerCallback(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Callback queued",
+	})
+}
+
+func applyPartnerRequest(partner *models.Partner, req PartnerRequest) {
+	if req.Name != nil {
+		partner.Name = *req.Name
+	}
+	if req.UserID != nil {
+		partner.UserID = *req.UserID
+	}
+	if req.CallbackURL != nil {
+		partner.CallbackURL = *req.CallbackURL
+	}
+	if req.AllowedIPs != nil {
+		partner.AllowedIPs = *req.AllowedIPs
+	}
+	if req.Active != nil {
+		partner.Active = *req.Active
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// PricingRuleRequest is the payload for creating or updating a pricing rule
+type PricingRuleRequest struct {
+	Name          string  `json:"name"`
+	PackageCode   string  `json:"package_code"`
+	NamePattern   string  `json:"name_pattern"`
+	Category      string  `json:"category"`
+	PaymentMethod string  `json:"payment_method"`
+	MarkupType    string  `json:"markup_type" binding:"required"` // "fixed" or "percent"
+	MarkupValue   float64 `json:"markup_value"`
+	RoundTo       int64   `json:"round_to"`
+	Priority      int     `json:"priority"`
+	IsActive      *bool   `json:"is_active"` // defaults to true
+}
+
+// Get all pricing rules
+func GetPricingRules(c *gin.Context) {
+	rules, err := service.GetPricingRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load pricing rules: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rules,
+		"count":   len(rules),
+	})
+}
+
+// Create a new pricing rule
+func CreatePricingRule(c *gin.Context) {
+	var req PricingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	rule := models.PricingRule{}
+	applyPricingRuleRequest(&rule, req)
+
+	if err := service.SavePricingRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// Update an existing pricing rule
+func UpdatePricingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid rule ID",
+		})
+		return
+	}
+
+	var req PricingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	rule, err := service.GetPricingRule(uint(id))
+	if err != nil {
+		c.JSON(pricingRuleErrorStatus(err), gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	applyPricingRuleRequest(rule, req)
+
+	if err := service.SavePricingRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    rule,
+	})
+}
+
+// Delete a pricing rule
+func DeletePricingRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid rule ID",
+		})
+		return
+	}
+
+	if err := service.DeletePricingRule(uint(id)); err != nil {
+		c.JSON(pricingRuleErrorStatus(err), gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Pricing rule deleted successfully",
+	})
+}
+
+// pricingRuleErrorStatus answers 404 for an unknown rule and 500 for database failures
+func pricingRuleErrorStatus(err error) int {
+	if errors.Is(err, service.ErrPricingRuleNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// Quote the sell price of a package for a payment method, optionally at a user's tier price
+func GetPriceQuote(c *gin.Context) {
+	packageCode := c.Query("package_code")
+	if packageCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "package_code is required",
+		})
+		return
+	}
+
+	var userID int64
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid user ID",
+			})
+			return
+		}
+		userID = id
+	}
+
+	quote, err := service.QuotePriceForUser(userID, packageCode, c.Query("payment_method"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"package_code":   quote.PackageCode,
+			"payment_method": quote.PaymentMethod,
+			"cost_price":     quote.CostPrice,
+			"sell_price":     quote.SellPrice,
+			"margin":         quote.Margin(),
+			"rule_id":        quote.RuleID,
+			"tier":           quote.Tier,
+			"retail_price":   quote.RetailPrice,
+		},
+	})
+}
+
+func applyPricingRuleRequest(rule *models.PricingRule, req PricingRuleRequest) {
+	rule.Name = req.Name
+	rule.PackageCode = req.PackageCode
+	rule.NamePattern = req.NamePattern
+	rule.Category = req.Category
+	rule.PaymentMethod = req.PaymentMethod
+	rule.MarkupType = req.MarkupType
+	rule.MarkupValue = req.MarkupValue
+	rule.RoundTo = req.RoundTo
+	rule.Priority = req.Priority
+	rule.IsActive = req.IsActive == nil || *req.IsActive
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// Get referral earnings per referrer and the referrals blocked by the abuse checks
+func GetReferralReport(c *gin.Context) {
+	reports, err := service.GetReferralReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load referral report: " + err.Error(),
+		})
+		return
+	}
+
+	blocked, err := service.GetBlockedReferrals(100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load blocked referrals: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reports,
+		"blocked": blocked,
+		"count":   len(reports),
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// reportQuery reads the from/to (YYYY-MM-DD, inclusive) and period query parameters
+// shared by the report endpoints, answering 400 when they are invalid
+func reportQuery(c *gin.Context) (service.ReportRange, string, bool) {
+	r, err := service.NewReportRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return r, "", false
+	}
+
+	period := c.Query("period")
+	if period == "" {
+		period = service.DefaultReportPeriod(r)
+	} else if !service.IsReportPeriod(period) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "period must be day, week or month",
+		})
+		return r, "", false
+	}
+	return r, period, true
+}
+
+// Get topup inflow, package and VPN sales with cost and margin, active users, best
+// sellers and payment method mix for a date range
+func GetReport(c *gin.Context) {
+	r, period, ok := reportQuery(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	report, err := service.BuildReport(r, period, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to build report: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// Get the best selling packages and VPN protocols for a date range
+func GetTopProductsReport(c *gin.Context) {
+	r, _, ok := reportQuery(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	products, err := service.GetTopProducts(r, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load top products: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    products,
+		"count":   len(products),
+	})
+}
+
+// Get the active users of a date range per day, week or month
+func GetActiveUsersReport(c *gin.Context) {
+	r, period, ok := reportQuery(c)
+	if !ok {
+		return
+	}
+
+	total, points, err := service.GetActiveUsers(r, period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load active users: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    points,
+		"total":   total,
+		"period":  period,
+	})
+}
@@ -9,8 +9,8 @@ func SetupRoutes(router *gin.Engine) {
 	// API group
 	api := router.Group("/api")
 
-	// Admin approval endpoints
-	admin := api.Group("/admin")
+	// Admin endpoints, authenticated by ADMIN_API_TOKEN
+	admin := api.Group("/admin", AdminTokenAuth())
 	{
 		// Get pending top up transactions
 		admin.GET("/topups/pending", GetPendingTopUps)
@@ -26,6 +26,94 @@ func SetupRoutes(router *gin.Engine) {
 
 		// Bulk approve multiple transactions
 		admin.POST("/topups/bulk-approve", BulkApproveTransactions)
+
+		// Pricing rules and sell price quotes
+		admin.GET("/pricing/rules", GetPricingRules)
+		admin.POST("/pricing/rules", CreatePricingRule)
+		admin.PUT("/pricing/rules/:id", UpdatePricingRule)
+		admin.DELETE("/pricing/rules/:id", DeletePricingRule)
+		admin.GET("/pricing/quote", GetPriceQuote)
+
+		// Reseller tiers: user tiers and tier price lists
+		admin.GET("/tiers/users", GetTierMembers)
+		admin.PUT("/tiers/users/:user_id", SetUserTier)
+		admin.GET("/tiers/prices", GetTierPrices)
+		admin.POST("/tiers/prices", CreateTierPrice)
+		admin.PUT("/tiers/prices/:id", UpdateTierPrice)
+		admin.DELETE("/tiers/prices/:id", DeleteTierPrice)
+
+		// Catalog overrides: hide, rename, feature and categorize packages
+		admin.GET("/catalog", GetAdminCatalog)
+		admin.GET("/catalog/categories", GetCatalogCategories)
+		admin.GET("/catalog/overrides", GetCatalogOverrides)
+		admin.PUT("/catalog/overrides/:code", SetCatalogOverride)
+		admin.DELETE("/catalog/overrides/:code", DeleteCatalogOverride)
+
+		// Campaign conversion and referral reports
+		admin.GET("/campaigns", GetCampaignReports)
+		admin.GET("/referrals", GetReferralReport)
+
+		// Business reports from the database: ?from=&to= (YYYY-MM-DD) and ?period=day|week|month
+		admin.GET("/reports", GetReport)
+		admin.GET("/reports/products", GetTopProductsReport)
+		admin.GET("/reports/active-users", GetActiveUsersReport)
+
+		// Vouchers
+		admin.GET("/vouchers", GetVouchers)
+		admin.POST("/vouchers", CreateVoucher)
+		admin.PUT("/vouchers/:code", UpdateVoucher)
+		admin.DELETE("/vouchers/:code", DeleteVoucher)
+		admin.GET("/vouchers/:code/redemptions", GetVoucherRedemptions)
+		admin.GET("/topup-bonus-tiers", GetTopupBonusTiers)
+		admin.POST("/topup-bonus-tiers", CreateTopupBonusTier)
+		admin.PUT("/topup-bonus-tiers/:id", UpdateTopupBonusTier)
+		admin.DELETE("/topup-bonus-tiers/:id", DeleteTopupBonusTier)
+
+		// Host-to-host partners
+		admin.GET("/partners", GetPartners)
+		admin.POST("/partners", CreatePartner)
+		admin.PUT("/partners/:id", UpdatePartner)
+		admin.POST("/partners/:id/rotate-key", RotatePartnerKey)
+		admin.GET("/partners/:id/orders", GetPartnerOrders)
+		admin.POST("/partners/orders/:order_id/resend-callback", ResendPartnerCallback)
+
+		// Outgoing webhooks for business events
+		admin.GET("/webhooks", GetWebhooks)
+		admin.POST("/webhooks", CreateWebhook)
+		admin.PUT("/webhooks/:id", UpdateWebhook)
+		admin.DELETE("/webhooks/:id", DeleteWebhook)
+		admin.GET("/webhooks/deliveries", GetWebhookDeliveries)
+		admin.POST("/webhooks/deliveries/:delivery_id/replay", ReplayWebhookDelivery)
+
+		// Notification outbox
+		admin.GET("/outbox", GetOutboxMessages)
+		admin.GET("/outbox/stats", GetOutboxStats)
+		admin.POST("/outbox/:id/retry", RetryOutboxMessage)
+
+		// Message templates
+		admin.GET("/templates", GetTemplates)
+		admin.PUT("/templates/:language/:key", UpdateTemplate)
+		admin.DELETE("/templates/:language/:key", ResetTemplate)
+
+		// Broadcasts
+		admin.GET("/broadcasts", GetBroadcasts)
+		admin.POST("/broadcasts", CreateBroadcast)
+		admin.POST("/broadcasts/preview", PreviewBroadcastSegment)
+		admin.POST("/broadcasts/test", SendTestBroadcast)
+		admin.GET("/broadcasts/:id", GetBroadcast)
+		admin.POST("/broadcasts/:id/pause", PauseBroadcast)
+		admin.POST("/broadcasts/:id/resume", ResumeBroadcast)
+		admin.POST("/broadcasts/:id/cancel", CancelBroadcast)
+
+		// Support tickets
+		admin.GET("/tickets", GetTickets)
+		admin.GET("/tickets/:id", GetTicket)
+		admin.POST("/tickets/:id/reply", ReplyTicket)
+		admin.POST("/tickets/:id/assign", AssignTicket)
+		admin.POST("/tickets/:id/close", CloseTicket)
+
+		// Live admin feed over Server-Sent Events
+		admin.GET("/events", StreamAdminEvents)
 	}
 
 	// Public endpoints for external integration
@@ -38,6 +126,15 @@ func SetupRoutes(router *gin.Engine) {
 		public.GET("/users/:user_id/balance", GetUserBalance)
 	}
 
+	// Host-to-host API for partners, authenticated by X-API-Key and IP allowlist
+	h2h := api.Group("/h2h", PartnerAuth())
+	{
+		h2h.GET("/catalog", GetH2HCatalog)
+		h2h.GET("/balance", GetH2HBalance)
+		h2h.POST("/purchase", CreateH2HPurchase)
+		h2h.GET("/status/:ref_id", GetH2HStatus)
+	}
+
 	// Health check endpoint
 	api.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// UpdateTemplateRequest is the body of PUT /admin/templates/:language/:key
+type UpdateTemplateRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// Get every message template with its bundled text and admin edit, optionally for one language
+func GetTemplates(c *gin.Context) {
+	entries, err := service.GetMessageTemplates(c.Query("language"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      entries,
+		"count":     len(entries),
+		"languages": service.SupportedLanguages(),
+	})
+}
+
+// Replace the text of a template in one language
+func UpdateTemplate(c *gin.Context) {
+	var req UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if err := service.SetMessageTemplate(c.Param("language"), c.Param("key"), req.Body, 0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Template updated",
+	})
+}
+
+// Drop the admin edit of a template so the bundled text is used again
+func ResetTemplate(c *gin.Context) {
+	if err := service.ResetMessageTemplate(c.Param("language"), c.Param("key")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Template reset to default",
+	})
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// TicketReplyRequest is the body of POST /admin/tickets/:id/reply
+type TicketReplyRequest struct {
+	Message     string `json:"message" binding:"required"`
+	AdminChatID int64  `json:"admin_chat_id"` // admin the reply is recorded for; assigns an unassigned ticket
+}
+
+// TicketAssignRequest is the body of POST /admin/tickets/:id/assign
+type TicketAssignRequest struct {
+	AdminChatID int64 `json:"admin_chat_id" binding:"required"`
+}
+
+// Get the tickets, optionally filtered by status, most recently active first
+func GetTickets(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	status := c.Query("status")
+	switch status {
+	case "", service.TicketOpen, service.TicketPending, service.TicketClosed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid status",
+		})
+		return
+	}
+
+	tickets, err := service.GetTickets(status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tickets,
+		"count":   len(tickets),
+	})
+}
+
+// Get a ticket with its messages
+func GetTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	ticket, err := service.GetTicket(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	messages, err := service.GetTicketMessages(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"ticket":   ticket,
+			"messages": messages,
+		},
+	})
+}
+
+// Reply to a ticket; the user receives the reply from the bot
+func ReplyTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req TicketReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if req.AdminChatID != 0 && !config.IsAdmin(req.AdminChatID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "admin_chat_id is not an admin",
+		})
+		return
+	}
+
+	changeTicket(c, func() (*models.Ticket, error) {
+		return service.ReplyTicket(config.BotInstance, id, req.AdminChatID, req.Message, "")
+	})
+}
+
+// Assign a ticket to an admin
+func AssignTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	var req TicketAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	changeTicket(c, func() (*models.Ticket, error) {
+		return service.AssignTicket(config.BotInstance, id, req.AdminChatID)
+	})
+}
+
+// Close a ticket; the user is told it was closed
+func CloseTicket(c *gin.Context) {
+	id, ok := ticketID(c)
+	if !ok {
+		return
+	}
+
+	changeTicket(c, func() (*models.Ticket, error) {
+		return service.CloseTicket(config.BotInstance, id, 0)
+	})
+}
+
+// changeTicket runs a change that messages users or admins, so it needs the bot
+func changeTicket(c *gin.Context, change func() (*models.Ticket, error)) {
+	if config.BotInstance == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Bot is not running",
+		})
+		return
+	}
+
+	ticket, err := change()
+	if errors.Is(err, service.ErrTicketAssignConflict) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    ticket,
+	})
+}
+
+func ticketID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid ticket ID",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// UserTierRequest is the payload for changing a user's tier
+type UserTierRequest struct {
+	Tier    string `json:"tier" binding:"required"` // "retail", "reseller" or "agent"
+	AdminID int64  `json:"admin_id"`
+}
+
+// TierPriceRequest is the payload for creating or updating a tier price.
+// On update, omitted fields keep their current value.
+type TierPriceRequest struct {
+	Tier          *string  `json:"tier"`
+	PackageCode   *string  `json:"package_code"`  // empty = every package
+	Price         *int64   `json:"price"`         // fixed sell price; 0 = use the discount
+	DiscountType  *string  `json:"discount_type"` // "fixed" or "percent"
+	DiscountValue *float64 `json:"discount_value"`
+	IsActive      *bool    `json:"is_active"` // defaults to true on create
+}
+
+// Get every reseller and agent with their spend this month
+func GetTierMembers(c *gin.Context) {
+	members, err := service.GetTierMembers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load tier members: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    members,
+		"count":   len(members),
+	})
+}
+
+// Promote or demote a user
+func SetUserTier(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid user ID",
+		})
+		return
+	}
+
+	var req UserTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := service.SetUserTier(userID, req.Tier, req.AdminID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user_id": userID,
+			"tier":    service.GetUserTier(userID),
+		},
+	})
+}
+
+// Get all tier prices
+func GetTierPrices(c *gin.Context) {
+	entries, err := service.GetTierPrices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load tier prices: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"count":   len(entries),
+	})
+}
+
+// Create a tier price; an existing entry for the same tier and package is replaced
+func CreateTierPrice(c *gin.Context) {
+	var req TierPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	entry := models.TierPrice{IsActive: true}
+	applyTierPriceRequest(&entry, req)
+
+	if err := service.SaveTierPrice(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    entry,
+	})
+}
+
+// Update an existing tier price
+func UpdateTierPrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid tier price ID",
+		})
+		return
+	}
+
+	var req TierPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	entry, err := service.UpdateTierPrice(uint(id), func(e *models.TierPrice) {
+		applyTierPriceRequest(e, req)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entry,
+	})
+}
+
+// Delete a tier price
+func DeleteTierPrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid tier price ID",
+		})
+		return
+	}
+
+	if err := service.DeleteTierPrice(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Tier price deleted successfully",
+	})
+}
+
+func applyTierPriceRequest(entry *models.TierPrice, req TierPriceRequest) {
+	if req.Tier != nil {
+		entry.Tier = *req.Tier
+	}
+	if req.PackageCode != nil {
+		entry.PackageCode = *req.PackageCode
+	}
+	if req.Price != nil {
+		entry.Price = *req.Price
+	}
+	if req.DiscountType != nil {
+		entry.DiscountType = *req.DiscountType
+	}
+	if req.DiscountValue != nil {
+		entry.DiscountValue = *req.DiscountValue
+	}
+	if req.IsActive != nil {
+		entry.IsActive = *req.IsActive
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// TopupBonusTierRequest is the payload for creating or updating a top-up bonus tier.
+// On update, omitted fields keep their current value.
+type TopupBonusTierRequest struct {
+	Name       *string    `json:"name"`
+	MinAmount  *int64     `json:"min_amount"`
+	BonusType  *string    `json:"bonus_type"` // "fixed" or "percent"
+	BonusValue *float64   `json:"bonus_value"`
+	MaxBonus   *int64     `json:"max_bonus"`
+	StartsAt   *time.Time `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at"`
+	Active     *bool      `json:"active"` // defaults to true on create
+}
+
+// Get all top-up bonus tiers
+func GetTopupBonusTiers(c *gin.Context) {
+	tiers, err := service.GetTopupBonusTiers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load bonus tiers: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tiers,
+		"count":   len(tiers),
+	})
+}
+
+// Create a new top-up bonus tier
+func CreateTopupBonusTier(c *gin.Context) {
+	var req TopupBonusTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	tier := models.TopupBonusTier{
+		BonusType: service.MarkupFixed,
+		Active:    true,
+	}
+	applyTopupBonusTierRequest(&tier, req)
+
+	if err := service.SaveTopupBonusTier(&tier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    tier,
+	})
+}
+
+// Update an existing top-up bonus tier
+func UpdateTopupBonusTier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid tier ID",
+		})
+		return
+	}
+
+	var req TopupBonusTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	tier, err := service.UpdateTopupBonusTier(uint(id), func(t *models.TopupBonusTier) {
+		applyTopupBonusTierRequest(t, req)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tier,
+	})
+}
+
+// Delete a top-up bonus tier; pending top-ups keep their bonus
+func DeleteTopupBonusTier(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid tier ID",
+		})
+		return
+	}
+
+	if err := service.DeleteTopupBonusTier(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Bonus tier deleted successfully",
+	})
+}
+
+func applyTopupBonusTierRequest(tier *models.TopupBonusTier, req TopupBonusTierRequest) {
+	if req.Name != nil {
+		tier.Name = *req.Name
+	}
+	if req.MinAmount != nil {
+		tier.MinAmount = *req.MinAmount
+	}
+	if req.BonusType != nil {
+		tier.BonusType = *req.BonusType
+	}
+	if req.BonusValue != nil {
+		tier.BonusValue = *req.BonusValue
+	}
+	if req.MaxBonus != nil {
+		tier.MaxBonus = *req.MaxBonus
+	}
+	if req.StartsAt != nil {
+		tier.StartsAt = req.StartsAt
+	}
+	if req.EndsAt != nil {
+		tier.EndsAt = req.EndsAt
+	}
+	if req.Active != nil {
+		tier.Active = *req.Active
+	}
+}
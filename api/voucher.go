@@ -0,0 +1,186 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// VoucherRequest is the payload for creating or updating a voucher.
+// On update, omitted fields keep their current value.
+type VoucherRequest struct {
+	Code             string     `json:"code"`
+	Description      *string    `json:"description"`
+	Scope            *string    `json:"scope"`         // "package", "vpn" or "topup"
+	DiscountType     *string    `json:"discount_type"` // "fixed" or "percent"
+	DiscountValue    *float64   `json:"discount_value"`
+	MaxDiscount      *int64     `json:"max_discount"`
+	MinSpend         *int64     `json:"min_spend"`
+	EligibleProducts *string    `json:"eligible_products"`
+	MaxUses          *int       `json:"max_uses"`
+	MaxUsesPerUser   *int       `json:"max_uses_per_user"` // defaults to 1 on create
+	StartsAt         *time.Time `json:"starts_at"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	Active           *bool      `json:"active"` // defaults to true on create
+}
+
+// Get all vouchers with their usage numbers
+func GetVouchers(c *gin.Context) {
+	reports, err := service.GetVoucherReports()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load vouchers: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reports,
+		"count":   len(reports),
+	})
+}
+
+// Create a new voucher
+func CreateVoucher(c *gin.Context) {
+	var req VoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	voucher := models.Voucher{
+		Code:           req.Code,
+		DiscountType:   service.MarkupFixed,
+		MaxUsesPerUser: 1,
+		Active:         true,
+	}
+	applyVoucherRequest(&voucher, req)
+
+	if err := service.CreateVoucher(&voucher); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    voucher,
+	})
+}
+
+// Update an existing voucher
+func UpdateVoucher(c *gin.Context) {
+	var req VoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	voucher, err := service.UpdateVoucher(c.Param("code"), func(v *models.Voucher) {
+		applyVoucherRequest(v, req)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    voucher,
+	})
+}
+
+// Delete a voucher; its redemption history is kept
+func DeleteVoucher(c *gin.Context) {
+	if err := service.DeleteVoucher(c.Param("code")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Voucher deleted successfully",
+	})
+}
+
+// Get the latest redemptions of a voucher
+func GetVoucherRedemptions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	redemptions, err := service.GetVoucherRedemptions(c.Param("code"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load redemptions: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    redemptions,
+		"count":   len(redemptions),
+	})
+}
+
+func applyVoucherRequest(voucher *models.Voucher, req VoucherRequest) {
+	if req.Description != nil {
+		voucher.Description = *req.Description
+	}
+	if req.Scope != nil {
+		voucher.Scope = *req.Scope
+	}
+	if req.DiscountType != nil {
+		voucher.DiscountType = *req.DiscountType
+	}
+	if req.DiscountValue != nil {
+		voucher.DiscountValue = *req.DiscountValue
+	}
+	if req.MaxDiscount != nil {
+		voucher.MaxDiscount = *req.MaxDiscount
+	}
+	if req.MinSpend != nil {
+		voucher.MinSpend = *req.MinSpend
+	}
+	if req.EligibleProducts != nil {
+		voucher.EligibleProducts = *req.EligibleProducts
+	}
+	if req.MaxUses != nil {
+		voucher.MaxUses = *req.MaxUses
+	}
+	if req.MaxUsesPerUser != nil {
+		voucher.MaxUsesPerUser = *req.MaxUsesPerUser
+	}
+	if req.StartsAt != nil {
+		voucher.StartsAt = req.StartsAt
+	}
+	if req.ExpiresAt != nil {
+		voucher.ExpiresAt = req.ExpiresAt
+	}
+	if req.Active != nil {
+		voucher.Active = *req.Active
+	}
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+)
+
+// WebhookRequest is the payload for creating or updating a webhook subscription.
+// On update, omitted fields keep their current value.
+type WebhookRequest struct {
+	Name       *string `json:"name"`
+	URL        *string `json:"url"`
+	EventTypes *string `json:"event_types"` // comma separated event types, "*" for all
+	Active     *bool   `json:"active"`      // defaults to true on create
+}
+
+// Get all webhook subscriptions
+func GetWebhooks(c *gin.Context) {
+	subs, err := service.GetWebhookSubscriptions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load webhooks: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"data":        subs,
+		"count":       len(subs),
+		"event_types": service.WebhookEventTypes,
+	})
+}
+
+// Create a webhook subscription; the signing secret is only returned here
+func CreateWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	sub := models.WebhookSubscription{Active: true}
+	applyWebhookRequest(&sub, req)
+
+	secret, err := service.CreateWebhookSubscription(&sub)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    sub,
+		"secret":  secret,
+	})
+}
+
+// Update a webhook subscription
+func UpdateWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid webhook ID",
+		})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	sub, err := service.UpdateWebhookSubscription(uint(id), func(s *models.WebhookSubscription) {
+		applyWebhookRequest(s, req)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sub,
+	})
+}
+
+// Delete a webhook subscription
+func DeleteWebhook(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid webhook ID",
+		})
+		return
+	}
+
+	if err := service.DeleteWebhookSubscription(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Webhook deleted",
+	})
+}
+
+// Get the delivery log, newest first.
+// Filters: subscription_id, status (pending, sent, failed) and limit.
+func GetWebhookDeliveries(c *gin.Context) {
+	var subscriptionID uint64
+	if raw := c.Query("subscription_id"); raw != "" {
+		var err error
+		subscriptionID, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid subscription ID",
+			})
+			return
+		}
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	deliveries, err := service.GetWebhookDeliveries(uint(subscriptionID), c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load deliveries: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    deliveries,
+		"count":   len(deliveries),
+	})
+}
+
+// Send a delivery again with a fresh retry budget
+func ReplayWebhookDelivery(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "Invalid delivery ID",
+		})
+		return
+	}
+
+	if err := service.ReplayWebhookDelivery(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Delivery queued",
+	})
+}
+
+func applyWebhookRequest(sub *models.WebhookSubscription, req WebhookRequest) {
+	if req.Name != nil {
+		sub.Name = *req.Name
+	}
+	if req.URL != nil {
+		sub.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		sub.EventTypes = *req.EventTypes
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+}
@@ -31,9 +31,21 @@ func main() {
 		log.Printf("Warning: Failed to load transactions from database: %v", err)
 	}
 
+	// Warn about admin notifications that have nowhere to go, e.g. activity without ADMIN_WHATSAPP
+	service.CheckNotifyRoutes()
+
 	// Start cleanup routine for transaction locks
 	service.StartCleanupRoutine()
 
+	// Warm the product catalog cache and keep it fresh in the background
+	service.StartCatalogRefreshRoutine()
+
+	// Poll pending H2H orders and deliver partner callbacks
+	service.StartPartnerWorker()
+
+	// Retry outgoing webhook deliveries with backoff
+	service.StartWebhookDispatcher()
+
 	// Sekarang, panggil fungsi Anda seperti biasa
 	// os.Getenv() akan berhasil menemukan variabelnya
 	botToken := config.GetBotToken()
@@ -48,6 +60,18 @@ func main() {
 	// Store bot instance for admin notifications
 	config.BotInstance = botAPI
 
+	// Deliver queued user and admin notifications with retries; started once the bot can send
+	service.StartOutboxDispatcher()
+
+	// Send queued and interrupted broadcasts within Telegram's rate limits
+	service.StartBroadcastWorker()
+
+	// Send yesterday's numbers to the daily_report notification route
+	service.StartDailyReportRoutine()
+
+	// Delete payment proof images past PAYMENT_PROOF_RETENTION_DAYS
+	service.StartPaymentProofCleanup()
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 30
 	updates := botAPI.GetUpdatesChan(u)
@@ -64,6 +88,8 @@ func main() {
 		{Command: "history", Description: "📜 Riwayat transaksi"},
 		{Command: "help", Description: "❓ Bantuan dan panduan"},
 		{Command: "rules", Description: "📋 Peraturan bot"},
+		{Command: "tickets", Description: "🎫 Tiket bantuan"},
+		{Command: "language", Description: "🌐 Ganti bahasa / Change language"},
 	}
 
 	setCommands := tgbotapi.NewSetMyCommands(commands...)
@@ -75,7 +101,12 @@ func main() {
 
 	// Setup API server
 	go func() {
-		router := gin.Default()
+		// gin.Default, with the admin token redacted from the request log
+		router := gin.New()
+		router.Use(api.RequestLogger(), gin.Recovery())
+		if err := router.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+			log.Printf("Invalid TRUSTED_PROXIES: %v", err)
+		}
 
 		// Setup CORS middleware
 		router.Use(func(c *gin.Context) {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -45,9 +46,37 @@ func GetAdminUsername() string {
 	return strings.TrimPrefix(username, "@")
 }
 
+// GetAdminChatIDs returns every admin: ADMIN_CHAT_ID followed by the comma separated
+// ADMIN_CHAT_IDS
+func GetAdminChatIDs() []int64 {
+	var chatIDs []int64
+	if chatID := GetAdminChatID(); chatID != 0 {
+		chatIDs = append(chatIDs, chatID)
+	}
+	for _, value := range splitEnvList("ADMIN_CHAT_IDS", ",") {
+		chatID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Printf("Error parsing ADMIN_CHAT_IDS entry %q: %v", value, err)
+			continue
+		}
+		if chatID != 0 && !containsChatID(chatIDs, chatID) {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs
+}
+
 func IsAdmin(chatID int64) bool {
-	adminChatID := GetAdminChatID()
-	return adminChatID != 0 && chatID == adminChatID
+	return chatID != 0 && containsChatID(GetAdminChatIDs(), chatID)
+}
+
+func containsChatID(chatIDs []int64, chatID int64) bool {
+	for _, id := range chatIDs {
+		if id == chatID {
+			return true
+		}
+	}
+	return false
 }
 
 func GetAdminTelegramID() int64 {
@@ -62,3 +91,290 @@ func GetAdminWhatsAppNumber() string {
 	}
 	return phone
 }
+
+// getEnvInt reads an integer environment variable, falling back to def when it is unset or invalid
+func getEnvInt(key string, def int) int {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(valueStr))
+	if err != nil {
+		log.Printf("Error parsing %s: %v", key, err)
+		return def
+	}
+
+	return value
+}
+
+// GetCatalogCacheTTL returns how long the product catalog is considered fresh. It is also
+// the background refresh interval, so values below one second fall back to the default.
+func GetCatalogCacheTTL() time.Duration {
+	ttl := getEnvInt("CATALOG_CACHE_TTL", 300)
+	if ttl < 1 {
+		log.Printf("Warning: CATALOG_CACHE_TTL must be at least 1 second, using 300")
+		ttl = 300
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// GetCatalogStaleTTL returns how long an expired catalog may still be served while it is refreshed in the background
+func GetCatalogStaleTTL() time.Duration {
+	ttl := getEnvInt("CATALOG_STALE_TTL", 3600)
+	if ttl < 0 {
+		ttl = 0
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// GetProductsAPIURL returns the upstream product list endpoint
+func GetProductsAPIURL() string {
+	if url := os.Getenv("PRODUCTS_API_URL"); url != "" {
+		return url
+	}
+	return "https://grnstore.domcloud.dev/api/user/products?limit=100"
+}
+
+// GetPurchaseAPIURL returns the upstream purchase endpoint
+func GetPurchaseAPIURL() string {
+	if url := os.Getenv("PURCHASE_API_URL"); url != "" {
+		return url
+	}
+	return "https://grnstore.domcloud.dev/api/purchase"
+}
+
+// GetTransactionCheckAPIURL returns the upstream purchase status endpoint
+func GetTransactionCheckAPIURL() string {
+	if url := os.Getenv("TRANSACTION_CHECK_API_URL"); url != "" {
+		return url
+	}
+	return "https://grnstore.domcloud.dev/api/transaction/check"
+}
+
+// GetDefaultMarkupType returns the markup type applied when no pricing rule matches ("fixed" or "percent")
+func GetDefaultMarkupType() string {
+	markupType := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_MARKUP_TYPE")))
+	if markupType == "" {
+		return "fixed"
+	}
+	return markupType
+}
+
+// GetDefaultMarkupValue returns the markup value applied when no pricing rule matches
+func GetDefaultMarkupValue() float64 {
+	valueStr := os.Getenv("DEFAULT_MARKUP_VALUE")
+	if valueStr == "" {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(valueStr), 64)
+	if err != nil {
+		log.Printf("Error parsing DEFAULT_MARKUP_VALUE: %v", err)
+		return 0
+	}
+
+	return value
+}
+
+// GetInlineCacheTTL returns how long inline query results are cached, both locally and by Telegram
+func GetInlineCacheTTL() time.Duration {
+	return time.Duration(getEnvInt("INLINE_CACHE_TTL", 60)) * time.Second
+}
+
+// GetReferralCommissionType returns how referral commission is calculated ("fixed" or "percent")
+func GetReferralCommissionType() string {
+	commissionType := strings.ToLower(strings.TrimSpace(os.Getenv("REFERRAL_COMMISSION_TYPE")))
+	if commissionType == "" {
+		return "percent"
+	}
+	return commissionType
+}
+
+// GetReferralCommissionValue returns the commission amount (rupiah) or percentage; 0 disables commission
+func GetReferralCommissionValue() float64 {
+	valueStr := os.Getenv("REFERRAL_COMMISSION_VALUE")
+	if valueStr == "" {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(valueStr), 64)
+	if err != nil {
+		log.Printf("Error parsing REFERRAL_COMMISSION_VALUE: %v", err)
+		return 0
+	}
+
+	return value
+}
+
+// GetReferralMaxRewardedEvents returns how many purchases or top-ups of a referred friend earn commission
+func GetReferralMaxRewardedEvents() int {
+	return getEnvInt("REFERRAL_MAX_REWARDED_EVENTS", 3)
+}
+
+// GetReferralMaxPerHour limits how many new referrals one user can collect per hour before they are flagged
+func GetReferralMaxPerHour() int {
+	return getEnvInt("REFERRAL_MAX_PER_HOUR", 10)
+}
+
+// GetTierResellerMonthlySpend is the monthly spend that promotes a retail user to reseller; 0 disables it
+func GetTierResellerMonthlySpend() int64 {
+	return int64(getEnvInt("TIER_RESELLER_MONTHLY_SPEND", 0))
+}
+
+// GetTierAgentMonthlySpend is the monthly spend that promotes a user to agent; 0 disables it
+func GetTierAgentMonthlySpend() int64 {
+	return int64(getEnvInt("TIER_AGENT_MONTHLY_SPEND", 0))
+}
+
+// GetTrustedProxies returns the proxy IPs/CIDRs allowed to set X-Forwarded-For.
+// Without it the API uses the connection address, so partner IP allowlists cannot be spoofed.
+func GetTrustedProxies() []string {
+	return splitEnvList("TRUSTED_PROXIES", ",")
+}
+
+// GetWebhookMaxAttempts is how many times a webhook delivery is tried before it is marked failed
+func GetWebhookMaxAttempts() int {
+	return getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+}
+
+// GetOutboxMaxAttempts is how many times a queued notification is tried before it is dead-lettered
+func GetOutboxMaxAttempts() int {
+	return getEnvInt("OUTBOX_MAX_ATTEMPTS", 10)
+}
+
+// GetWhatsAppAPIURL returns the endpoint of the WhatsApp gateway
+func GetWhatsAppAPIURL() string {
+	if url := os.Getenv("WHATSAPP_API_URL"); url != "" {
+		return url
+	}
+	return "http://128.199.109.211:25120/send-message"
+}
+
+// GetSMTPHost returns the SMTP server used for email notifications; empty disables email
+func GetSMTPHost() string {
+	return os.Getenv("SMTP_HOST")
+}
+
+// GetSMTPPort returns the SMTP server port
+func GetSMTPPort() int {
+	return getEnvInt("SMTP_PORT", 587)
+}
+
+// GetSMTPUsername returns the SMTP login; empty sends without authentication
+func GetSMTPUsername() string {
+	return os.Getenv("SMTP_USERNAME")
+}
+
+// GetSMTPPassword returns the SMTP password
+func GetSMTPPassword() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
+
+// GetSMTPFrom returns the sender address of notification emails, defaulting to the SMTP login
+func GetSMTPFrom() string {
+	if from := os.Getenv("SMTP_FROM"); from != "" {
+		return from
+	}
+	return GetSMTPUsername()
+}
+
+// GetAdminEmails returns the comma separated ADMIN_EMAIL addresses that receive admin emails
+func GetAdminEmails() []string {
+	return splitEnvList("ADMIN_EMAIL", ",")
+}
+
+// GetNotifyWebhookURL returns the endpoint that receives admin notifications routed to "webhook"
+func GetNotifyWebhookURL() string {
+	return os.Getenv("NOTIFY_WEBHOOK_URL")
+}
+
+// GetNotifyWebhookSecret returns the HMAC secret used to sign notification webhooks
+func GetNotifyWebhookSecret() string {
+	return os.Getenv("NOTIFY_WEBHOOK_SECRET")
+}
+
+// GetNotifyRoutes parses NOTIFY_ROUTES, e.g. "error=telegram;daily_report=email,telegram",
+// into channels per notification kind. Kinds that are not listed keep their default route.
+func GetNotifyRoutes() map[string][]string {
+	routes := make(map[string][]string)
+	for _, rule := range strings.Split(os.Getenv("NOTIFY_ROUTES"), ";") {
+		kind, channels, found := strings.Cut(rule, "=")
+		kind = strings.TrimSpace(kind)
+		if !found || kind == "" {
+			continue
+		}
+
+		routes[kind] = []string{}
+		for _, channel := range strings.Split(channels, ",") {
+			if channel = strings.TrimSpace(channel); channel != "" {
+				routes[kind] = append(routes[kind], channel)
+			}
+		}
+	}
+	return routes
+}
+
+// GetDefaultLanguage returns the language used when a user has none and for template keys
+// missing in the user's language
+func GetDefaultLanguage() string {
+	language := strings.ToLower(strings.TrimSpace(os.Getenv("DEFAULT_LANGUAGE")))
+	if language == "" {
+		return "id"
+	}
+	return language
+}
+
+// GetBroadcastRate returns how many broadcast messages are sent per second, across all chats
+func GetBroadcastRate() int {
+	return getEnvInt("BROADCAST_RATE", 25)
+}
+
+// GetBroadcastChatInterval returns the minimum time between two broadcast messages to the same chat
+func GetBroadcastChatInterval() time.Duration {
+	return time.Duration(getEnvInt("BROADCAST_CHAT_INTERVAL_MS", 1000)) * time.Millisecond
+}
+
+// GetPaymentProofDir returns the directory payment proof images are stored in
+func GetPaymentProofDir() string {
+	if dir := strings.TrimSpace(os.Getenv("PAYMENT_PROOF_DIR")); dir != "" {
+		return dir
+	}
+	return "data/payment_proofs"
+}
+
+// GetPaymentProofRetention returns how long payment proof images are kept; their hashes
+// are kept longer so a reused image is still recognised
+func GetPaymentProofRetention() time.Duration {
+	return time.Duration(getEnvInt("PAYMENT_PROOF_RETENTION_DAYS", 90)) * 24 * time.Hour
+}
+
+// GetAdminAPIToken returns the bearer token of the admin event stream; empty disables the stream
+func GetAdminAPIToken() string {
+	return os.Getenv("ADMIN_API_TOKEN")
+}
+
+// GetAdminEventBuffer returns how many admin events are kept for clients resuming with Last-Event-ID
+func GetAdminEventBuffer() int {
+	return getEnvInt("ADMIN_EVENT_BUFFER", 500)
+}
+
+// GetVPNCostPerDay returns what one VPN day costs on the VPN panel, used to report VPN margin
+func GetVPNCostPerDay() int64 {
+	return int64(getEnvInt("VPN_COST_PER_DAY", 0))
+}
+
+// GetDailyReportHour returns the hour (0-23) the daily report is sent; a negative value disables it
+func GetDailyReportHour() int {
+	return getEnvInt("DAILY_REPORT_HOUR", 7)
+}
+
+func splitEnvList(key, sep string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
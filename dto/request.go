@@ -42,4 +42,5 @@ type SearchRequest struct {
 	MinPrice      int64  `json:"min_price"`
 	MaxPrice      int64  `json:"max_price"`
 	PaymentMethod string `json:"payment_method"`
+	UserID        int64  `json:"user_id"` // prices are filtered at this user's tier; 0 means retail
 }
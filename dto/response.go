@@ -78,19 +78,26 @@ type TopUpData struct {
 	QRISCode      string `json:"qris_code"`
 	Amount        int64  `json:"amount"`
 	ExpiredAt     string `json:"expired_at"`
+	VoucherCode   string `json:"voucher_code,omitempty"`
+	VoucherBonus  int64  `json:"voucher_bonus,omitempty"` // credited on top of Amount once confirmed
+	BonusAmount   int64  `json:"bonus_amount,omitempty"`  // top-up bonus tier, credited once confirmed
+	BonusTier     string `json:"bonus_tier,omitempty"`
 }
 
 type Transaction struct {
-	ID         string `json:"id"`
-	UserID     int64  `json:"user_id"`
-	Username   string `json:"username"`
-	Amount     int64  `json:"amount"`
-	Status     string `json:"status"` // pending, confirmed, rejected, expired
-	QRISCode   string `json:"qris_code"`
-	CreatedAt  string `json:"created_at"`
-	ApprovedBy int64  `json:"approved_by,omitempty"`
-	ApprovedAt string `json:"approved_at,omitempty"`
-	ExpiredAt  string `json:"expired_at"`
+	ID           string `json:"id"`
+	UserID       int64  `json:"user_id"`
+	Username     string `json:"username"`
+	Amount       int64  `json:"amount"`
+	Status       string `json:"status"` // pending, confirmed, rejected, expired
+	QRISCode     string `json:"qris_code"`
+	CreatedAt    string `json:"created_at"`
+	ApprovedBy   int64  `json:"approved_by,omitempty"`
+	ApprovedAt   string `json:"approved_at,omitempty"`
+	ExpiredAt    string `json:"expired_at"`
+	VoucherCode  string `json:"voucher_code,omitempty"`  // top-up bonus voucher, redeemed on confirmation
+	BonusAmount  int64  `json:"bonus_amount,omitempty"`  // bonus tier credit, locked in when the QRIS is created
+	RejectReason string `json:"reject_reason,omitempty"` // sent to the user with the rejection
 }
 
 type UserBalance struct {
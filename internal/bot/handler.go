@@ -20,8 +20,6 @@ import (
 
 const pageSize = 10
 
-var packageMap = map[string]service.PackageAlias{} // alias untuk caching
-
 func HandleUpdate(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -31,22 +29,35 @@ func HandleUpdate(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
 
 	// Track user interaction
 	var userID int64
+	var from *tgbotapi.User
 	if update.Message != nil {
 		userID = update.Message.Chat.ID
+		from = update.Message.From
 		handleMessage(bot, update.Message)
 	}
 
 	if update.CallbackQuery != nil {
 		userID = update.CallbackQuery.Message.Chat.ID
+		from = update.CallbackQuery.From
 		handleCallbackQuery(bot, update.CallbackQuery)
 	}
 
+	// Inline queries come from any chat and are not tracked as bot users
+	if update.InlineQuery != nil {
+		handleInlineQuery(bot, update.InlineQuery)
+	}
+
 	// Add user to active users list in database
 	if userID != 0 {
 		err := service.AddActiveUserToDB(userID)
 		if err != nil {
 			log.Printf("Error adding active user %d: %v", userID, err)
 		}
+		if from != nil {
+			if err := service.RecordLanguageCode(userID, from.LanguageCode); err != nil {
+				log.Printf("Error recording language of user %d: %v", userID, err)
+			}
+		}
 	}
 }
 
@@ -57,7 +68,7 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	if message.IsCommand() {
 		switch message.Command() {
 		case "start":
-			handleStart(bot, chatID)
+			handleStart(bot, chatID, message.CommandArguments())
 		case "menu":
 			showMainMenu(bot, chatID)
 		case "products":
@@ -70,27 +81,33 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 			handleAdminCommand(bot, message)
 		case "stats":
 			handleStatsCommand(bot, chatID)
+		case "report":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleReportCommand(bot, message)
 		case "pending":
 			if !config.IsAdmin(chatID) {
-				sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 				return
 			}
 			handlePendingCommand(bot, message)
 		case "confirm":
 			if !config.IsAdmin(chatID) {
-				sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 				return
 			}
 			handleConfirmCommand(bot, message)
 		case "debug":
 			if !config.IsAdmin(chatID) {
-				sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 				return
 			}
 			handleDebugCommand(bot, message)
 		case "reject":
 			if !config.IsAdmin(chatID) {
-				sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 				return
 			}
 			handleRejectCommand(bot, message)
@@ -104,16 +121,96 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 			handleTopUpRequest(bot, chatID)
 		case "broadcast":
 			if !config.IsAdmin(chatID) {
-				sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 				return
 			}
 			handleBroadcastCommand(bot, message)
+		case "broadcasts":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleBroadcastsCommand(bot, chatID)
+		case "refreshcatalog":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleRefreshCatalogCommand(bot, chatID)
+		case "catalog":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleCatalogCommand(bot, message)
+		case "campaign":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleCampaignCommand(bot, message)
+		case "link":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleLinkCommand(bot, message)
+		case "voucher":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleVoucherCommand(bot, message)
+		case "topupbonus":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleTopupBonusCommand(bot, message)
+		case "tier":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleTierCommand(bot, message)
+		case "referral":
+			handleReferralCommand(bot, chatID)
+		case "language":
+			handleLanguageCommand(bot, chatID)
+		case "template":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleTemplateCommand(bot, message)
+		case "tickets":
+			handleTicketsCommand(bot, chatID, message.CommandArguments())
+		case "reply":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			handleReplyCommand(bot, message)
+		case "referrals":
+			if !config.IsAdmin(chatID) {
+				sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
+				return
+			}
+			sendReferralReport(bot, chatID)
 		default:
-			sendErrorMessage(bot, chatID, "❌ Perintah tidak dikenal. Ketik /menu untuk melihat menu utama.")
+			sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "unknown_command", nil))
 		}
 		return
 	}
 
+	// Admins answer a ticket by replying to its notification
+	if message.ReplyToMessage != nil && config.IsAdmin(chatID) {
+		if ticketID, ok := service.TicketForAdminMessage(chatID, message.ReplyToMessage.MessageID); ok {
+			replyToTicket(bot, chatID, ticketID, message)
+			return
+		}
+	}
+
 	// Handle text messages based on user state
 	userState.mu.RLock()
 	state := userState.State
@@ -125,11 +222,23 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	case "waiting_otp":
 		handleOTPInput(bot, chatID, message.Text)
 	case "waiting_admin_message":
-		handleAdminMessageInput(bot, chatID, message.Text, message.From)
+		handleAdminMessageInput(bot, chatID, message)
+	case "waiting_ticket_reply":
+		handleTicketReplyInput(bot, chatID, message)
 	case "waiting_topup_amount":
 		handleTopUpAmountInput(bot, chatID, message.Text, message.From)
+	case "waiting_payment_proof":
+		handlePaymentProofInput(bot, chatID, message)
+	case "waiting_reject_reason":
+		handleRejectReasonInput(bot, chatID, message.Text)
 	case "waiting_broadcast_message":
-		handleBroadcastMessageInput(bot, chatID, message.Text)
+		handleBroadcastMessageInput(bot, chatID, message)
+	case "waiting_broadcast_segment":
+		handleBroadcastSegmentSelect(bot, chatID, message.Text)
+	case "waiting_broadcast_buttons":
+		handleBroadcastButtonsInput(bot, chatID, message.Text)
+	case "waiting_broadcast_schedule":
+		handleBroadcastScheduleInput(bot, chatID, message.Text)
 	case "waiting_search_query":
 		handleSearchQueryInput(bot, chatID, message.Text)
 	case "waiting_vpn_email":
@@ -140,6 +249,8 @@ func handleMessage(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 		handleVPNDaysInput(bot, chatID, message.Text)
 	case "waiting_vpn_extend_days":
 		handleVPNExtendDaysInput(bot, chatID, message.Text)
+	case "waiting_voucher_code":
+		handleVoucherCodeInput(bot, chatID, message.Text)
 	default:
 		showMainMenu(bot, chatID)
 	}
@@ -168,6 +279,15 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, cq *tgbotapi.CallbackQuery) {
 		showMainMenu(bot, chatID)
 	} else if data == "products" {
 		sendProductList(bot, chatID, 0)
+	} else if data == "categories" {
+		showCategories(bot, chatID)
+	} else if strings.HasPrefix(data, "cat:") {
+		// Format: cat:<category key>:<page>
+		payload := strings.TrimPrefix(data, "cat:")
+		if idx := strings.LastIndex(payload, ":"); idx > 0 {
+			page, _ := strconv.Atoi(payload[idx+1:])
+			handleCategorySelect(bot, chatID, cq.Message, payload[:idx], page)
+		}
 	} else if data == "help" {
 		showHelp(bot, chatID)
 	} else if data == "balance" {
@@ -178,6 +298,13 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, cq *tgbotapi.CallbackQuery) {
 		handleHistoryCommandNew(bot, chatID)
 	} else if data == "contact_admin" {
 		handleContactAdmin(bot, chatID)
+	} else if data == "tickets" {
+		handleTicketsCommand(bot, chatID, "")
+	} else if strings.HasPrefix(data, "ticket") {
+		// Format: ticket_<action>:<ticket id>, or ticket:<ticket id> to show it
+		if parts := strings.SplitN(data, ":", 2); len(parts) == 2 {
+			handleTicketAction(bot, chatID, strings.TrimPrefix(parts[0], "ticket"), parts[1])
+		}
 	} else if data == "proceed_payment" {
 		// Debug: Check state before calling handleProceedPayment
 		debugState := getUserState(chatID)
@@ -193,47 +320,41 @@ func handleCallbackQuery(bot *tgbotapi.BotAPI, cq *tgbotapi.CallbackQuery) {
 		handleAdminCommand(bot, &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}})
 	} else if data == "topup" {
 		handleTopUpRequest(bot, chatID)
+	} else if data == "topup_proof" {
+		handlePaymentProofRequest(bot, chatID)
 	} else if data == "check_balance" {
 		handleBalanceCommand(bot, chatID)
+	} else if data == "referral" {
+		handleReferralCommand(bot, chatID)
 	} else if data == "admin_pending" {
 		handlePendingCommand(bot, &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}})
 	} else if data == "admin_broadcast" {
 		handleBroadcastRequest(bot, chatID)
-	} else if strings.HasPrefix(data, "send_broadcast:") {
-		broadcastMessage := strings.TrimPrefix(data, "send_broadcast:")
-		handleSendBroadcast(bot, chatID, broadcastMessage)
+	} else if data == "send_broadcast" {
+		handleSendBroadcast(bot, chatID)
+	} else if data == "bcseg_pick" {
+		showBroadcastSegments(bot, chatID)
+	} else if data == "bcseg_custom" {
+		handleBroadcastCustomSegment(bot, chatID)
+	} else if strings.HasPrefix(data, "bcdraft_") {
+		handleBroadcastDraftAction(bot, chatID, strings.TrimPrefix(data, "bcdraft_"))
+	} else if strings.HasPrefix(data, "bcseg:") {
+		handleBroadcastSegmentSelect(bot, chatID, strings.TrimPrefix(data, "bcseg:"))
+	} else if strings.HasPrefix(data, "bc_") {
+		// Format: bc_<action>:<job id>
+		if parts := strings.SplitN(strings.TrimPrefix(data, "bc_"), ":", 2); len(parts) == 2 {
+			handleBroadcastControl(bot, chatID, parts[0], parts[1])
+		}
 	} else if strings.HasPrefix(data, "topup:") {
 		amountStr := strings.TrimPrefix(data, "topup:")
 		if amountStr == "custom" {
 			setUserState(chatID, "waiting_topup_amount")
-			text := `╔══════════════════════════╗
-║     💳 *TOP UP SALDO*    ║
-╚══════════════════════════╝
-
-💰 *Masukkan Nominal Custom*
-
-Silakan ketik nominal top up yang Anda inginkan.
-
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-📋 *KETENTUAN:*
-• 💵 Minimum: Rp 10.000
-• 💎 Maximum: Rp 1.000.000
-• ⚠️ Hanya angka (tanpa titik/koma)
-
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-💡 *CONTOH INPUT:*
-• Untuk Rp 50.000 → ketik: *50000*
-• Untuk Rp 100.000 → ketik: *100000*
-• Untuk Rp 250.000 → ketik: *250000*
-
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-⚡ *Pembayaran via QRIS - Aman & Cepat*
-
-🔤 *Ketik nominal sekarang:*`
-
-			msg := tgbotapi.NewMessage(chatID, text)
+			msg := tgbotapi.NewMessage(chatID, service.RenderUserTemplate(chatID, "topup_request", topupRequestData{
+				MinAmount: minTopUpAmount,
+				MaxAmount: maxTopUpAmount,
+			}))
 			msg.ParseMode = "Markdown"
-			if _, err := bot.Send(msg); err != nil {
+			if _, err := service.SendWithFallback(bot, msg); err != nil {
 				log.Printf("Error sending custom topup message: %v", err)
 			}
 		} else {
@@ -259,14 +380,17 @@ Silakan ketik nominal top up yang Anda inginkan.
 		transactionID := strings.TrimPrefix(data, "check:")
 		handleCheckTransaction(bot, chatID, transactionID)
 	} else if strings.HasPrefix(data, "search_page:") {
-		parts := strings.Split(strings.TrimPrefix(data, "search_page:"), ":")
-		if len(parts) == 2 {
-			query := parts[0]
-			page, _ := strconv.Atoi(parts[1])
-			// Re-search and display page
-			searchResp, err := service.SearchProducts(query, 0, 1000000, "")
+		// Format: search_page:<query>:<page>; the query may itself contain colons
+		payload := strings.TrimPrefix(data, "search_page:")
+		if idx := strings.LastIndex(payload, ":"); idx >= 0 {
+			query := payload[:idx]
+			page, _ := strconv.Atoi(payload[idx+1:])
+			// Re-run the local search and display page
+			req := service.ParseSearchQuery(query)
+			req.UserID = chatID
+			results, err := service.SearchCatalog(req)
 			if err == nil {
-				displaySearchResults(bot, chatID, query, searchResp.Data, page)
+				displaySearchResults(bot, chatID, query, results, page)
 			}
 		}
 	} else if strings.HasPrefix(data, "history_page:") {
@@ -287,6 +411,14 @@ Silakan ketik nominal top up yang Anda inginkan.
 	} else if strings.HasPrefix(data, "reject_tx:") {
 		transactionID := strings.TrimPrefix(data, "reject_tx:")
 		handleRejectTransaction(bot, chatID, transactionID)
+	} else if strings.HasPrefix(data, "rejectr:") {
+		// Format: rejectr:<reason index|x>:<transaction id>
+		if parts := strings.SplitN(strings.TrimPrefix(data, "rejectr:"), ":", 2); len(parts) == 2 {
+			handleRejectReasonSelect(bot, chatID, parts[0], parts[1])
+		}
+	} else if strings.HasPrefix(data, "askproof_tx:") {
+		transactionID := strings.TrimPrefix(data, "askproof_tx:")
+		handleAskPaymentProof(bot, chatID, transactionID)
 	} else if data == "vpn_menu" {
 		handleVPNMenu(bot, chatID)
 	} else if strings.HasPrefix(data, "vpn_create:") {
@@ -311,58 +443,59 @@ Silakan ketik nominal top up yang Anda inginkan.
 	} else if strings.HasPrefix(data, "vpn_extend_days:") {
 		daysStr := strings.TrimPrefix(data, "vpn_extend_days:")
 		handleVPNExtendDaysInput(bot, chatID, daysStr)
+	} else if strings.HasPrefix(data, "lang:") {
+		handleLanguageSelect(bot, chatID, strings.TrimPrefix(data, "lang:"))
+	} else if strings.HasPrefix(data, "voucher_apply:") {
+		handleVoucherRequest(bot, chatID, strings.TrimPrefix(data, "voucher_apply:"))
+	} else if strings.HasPrefix(data, "voucher_remove:") {
+		target := strings.TrimPrefix(data, "voucher_remove:")
+		setUserVoucher(chatID, "", "")
+		continueAfterVoucher(bot, chatID, target)
 	}
 }
 
-func handleStart(bot *tgbotapi.BotAPI, chatID int64) {
+func handleStart(bot *tgbotapi.BotAPI, chatID int64, payload string) {
 	clearUserState(chatID)
 
-	text := "```\n" +
-		"╔══════════════════════════╗\n" +
-		"║       🌟 GRN STORE 🌟      ║\n" +
-		"║   Premium Digital Store   ║\n" +
-		"╚══════════════════════════╝\n\n" +
-		"🎯 SELAMAT DATANG!\n" +
-		"Terima kasih telah memilih GRN Store!\n\n" +
-		"━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n" +
-		"🛍️ LAYANAN KAMI:\n" +
-		"• 📶 Jual Kuota Internet All Operator\n" +
-		"• 💳 Top Up Saldo\n" +
-		"• 🌐 VPN Premium (SSHWS, Trojan, Vmess, Vless)\n" +
-		"   ➝ Rp8.000 / bulan\n" +
-		"   ➝ Server SG tersedia\n\n" +
-		"━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n" +
-		"📋 ALUR PEMBELIAN KUOTA:\n" +
-		"1️⃣ Top Up saldo di bot\n" +
-		"2️⃣ Pilih paket kuota yang ingin dibeli\n" +
-		"3️⃣ Lakukan Verifikasi OTP (wajib)\n" +
-		"4️⃣ Lanjutkan pembayaran\n" +
-		"   (beberapa paket ada tambahan via DANA/QRIS – baca deskripsi)\n" +
-		"5️⃣ Kuota akan diproses otomatis\n\n" +
-		"━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n" +
-		"⚠️ PERATURAN:\n" +
-		"- 🚫 Tidak boleh spam & neko²\n" +
-		"- ❗ Jika ada error segera lapor admin\n" +
-		"- ⏳ Jika bot lemot, mohon sabar (mungkin sedang banyak pengguna)\n\n" +
-		"━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n" +
-		"💬 Grup VPN Server SG:\n" +
-		"👉 https://chat.whatsapp.com/IeIXOndIoFr0apnlKzghUC\n" +
-		"```"
+	// Deep link from an inline result or shared link: open the product detail directly
+	if productCode, ok := service.DecodeProductStartPayload(payload); ok {
+		handleProductDetail(bot, chatID, productCode)
+		return
+	}
+
+	// Referral and campaign links are recorded first-touch, then the normal welcome is shown
+	switch {
+	case strings.HasPrefix(payload, "ref_"):
+		referrerID, err := strconv.ParseInt(strings.TrimPrefix(payload, "ref_"), 10, 64)
+		if err == nil {
+			err = service.RecordReferral(chatID, referrerID)
+		}
+		if err != nil {
+			log.Printf("Referral not recorded for user %d (%s): %v", chatID, payload, err)
+		}
+	case strings.HasPrefix(payload, "c_"):
+		if err := service.RecordCampaign(chatID, strings.TrimPrefix(payload, "c_")); err != nil {
+			log.Printf("Campaign not recorded for user %d (%s): %v", chatID, payload, err)
+		}
+	}
+
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "start", nil)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🛍️ Mulai Belanja", "main_menu"),
+			templateButton(lang, "button_start_shopping", "main_menu"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💰 Cek Saldo", "balance"),
-			tgbotapi.NewInlineKeyboardButtonData("💳 Top Up Saldo", "topup"),
+			templateButton(lang, "button_balance", "balance"),
+			templateButton(lang, "button_topup", "topup"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📜 Riwayat", "history"),
-			tgbotapi.NewInlineKeyboardButtonData("📋 Peraturan", "rules"),
+			templateButton(lang, "button_history", "history"),
+			templateButton(lang, "button_rules", "rules"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❓ Bantuan", "help"),
+			templateButton(lang, "button_help", "help"),
 		),
 	)
 
@@ -370,36 +503,39 @@ func handleStart(bot *tgbotapi.BotAPI, chatID int64) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending start message: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
 func showMainMenu(bot *tgbotapi.BotAPI, chatID int64) {
-	text := `🏪 *GRN Store - Menu Utama*
-
-Pilih layanan yang Anda butuhkan:`
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "main_menu", nil)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📱 Lihat Produk", "products"),
-			tgbotapi.NewInlineKeyboardButtonData("🔍 Cari Produk", "search_products"),
+			templateButton(lang, "button_products", "products"),
+			templateButton(lang, "button_search", "search_products"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📞 Verifikasi Nomor", "verify_phone"),
-			tgbotapi.NewInlineKeyboardButtonData("📋 History", "history"),
+			templateButton(lang, "button_categories", "categories"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💰 Top Up Saldo", "topup"),
-			tgbotapi.NewInlineKeyboardButtonData("💳 Cek Saldo", "check_balance"),
+			templateButton(lang, "button_verify_phone", "verify_phone"),
+			templateButton(lang, "button_menu_history", "history"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			templateButton(lang, "button_menu_topup", "topup"),
+			templateButton(lang, "button_menu_balance", "check_balance"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔐 VPN Premium", "vpn_menu"),
+			templateButton(lang, "button_vpn", "vpn_menu"),
+			templateButton(lang, "button_referral", "referral"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("ℹ️ Bantuan", "help"),
-			tgbotapi.NewInlineKeyboardButtonData("👨‍💼 Hubungi Admin", "contact_admin"),
+			templateButton(lang, "button_menu_help", "help"),
+			templateButton(lang, "button_contact_admin", "contact_admin"),
 		),
 	)
 
@@ -407,39 +543,22 @@ Pilih layanan yang Anda butuhkan:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending main menu: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
 func showHelp(bot *tgbotapi.BotAPI, chatID int64) {
-	text := `ℹ️ *Bantuan - GRN Store*
-
-*Cara Berbelanja:*
-1️⃣ Verifikasi nomor HP Anda terlebih dahulu
-2️⃣ Pilih produk paket data yang diinginkan
-3️⃣ Lakukan pembayaran sesuai instruksi
-4️⃣ Paket data akan otomatis masuk ke nomor Anda
-
-*Perintah Bot:*
-• /start - Kembali ke menu utama
-• /menu - Tampilkan menu utama
-• /products - Lihat daftar produk
-• /help - Bantuan
-
-*Dukungan Pelanggan:*
-Jika mengalami kendala, silakan hubungi admin kami.
-
-*Jam Operasional:*
-🕐 24 jam setiap hari`
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "help", nil)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("👨‍💼 Hubungi Admin", "contact_admin"),
+			templateButton(lang, "button_contact_admin", "contact_admin"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Kembali ke Menu", "main_menu"),
+			templateButton(lang, "button_back_to_menu", "main_menu"),
 		),
 	)
 
@@ -447,163 +566,225 @@ Jika mengalami kendala, silakan hubungi admin kami.
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending help: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
 func sendErrorMessage(bot *tgbotapi.BotAPI, chatID int64, message string) {
 	msg := tgbotapi.NewMessage(chatID, message)
-	bot.Send(msg)
+	service.SendWithFallback(bot, msg)
 }
 
 func sendProductList(bot *tgbotapi.BotAPI, chatID int64, page int) {
-	packages, err := service.FetchPackages()
+	entries, err := service.GetStorefront()
 	if err != nil {
 		log.Printf("Error fetching packages: %v", err)
 		sendErrorMessage(bot, chatID, "❌ Maaf, gagal memuat daftar produk. Silakan coba lagi nanti.")
 		return
 	}
 
-	if len(packages) == 0 {
+	if len(entries) == 0 {
 		sendErrorMessage(bot, chatID, "📭 Maaf, saat ini tidak ada produk yang tersedia.")
 		return
 	}
 
-	total := len(packages)
+	text, kb := buildProductListPage(chatID, "📱 *Daftar Paket Data GRN Store*", entries, page, "page:", nil)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = kb
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending product list: %v", err)
+		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan produk.")
+	}
+}
+
+func editProductList(bot *tgbotapi.BotAPI, message *tgbotapi.Message, page int) {
+	entries, err := service.GetStorefront()
+	if err != nil {
+		log.Printf("Error fetching packages: %v", err)
+		return
+	}
+
+	text, kb := buildProductListPage(message.Chat.ID, "📱 *Daftar Paket Data GRN Store*", entries, page, "page:", nil)
+	editMsg := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	editMsg.ParseMode = "Markdown"
+	editMsg.ReplyMarkup = &kb
+
+	if _, err := service.SendWithFallback(bot, editMsg); err != nil {
+		log.Printf("Error editing product list: %v", err)
+	}
+}
+
+// buildProductListPage renders one page of storefront entries at the viewer's tier prices.
+// pagePrefix is prepended to the page number in the navigation callbacks.
+func buildProductListPage(viewerID int64, title string, entries []service.CatalogEntry, page int, pagePrefix string, backRow []tgbotapi.InlineKeyboardButton) (string, tgbotapi.InlineKeyboardMarkup) {
+	total := len(entries)
 	start := page * pageSize
+	if start >= total || start < 0 {
+		page = 0
+		start = 0
+	}
 	end := start + pageSize
 	if end > total {
 		end = total
 	}
 
-	text := fmt.Sprintf(`📱 *Daftar Paket Data GRN Store*
+	text := fmt.Sprintf(`%s
 
 Halaman %d dari %d | Total: %d produk
 
-Pilih paket data yang Anda inginkan:`, page+1, (total+pageSize-1)/pageSize, total)
+Pilih paket data yang Anda inginkan:`, title, page+1, (total+pageSize-1)/pageSize, total)
 
-	var rows [][]tgbotapi.InlineKeyboardButton
-	for _, p := range packages[start:end] {
-		packageMap[p.PackageCode] = service.PackageAlias{Name: p.PackageName, Price: p.Price}
+	if tier := service.GetUserTier(viewerID); tier != service.TierRetail {
+		text += fmt.Sprintf("\n\n🏅 Harga khusus *%s* sudah diterapkan", service.TierName(tier))
+	}
 
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, entry := range entries[start:end] {
 		// Format harga dengan pemisah ribuan
-		priceStr := formatPrice(p.Price)
+		priceStr := formatPrice(service.GetStartingPriceForUser(viewerID, &entry.Package))
 
-		// Use short name if available, otherwise use full name
-		displayName := p.PackageNameAliasShort
-		if displayName == "" {
-			displayName = p.PackageName
-		}
+		displayName := entry.DisplayName
 
 		// Truncate long names for button display
 		if len(displayName) > 50 {
 			displayName = displayName[:47] + "..."
 		}
 
-		btnText := fmt.Sprintf("📦 %s - %s", displayName, priceStr)
+		icon := "📦"
+		if entry.Featured {
+			icon = "⭐"
+		}
+
+		btnText := fmt.Sprintf("%s %s - %s", icon, displayName, priceStr)
 
-		// Create row with product button and detail button
-		productBtn := tgbotapi.NewInlineKeyboardButtonData(btnText, "detail:"+p.PackageCode)
+		// Create row with product button
+		productBtn := tgbotapi.NewInlineKeyboardButtonData(btnText, "detail:"+entry.Package.PackageCode)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(productBtn))
 	}
 
 	// Navigation buttons
 	var navButtons []tgbotapi.InlineKeyboardButton
 	if start > 0 {
-		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("⬅️ Sebelumnya", fmt.Sprintf("page:%d", page-1)))
+		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("⬅️ Sebelumnya", fmt.Sprintf("%s%d", pagePrefix, page-1)))
 	}
 	if end < total {
-		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("Selanjutnya ➡️", fmt.Sprintf("page:%d", page+1)))
+		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("Selanjutnya ➡️", fmt.Sprintf("%s%d", pagePrefix, page+1)))
 	}
 	if len(navButtons) > 0 {
 		rows = append(rows, navButtons)
 	}
 
+	if len(backRow) > 0 {
+		rows = append(rows, backRow)
+	}
+
 	// Back to main menu button
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 Menu Utama", "main_menu"),
 	))
 
-	kb := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = kb
-
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending product list: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan produk.")
-	}
+	return text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
-func editProductList(bot *tgbotapi.BotAPI, message *tgbotapi.Message, page int) {
-	packages, err := service.FetchPackages()
+// Category Functions
+
+func showCategories(bot *tgbotapi.BotAPI, chatID int64) {
+	categories, err := service.GetStorefrontCategories()
 	if err != nil {
-		log.Printf("Error fetching packages: %v", err)
+		log.Printf("Error fetching categories: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Maaf, gagal memuat kategori. Silakan coba lagi nanti.")
 		return
 	}
 
-	total := len(packages)
-	start := page * pageSize
-	end := start + pageSize
-	if end > total {
-		end = total
+	if len(categories) == 0 {
+		sendErrorMessage(bot, chatID, "📭 Maaf, saat ini tidak ada produk yang tersedia.")
+		return
 	}
 
-	text := fmt.Sprintf(`📱 *Daftar Paket Data GRN Store*
-
-Halaman %d dari %d | Total: %d produk
+	text := `🗂️ *Kategori Produk*
 
-Pilih paket data yang Anda inginkan:`, page+1, (total+pageSize-1)/pageSize, total)
+Pilih kategori yang ingin Anda lihat:`
 
 	var rows [][]tgbotapi.InlineKeyboardButton
-	for _, p := range packages[start:end] {
-		packageMap[p.PackageCode] = service.PackageAlias{Name: p.PackageName, Price: p.Price}
-
-		priceStr := formatPrice(p.Price)
-
-		// Use short name if available, otherwise use full name
-		displayName := p.PackageNameAliasShort
-		if displayName == "" {
-			displayName = p.PackageName
-		}
+	for _, category := range categories {
+		btnText := fmt.Sprintf("%s (%d)", category.Name, category.Count)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(btnText, fmt.Sprintf("cat:%s:0", category.Key)),
+		))
+	}
 
-		// Truncate long names for button display
-		if len(displayName) > 50 {
-			displayName = displayName[:47] + "..."
-		}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("📱 Semua Produk", "products"),
+		tgbotapi.NewInlineKeyboardButtonData("🔙 Menu Utama", "main_menu"),
+	))
 
-		btnText := fmt.Sprintf("📦 %s - %s", displayName, priceStr)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 
-		// Create row with product button
-		productBtn := tgbotapi.NewInlineKeyboardButtonData(btnText, "detail:"+p.PackageCode)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(productBtn))
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending categories: %v", err)
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
+}
 
-	var navButtons []tgbotapi.InlineKeyboardButton
-	if start > 0 {
-		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("⬅️ Sebelumnya", fmt.Sprintf("page:%d", page-1)))
+// handleCategorySelect opens the category of a cat: button. Buttons sent before categories
+// were keyed carry the category name instead, which still works for short names.
+func handleCategorySelect(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message, key string, page int) {
+	category, found, err := service.FindStorefrontCategory(key)
+	if err != nil {
+		log.Printf("Error fetching categories: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Maaf, gagal memuat kategori. Silakan coba lagi nanti.")
+		return
 	}
-	if end < total {
-		navButtons = append(navButtons, tgbotapi.NewInlineKeyboardButtonData("Selanjutnya ➡️", fmt.Sprintf("page:%d", page+1)))
+	if !found {
+		category = key
 	}
-	if len(navButtons) > 0 {
-		rows = append(rows, navButtons)
+	showCategoryProducts(bot, chatID, message, category, page)
+}
+
+// showCategoryProducts sends a new product list, or edits message in place when paging
+func showCategoryProducts(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message, category string, page int) {
+	entries, err := service.GetStorefrontByCategory(category)
+	if err != nil {
+		log.Printf("Error fetching category %s: %v", category, err)
+		sendErrorMessage(bot, chatID, "❌ Maaf, gagal memuat daftar produk. Silakan coba lagi nanti.")
+		return
 	}
 
-	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-		tgbotapi.NewInlineKeyboardButtonData("🔙 Menu Utama", "main_menu"),
-	))
+	if len(entries) == 0 {
+		sendErrorMessage(bot, chatID, "📭 Tidak ada produk dalam kategori ini.")
+		return
+	}
+
+	title := fmt.Sprintf("🗂️ *Kategori: %s*", category)
+	backRow := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔙 Kategori Lain", "categories"),
+	)
+	text, kb := buildProductListPage(chatID, title, entries, page, fmt.Sprintf("cat:%s:", service.CategoryKey(category)), backRow)
 
-	kb := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+	if message != nil {
+		editMsg := tgbotapi.NewEditMessageText(chatID, message.MessageID, text)
+		editMsg.ParseMode = "Markdown"
+		editMsg.ReplyMarkup = &kb
 
-	editMsg := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
-	editMsg.ParseMode = "Markdown"
-	editMsg.ReplyMarkup = &kb
+		if _, err := service.SendWithFallback(bot, editMsg); err != nil {
+			log.Printf("Error editing category list: %v", err)
+		}
+		return
+	}
 
-	if _, err := bot.Send(editMsg); err != nil {
-		log.Printf("Error editing product list: %v", err)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = kb
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending category list: %v", err)
+		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan produk.")
 	}
 }
 
@@ -644,7 +825,7 @@ Silakan verifikasi nomor HP Anda untuk melanjutkan pembelian.`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending verification required message: %v", err)
 		}
 		return
@@ -658,14 +839,16 @@ Silakan verifikasi nomor HP Anda untuk melanjutkan pembelian.`
 	}
 
 	// User is verified, proceed with purchase
-	p, ok := packageMap[productCode]
-	if !ok {
+	entry, err := service.GetStorefrontEntry(productCode)
+	if err != nil {
 		sendErrorMessage(bot, chatID, "❌ Produk tidak ditemukan. Silakan pilih produk lain.")
 		return
 	}
+	p := &entry.Package
 
-	// Store selected product and phone number in user state
+	// Store selected product and phone number in user state; a new product starts without a voucher
 	setUserData(chatID, userSession.PhoneNumber, "", productCode)
+	setUserVoucher(chatID, "", "")
 
 	// Debug: Verify data was stored
 	verifyState := getUserState(chatID)
@@ -674,19 +857,22 @@ Silakan verifikasi nomor HP Anda untuk melanjutkan pembelian.`
 		chatID, verifyState.PhoneNumber, verifyState.ProductCode)
 	verifyState.mu.RUnlock()
 
-	priceStr := formatPrice(p.Price)
+	priceStr := formatPrice(service.GetStartingPriceForUser(chatID, p))
 	text := fmt.Sprintf(`✅ *Produk Dipilih*
 
 📦 *Produk:* %s
 💰 *Harga:* %s
 📱 *Nomor:* %s
 
-Silakan lanjutkan ke pembayaran untuk menyelesaikan pembelian.`, p.Name, priceStr, userSession.PhoneNumber)
+Silakan lanjutkan ke pembayaran untuk menyelesaikan pembelian.`, service.EscapeMarkdown(p.PackageName), priceStr, service.EscapeMarkdown(userSession.PhoneNumber))
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("💳 Lanjut Pembayaran", "proceed_payment"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎟️ Pakai Voucher", "voucher_apply:"+service.VoucherScopePackage),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 Pilih Produk Lain", "products"),
 			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
@@ -697,9 +883,9 @@ Silakan lanjutkan ke pembayaran untuk menyelesaikan pembelian.`, p.Name, priceSt
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending product selection: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
@@ -722,9 +908,9 @@ Ketik nomor HP Anda:`
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending phone verification request: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
@@ -751,7 +937,7 @@ Ketik nomor HP Anda:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid phone message: %v", err)
 		}
 		return
@@ -783,9 +969,9 @@ Silakan masukkan kode OTP yang Anda terima:
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending OTP sent message: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
@@ -816,7 +1002,7 @@ Masukkan kode OTP Anda:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid OTP message: %v", err)
 		}
 		return
@@ -840,7 +1026,7 @@ Silakan masukkan kode OTP yang benar:`, verifyResp.Message)
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending wrong OTP message: %v", err)
 		}
 		return
@@ -874,7 +1060,7 @@ Sekarang Anda dapat membeli paket data dengan aman. Silakan pilih produk yang An
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending login success message: %v", err)
 		sendErrorMessage(bot, chatID, "Login berhasil! Silakan pilih produk yang Anda inginkan.")
 	}
@@ -911,7 +1097,7 @@ func handleContactAdmin(bot *tgbotapi.BotAPI, chatID int64) {
 
 	text := `👨‍💼 *Hubungi Admin GRN Store*
 
-Silakan ketik pesan Anda untuk admin. Admin akan merespons secepat mungkin.
+Silakan ketik pesan Anda untuk admin, atau kirim foto (misalnya bukti pembayaran) dengan keterangan. Pesan Anda akan menjadi tiket yang bisa dilihat lewat /tickets, dan balasan admin dikirim di chat ini.
 
 *Contoh pesan:*
 • Pertanyaan tentang produk
@@ -931,17 +1117,17 @@ Ketik pesan Anda:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending contact admin message: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
-func handleAdminMessageInput(bot *tgbotapi.BotAPI, chatID int64, message string, user *tgbotapi.User) {
-	// Send message to admin
-	err := service.SendMessageToAdmin(bot, message, user)
+func handleAdminMessageInput(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message) {
+	text, photoID := ticketMessageContent(message)
+	ticket, err := service.OpenTicket(bot, message.From, text, photoID)
 	if err != nil {
-		log.Printf("Error sending message to admin: %v", err)
+		log.Printf("Error opening ticket: %v", err)
 		sendErrorMessage(bot, chatID, "❌ Maaf, gagal mengirim pesan ke admin. Silakan coba lagi nanti.")
 		setUserState(chatID, "start")
 		return
@@ -950,14 +1136,15 @@ func handleAdminMessageInput(bot *tgbotapi.BotAPI, chatID int64, message string,
 	// Reset user state
 	setUserState(chatID, "start")
 
-	text := `✅ *Pesan Terkirim!*
+	text = fmt.Sprintf(`✅ *Tiket #%d Dibuat!*
 
 Pesan Anda telah berhasil dikirim ke admin GRN Store.
 
-Admin akan merespons pesan Anda secepat mungkin. Terima kasih atas kepercayaan Anda!`
+Balasan admin akan dikirim di chat ini. Lihat semua tiket Anda dengan /tickets.`, ticket.ID)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎫 Tiket Saya", "tickets"),
 			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
 		),
 	)
@@ -966,7 +1153,7 @@ Admin akan merespons pesan Anda secepat mungkin. Terima kasih atas kepercayaan A
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending message sent confirmation: %v", err)
 		sendErrorMessage(bot, chatID, "Pesan berhasil dikirim ke admin!")
 	}
@@ -995,6 +1182,9 @@ Selamat datang, Admin! Pilih menu admin yang Anda butuhkan:`
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("📢 Broadcast Message", "admin_broadcast"),
 		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎫 Antrian Tiket", "tickets"),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("🔙 Menu Utama", "main_menu"),
 		),
@@ -1004,7 +1194,7 @@ Selamat datang, Admin! Pilih menu admin yang Anda butuhkan:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending admin panel: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
@@ -1032,12 +1222,37 @@ func handleStatsCommand(bot *tgbotapi.BotAPI, chatID int64) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending stats: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
 }
 
+const reportUsage = "📈 *Laporan*\n\n" +
+	"`/report` - 30 hari terakhir\n" +
+	"`/report hari|minggu|bulan` - hari ini, minggu ini atau bulan ini\n" +
+	"`/report 7d` - 7 hari terakhir\n" +
+	"`/report 2025-01-01 2025-01-31` - rentang tanggal, maksimal 366 hari"
+
+// handleReportCommand sends top up inflow, sales, cost and margin of a period from the database
+func handleReportCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	r, err := service.ParseReportArgs(message.CommandArguments(), time.Now())
+	if err != nil {
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("❌ %s\n\n%s", service.EscapeMarkdown(err.Error()), reportUsage))
+		return
+	}
+
+	report, err := service.BuildReport(r, "", 5)
+	if err != nil {
+		log.Printf("Error building report: %v", err)
+		sendErrorMessage(bot, chatID, "Maaf, laporan gagal dibuat.")
+		return
+	}
+	sendMarkdownMessage(bot, chatID, service.FormatReport(report))
+}
+
 func handleProceedPayment(bot *tgbotapi.BotAPI, chatID int64) {
 	userState := getUserState(chatID)
 
@@ -1056,8 +1271,8 @@ func handleProceedPayment(bot *tgbotapi.BotAPI, chatID int64) {
 		return
 	}
 
-	p, ok := packageMap[productCode]
-	if !ok {
+	p, err := service.GetCatalogPackage(productCode)
+	if err != nil {
 		sendErrorMessage(bot, chatID, "❌ Produk tidak ditemukan. Silakan pilih produk lain.")
 		return
 	}
@@ -1083,29 +1298,44 @@ func handleProceedPayment(bot *tgbotapi.BotAPI, chatID int64) {
 📦 *Produk:* %s
 💰 *Harga:* %s
 
-⏰ *Waktu:* %s`, chatID, phoneNumber, p.Name, formatPrice(p.Price), "Sekarang")
+⏰ *Waktu:* %s`, chatID, service.EscapeMarkdown(phoneNumber), service.EscapeMarkdown(p.PackageName), formatPrice(service.GetStartingPriceForUser(chatID, p)), "Sekarang")
 
 	service.SendAdminNotification(bot, adminNotification)
 
+	voucherCode := getUserVoucher(chatID, service.VoucherScopePackage)
+	voucherLine := ""
+	if voucherCode != "" {
+		voucherLine = fmt.Sprintf("\n🎟️ *Voucher:* `%s`", voucherCode)
+	}
+
 	// Display payment method selection
 	text := fmt.Sprintf(`💳 *Pilih Metode Pembayaran*
 
 📦 *Produk:* %s
 💰 *Harga:* %s
-📱 *Nomor:* %s
+📱 *Nomor:* %s%s
 
-Silakan pilih metode pembayaran yang Anda inginkan:`, p.Name, formatPrice(p.Price), phoneNumber)
+Harga dapat berbeda per metode pembayaran.
+Silakan pilih metode pembayaran yang Anda inginkan:`, service.EscapeMarkdown(p.PackageName), formatPrice(service.GetStartingPriceForUser(chatID, p)), service.EscapeMarkdown(phoneNumber), voucherLine)
 
 	var rows [][]tgbotapi.InlineKeyboardButton
 
 	// Add payment method buttons
 	for _, pm := range paymentMethods {
-		btnText := fmt.Sprintf("💳 %s", pm.PaymentMethodDisplayName)
+		quote := service.QuotePackagePriceForUser(chatID, p, pm.PaymentMethod)
+		btnText := fmt.Sprintf("💳 %s - %s", pm.PaymentMethodDisplayName, formatPrice(quote.SellPrice))
+		if voucherCode != "" {
+			if _, discount, err := service.CheckVoucher(voucherCode, chatID, service.VoucherScopePackage, productCode, quote.SellPrice); err == nil && discount > 0 {
+				btnText = fmt.Sprintf("💳 %s - %s (hemat %s)", pm.PaymentMethodDisplayName, formatPrice(quote.SellPrice-discount), formatPrice(discount))
+			}
+		}
 		callbackData := fmt.Sprintf("pay:%s:%s", productCode, pm.PaymentMethod)
 		btn := tgbotapi.NewInlineKeyboardButtonData(btnText, callbackData)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 	}
 
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(voucherButton(voucherCode, service.VoucherScopePackage)))
+
 	// Add back buttons
 	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
 		tgbotapi.NewInlineKeyboardButtonData("🔙 Pilih Produk Lain", "products"),
@@ -1117,45 +1347,51 @@ Silakan pilih metode pembayaran yang Anda inginkan:`, p.Name, formatPrice(p.Pric
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending payment methods: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
 // Top-Up Functions
 
-func handleTopUpRequest(bot *tgbotapi.BotAPI, chatID int64) {
-	setUserState(chatID, "waiting_topup_amount")
-
-	text := `╔══════════════════════════╗
-║     💳 *TOP UP SALDO*    ║
-╚══════════════════════════╝
-
-💰 *Masukkan Nominal Custom*
-
-Silakan ketik nominal top up yang Anda inginkan.
+// Top-up amount limits, also shown in the topup_request template
+const (
+	minTopUpAmount = 10000
+	maxTopUpAmount = 1000000
+)
 
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-📋 *KETENTUAN:*
-• 💵 Minimum: Rp 10.000
-• 💎 Maximum: Rp 1.000.000
-• ⚠️ Hanya angka (tanpa titik/koma)
+// topupRequestData is the data of the topup_request template
+type topupRequestData struct {
+	VoucherCode string
+	BonusTiers  []string
+	MinAmount   int64
+	MaxAmount   int64
+}
 
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-💡 *CONTOH INPUT:*
-• Untuk Rp 50.000 → ketik: *50000*
-• Untuk Rp 100.000 → ketik: *100000*
-• Untuk Rp 250.000 → ketik: *250000*
+func handleTopUpRequest(bot *tgbotapi.BotAPI, chatID int64) {
+	setUserState(chatID, "waiting_topup_amount")
 
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-⚡ *Pembayaran via QRIS - Aman & Cepat*
+	data := topupRequestData{
+		VoucherCode: getUserVoucher(chatID, service.VoucherScopeTopUp),
+		MinAmount:   minTopUpAmount,
+		MaxAmount:   maxTopUpAmount,
+	}
+	if tiers, err := service.GetActiveTopupBonusTiers(); err != nil {
+		log.Printf("Error loading topup bonus tiers: %v", err)
+	} else {
+		for i := range tiers {
+			data.BonusTiers = append(data.BonusTiers, service.DescribeTopupBonusTier(&tiers[i]))
+		}
+	}
 
-🔤 *Ketik nominal sekarang:*`
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "topup_request", data)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(voucherButton(data.VoucherCode, service.VoucherScopeTopUp)),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "main_menu"),
+			templateButton(lang, "button_cancel", "main_menu"),
 		),
 	)
 
@@ -1163,9 +1399,9 @@ Silakan ketik nominal top up yang Anda inginkan.
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending top up request: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan. Silakan coba lagi.")
+		sendErrorMessage(bot, chatID, service.RenderUserTemplate(chatID, "generic_error", nil))
 	}
 }
 
@@ -1184,18 +1420,18 @@ Ketik nominal top up:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid amount message: %v", err)
 		}
 		return
 	}
 
 	// Validate amount
-	if amount < 10000 {
+	if amount < minTopUpAmount {
 		sendErrorMessage(bot, chatID, "❌ Minimal top up adalah Rp 10.000")
 		return
 	}
-	if amount > 1000000 {
+	if amount > maxTopUpAmount {
 		sendErrorMessage(bot, chatID, "❌ Maksimal top up adalah Rp 1.000.000")
 		return
 	}
@@ -1204,7 +1440,7 @@ Ketik nominal top up:`
 	username := getUserDisplayName(user)
 
 	// Create top up transaction
-	topUpResp, err := service.CreateTopUpTransaction(chatID, username, amount)
+	topUpResp, err := service.CreateTopUpTransaction(chatID, username, amount, getUserVoucher(chatID, service.VoucherScopeTopUp))
 	if err != nil {
 		log.Printf("Error creating top up transaction: %v", err)
 		// Show user-friendly error message (admin already notified by service)
@@ -1213,8 +1449,9 @@ Ketik nominal top up:`
 		return
 	}
 
-	// Reset user state
+	// Reset user state; the voucher now belongs to the top-up transaction
 	setUserState(chatID, "start")
+	setUserVoucher(chatID, "", "")
 
 	// Generate QR code
 	qrBytes, err := service.GenerateQRCodeBytes(topUpResp.Data.QRISCode)
@@ -1241,7 +1478,8 @@ Ketik nominal top up:`
 1️⃣ Scan QR code di atas dengan aplikasi e-wallet
 2️⃣ Pastikan nominal sesuai: %s
 3️⃣ Lakukan pembayaran
-4️⃣ Tunggu konfirmasi dari admin
+4️⃣ Kirim screenshot bukti transfer di chat ini
+5️⃣ Tunggu konfirmasi dari admin
 
 ⚠️ *Penting:*
 • QR code berlaku selama 30 menit
@@ -1254,28 +1492,29 @@ Admin akan mengkonfirmasi pembayaran Anda secepat mungkin.`,
 		topUpResp.Data.ExpiredAt,
 		formatPrice(amount))
 
+	if topUpResp.Data.BonusAmount > 0 {
+		text += fmt.Sprintf("\n\n🎁 *Bonus Top Up:* %s (%s) - masuk sebagai saldo terpisah setelah dikonfirmasi", formatPrice(topUpResp.Data.BonusAmount), topUpResp.Data.BonusTier)
+	}
+	if topUpResp.Data.VoucherCode != "" {
+		text += fmt.Sprintf("\n\n🎟️ *Voucher* `%s` - bonus %s setelah dikonfirmasi", topUpResp.Data.VoucherCode, formatPrice(topUpResp.Data.VoucherBonus))
+	}
+
 	photoMsg.Caption = text
 	photoMsg.ParseMode = "Markdown"
+	photoMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📤 Kirim Bukti Transfer", "topup_proof"),
+		),
+	)
 
-	if _, err := bot.Send(photoMsg); err != nil {
+	if _, err := service.SendWithFallback(bot, photoMsg); err != nil {
 		log.Printf("Error sending QR code: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat mengirim QR code.")
+	} else {
+		// The next photo the user sends is the transfer screenshot
+		setUserState(chatID, "waiting_payment_proof")
 	}
 
-	// Notify admin about new top up request
-	adminNotification := fmt.Sprintf(`💰 *Top Up Request Baru!*
-
-👤 *User:* %s (%d)
-💳 *Nominal:* %s
-🆔 *Transaction ID:* `+"`%s`"+`
-⏰ *Expired:* %s
-
-Menunggu pembayaran dari user.
-Gunakan /confirm %s untuk approve setelah pembayaran diterima.`,
-		username, chatID, formatPrice(amount), topUpResp.Data.TransactionID, topUpResp.Data.ExpiredAt, topUpResp.Data.TransactionID)
-
-	service.SendAdminNotification(bot, adminNotification)
-
 	// Send WhatsApp notification to admin about new topup request
 	whatsappMsg := fmt.Sprintf(`🔔 TOPUP REQUEST BARU
 
@@ -1287,19 +1526,87 @@ Status: Menunggu Pembayaran
 Silakan cek pembayaran dan konfirmasi jika sudah diterima.`,
 		username, chatID, formatPrice(amount), topUpResp.Data.TransactionID)
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
-func handleBalanceCommand(bot *tgbotapi.BotAPI, chatID int64) {
-	balance := service.GetUserBalance(chatID)
-
-	text := fmt.Sprintf(`💳 *Saldo Anda*
+// handlePaymentProofRequest asks for the transfer screenshot of the user's pending top up
+func handlePaymentProofRequest(bot *tgbotapi.BotAPI, chatID int64) {
+	tx := service.GetTransactionByUserID(chatID)
+	if tx == nil {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada top up yang menunggu pembayaran.")
+		return
+	}
 
-💰 *Saldo saat ini:* %s
+	setUserState(chatID, "waiting_payment_proof")
+	sendMarkdownMessage(bot, chatID, fmt.Sprintf("📤 *Kirim Bukti Transfer*\n\nKirim screenshot bukti pembayaran top up `%s` sebagai foto di chat ini.", tx.ID))
+}
 
-Gunakan saldo untuk membeli paket data di GRN Store.`, formatPrice(balance.Balance))
+// handlePaymentProofInput attaches the photo the user sent to their pending top up
+func handlePaymentProofInput(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message) {
+	var fileID string
+	switch {
+	case len(message.Photo) > 0:
+		// The last size is the largest
+		fileID = message.Photo[len(message.Photo)-1].FileID
+	case message.Document != nil && strings.HasPrefix(message.Document.MimeType, "image/"):
+		fileID = message.Document.FileID
+	default:
+		sendMarkdownMessage(bot, chatID, "📸 Kirim screenshot bukti transfer sebagai *foto*, atau ketik /menu untuk kembali.")
+		return
+	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+	data, err := service.DownloadTelegramFile(bot, fileID)
+	if err != nil {
+		log.Printf("Error downloading payment proof of user %d: %v", chatID, err)
+		sendErrorMessage(bot, chatID, "❌ Gagal mengambil gambar, silakan kirim ulang.")
+		return
+	}
+
+	proof, err := service.SubmitPaymentProof(bot, chatID, fileID, data)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+	setUserState(chatID, "start")
+
+	text := fmt.Sprintf(`✅ *Bukti Transfer Diterima*
+
+🆔 *Transaction ID:* `+"`%s`"+`
+
+Admin akan mengecek pembayaran Anda dan saldo masuk setelah dikonfirmasi.`, proof.TransactionID)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending payment proof confirmation: %v", err)
+	}
+}
+
+func paymentProofStatus(transactionID string) string {
+	if service.HasPaymentProof(transactionID) {
+		return "✅ dikirim"
+	}
+	return "❌ belum"
+}
+
+func handleBalanceCommand(bot *tgbotapi.BotAPI, chatID int64) {
+	balance := service.GetUserBalance(chatID)
+
+	text := fmt.Sprintf(`💳 *Saldo Anda*
+
+💰 *Saldo saat ini:* %s
+
+Gunakan saldo untuk membeli paket data di GRN Store.`, formatPrice(balance.Balance))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("💰 Top Up Saldo", "topup"),
 			tgbotapi.NewInlineKeyboardButtonData("📱 Lihat Produk", "products"),
@@ -1313,7 +1620,7 @@ Gunakan saldo untuk membeli paket data di GRN Store.`, formatPrice(balance.Balan
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending balance info: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
@@ -1352,7 +1659,7 @@ Semua transaksi sudah diproses atau expired.`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending empty pending list: %v", err)
 		}
 		return
@@ -1368,12 +1675,13 @@ Daftar transaksi yang menunggu konfirmasi:
 	var keyboardRows [][]tgbotapi.InlineKeyboardButton
 
 	for i, tx := range pendingTxs {
-		text += fmt.Sprintf(`%d. *%s* (ID: %d)
+		text += fmt.Sprintf(`%d. 👤 %s (ID: %d)
    💳 Nominal: %s
    🆔 ID: `+"`%s`"+`
    ⏰ Expired: %s
+   📎 Bukti transfer: %s
    
-`, i+1, tx.Username, tx.UserID, formatPrice(tx.Amount), tx.ID, tx.ExpiredAt)
+`, i+1, service.EscapeMarkdown(tx.Username), tx.UserID, formatPrice(tx.Amount), tx.ID, tx.ExpiredAt, paymentProofStatus(tx.ID))
 
 		// Add approve/reject buttons for each transaction
 		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
@@ -1398,7 +1706,7 @@ Daftar transaksi yang menunggu konfirmasi:
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending pending list: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
@@ -1458,16 +1766,16 @@ func handleConfirmCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 💰 *Saldo User Sekarang:* %s
 
 Notifikasi telah dikirim ke user.`,
-		confirmedTx.Username,
+		service.EscapeMarkdown(confirmedTx.Username),
 		confirmedTx.UserID,
 		formatPrice(confirmedTx.Amount),
-		transactionID,
+		service.EscapeMarkdown(transactionID),
 		formatPrice(balance.Balance))
 
 	msg := tgbotapi.NewMessage(chatID, adminText)
 	msg.ParseMode = "Markdown"
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending admin confirmation: %v", err)
 	}
 
@@ -1495,7 +1803,7 @@ Sekarang Anda dapat membeli paket data di GRN Store.`,
 	userMsg.ParseMode = "Markdown"
 	userMsg.ReplyMarkup = userKeyboard
 
-	if _, err := bot.Send(userMsg); err != nil {
+	if _, err := service.SendWithFallback(bot, userMsg); err != nil {
 		log.Printf("Error sending user notification: %v", err)
 	}
 
@@ -1514,7 +1822,7 @@ Saldo user telah berhasil ditambahkan.`,
 		formatPrice(balance.Balance),
 		transactionID)
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 func handleRejectCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
@@ -1526,18 +1834,26 @@ func handleRejectCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 		return
 	}
 
-	// Parse command arguments
-	args := strings.Fields(message.Text)
-	if len(args) != 2 {
-		sendErrorMessage(bot, chatID, "❌ Format salah. Gunakan: /reject <transaction_id>")
+	// Parse command arguments: /reject <transaction_id> [alasan]
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		sendErrorMessage(bot, chatID, "❌ Format salah. Gunakan: /reject <transaction_id> [alasan]")
 		return
 	}
 
-	transactionID := args[1]
+	rejectTopUp(bot, chatID, args[0], strings.Join(args[1:], " "))
+}
 
+// rejectTopUp rejects a top up for an admin; the user gets the reason with the rejection
+func rejectTopUp(bot *tgbotapi.BotAPI, chatID int64, transactionID, reason string) {
 	// Get transaction details before rejection
 	service.TxMutex.RLock()
 	rejectedTx, exists := service.Transactions[transactionID]
+	var username string
+	var userID, amount int64
+	if exists {
+		username, userID, amount = rejectedTx.Username, rejectedTx.UserID, rejectedTx.Amount
+	}
 	service.TxMutex.RUnlock()
 
 	if !exists {
@@ -1546,12 +1862,14 @@ func handleRejectCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	}
 
 	// Reject transaction
-	err := service.RejectTopUp(transactionID, chatID)
-	if err != nil {
+	if err := service.RejectTopUp(transactionID, chatID, reason); err != nil {
 		log.Printf("Error rejecting top up: %v", err)
 		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal menolak: %s", err.Error()))
 		return
 	}
+	if reason == "" {
+		reason = "-"
+	}
 
 	// Send confirmation to admin
 	adminText := fmt.Sprintf(`❌ *Top-Up Ditolak*
@@ -1559,47 +1877,25 @@ func handleRejectCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 👤 *User:* %s (%d)
 💳 *Nominal:* %s
 🆔 *Transaction ID:* %s
+📝 *Alasan:* %s
 
-Transaksi telah ditolak dan user akan diberitahu.`,
-		rejectedTx.Username,
-		rejectedTx.UserID,
-		formatPrice(rejectedTx.Amount),
-		transactionID)
+Transaksi telah ditolak dan user sudah diberitahu beserta alasannya.`,
+		service.EscapeMarkdown(username),
+		userID,
+		formatPrice(amount),
+		service.EscapeMarkdown(transactionID),
+		service.EscapeMarkdown(reason))
 
 	msg := tgbotapi.NewMessage(chatID, adminText)
 	msg.ParseMode = "Markdown"
-
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending admin rejection confirmation: %v", err)
-	}
-
-	// Send notification to user
-	userText := fmt.Sprintf(`❌ *Top-Up Ditolak*
-
-💳 *Nominal:* %s
-🆔 *Transaction ID:* %s
-
-Maaf, transaksi top-up Anda ditolak oleh admin.
-Silakan hubungi admin untuk informasi lebih lanjut atau coba lagi.`,
-		formatPrice(rejectedTx.Amount),
-		transactionID)
-
-	userKeyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("👨‍💼 Hubungi Admin", "contact_admin"),
-		),
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("💰 Top Up Lagi", "topup"),
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
+			tgbotapi.NewInlineKeyboardButtonData("📋 Lihat Pending", "admin_pending"),
 		),
 	)
 
-	userMsg := tgbotapi.NewMessage(rejectedTx.UserID, userText)
-	userMsg.ParseMode = "Markdown"
-	userMsg.ReplyMarkup = userKeyboard
-
-	if _, err := bot.Send(userMsg); err != nil {
-		log.Printf("Error sending user rejection notification: %v", err)
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending admin rejection confirmation: %v", err)
 	}
 
 	// Send WhatsApp notification for rejected topup
@@ -1608,14 +1904,16 @@ Silakan hubungi admin untuk informasi lebih lanjut atau coba lagi.`,
 User: %s (%d)
 Nominal: %s
 Transaction ID: %s
+Alasan: %s
 
 Transaksi topup telah ditolak oleh admin.`,
-		rejectedTx.Username,
-		rejectedTx.UserID,
-		formatPrice(rejectedTx.Amount),
-		transactionID)
+		username,
+		userID,
+		formatPrice(amount),
+		transactionID,
+		reason)
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 func getUserDisplayName(user *tgbotapi.User) string {
@@ -1653,7 +1951,7 @@ func handleDebugCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	} else {
 		for id, tx := range service.Transactions {
 			text += fmt.Sprintf("• `%s`\n  User: %s (%d)\n  Amount: %s\n  Status: %s\n\n",
-				id, tx.Username, tx.UserID, formatPrice(tx.Amount), tx.Status)
+				id, service.EscapeMarkdown(tx.Username), tx.UserID, formatPrice(tx.Amount), tx.Status)
 		}
 	}
 	service.TxMutex.RUnlock()
@@ -1663,75 +1961,341 @@ func handleDebugCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending debug info: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
 }
 
-// Broadcast Functions
+func handleRefreshCatalogCommand(bot *tgbotapi.BotAPI, chatID int64) {
+	if err := service.RefreshCatalog(); err != nil {
+		log.Printf("Error refreshing catalog: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memperbarui katalog produk. Data lama tetap digunakan.")
+		return
+	}
 
-func handleBroadcastCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	count, fetchedAt := service.GetCatalogStatus()
+	text := fmt.Sprintf(`🔄 *Katalog Diperbarui*
+
+📦 *Jumlah Produk:* %d
+⏰ *Waktu:* %s`, count, fetchedAt.Format("02/01/2006 15:04:05"))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending catalog refresh result: %v", err)
+	}
+}
+
+// Inline Query Functions
+
+const inlinePageSize = 20
+
+func handleInlineQuery(bot *tgbotapi.BotAPI, query *tgbotapi.InlineQuery) {
+	ttl := config.GetInlineCacheTTL()
+
+	results, err := service.SearchCatalogCached(query.Query, query.From.ID, ttl)
+	if err != nil {
+		log.Printf("Error searching catalog for inline query %q: %v", query.Query, err)
+		results = nil
+	}
+
+	offset, _ := strconv.Atoi(query.Offset)
+	if offset < 0 || offset > len(results) {
+		offset = 0
+	}
+	end := offset + inlinePageSize
+	if end > len(results) {
+		end = len(results)
+	}
+
+	var articles []interface{}
+	for i, entry := range results[offset:end] {
+		articles = append(articles, buildInlineProductArticle(bot, query.From.ID, offset+i, entry))
+	}
+
+	nextOffset := ""
+	if end < len(results) {
+		nextOffset = strconv.Itoa(end)
+	}
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       articles,
+		CacheTime:     int(ttl.Seconds()),
+		NextOffset:    nextOffset,
+		IsPersonal:    true, // prices depend on the user's tier, so answers must not be shared between users
+	}
+	if len(results) == 0 {
+		answer.SwitchPMText = "Produk tidak ditemukan - buka bot"
+		answer.SwitchPMParameter = "inline"
+	}
+
+	if _, err := bot.Request(answer); err != nil {
+		log.Printf("Error answering inline query: %v", err)
+	}
+}
+
+func buildInlineProductArticle(bot *tgbotapi.BotAPI, viewerID int64, index int, entry service.CatalogEntry) tgbotapi.InlineQueryResultArticle {
+	price := formatPrice(service.GetStartingPriceForUser(viewerID, &entry.Package))
+
+	text := fmt.Sprintf("📦 %s\n💰 Mulai %s\n🗂️ %s", entry.DisplayName, price, entry.Category)
+	if entry.Package.PackageName != entry.DisplayName {
+		text += "\n\n" + entry.Package.PackageName
+	}
+	text += fmt.Sprintf("\n\nBeli di @%s", bot.Self.UserName)
+
+	article := tgbotapi.NewInlineQueryResultArticle(strconv.Itoa(index), entry.DisplayName, text)
+	article.Description = fmt.Sprintf("%s • %s", price, entry.Category)
+	if entry.Featured {
+		article.Description = "⭐ " + article.Description
+	}
+
+	link := buildStartLink(bot, service.EncodeProductStartPayload(entry.Package.PackageCode))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("🛒 Lihat di Bot", link),
+		),
+	)
+	article.ReplyMarkup = &keyboard
+
+	return article
+}
+
+// Deep Link Functions
+
+func buildStartLink(bot *tgbotapi.BotAPI, payload string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", bot.Self.UserName, payload)
+}
+
+const linkUsage = `🔗 *Buat Link Bot*
+
+*Penggunaan:*
+• /link produk <kode> - Link langsung ke detail produk
+• /link ref <chat_id> - Link referral
+• /link kampanye <kode> - Link kampanye`
+
+func handleLinkCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
 	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
 
-	// Check if user is admin
-	if !config.IsAdmin(chatID) {
-		sendErrorMessage(bot, chatID, "❌ Anda tidak memiliki akses admin.")
+	if len(args) < 2 {
+		sendMarkdownMessage(bot, chatID, linkUsage)
 		return
 	}
 
-	// Parse command arguments
-	args := strings.Fields(message.Text)
-	if len(args) < 2 {
-		sendErrorMessage(bot, chatID, "❌ Format salah. Gunakan: /broadcast <pesan>")
+	var payload string
+	switch strings.ToLower(args[0]) {
+	case "produk", "p":
+		if _, err := service.GetCatalogPackage(args[1]); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Produk dengan kode %s tidak ditemukan di katalog.", args[1]))
+			return
+		}
+		payload = service.EncodeProductStartPayload(args[1])
+	case "ref":
+		if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+			sendErrorMessage(bot, chatID, "❌ Chat ID referral harus berupa angka.")
+			return
+		}
+		payload = "ref_" + args[1]
+	case "kampanye", "campaign", "c":
+		payload = "c_" + args[1]
+	default:
+		sendMarkdownMessage(bot, chatID, linkUsage)
 		return
 	}
 
-	// Get broadcast message
-	broadcastMessage := strings.Join(args[1:], " ")
+	// Sent without Markdown so underscores in the link are not parsed
+	msg := tgbotapi.NewMessage(chatID, "🔗 Link siap dibagikan:\n\n"+buildStartLink(bot, payload))
+	msg.DisableWebPagePreview = true
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending deep link: %v", err)
+	}
+}
+
+const campaignUsage = `📣 *Kampanye*
+
+*Penggunaan:*
+• /campaign - Laporan konversi semua kampanye
+• /campaign buat <kode> [nama] - Buat kampanye baru
+• /campaign hapus <kode> - Hapus kampanye`
 
-	// Get all user IDs
-	userIDs := service.GetAllUserIDs()
+func handleCampaignCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
 
-	if len(userIDs) == 0 {
-		sendErrorMessage(bot, chatID, "❌ Tidak ada user untuk broadcast.")
+	if len(args) == 0 {
+		sendCampaignReport(bot, chatID)
 		return
 	}
 
-	// Send broadcast
-	err := service.BroadcastMessage(bot, broadcastMessage, userIDs)
+	switch strings.ToLower(args[0]) {
+	case "buat", "create":
+		if len(args) < 2 {
+			sendMarkdownMessage(bot, chatID, campaignUsage)
+			return
+		}
+		campaign, err := service.CreateCampaign(args[1], strings.Join(args[2:], " "), chatID)
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Kampanye %s dibuat.\n\nLink:\n%s",
+			campaign.Name, buildStartLink(bot, "c_"+campaign.Code)))
+		msg.DisableWebPagePreview = true
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
+			log.Printf("Error sending campaign link: %v", err)
+		}
+	case "hapus", "delete":
+		if len(args) < 2 {
+			sendMarkdownMessage(bot, chatID, campaignUsage)
+			return
+		}
+		if err := service.DeleteCampaign(args[1]); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		if _, err := service.SendWithFallback(bot, tgbotapi.NewMessage(chatID, fmt.Sprintf("✅ Kampanye %s dihapus.", args[1]))); err != nil {
+			log.Printf("Error sending campaign deletion: %v", err)
+		}
+	default:
+		sendMarkdownMessage(bot, chatID, campaignUsage)
+	}
+}
+
+func sendCampaignReport(bot *tgbotapi.BotAPI, chatID int64) {
+	reports, err := service.GetCampaignReports()
 	if err != nil {
-		log.Printf("Error broadcasting message: %v", err)
-		sendErrorMessage(bot, chatID, "❌ Gagal mengirim broadcast.")
+		log.Printf("Error loading campaign reports: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat laporan kampanye.")
+		return
+	}
+
+	if len(reports) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada kampanye.\n\n"+campaignUsage)
 		return
 	}
 
-	// Confirmation message already sent by BroadcastMessage function
+	text := "📣 *Laporan Kampanye*\n\n"
+	for _, report := range reports {
+		conversion := 0.0
+		if report.Users > 0 {
+			conversion = float64(report.Buyers) * 100 / float64(report.Users)
+		}
+		text += fmt.Sprintf("🏷️ *%s* (`%s`)\n   👥 User: %d\n   🛒 Pembeli: %d (%.1f%%)\n   📦 Pembelian: %d - %s\n   💳 Top Up: %s\n\n",
+			report.Name, report.Code, report.Users, report.Buyers, conversion,
+			report.Purchases, formatPrice(report.PurchaseRevenue), formatPrice(report.TopUpAmount))
+	}
+
+	sendMarkdownMessage(bot, chatID, text)
 }
 
-func handleBroadcastRequest(bot *tgbotapi.BotAPI, chatID int64) {
-	setUserState(chatID, "waiting_broadcast_message")
+// Referral Functions
+
+func describeReferralCommission() string {
+	value := config.GetReferralCommissionValue()
+	if config.GetReferralCommissionType() == service.MarkupPercent {
+		return fmt.Sprintf("%g%% dari nilai transaksi", value)
+	}
+	return formatPrice(int64(value)) + " per transaksi"
+}
 
-	userIDs := service.GetAllUserIDs()
+func handleReferralCommand(bot *tgbotapi.BotAPI, chatID int64) {
+	if config.GetReferralCommissionValue() <= 0 {
+		sendMarkdownMessage(bot, chatID, "🎁 Program referral sedang tidak aktif.")
+		return
+	}
 
-	text := fmt.Sprintf(`📢 *Broadcast Message*
+	summary, err := service.GetReferralSummary(chatID)
+	if err != nil {
+		log.Printf("Error loading referral summary for %d: %v", chatID, err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat data referral.")
+		return
+	}
 
-Anda akan mengirim pesan ke *%d user* yang pernah berinteraksi dengan bot.
+	// Sent without Markdown so underscores in the link are not parsed
+	text := fmt.Sprintf(`🎁 Ajak Teman, Dapat Komisi!
 
-Silakan ketik pesan yang ingin Anda broadcast:
+Bagikan link berikut ke teman Anda:
+%s
 
-*Tips:*
-• Gunakan format Markdown untuk formatting
-• Pesan akan dikirim ke semua user
-• Pastikan pesan sudah benar sebelum mengirim
+Setiap teman baru yang bergabung lewat link Anda memberi komisi %s untuk %d pembelian atau top-up pertamanya. Komisi langsung masuk ke saldo Anda.
 
-*Contoh:*
-🎉 *Promo Spesial GRN Store!*
-Dapatkan bonus 20%% untuk top-up hari ini!`, len(userIDs))
+📊 Ringkasan:
+👥 Teman diundang: %d
+✅ Transaksi berkomisi: %d
+💰 Total komisi: %s
+
+Catatan: referral dari nomor HP yang sama dengan akun Anda atau pendaftaran massal tidak mendapat komisi.`,
+		buildStartLink(bot, fmt.Sprintf("ref_%d", chatID)),
+		describeReferralCommission(),
+		config.GetReferralMaxRewardedEvents(),
+		summary.Active,
+		summary.RewardedEvents,
+		formatPrice(summary.TotalCommission))
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending referral summary: %v", err)
+	}
+}
+
+func sendReferralReport(bot *tgbotapi.BotAPI, chatID int64) {
+	reports, err := service.GetReferralReport()
+	if err != nil {
+		log.Printf("Error loading referral report: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat laporan referral.")
+		return
+	}
+
+	if len(reports) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada referral.")
+		return
+	}
+
+	var totalCommission int64
+	text := fmt.Sprintf("🎁 *Laporan Referral*\n\nKomisi: %s, maks %d transaksi per teman\n\n",
+		describeReferralCommission(), config.GetReferralMaxRewardedEvents())
+	for i, report := range reports {
+		totalCommission += report.TotalCommission
+		if i >= 20 {
+			continue
+		}
+		text += fmt.Sprintf("👤 `%d`\n   👥 Diundang: %d (diblokir: %d)\n   ✅ Transaksi berkomisi: %d\n   💰 Komisi: %s\n\n",
+			report.ReferrerID, report.Referred, report.Blocked, report.RewardedEvents, formatPrice(report.TotalCommission))
+	}
+	if len(reports) > 20 {
+		text += fmt.Sprintf("... dan %d pengundang lainnya\n\n", len(reports)-20)
+	}
+	text += fmt.Sprintf("💰 *Total komisi dibayarkan:* %s", formatPrice(totalCommission))
+
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+// Voucher Functions
+
+// voucherButton returns the button to apply a voucher to an order, or to remove the applied one
+func voucherButton(voucherCode, target string) tgbotapi.InlineKeyboardButton {
+	if voucherCode != "" {
+		return tgbotapi.NewInlineKeyboardButtonData("❌ Hapus Voucher "+voucherCode, "voucher_remove:"+target)
+	}
+	return tgbotapi.NewInlineKeyboardButtonData("🎟️ Pakai Voucher", "voucher_apply:"+target)
+}
+
+func handleVoucherRequest(bot *tgbotapi.BotAPI, chatID int64, target string) {
+	setUserVoucher(chatID, "", target)
+	setUserState(chatID, "waiting_voucher_code")
+
+	text := `🎟️ *Pakai Voucher*
+
+Ketik kode voucher Anda:`
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "admin_panel"),
+			tgbotapi.NewInlineKeyboardButtonData("⏭️ Lanjut Tanpa Voucher", "voucher_remove:"+target),
 		),
 	)
 
@@ -1739,23 +2303,1071 @@ Dapatkan bonus 20%% untuk top-up hari ini!`, len(userIDs))
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending broadcast request: %v", err)
-		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending voucher request: %v", err)
 	}
 }
 
-func handleBroadcastMessageInput(bot *tgbotapi.BotAPI, chatID int64, message string) {
-	// Reset user state
+func handleVoucherCodeInput(bot *tgbotapi.BotAPI, chatID int64, code string) {
+	userState := getUserState(chatID)
+	userState.mu.RLock()
+	target := userState.VoucherTarget
+	productCode := userState.ProductCode
+	protocol := userState.VPNProtocol
+	userState.mu.RUnlock()
+
+	scope := strings.SplitN(target, ":", 2)[0]
+	switch scope {
+	case service.VoucherScopeVPN:
+		productCode = protocol
+	case service.VoucherScopeTopUp:
+		productCode = ""
+	}
+
+	voucher, err := service.LookupVoucher(code, chatID, scope, productCode)
+	if err != nil {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⏭️ Lanjut Tanpa Voucher", "voucher_remove:"+target),
+			),
+		)
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ %s\n\nKetik kode voucher lain:", err.Error()))
+		msg.ReplyMarkup = keyboard
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
+			log.Printf("Error sending voucher error: %v", err)
+		}
+		return
+	}
+
+	setUserVoucher(chatID, voucher.Code, target)
 	setUserState(chatID, "start")
 
-	// Get all user IDs
-	userIDs := service.GetAllUserIDs()
+	text := fmt.Sprintf("✅ Voucher `%s` dipakai: %s %s", voucher.Code, service.VoucherScopeName(voucher.Scope), service.FormatVoucherValue(voucher))
+	if voucher.MinSpend > 0 {
+		text += fmt.Sprintf(" (min. transaksi %s)", formatPrice(voucher.MinSpend))
+	}
+	sendMarkdownMessage(bot, chatID, text)
+
+	continueAfterVoucher(bot, chatID, target)
+}
+
+// continueAfterVoucher returns the user to the order step the voucher was applied from
+func continueAfterVoucher(bot *tgbotapi.BotAPI, chatID int64, target string) {
+	scope, arg, _ := strings.Cut(target, ":")
+	switch scope {
+	case service.VoucherScopePackage:
+		setUserState(chatID, "start")
+		handleProceedPayment(bot, chatID)
+	case service.VoucherScopeVPN:
+		setUserState(chatID, "waiting_vpn_days")
+		handleVPNDaysInput(bot, chatID, arg)
+	case service.VoucherScopeTopUp:
+		handleTopUpRequest(bot, chatID)
+	default:
+		showMainMenu(bot, chatID)
+	}
+}
+
+const voucherUsage = "🎟️ *Voucher*\n\n" +
+	"*Penggunaan:*\n" +
+	"• /voucher - Laporan pemakaian semua voucher\n" +
+	"• /voucher buat <kode> <package|vpn|topup> <nilai> [opsi] - Buat voucher, nilai `10%` atau `5000`\n" +
+	"• /voucher info <kode> - Detail dan pemakaian terakhir\n" +
+	"• /voucher aktif <kode> / nonaktif <kode>\n" +
+	"• /voucher hapus <kode>\n\n" +
+	"*Opsi:* `min=50000` `maks=10000` `kuota=100` `peruser=1` `produk=KODE1,KODE2` `mulai=2025-01-01` `sampai=2025-01-31` `ket=Promo_Gajian`\n" +
+	"Voucher topup memberi bonus saldo; `produk` untuk voucher vpn berisi protokol (ssh, vmess, ...)."
+
+func handleVoucherCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+
+	if len(args) == 0 {
+		sendVoucherReport(bot, chatID)
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	if action == "buat" || action == "create" {
+		voucher, err := service.ParseVoucherSpec(args[1:])
+		if err == nil {
+			voucher.CreatedBy = chatID
+			err = service.CreateVoucher(voucher)
+		}
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, "✅ Voucher dibuat.\n\n"+formatVoucher(voucher))
+		return
+	}
 
-	if len(userIDs) == 0 {
-		sendErrorMessage(bot, chatID, "❌ Tidak ada user untuk broadcast.")
+	if len(args) < 2 {
+		sendMarkdownMessage(bot, chatID, voucherUsage)
 		return
 	}
+	code := args[1]
+
+	switch action {
+	case "info":
+		sendVoucherInfo(bot, chatID, code)
+	case "aktif", "nonaktif":
+		active := action == "aktif"
+		voucher, err := service.UpdateVoucher(code, func(v *models.Voucher) { v.Active = active })
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, "✅ Voucher diperbarui.\n\n"+formatVoucher(voucher))
+	case "hapus", "delete":
+		if err := service.DeleteVoucher(code); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Voucher `%s` dihapus.", service.NormalizeVoucherCode(code)))
+	default:
+		sendMarkdownMessage(bot, chatID, voucherUsage)
+	}
+}
+
+func formatVoucher(voucher *models.Voucher) string {
+	status := "✅ aktif"
+	if !voucher.Active {
+		status = "⏸️ nonaktif"
+	}
+
+	text := fmt.Sprintf("🎟️ `%s` - %s\n   Jenis: %s, nilai %s\n   Terpakai: %d", voucher.Code, status,
+		service.VoucherScopeName(voucher.Scope), service.FormatVoucherValue(voucher), voucher.UsedCount)
+	if voucher.MaxUses > 0 {
+		text += fmt.Sprintf("/%d", voucher.MaxUses)
+	}
+	if voucher.MaxUsesPerUser > 0 {
+		text += fmt.Sprintf(", maks %dx per user", voucher.MaxUsesPerUser)
+	}
+	if voucher.MinSpend > 0 {
+		text += "\n   Min. transaksi: " + formatPrice(voucher.MinSpend)
+	}
+	if voucher.EligibleProducts != "" {
+		text += "\n   Produk: `" + voucher.EligibleProducts + "`"
+	}
+	if voucher.StartsAt != nil || voucher.ExpiresAt != nil {
+		period := "\n   Berlaku:"
+		if voucher.StartsAt != nil {
+			period += " " + voucher.StartsAt.Format("02/01/2006")
+		}
+		period += " s/d"
+		if voucher.ExpiresAt != nil {
+			period += " " + voucher.ExpiresAt.Format("02/01/2006")
+		}
+		text += period
+	}
+	return text
+}
+
+func sendVoucherReport(bot *tgbotapi.BotAPI, chatID int64) {
+	reports, err := service.GetVoucherReports()
+	if err != nil {
+		log.Printf("Error loading voucher reports: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat laporan voucher.")
+		return
+	}
+
+	if len(reports) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada voucher.\n\n"+voucherUsage)
+		return
+	}
+
+	text := "🎟️ *Laporan Voucher*\n\n"
+	for _, report := range reports {
+		text += formatVoucher(&report.Voucher)
+		text += fmt.Sprintf("\n   👥 User: %d, transaksi: %d\n   💸 Total %s: %s\n   💰 Nilai transaksi: %s\n\n",
+			report.Users, report.Redemptions, voucherBenefitName(report.Scope), formatPrice(report.TotalDiscount), formatPrice(report.Revenue))
+	}
+
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+func sendVoucherInfo(bot *tgbotapi.BotAPI, chatID int64, code string) {
+	reports, err := service.GetVoucherReports()
+	if err != nil {
+		log.Printf("Error loading voucher reports: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat voucher.")
+		return
+	}
+
+	code = service.NormalizeVoucherCode(code)
+	for _, report := range reports {
+		if report.Code != code {
+			continue
+		}
+
+		text := formatVoucher(&report.Voucher)
+		if report.Description != "" {
+			text += "\n   Keterangan: " + report.Description
+		}
+		text += fmt.Sprintf("\n\n👥 User: %d\n🧾 Transaksi: %d\n💸 Total %s: %s\n💰 Nilai transaksi: %s",
+			report.Users, report.Redemptions, voucherBenefitName(report.Scope), formatPrice(report.TotalDiscount), formatPrice(report.Revenue))
+
+		redemptions, err := service.GetVoucherRedemptions(code, 10)
+		if err == nil && len(redemptions) > 0 {
+			text += "\n\n*Pemakaian terakhir:*\n"
+			for _, r := range redemptions {
+				source := "`" + r.SourceID + "`"
+				if r.SourceID == "" {
+					source = "diproses"
+				}
+				text += fmt.Sprintf("• %s - user `%d` - %s (%s)\n", r.CreatedAt.Format("02/01 15:04"), r.UserID, formatPrice(r.Discount), source)
+			}
+		}
+
+		sendMarkdownMessage(bot, chatID, text)
+		return
+	}
+
+	sendErrorMessage(bot, chatID, "❌ Voucher tidak ditemukan.")
+}
+
+func voucherBenefitName(scope string) string {
+	if scope == service.VoucherScopeTopUp {
+		return "bonus"
+	}
+	return "diskon"
+}
+
+// Top Up Bonus Functions
+
+const topupBonusUsage = "🎁 *Bonus Top Up*\n\n" +
+	"*Penggunaan:*\n" +
+	"• /topupbonus - Daftar tier bonus\n" +
+	"• /topupbonus tambah <minimal> <nilai> [opsi] - Tambah tier, nilai `5%` atau `5000`\n" +
+	"• /topupbonus aktif <id> / nonaktif <id>\n" +
+	"• /topupbonus hapus <id>\n\n" +
+	"*Opsi:* `maks=10000` `mulai=2025-01-01` `sampai=2025-01-31` `nama=Promo_Gajian`\n" +
+	"Jika beberapa tier cocok, user mendapat bonus terbesar."
+
+func handleTopupBonusCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+
+	if len(args) == 0 {
+		sendTopupBonusTierList(bot, chatID)
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	if action == "tambah" || action == "add" {
+		tier, err := service.ParseTopupBonusSpec(args[1:])
+		if err == nil {
+			err = service.SaveTopupBonusTier(tier)
+		}
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, "✅ Tier bonus ditambahkan.\n\n"+formatTopupBonusTier(tier))
+		return
+	}
+
+	if len(args) < 2 {
+		sendMarkdownMessage(bot, chatID, topupBonusUsage)
+		return
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ ID tier tidak valid")
+		return
+	}
+
+	switch action {
+	case "aktif", "nonaktif":
+		active := action == "aktif"
+		tier, err := service.UpdateTopupBonusTier(uint(id), func(t *models.TopupBonusTier) { t.Active = active })
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, "✅ Tier bonus diperbarui.\n\n"+formatTopupBonusTier(tier))
+	case "hapus", "delete":
+		if err := service.DeleteTopupBonusTier(uint(id)); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Tier bonus #%d dihapus.", id))
+	default:
+		sendMarkdownMessage(bot, chatID, topupBonusUsage)
+	}
+}
+
+func formatTopupBonusTier(tier *models.TopupBonusTier) string {
+	status := "✅ aktif"
+	if !tier.Active {
+		status = "⏸️ nonaktif"
+	}
+
+	text := fmt.Sprintf("🎁 #%d - %s\n   %s", tier.ID, status, service.DescribeTopupBonusTier(tier))
+	if tier.Name != "" {
+		text += "\n   Nama: " + tier.Name
+	}
+	if tier.StartsAt != nil {
+		text += "\n   Mulai: " + tier.StartsAt.Format("02/01/2006")
+	}
+	return text
+}
+
+func sendTopupBonusTierList(bot *tgbotapi.BotAPI, chatID int64) {
+	tiers, err := service.GetTopupBonusTiers()
+	if err != nil {
+		log.Printf("Error loading topup bonus tiers: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat tier bonus top up.")
+		return
+	}
+
+	if len(tiers) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada tier bonus top up.\n\n"+topupBonusUsage)
+		return
+	}
+
+	text := "🎁 *Tier Bonus Top Up*\n\n"
+	for i := range tiers {
+		text += formatTopupBonusTier(&tiers[i]) + "\n\n"
+	}
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+// User Tier Functions
+
+const tierUsage = "🏅 *Tier Harga User*\n\n" +
+	"*Penggunaan:*\n" +
+	"• /tier - Daftar reseller & agen beserta belanja bulan ini\n" +
+	"• /tier set <user\\_id> <retail|reseller|agent> - Ubah tier user\n" +
+	"• /tier harga - Daftar harga & diskon tier\n" +
+	"• /tier harga <tier> <kode> <harga> - Harga tetap paket untuk tier\n" +
+	"• /tier diskon <tier> <kode|semua> <nilai> - Diskon tier, nilai `5%` atau `2000`\n" +
+	"• /tier hapusharga <id> - Hapus harga/diskon tier\n\n" +
+	"Harga tier dihitung dari harga jual (setelah pricing rule) dan tidak pernah di bawah harga modal."
+
+func handleTierCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+
+	if len(args) == 0 {
+		sendTierMembers(bot, chatID)
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "set":
+		if len(args) < 3 {
+			sendMarkdownMessage(bot, chatID, tierUsage)
+			return
+		}
+		userID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			sendErrorMessage(bot, chatID, "❌ User ID tidak valid")
+			return
+		}
+		if err := service.SetUserTier(userID, args[2], chatID); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		tier := service.GetUserTier(userID)
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ User `%d` sekarang *%s*.", userID, service.TierName(tier)))
+	case "harga":
+		if len(args) == 1 {
+			sendTierPrices(bot, chatID)
+			return
+		}
+		if len(args) < 4 {
+			sendMarkdownMessage(bot, chatID, tierUsage)
+			return
+		}
+		entry := &models.TierPrice{Tier: args[1], PackageCode: args[2], Price: parseTierAmount(args[3]), IsActive: true}
+		if strings.EqualFold(entry.PackageCode, "semua") {
+			entry.PackageCode = ""
+		}
+		saveTierPriceFromCommand(bot, chatID, entry)
+	case "diskon":
+		if len(args) < 4 {
+			sendMarkdownMessage(bot, chatID, tierUsage)
+			return
+		}
+		entry := &models.TierPrice{Tier: args[1], PackageCode: args[2], IsActive: true}
+		if strings.EqualFold(entry.PackageCode, "semua") {
+			entry.PackageCode = ""
+		}
+		if err := service.ParseTierDiscount(entry, args[3]); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		saveTierPriceFromCommand(bot, chatID, entry)
+	case "hapusharga":
+		if len(args) < 2 {
+			sendMarkdownMessage(bot, chatID, tierUsage)
+			return
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			sendErrorMessage(bot, chatID, "❌ ID harga tier tidak valid")
+			return
+		}
+		if err := service.DeleteTierPrice(uint(id)); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Harga tier #%d dihapus.", id))
+	default:
+		sendMarkdownMessage(bot, chatID, tierUsage)
+	}
+}
+
+func parseTierAmount(value string) int64 {
+	amount, err := strconv.ParseInt(strings.NewReplacer(".", "", ",", "").Replace(value), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return amount
+}
+
+func saveTierPriceFromCommand(bot *tgbotapi.BotAPI, chatID int64, entry *models.TierPrice) {
+	if err := service.SaveTierPrice(entry); err != nil {
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+		return
+	}
+	sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Harga tier disimpan.\n\n#%d *%s* - `%s`", entry.ID, service.TierName(entry.Tier), service.DescribeTierPrice(entry)))
+}
+
+func sendTierMembers(bot *tgbotapi.BotAPI, chatID int64) {
+	members, err := service.GetTierMembers()
+	if err != nil {
+		log.Printf("Error loading tier members: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat daftar tier.")
+		return
+	}
+
+	if len(members) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada reseller atau agen.\n\n"+tierUsage)
+		return
+	}
+
+	text := "🏅 *Reseller & Agen*\n\n"
+	for _, member := range members {
+		source := "admin"
+		if member.AutoPromoted {
+			source = "otomatis"
+		}
+		text += fmt.Sprintf("• `%d` - *%s* (%s)\n   Belanja bulan ini: %s\n", member.UserID, service.TierName(member.Tier), source, formatPrice(member.MonthlySpend))
+	}
+
+	if spend := config.GetTierResellerMonthlySpend(); spend > 0 {
+		text += "\n⬆️ Otomatis reseller dari belanja " + formatPrice(spend) + "/bulan"
+	}
+	if spend := config.GetTierAgentMonthlySpend(); spend > 0 {
+		text += "\n⬆️ Otomatis agen dari belanja " + formatPrice(spend) + "/bulan"
+	}
+
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+func sendTierPrices(bot *tgbotapi.BotAPI, chatID int64) {
+	entries, err := service.GetTierPrices()
+	if err != nil {
+		log.Printf("Error loading tier prices: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat harga tier.")
+		return
+	}
+
+	if len(entries) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada harga tier.\n\n"+tierUsage)
+		return
+	}
+
+	text := "🏷️ *Harga & Diskon Tier*\n\n"
+	for i := range entries {
+		text += fmt.Sprintf("#%d *%s* - `%s`\n", entries[i].ID, service.TierName(entries[i].Tier), service.DescribeTierPrice(&entries[i]))
+	}
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+// Catalog Override Functions
+
+const catalogUsage = `🗂️ *Pengaturan Katalog*
+
+*Penggunaan:*
+• /catalog list - Daftar override
+• /catalog hide <kode> - Sembunyikan produk
+• /catalog show <kode> - Tampilkan kembali produk
+• /catalog rename <kode> <nama> - Ganti nama tampilan
+• /catalog category <kode> <kategori> - Atur kategori
+• /catalog sort <kode> <angka> - Atur urutan (lebih besar tampil lebih dulu)
+• /catalog feature <kode> - Tandai sebagai unggulan
+• /catalog unfeature <kode> - Hapus tanda unggulan
+• /catalog reset <kode> - Hapus semua override produk`
+
+func handleCatalogCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+
+	if len(args) == 0 {
+		sendMarkdownMessage(bot, chatID, catalogUsage)
+		return
+	}
+
+	action := strings.ToLower(args[0])
+	if action == "list" {
+		sendCatalogOverrideList(bot, chatID)
+		return
+	}
+
+	if len(args) < 2 {
+		sendMarkdownMessage(bot, chatID, catalogUsage)
+		return
+	}
+
+	packageCode := args[1]
+	value := strings.TrimSpace(strings.Join(args[2:], " "))
+
+	if action == "reset" {
+		if err := service.DeleteCatalogOverride(packageCode); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal reset override: %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Override untuk `%s` telah dihapus.", packageCode))
+		return
+	}
+
+	if _, err := service.GetCatalogPackage(packageCode); err != nil {
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Produk dengan kode %s tidak ditemukan di katalog.", packageCode))
+		return
+	}
+
+	var update func(*models.CatalogOverride)
+	switch action {
+	case "hide":
+		update = func(o *models.CatalogOverride) { o.Hidden = true }
+	case "show":
+		update = func(o *models.CatalogOverride) { o.Hidden = false }
+	case "feature":
+		update = func(o *models.CatalogOverride) { o.Featured = true }
+	case "unfeature":
+		update = func(o *models.CatalogOverride) { o.Featured = false }
+	case "rename":
+		update = func(o *models.CatalogOverride) { o.DisplayName = value }
+	case "category":
+		update = func(o *models.CatalogOverride) { o.Category = value }
+	case "sort":
+		weight, err := strconv.Atoi(value)
+		if err != nil {
+			sendErrorMessage(bot, chatID, "❌ Urutan harus berupa angka.")
+			return
+		}
+		update = func(o *models.CatalogOverride) { o.SortWeight = weight }
+	default:
+		sendMarkdownMessage(bot, chatID, catalogUsage)
+		return
+	}
+
+	override, err := service.UpdateCatalogOverride(packageCode, update)
+	if err != nil {
+		log.Printf("Error updating catalog override for %s: %v", packageCode, err)
+		sendErrorMessage(bot, chatID, "❌ Gagal menyimpan override katalog.")
+		return
+	}
+
+	sendMarkdownMessage(bot, chatID, "✅ *Override Disimpan*\n\n"+formatCatalogOverride(*override))
+}
+
+func sendCatalogOverrideList(bot *tgbotapi.BotAPI, chatID int64) {
+	overrides, err := service.GetCatalogOverrides()
+	if err != nil {
+		log.Printf("Error loading catalog overrides: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat override katalog.")
+		return
+	}
+
+	if len(overrides) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada override katalog.")
+		return
+	}
+
+	text := fmt.Sprintf("🗂️ *Override Katalog* (%d)\n\n", len(overrides))
+	for _, override := range overrides {
+		text += formatCatalogOverride(override) + "\n"
+	}
+
+	sendMarkdownMessage(bot, chatID, text)
+}
+
+func formatCatalogOverride(override models.CatalogOverride) string {
+	text := fmt.Sprintf("📦 `%s`\n", override.PackageCode)
+	if override.Hidden {
+		text += "   🙈 Disembunyikan\n"
+	}
+	if override.Featured {
+		text += "   ⭐ Unggulan\n"
+	}
+	if override.DisplayName != "" {
+		text += fmt.Sprintf("   🏷️ Nama: %s\n", override.DisplayName)
+	}
+	if override.Category != "" {
+		text += fmt.Sprintf("   🗂️ Kategori: %s\n", override.Category)
+	}
+	if override.SortWeight != 0 {
+		text += fmt.Sprintf("   🔢 Urutan: %d\n", override.SortWeight)
+	}
+	return text
+}
+
+func sendMarkdownMessage(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending message: %v", err)
+	}
+}
+
+// Ticket Functions
+
+const replyUsage = "↩️ *Balas Tiket*\n\n" +
+	"`/reply <tiket> <pesan>` - balas tiket user\n" +
+	"`/reply <tiket>` - pesan berikutnya (teks atau foto) menjadi balasan\n\n" +
+	"Anda juga bisa langsung reply pesan tiket di chat ini."
+
+const maxTicketThread = 10
+
+// ticketMessageContent returns the text and the largest photo of a ticket message
+func ticketMessageContent(message *tgbotapi.Message) (string, string) {
+	if len(message.Photo) > 0 {
+		// The last size is the largest
+		return message.Caption, message.Photo[len(message.Photo)-1].FileID
+	}
+	return message.Text, ""
+}
+
+// handleTicketsCommand lists the user's tickets; admins get the queue of tickets that
+// are not closed, or those of the status given as argument
+func handleTicketsCommand(bot *tgbotapi.BotAPI, chatID int64, args string) {
+	var tickets []models.Ticket
+	var err error
+	title := "🎫 *Tiket Saya*"
+	if config.IsAdmin(chatID) {
+		title = "🎫 *Antrian Tiket*"
+		switch status := strings.ToLower(strings.TrimSpace(args)); status {
+		case "":
+			if tickets, err = service.GetTickets(service.TicketOpen, 20); err == nil {
+				var pending []models.Ticket
+				pending, err = service.GetTickets(service.TicketPending, 20)
+				tickets = append(tickets, pending...)
+			}
+		case "all", "semua":
+			tickets, err = service.GetTickets("", 20)
+		case service.TicketOpen, service.TicketPending, service.TicketClosed:
+			tickets, err = service.GetTickets(status, 20)
+		default:
+			sendErrorMessage(bot, chatID, "❌ Status tidak dikenal. Gunakan: open, pending, closed atau all")
+			return
+		}
+	} else {
+		tickets, err = service.GetUserTickets(chatID, 10)
+	}
+	if err != nil {
+		log.Printf("Error getting tickets: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal mengambil daftar tiket.")
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, ticket := range tickets {
+		label := fmt.Sprintf("#%d %s %s", ticket.ID, strings.Fields(service.TicketStatusName(ticket.Status))[0], ticket.Subject)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("ticket:%d", ticket.ID)),
+		))
+	}
+
+	text := title + "\n\n"
+	if len(tickets) == 0 {
+		text += "Belum ada tiket."
+	} else {
+		text += "🟢 menunggu admin • 🟡 menunggu user • ⚪ ditutup\n\nPilih tiket untuk melihat percakapannya:"
+	}
+	if config.IsAdmin(chatID) {
+		text += "\n\n`/tickets open|pending|closed|all` - filter status"
+	} else {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➕ Tiket Baru", "contact_admin"),
+			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending ticket list: %v", err)
+	}
+}
+
+// handleTicketAction handles the ticket buttons: show (empty action), _reply, _close
+// and _assign. Users can only act on their own tickets.
+func handleTicketAction(bot *tgbotapi.BotAPI, chatID int64, action, idStr string) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ ID tiket tidak valid.")
+		return
+	}
+	ticket, err := service.GetTicket(uint(id))
+	isAdmin := config.IsAdmin(chatID)
+	if err == nil && !isAdmin && ticket.UserID != chatID {
+		err = fmt.Errorf("tiket #%d tidak ditemukan", id)
+	}
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+
+	switch action {
+	case "":
+		showTicket(bot, chatID, ticket)
+	case "_reply":
+		if ticket.Status == service.TicketClosed && ticket.UserID != chatID {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Tiket #%d sudah ditutup.", ticket.ID))
+			return
+		}
+		setTicketReply(chatID, ticket.ID)
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("↩️ *Balas Tiket #%d*\n\nKetik balasan Anda, atau kirim foto dengan keterangan:", ticket.ID))
+	case "_close":
+		if _, err := service.CloseTicket(bot, ticket.ID, chatID); err != nil {
+			sendErrorMessage(bot, chatID, "❌ "+err.Error())
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Tiket #%d ditutup.", ticket.ID))
+	case "_assign":
+		if !isAdmin {
+			return
+		}
+		if _, err := service.AssignTicket(bot, ticket.ID, chatID); err != nil {
+			sendErrorMessage(bot, chatID, "❌ "+err.Error())
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("🙋 Tiket #%d sekarang Anda tangani. Admin lain tidak lagi menerima pesannya.", ticket.ID))
+	}
+}
+
+// showTicket sends the latest messages of a ticket with its actions
+func showTicket(bot *tgbotapi.BotAPI, chatID int64, ticket *models.Ticket) {
+	messages, err := service.GetTicketMessages(ticket.ID)
+	if err != nil {
+		log.Printf("Error getting messages of ticket %d: %v", ticket.ID, err)
+		sendErrorMessage(bot, chatID, "❌ Gagal mengambil percakapan tiket.")
+		return
+	}
+	isAdmin := config.IsAdmin(chatID)
+
+	b := service.NewMessageBuilder(service.ParseModeMarkdownV2).
+		Raw("🎫 ").Bold(fmt.Sprintf("Tiket #%d", ticket.ID)).Raw("\n\n").
+		Field("📌", "Status", service.TicketStatusName(ticket.Status)).
+		Field("🕐", "Dibuat", ticket.CreatedAt.Format("02/01/2006 15:04"))
+	if isAdmin {
+		b.Field("👤", "User", fmt.Sprintf("%s - %d", ticket.UserName, ticket.UserID))
+		assignee := "-"
+		if ticket.AssignedTo != 0 {
+			assignee = fmt.Sprintf("%d", ticket.AssignedTo)
+		}
+		b.Field("🙋", "Ditangani", assignee)
+	}
+	if len(messages) > maxTicketThread {
+		b.Raw("\n").Italic(fmt.Sprintf("%d pesan sebelumnya tidak ditampilkan", len(messages)-maxTicketThread)).Raw("\n")
+		messages = messages[len(messages)-maxTicketThread:]
+	}
+	for _, message := range messages {
+		who := "👤 User"
+		if message.FromAdmin {
+			who = "👨‍💼 Admin"
+		}
+		b.Raw("\n").Bold(fmt.Sprintf("%s • %s", who, message.CreatedAt.Format("02/01 15:04"))).Raw("\n")
+		if message.PhotoID != "" {
+			b.Text("📷 [foto] ")
+		}
+		b.Text(message.Text).Raw("\n")
+	}
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if ticket.Status != service.TicketClosed || !isAdmin {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("↩️ Balas", fmt.Sprintf("ticket_reply:%d", ticket.ID)))
+	}
+	if isAdmin && ticket.Status != service.TicketClosed && ticket.AssignedTo != chatID {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("🙋 Ambil", fmt.Sprintf("ticket_assign:%d", ticket.ID)))
+	}
+	if ticket.Status != service.TicketClosed {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("✅ Tutup", fmt.Sprintf("ticket_close:%d", ticket.ID)))
+	}
+
+	msg := b.Message(chatID)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		buttons,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🎫 Semua Tiket", "tickets")),
+	)
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending ticket %d: %v", ticket.ID, err)
+	}
+}
+
+// handleReplyCommand handles /reply <ticket> [pesan]
+func handleReplyCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args := strings.TrimSpace(message.CommandArguments())
+	idStr, text, _ := strings.Cut(args, " ")
+	id, err := strconv.ParseUint(strings.TrimPrefix(idStr, "#"), 10, 64)
+	if err != nil {
+		sendMarkdownMessage(bot, chatID, replyUsage)
+		return
+	}
+
+	if strings.TrimSpace(text) == "" {
+		handleTicketAction(bot, chatID, "_reply", strconv.FormatUint(id, 10))
+		return
+	}
+	replyToTicket(bot, chatID, uint(id), &tgbotapi.Message{Text: text})
+}
+
+// handleTicketReplyInput sends the message after a ↩️ Balas tap to the ticket, as the
+// user's follow-up or as an admin's reply
+func handleTicketReplyInput(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message) {
+	ticketID := getTicketReply(chatID)
+	setUserState(chatID, "start")
+
+	ticket, err := service.GetTicket(ticketID)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+	if ticket.UserID != chatID && config.IsAdmin(chatID) {
+		replyToTicket(bot, chatID, ticket.ID, message)
+		return
+	}
+
+	text, photoID := ticketMessageContent(message)
+	if _, err := service.AddUserTicketMessage(bot, ticket.ID, chatID, text, photoID); err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+	sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Pesan ditambahkan ke tiket #%d. Admin akan segera membalas.", ticket.ID))
+}
+
+// replyToTicket sends an admin's message to the user of the ticket
+func replyToTicket(bot *tgbotapi.BotAPI, chatID int64, ticketID uint, message *tgbotapi.Message) {
+	text, photoID := ticketMessageContent(message)
+	if _, err := service.ReplyTicket(bot, ticketID, chatID, text, photoID); err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+	sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Balasan terkirim ke tiket #%d.", ticketID))
+}
+
+// Broadcast Functions
+
+const broadcastUsage = "📢 *Broadcast*\n\n" +
+	"`/broadcast <pesan>` - kirim pesan ke semua user atau satu segmen\n" +
+	"`/broadcasts` - lihat status broadcast terakhir\n\n" +
+	"Broadcast dikirim bertahap di latar belakang dan bisa dijeda, dilanjutkan, atau dibatalkan."
+
+const broadcastSegmentUsage = "✏️ *Segmen Kustom*\n\n" +
+	"Ketik kondisi segmen, dipisah spasi. Semua kondisi harus terpenuhi:\n\n" +
+	"`topup:30` - top up dalam 30 hari terakhir\n" +
+	"`balance:50000` - saldo minimal 50.000\n" +
+	"`vpn:7` - VPN habis dalam 7 hari\n" +
+	"`tier:reseller,agent` - tier harga\n" +
+	"`nopurchase` - belum pernah beli\n\n" +
+	"*Contoh:* `topup:30 tier:reseller`"
+
+const broadcastButtonsUsage = "🔘 *Tombol Broadcast*\n\n" +
+	"Ketik satu tombol per baris:\n\n" +
+	"`Beli sekarang | product:KODE_PAKET` - buka detail produk di bot\n" +
+	"`Info promo | https://example.com/promo` - buka link\n\n" +
+	"Ketik `hapus` untuk menghapus semua tombol."
+
+const broadcastScheduleUsage = "⏰ *Jadwalkan Broadcast*\n\n" +
+	"Ketik waktu kirim (WIB) dengan format `YYYY-MM-DD HH:MM`, opsional diikuti `harian` atau `mingguan` untuk mengulang.\n\n" +
+	"Membatalkan salah satu pengiriman broadcast berulang menghentikan seluruh pengulangannya.\n\n" +
+	"*Contoh:*\n`2025-01-31 19:00`\n`2025-01-31 08:00 harian`"
+
+func handleBroadcastCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	// Check if user is admin
+	if !config.IsAdmin(chatID) {
+		sendErrorMessage(bot, chatID, "❌ Anda tidak memiliki akses admin.")
+		return
+	}
+
+	// Keep the line breaks of the message
+	broadcastMessage := strings.TrimSpace(message.CommandArguments())
+	if broadcastMessage == "" {
+		sendMarkdownMessage(bot, chatID, broadcastUsage)
+		return
+	}
+
+	setBroadcastDraft(chatID, service.BroadcastContent{Message: broadcastMessage, ParseMode: service.ParseModeMarkdown})
+	showBroadcastSegments(bot, chatID)
+}
+
+func handleBroadcastRequest(bot *tgbotapi.BotAPI, chatID int64) {
+	setUserState(chatID, "waiting_broadcast_message")
+
+	text := `📢 *Broadcast Message*
+
+Silakan ketik pesan yang ingin Anda broadcast, atau kirim foto/dokumen dengan caption. Setelah itu Anda memilih segmen penerima, misalnya semua user, reseller, atau user yang top up 30 hari terakhir.
+
+*Tips:*
+• Gunakan format Markdown untuk formatting
+• Tombol (misalnya "Beli sekarang") dan jadwal kirim bisa ditambahkan sebelum mengirim
+• Gunakan Preview untuk melihat pesan persis seperti yang diterima user
+
+*Contoh:*
+🎉 *Promo Spesial GRN Store!*
+Dapatkan bonus 20% untuk top-up hari ini!`
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "admin_panel"),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending broadcast request: %v", err)
+		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
+	}
+}
+
+// handleBroadcastMessageInput takes the text, photo or document to broadcast
+func handleBroadcastMessageInput(bot *tgbotapi.BotAPI, chatID int64, message *tgbotapi.Message) {
+	content := service.BroadcastContent{Message: message.Text, ParseMode: service.ParseModeMarkdown}
+	switch {
+	case len(message.Photo) > 0:
+		// The last size is the largest
+		content.MediaType = service.BroadcastMediaPhoto
+		content.Media = message.Photo[len(message.Photo)-1].FileID
+		content.Message = message.Caption
+	case message.Document != nil:
+		content.MediaType = service.BroadcastMediaDocument
+		content.Media = message.Document.FileID
+		content.Message = message.Caption
+	}
+	if err := content.Validate(); err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+
+	// Reset user state
+	setUserState(chatID, "start")
+
+	// The draft is kept in the state; callback data is limited to 64 bytes
+	setBroadcastDraft(chatID, content)
+	showBroadcastSegments(bot, chatID)
+}
+
+// showBroadcastSegments lets the admin pick who receives the drafted broadcast, with the
+// size of each preset segment
+func showBroadcastSegments(bot *tgbotapi.BotAPI, chatID int64) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
+
+	text := "🎯 *Pilih Segmen Broadcast*\n\nPesan akan dikirim ke user yang termasuk segmen yang Anda pilih:"
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, preset := range service.BroadcastSegmentPresets {
+		count, err := service.CountBroadcastSegment(preset.Segment)
+		if err != nil {
+			log.Printf("Error counting segment %q: %v", preset.Segment.String(), err)
+			continue
+		}
+		spec := preset.Segment.String()
+		if spec == "" {
+			spec = "all"
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s (%d)", preset.Label, count), "bcseg:"+spec),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✏️ Segmen Kustom", "bcseg_custom")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "admin_panel")),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending broadcast segments: %v", err)
+		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
+	}
+}
+
+// handleBroadcastSegmentSelect stores the chosen segment and asks for confirmation
+func handleBroadcastSegmentSelect(bot *tgbotapi.BotAPI, chatID int64, spec string) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
+
+	segment, err := service.ParseBroadcastSegment(spec)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
+	count, err := service.CountBroadcastSegment(segment)
+	if err != nil {
+		log.Printf("Error counting segment %q: %v", spec, err)
+		sendErrorMessage(bot, chatID, "❌ Gagal menghitung user di segmen.")
+		return
+	}
+	if count == 0 {
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Tidak ada user di segmen %s.", segment.Describe()))
+		return
+	}
+
+	if !updateBroadcastDraft(chatID, func(draft *broadcastDraft) { draft.Segment = segment.String() }) {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
+		return
+	}
+	setUserState(chatID, "start")
+	showBroadcastConfirmation(bot, chatID)
+}
+
+// showBroadcastConfirmation shows the draft with its segment size, and the buttons to
+// send, preview, add buttons or schedule it
+func showBroadcastConfirmation(bot *tgbotapi.BotAPI, chatID int64) {
+	draft, ok := getBroadcastDraft(chatID)
+	if !ok {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
+		return
+	}
+
+	segment, _ := service.ParseBroadcastSegment(draft.Segment)
+	count, err := service.CountBroadcastSegment(segment)
+	if err != nil {
+		log.Printf("Error counting segment %q: %v", draft.Segment, err)
+	}
+
+	content := draft.Content
+	details := ""
+	if content.MediaType != "" {
+		details += fmt.Sprintf("*Media:* %s\n", content.MediaType)
+	}
+	if len(content.Buttons) > 0 {
+		labels := make([]string, len(content.Buttons))
+		for i, button := range content.Buttons {
+			labels[i] = service.EscapeMarkdown(button.Text)
+		}
+		details += fmt.Sprintf("*Tombol:* %s\n", strings.Join(labels, ", "))
+	}
 
 	// Confirm broadcast
 	text := fmt.Sprintf(`📢 *Konfirmasi Broadcast*
@@ -1763,13 +3375,22 @@ func handleBroadcastMessageInput(bot *tgbotapi.BotAPI, chatID int64, message str
 *Pesan yang akan dikirim:*
 %s
 
+%s*Segmen:* %s
 *Target:* %d user
 
-Apakah Anda yakin ingin mengirim broadcast ini?`, message, len(userIDs))
+Apakah Anda yakin ingin mengirim broadcast ini?`, content.Message, details, service.EscapeMarkdown(segment.Describe()), count)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("✅ Kirim Sekarang", fmt.Sprintf("send_broadcast:%s", message)),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Kirim Sekarang", "send_broadcast"),
+			tgbotapi.NewInlineKeyboardButtonData("👁️ Preview", "bcdraft_preview"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔘 Tombol", "bcdraft_buttons"),
+			tgbotapi.NewInlineKeyboardButtonData("⏰ Jadwalkan", "bcdraft_schedule"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🎯 Ganti Segmen", "bcseg_pick"),
 			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "admin_panel"),
 		),
 	)
@@ -1778,71 +3399,248 @@ Apakah Anda yakin ingin mengirim broadcast ini?`, message, len(userIDs))
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending broadcast confirmation: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
 }
 
-func handleSendBroadcast(bot *tgbotapi.BotAPI, chatID int64, message string) {
-	// Get all user IDs
-	userIDs := service.GetAllUserIDs()
+// handleBroadcastCustomSegment asks the admin to type a segment spec
+func handleBroadcastCustomSegment(bot *tgbotapi.BotAPI, chatID int64) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
+	setUserState(chatID, "waiting_broadcast_segment")
+	sendMarkdownMessage(bot, chatID, broadcastSegmentUsage)
+}
+
+// handleBroadcastDraftAction handles the preview, buttons and schedule buttons of the confirmation
+func handleBroadcastDraftAction(bot *tgbotapi.BotAPI, chatID int64, action string) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
+	draft, ok := getBroadcastDraft(chatID)
+	if !ok {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
+		return
+	}
+
+	switch action {
+	case "preview":
+		// Sent exactly as users will receive it, buttons included
+		if err := service.SendBroadcastPreview(bot, chatID, draft.Content); err != nil {
+			log.Printf("Error sending broadcast preview: %v", err)
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Preview gagal dikirim: %v", err))
+			return
+		}
+		showBroadcastConfirmation(bot, chatID)
+	case "buttons":
+		setUserState(chatID, "waiting_broadcast_buttons")
+		sendMarkdownMessage(bot, chatID, broadcastButtonsUsage)
+	case "schedule":
+		setUserState(chatID, "waiting_broadcast_schedule")
+		sendMarkdownMessage(bot, chatID, broadcastScheduleUsage)
+	}
+}
+
+// handleBroadcastButtonsInput sets the inline buttons of the draft
+func handleBroadcastButtonsInput(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	var buttons []service.BroadcastButton
+	if !strings.EqualFold(strings.TrimSpace(text), "hapus") {
+		var err error
+		buttons, err = service.ParseBroadcastButtons(text)
+		if err != nil {
+			sendErrorMessage(bot, chatID, "❌ "+err.Error())
+			return
+		}
+		for _, button := range buttons {
+			if button.Product == "" {
+				continue
+			}
+			if _, err := service.GetStorefrontEntry(button.Product); err != nil {
+				sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Produk %s tidak ditemukan.", button.Product))
+				return
+			}
+		}
+	}
 
-	if len(userIDs) == 0 {
-		sendErrorMessage(bot, chatID, "❌ Tidak ada user untuk broadcast.")
+	if !updateBroadcastDraft(chatID, func(draft *broadcastDraft) { draft.Content.Buttons = buttons }) {
+		setUserState(chatID, "start")
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
 		return
 	}
+	setUserState(chatID, "start")
+	showBroadcastConfirmation(bot, chatID)
+}
 
-	// Send broadcast
-	err := service.BroadcastMessage(bot, message, userIDs)
+// handleBroadcastScheduleInput schedules the draft for the time the admin typed
+func handleBroadcastScheduleInput(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	at, repeat, err := service.ParseBroadcastSchedule(text)
 	if err != nil {
-		log.Printf("Error broadcasting message: %v", err)
-		sendErrorMessage(bot, chatID, "❌ Gagal mengirim broadcast.")
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
 		return
 	}
+	setUserState(chatID, "start")
 
-	// Send confirmation to admin
-	confirmText := fmt.Sprintf(`✅ *Broadcast Berhasil Dikirim*
+	draft, ok := takeBroadcastDraft(chatID)
+	if !ok {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
+		return
+	}
+	segment, err := service.ParseBroadcastSegment(draft.Segment)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
 
-*Pesan:* %s
-*Target:* %d user
+	job, err := service.ScheduleBroadcastJob(draft.Content, chatID, segment, at, repeat)
+	if err != nil {
+		log.Printf("Error scheduling broadcast: %v", err)
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal menjadwalkan broadcast: %v", err))
+		return
+	}
+	postBroadcastProgress(bot, chatID, job)
+}
 
-Laporan detail akan dikirim setelah semua pesan terkirim.`, message, len(userIDs))
+func handleSendBroadcast(bot *tgbotapi.BotAPI, chatID int64) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
 
-	msg := tgbotapi.NewMessage(chatID, confirmText)
-	msg.ParseMode = "Markdown"
+	draft, ok := takeBroadcastDraft(chatID)
+	if !ok {
+		sendErrorMessage(bot, chatID, "❌ Tidak ada broadcast yang menunggu konfirmasi.")
+		return
+	}
+	segment, err := service.ParseBroadcastSegment(draft.Segment)
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
+		return
+	}
 
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending broadcast confirmation: %v", err)
+	job, err := service.CreateSegmentBroadcastJob(draft.Content, chatID, segment)
+	if err != nil {
+		log.Printf("Error queueing broadcast: %v", err)
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal membuat broadcast: %v", err))
+		return
 	}
+	postBroadcastProgress(bot, chatID, job)
 }
 
-// Product Detail Functions
+// postBroadcastProgress posts the live progress message of a job, which the worker keeps up to date
+func postBroadcastProgress(bot *tgbotapi.BotAPI, chatID int64, job *models.BroadcastJob) {
+	text, keyboard := service.BroadcastProgressMessage(job)
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = keyboard
 
-func handleProductDetail(bot *tgbotapi.BotAPI, chatID int64, productCode string) {
-	packages, err := service.FetchPackages()
+	sent, err := service.SendWithFallback(bot, msg)
 	if err != nil {
-		log.Printf("Error fetching packages: %v", err)
-		sendErrorMessage(bot, chatID, "❌ Maaf, gagal memuat detail produk.")
+		log.Printf("Error sending broadcast progress: %v", err)
 		return
 	}
+	if err := service.SetBroadcastProgressMessage(job.ID, chatID, sent.MessageID); err != nil {
+		log.Printf("Error saving broadcast progress message: %v", err)
+	}
+}
 
-	// Find the product
-	var selectedProduct *dto.Package
-	for _, p := range packages {
-		if p.PackageCode == productCode {
-			selectedProduct = &p
-			break
+// handleBroadcastsCommand lists the latest broadcast jobs
+func handleBroadcastsCommand(bot *tgbotapi.BotAPI, chatID int64) {
+	jobs, err := service.GetBroadcastJobs(10)
+	if err != nil {
+		log.Printf("Error loading broadcasts: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat broadcast.")
+		return
+	}
+	if len(jobs) == 0 {
+		sendMarkdownMessage(bot, chatID, "📭 Belum ada broadcast.\n\n"+broadcastUsage)
+		return
+	}
+
+	text := "📢 *Broadcast Terakhir*\n\n"
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, job := range jobs {
+		done := job.Sent + job.Failed + job.Blocked
+		if job.Status == service.BroadcastScheduled {
+			text += fmt.Sprintf("#%d %s - %s WIB, %s\n", job.ID, job.Status, job.ScheduledAt.In(service.BroadcastLocation).Format("02/01 15:04"), service.BroadcastRepeatName(job.Repeat))
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⏰ Broadcast #%d", job.ID), fmt.Sprintf("bc_show:%d", job.ID)),
+			))
+			continue
+		}
+		text += fmt.Sprintf("#%d %s - %d/%d terkirim, %s\n", job.ID, job.Status, job.Sent, job.Total, job.CreatedAt.Format("02/01 15:04"))
+		if done < job.Total && (job.Status == service.BroadcastRunning || job.Status == service.BroadcastQueued || job.Status == service.BroadcastPaused) {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📊 Broadcast #%d", job.ID), fmt.Sprintf("bc_show:%d", job.ID)),
+			))
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	if len(rows) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending broadcasts: %v", err)
+	}
+}
+
+// handleBroadcastControl handles the buttons of a broadcast progress message
+func handleBroadcastControl(bot *tgbotapi.BotAPI, chatID int64, action, idStr string) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return
+	}
+	jobID := uint(id)
+
+	switch action {
+	case "pause":
+		err = service.PauseBroadcastJob(jobID)
+	case "resume":
+		err = service.ResumeBroadcastJob(jobID)
+	case "cancel":
+		err = service.CancelBroadcastJob(jobID)
+	case "show":
+		// Post a new progress message in this chat and keep it up to date from now on
+		job, getErr := service.GetBroadcastJob(jobID)
+		if getErr != nil {
+			sendErrorMessage(bot, chatID, "❌ "+getErr.Error())
+			return
+		}
+		text, keyboard := service.BroadcastProgressMessage(job)
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = keyboard
+		if sent, sendErr := service.SendWithFallback(bot, msg); sendErr == nil {
+			service.SetBroadcastProgressMessage(jobID, chatID, sent.MessageID)
 		}
+		return
+	}
+	if err != nil {
+		sendErrorMessage(bot, chatID, "❌ "+err.Error())
 	}
+	service.RefreshBroadcastProgress(bot, jobID)
+}
+
+// Product Detail Functions
 
-	if selectedProduct == nil {
+func handleProductDetail(bot *tgbotapi.BotAPI, chatID int64, productCode string) {
+	entry, err := service.GetStorefrontEntry(productCode)
+	if err != nil {
+		log.Printf("Error looking up product %s: %v", productCode, err)
 		sendErrorMessage(bot, chatID, "❌ Produk tidak ditemukan.")
 		return
 	}
 
 	// Format product detail
-	text := formatProductDetail(selectedProduct)
+	text := formatProductDetail(chatID, &entry.Package)
+	if entry.Featured {
+		text = "⭐ *Produk Unggulan*\n\n" + text
+	}
 
 	// Create keyboard with buy option
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -1859,13 +3657,20 @@ func handleProductDetail(bot *tgbotapi.BotAPI, chatID int64, productCode string)
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending product detail: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan detail produk.")
 	}
 }
 
-func formatProductDetail(p *dto.Package) string {
+// formatProductDetail renders a package at the viewer's tier price
+func formatProductDetail(viewerID int64, p *dto.Package) string {
+	price := service.GetStartingPriceForUser(viewerID, p)
+	priceStr := formatPrice(price)
+	if retail := service.GetStartingPrice(p); price < retail {
+		priceStr = fmt.Sprintf("%s (harga %s, normal %s)", priceStr, service.TierName(service.GetUserTier(viewerID)), formatPrice(retail))
+	}
+
 	text := fmt.Sprintf(`📦 *Detail Produk - GRN Store*
 
 🏷️ *Nama:* %s
@@ -1875,7 +3680,7 @@ func formatProductDetail(p *dto.Package) string {
 📝 *Deskripsi:*
 %s
 
-`, p.PackageName, formatPrice(p.Price), p.PackageDescription)
+`, service.EscapeMarkdown(p.PackageName), priceStr, service.EscapeMarkdown(p.PackageDescription))
 
 	// Add features
 	text += "✨ *Fitur:*\n"
@@ -1944,7 +3749,7 @@ Untuk membeli produk lagi, Anda perlu login ulang dengan verifikasi OTP.`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending logout message: %v", err)
 		sendErrorMessage(bot, chatID, "Logout berhasil!")
 	}
@@ -1980,7 +3785,7 @@ Session login Anda telah berakhir. Silakan login ulang untuk melanjutkan pembeli
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending session expired message: %v", err)
 		}
 		return
@@ -1994,31 +3799,28 @@ Session login Anda telah berakhir. Silakan login ulang untuk melanjutkan pembeli
 	}
 
 	// Get product price for balance validation
-	packages, err := service.FetchPackages()
+	pkg, err := service.GetCatalogPackage(productCode)
 	if err != nil {
-		log.Printf("Error fetching packages for balance check: %v", err)
-		service.NotifyAdminError(chatID, "Package Fetch", fmt.Sprintf("Failed to fetch packages: %v", err))
-		sendErrorMessage(bot, chatID, "❌ Gagal memuat data produk. Silakan coba lagi.")
+		log.Printf("Product lookup failed for code %s: %v", productCode, err)
+		sendErrorMessage(bot, chatID, "❌ Produk tidak ditemukan. Silakan pilih produk lain.")
 		return
 	}
 
-	var packagePrice int64
-	var productName string
-	for _, pkg := range packages {
-		if pkg.PackageCode == productCode {
-			packagePrice = pkg.Price // Already includes +1500 from API
-			productName = pkg.PackageName
-			break
-		}
-	}
+	packagePrice := service.QuotePackagePriceForUser(chatID, pkg, paymentMethod).SellPrice
+	productName := pkg.PackageName
 
-	if productName == "" {
-		log.Printf("Product not found for code %s", productCode)
-		sendErrorMessage(bot, chatID, "❌ Produk tidak ditemukan. Silakan pilih produk lain.")
-		return
+	// Apply the voucher chosen earlier in the order, if any
+	voucherCode := getUserVoucher(chatID, service.VoucherScopePackage)
+	if voucherCode != "" {
+		_, discount, err := service.CheckVoucher(voucherCode, chatID, service.VoucherScopePackage, productCode, packagePrice)
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %s\n\nHapus voucher atau pilih metode pembayaran lain.", err.Error()))
+			return
+		}
+		packagePrice -= discount
 	}
 
-	// Check user balance against package price (already includes +1500 from API)
+	// Check user balance against the sell price for this payment method
 	balance := service.GetUserBalance(chatID)
 	if balance.Balance < packagePrice {
 		text := fmt.Sprintf(`❌ *Saldo Tidak Mencukupi*
@@ -2047,7 +3849,7 @@ Silakan top up saldo terlebih dahulu.`,
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending insufficient balance message: %v", err)
 		}
 		return
@@ -2055,20 +3857,20 @@ Silakan top up saldo terlebih dahulu.`,
 
 	// Send processing message
 	processingMsg := tgbotapi.NewMessage(chatID, "⏳ Memproses pembayaran, mohon tunggu...")
-	sentMsg, err := bot.Send(processingMsg)
+	sentMsg, err := service.SendWithFallback(bot, processingMsg)
 	if err != nil {
 		log.Printf("Error sending processing message: %v", err)
 	}
 
 	// Make purchase
-	purchaseResp, err := service.PurchaseProduct(chatID, productCode, paymentMethod)
+	purchaseResp, err := service.PurchaseProduct(chatID, productCode, paymentMethod, voucherCode)
 	if err != nil {
 		log.Printf("Error making purchase for user %d: %v", chatID, err)
 
 		// Delete processing message
 		if sentMsg.MessageID != 0 {
 			deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-			bot.Send(deleteMsg)
+			service.SendWithFallback(bot, deleteMsg)
 		}
 
 		// Show user-friendly error message (admin already notified by service)
@@ -2079,7 +3881,7 @@ Silakan top up saldo terlebih dahulu.`,
 	// Delete processing message
 	if sentMsg.MessageID != 0 {
 		deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-		bot.Send(deleteMsg)
+		service.SendWithFallback(bot, deleteMsg)
 	}
 
 	if !purchaseResp.Success {
@@ -2088,6 +3890,9 @@ Silakan top up saldo terlebih dahulu.`,
 		return
 	}
 
+	// The voucher is used up by this order
+	setUserVoucher(chatID, "", "")
+
 	// Validate response data
 	if purchaseResp.Data.TrxID == "" {
 		log.Printf("Empty transaction ID in purchase response for user %d", chatID)
@@ -2109,8 +3914,8 @@ Silakan top up saldo terlebih dahulu.`,
 }
 
 func handleDirectPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.PurchaseResponse) {
-	// Deduct user balance for all payment methods - use full price (original + 1500)
-	err := service.DeductUserBalance(chatID, purchaseResp.Data.Price)
+	// Deduct user balance for all payment methods - use the quoted sell price
+	err := service.ChargePurchase(chatID, purchaseResp)
 	if err != nil {
 		log.Printf("Error deducting balance for user %d: %v", chatID, err)
 		service.NotifyAdminError(chatID, "Balance Deduction", fmt.Sprintf("Failed to deduct balance for transaction %s: %v", purchaseResp.Data.TrxID, err))
@@ -2132,10 +3937,10 @@ func handleDirectPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.P
 %s
 
 Paket data akan segera aktif di nomor Anda.`,
-		purchaseResp.Data.PackageName,
+		service.EscapeMarkdown(purchaseResp.Data.PackageName),
 		formatPrice(purchaseResp.Data.PackageProcessingFee),
-		purchaseResp.Data.DeeplinkData.PaymentMethod,
-		purchaseResp.Data.TrxID,
+		service.EscapeMarkdown(purchaseResp.Data.DeeplinkData.PaymentMethod),
+		service.EscapeMarkdown(purchaseResp.Data.TrxID),
 		formatPrice(balance.Balance),
 		purchaseResp.Message)
 
@@ -2152,7 +3957,7 @@ Paket data akan segera aktif di nomor Anda.`,
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending purchase success message: %v", err)
 	}
 
@@ -2180,7 +3985,7 @@ Paket data telah berhasil diproses.`,
 		purchaseResp.Data.TrxID,
 		formatPrice(balance.Balance))
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 func handleQRISPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.PurchaseResponse) {
@@ -2192,8 +3997,8 @@ func handleQRISPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.Pur
 		}
 	}()
 
-	// Deduct user balance for QRIS payment - use full price (original + 1500)
-	err := service.DeductUserBalance(chatID, purchaseResp.Data.Price)
+	// Deduct user balance for QRIS payment - use the quoted sell price
+	err := service.ChargePurchase(chatID, purchaseResp)
 	if err != nil {
 		log.Printf("Error deducting balance for user %d: %v", chatID, err)
 		service.NotifyAdminError(chatID, "Balance Deduction", fmt.Sprintf("Failed to deduct balance for transaction %s: %v", purchaseResp.Data.TrxID, err))
@@ -2236,8 +4041,8 @@ func handleQRISPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.Pur
 3️⃣ Paket akan otomatis aktif setelah pembayaran berhasil
 
 ⚠️ *Penting:* QR code akan expired dalam %d detik. Segera lakukan pembayaran!`,
-		purchaseResp.Data.PackageName,
-		purchaseResp.Data.TrxID,
+		service.EscapeMarkdown(purchaseResp.Data.PackageName),
+		service.EscapeMarkdown(purchaseResp.Data.TrxID),
 		qrisData.RemainingTime,
 		qrisData.RemainingTime)
 
@@ -2255,7 +4060,7 @@ func handleQRISPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.Pur
 	)
 	photoMsg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(photoMsg); err != nil {
+	if _, err := service.SendWithFallback(bot, photoMsg); err != nil {
 		log.Printf("Error sending QRIS payment to user %d: %v", chatID, err)
 		service.NotifyAdminError(chatID, "Message Sending", fmt.Sprintf("Failed to send QRIS message: %v", err))
 		sendErrorMessage(bot, chatID, "❌ Gagal mengirim QR code. Silakan hubungi admin.")
@@ -2283,7 +4088,7 @@ User sedang melakukan pembayaran via QRIS.`,
 		formatPrice(purchaseResp.Data.PackageProcessingFee),
 		purchaseResp.Data.TrxID)
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 func handleDeeplinkPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto.PurchaseResponse) {
@@ -2295,8 +4100,8 @@ func handleDeeplinkPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto
 		}
 	}()
 
-	// Deduct user balance for deeplink payment - use full price (original + 1500)
-	err := service.DeductUserBalance(chatID, purchaseResp.Data.Price)
+	// Deduct user balance for deeplink payment - use the quoted sell price
+	err := service.ChargePurchase(chatID, purchaseResp)
 	if err != nil {
 		log.Printf("Error deducting balance for user %d: %v", chatID, err)
 		service.NotifyAdminError(chatID, "Balance Deduction", fmt.Sprintf("Failed to deduct balance for transaction %s: %v", purchaseResp.Data.TrxID, err))
@@ -2329,8 +4134,8 @@ func handleDeeplinkPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto
 
 ⚠️ *Penting:* Pastikan Anda memiliki saldo yang cukup di aplikasi %s.`,
 		paymentMethod,
-		purchaseResp.Data.PackageName,
-		purchaseResp.Data.TrxID,
+		service.EscapeMarkdown(purchaseResp.Data.PackageName),
+		service.EscapeMarkdown(purchaseResp.Data.TrxID),
 		paymentMethod,
 		paymentMethod,
 		paymentMethod)
@@ -2354,7 +4159,7 @@ func handleDeeplinkPayment(bot *tgbotapi.BotAPI, chatID int64, purchaseResp *dto
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending deeplink payment to user %d: %v", chatID, err)
 		service.NotifyAdminError(chatID, "Message Sending", fmt.Sprintf("Failed to send deeplink message: %v", err))
 		sendErrorMessage(bot, chatID, "❌ Gagal mengirim link pembayaran. Silakan hubungi admin.")
@@ -2384,6 +4189,12 @@ Silakan ketik kata kunci untuk mencari produk yang Anda inginkan.
 • Gunakan kata kunci yang spesifik
 • Bisa menggunakan nama operator
 • Bisa mencari berdasarkan jenis paket
+• Salah ketik sedikit tetap ditemukan ("akarb" → akrab)
+
+*Filter:*
+• max:50000 - harga maksimal
+• min:10000 - harga minimal
+• bayar:QRIS - metode pembayaran
 
 Ketik kata kunci pencarian:`
 
@@ -2397,7 +4208,7 @@ Ketik kata kunci pencarian:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending search request: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan.")
 	}
@@ -2433,16 +4244,18 @@ func handleSearchQueryInput(bot *tgbotapi.BotAPI, chatID int64, query string) {
 		return
 	}
 
-	// Search products with default parameters
-	searchResp, err := service.SearchProducts(query, 0, 1000000, "")
+	// Search the local catalog index
+	req := service.ParseSearchQuery(query)
+	req.UserID = chatID
+	results, err := service.SearchCatalog(req)
 	if err != nil {
 		log.Printf("Error searching products for user %d: %v", chatID, err)
-		service.NotifyAdminError(chatID, "Search API", fmt.Sprintf("Search failed for query '%s': %v", query, err))
+		service.NotifyAdminError(chatID, "Search", fmt.Sprintf("Search failed for query '%s': %v", query, err))
 		sendErrorMessage(bot, chatID, "❌ Maaf, pencarian gagal. Silakan coba lagi atau hubungi admin.")
 		return
 	}
 
-	if len(searchResp.Data) == 0 {
+	if len(results) == 0 {
 		text := fmt.Sprintf(`🔍 *Hasil Pencarian*
 
 Kata kunci: "%s"
@@ -2468,20 +4281,24 @@ Kata kunci: "%s"
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending search results: %v", err)
 		}
 		return
 	}
 
 	// Display search results
-	displaySearchResults(bot, chatID, query, searchResp.Data, 0)
+	displaySearchResults(bot, chatID, query, results, 0)
 }
 
-func displaySearchResults(bot *tgbotapi.BotAPI, chatID int64, query string, products []dto.Package, page int) {
+func displaySearchResults(bot *tgbotapi.BotAPI, chatID int64, query string, results []service.CatalogEntry, page int) {
 	pageSize := 5 // Smaller page size for search results
-	total := len(products)
+	total := len(results)
 	start := page * pageSize
+	if start >= total || start < 0 {
+		page = 0
+		start = 0
+	}
 	end := start + pageSize
 	if end > total {
 		end = total
@@ -2496,21 +4313,15 @@ Halaman: %d dari %d
 `, query, total, page+1, (total+pageSize-1)/pageSize)
 
 	var rows [][]tgbotapi.InlineKeyboardButton
-	for i, p := range products[start:end] {
-		// Store in packageMap for later use
-		packageMap[p.PackageCode] = service.PackageAlias{Name: p.PackageName, Price: p.Price}
-
-		displayName := p.PackageNameAliasShort
-		if displayName == "" {
-			displayName = p.PackageName
-		}
+	for i, entry := range results[start:end] {
+		displayName := entry.DisplayName
 
 		if len(displayName) > 45 {
 			displayName = displayName[:42] + "..."
 		}
 
-		btnText := fmt.Sprintf("%d. %s - %s", start+i+1, displayName, formatPrice(p.Price))
-		btn := tgbotapi.NewInlineKeyboardButtonData(btnText, "detail:"+p.PackageCode)
+		btnText := fmt.Sprintf("%d. %s - %s", start+i+1, displayName, formatPrice(service.GetStartingPriceForUser(chatID, &entry.Package)))
+		btn := tgbotapi.NewInlineKeyboardButtonData(btnText, "detail:"+entry.Package.PackageCode)
 		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
 	}
 
@@ -2541,7 +4352,7 @@ Halaman: %d dari %d
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending search results: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan hasil pencarian.")
 	}
@@ -2579,7 +4390,7 @@ Silakan verifikasi nomor HP Anda untuk login.`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending login required message: %v", err)
 		}
 		return
@@ -2614,7 +4425,7 @@ Mulai berbelanja sekarang untuk melihat history transaksi Anda.`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending empty history: %v", err)
 		}
 		return
@@ -2644,20 +4455,11 @@ Halaman: %d dari %d
 	for i, tx := range history[start:end] {
 		statusIcon := getStatusIcon(tx.Status)
 
-		// Recalculate price to ensure consistency (in case old transactions have wrong price)
-		var displayPrice int64
-		if packagePrice, err := service.GetPackagePrice(tx.PackageCode); err == nil {
-			displayPrice = packagePrice // Use current API price (includes +1500)
-		} else {
-			// Fallback to stored price if package lookup fails
-			displayPrice = tx.Price
-		}
-
 		btnText := fmt.Sprintf("%d. %s %s - %s",
 			start+i+1,
 			statusIcon,
 			tx.PackageName,
-			formatPrice(displayPrice))
+			formatPrice(tx.Price))
 
 		if len(btnText) > 60 {
 			btnText = btnText[:57] + "..."
@@ -2691,7 +4493,7 @@ Halaman: %d dari %d
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending purchase history: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan history.")
 	}
@@ -2738,28 +4540,30 @@ func handleCheckTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID st
 	// Format transaction status
 	data := checkResp.Data
 
-	// Get transaction from our database - use the stored price (from API that includes +1500)
+	// Get transaction from our database - the stored price is what the user was charged
 	dbTransaction, err := service.GetPurchaseTransaction(transactionID)
 	var displayPrice int64
 	if err != nil {
 		log.Printf("Warning: Could not get transaction from database: %v", err)
-		// Fallback: Try to get package price from API (already includes +1500)
-		if packagePrice, err := service.GetPackagePrice(data.Code); err == nil {
+		// Fallback: quote the current sell price, or show the upstream price if the package is gone
+		if packagePrice, err := service.GetPackagePrice(data.Code, data.Channel); err == nil {
 			displayPrice = packagePrice
 		} else {
-			// Last resort: default to 1500
-			displayPrice = 1500
+			displayPrice = data.Price
 		}
 		log.Printf("Using fallback price of %d for transaction %s", displayPrice, transactionID)
 	} else {
-		// Use stored price directly - it's from API that already includes +1500
 		displayPrice = dbTransaction.Price
 	}
 	var statusText string
 
-	if data.Status == 1 && data.RC == "00" {
+	outcome := service.PurchaseOutcome(&data)
+	switch outcome {
+	case "success":
 		statusText = "✅ *BERHASIL*"
-	} else {
+	case "pending":
+		statusText = "⏳ *DIPROSES*"
+	default:
 		statusText = "❌ *GAGAL*"
 	}
 
@@ -2786,9 +4590,12 @@ func handleCheckTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID st
 		data.RC,
 		data.RCMessage)
 
-	if data.Status == 1 && data.RC == "00" {
+	switch outcome {
+	case "success":
 		text += `✅ *Transaksi berhasil!* Paket data telah aktif di nomor Anda.`
-	} else {
+	case "pending":
+		text += `⏳ *Transaksi sedang diproses.* Silakan cek lagi beberapa saat lagi.`
+	default:
 		text += `❌ *Transaksi gagal.* Silakan hubungi admin jika ada masalah.`
 	}
 
@@ -2806,7 +4613,7 @@ func handleCheckTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID st
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending transaction status: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan status.")
 		return
@@ -2820,7 +4627,7 @@ func handleCheckTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID st
 	}
 
 	var whatsappStatus string
-	if data.Status == 1 && data.RC == "00" {
+	if outcome == "success" {
 		whatsappStatus = "BERHASIL"
 		// Only send notification for successful transactions to avoid spam
 		whatsappMsg := fmt.Sprintf(`✅ TRANSAKSI BERHASIL
@@ -2840,7 +4647,7 @@ Paket data telah berhasil diaktivasi.`,
 			data.DestinationMSISDN,
 			whatsappStatus)
 
-		service.SendWhatsAppNotification(whatsappMsg)
+		service.NotifyAdminActivity(whatsappMsg)
 	}
 }
 
@@ -2871,13 +4678,10 @@ func handleTransactionDetail(bot *tgbotapi.BotAPI, chatID int64, transactionID s
 	statusIcon := getStatusIcon(transaction.Status)
 	statusText := strings.ToUpper(transaction.Status)
 
-	// Recalculate price to ensure consistency (in case old transactions have wrong price)
-	var displayPrice int64
-	if packagePrice, err := service.GetPackagePrice(transaction.PackageCode); err == nil {
-		displayPrice = packagePrice // Use current API price (includes +1500)
-	} else {
-		// Fallback to stored price if package lookup fails
-		displayPrice = transaction.Price
+	// The stored price is the sell price that was actually charged
+	displayPrice := formatPrice(transaction.Price)
+	if transaction.VoucherCode != "" {
+		displayPrice += fmt.Sprintf(" (voucher `%s`, hemat %s)", transaction.VoucherCode, formatPrice(transaction.Discount))
 	}
 
 	text := fmt.Sprintf(`📋 *Detail Transaksi*
@@ -2892,10 +4696,10 @@ func handleTransactionDetail(bot *tgbotapi.BotAPI, chatID int64, transactionID s
 ⏰ *Waktu:* %s
 
 `, statusIcon, statusText,
-		transaction.ID,
-		transaction.PackageName,
-		formatPrice(displayPrice),
-		transaction.PaymentMethod,
+		service.EscapeMarkdown(transaction.ID),
+		service.EscapeMarkdown(transaction.PackageName),
+		displayPrice,
+		service.EscapeMarkdown(transaction.PaymentMethod),
 		transaction.PhoneNumber,
 		transaction.CreatedAt.Format("2006-01-02 15:04:05"))
 
@@ -2923,7 +4727,7 @@ func handleTransactionDetail(bot *tgbotapi.BotAPI, chatID int64, transactionID s
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending transaction detail: %v", err)
 		sendErrorMessage(bot, chatID, "Maaf, terjadi kesalahan saat menampilkan detail.")
 	}
@@ -2931,35 +4735,13 @@ func handleTransactionDetail(bot *tgbotapi.BotAPI, chatID int64, transactionID s
 
 // New professional functions
 func sendRulesMessage(bot *tgbotapi.BotAPI, chatID int64) {
-	text := `╔══════════════════════════╗
-║    📋 *PERATURAN BOT*    ║
-╚══════════════════════════╝
-
-ᴘᴇʀᴀᴛᴜʀᴀɴ ʙᴏᴛ
-1. ✧ ᴅɪʟᴀʀᴀɴɢ sᴘᴀᴍ ʙᴏᴛ
-2. ✧ ʙᴏᴛ ᴅɪᴀᴍ? ᴄᴏʙᴀ ʟᴀɢɪ sᴇᴛᴇʟᴀʜ ᴅᴇʟᴀʏ.  
-3. ✧ ᴘᴀsᴛɪᴋᴀɴ ɴᴏᴍᴏʀ / ɪᴅ sᴜᴅᴀʜ ʙᴇɴᴀʀ.  
-4. ✧ ᴅᴏʀ ɪɴᴛᴇʀɴᴇᴛ ᴛᴀɴᴘᴀ ɢᴀʀᴀɴsɪ.  
-5. ✧ ᴍᴇɴᴊᴜᴀʟ VPN ʙᴜᴋᴀɴ ᴄᴏɴꜰɪɢ.  
-6. ✧ ᴠɪʀᴛᴇx / ʙᴜɢ ᴅɪʟᴀʀᴀɴɢ
-7. ✧ ᴛᴇʟᴘᴏɴ ʙᴏᴛ = ʙʟᴏᴋɪʀ ᴘᴇʀᴍᴀɴᴇɴ.  
-8. ✧ ᴇʀʀᴏʀ? ʟᴀᴘᴏʀ ᴏᴡɴᴇʀ.  
-9. ✧ ʙᴏᴛ ʟᴀᴍʙᴀᴛ? ᴊᴀɴɢᴀɴ sᴘᴀᴍ.  
-10. ✧ ᴏʀᴅᴇʀ VPN / ᴘʀᴏᴅᴜᴋ ʟᴀɪɴ: ʜᴜʙᴜɴɢɪ ᴏᴡɴᴇʀ
-
-━━━━━━━━━━━━━━━━━━━━━━━━━━━━
-
-⚠️ *PENTING:*
-• Dengan menggunakan bot ini, Anda setuju dengan semua peraturan di atas
-• Pelanggaran dapat mengakibatkan pemblokiran permanen
-• Untuk pertanyaan lebih lanjut, hubungi admin
-
-🏪 *GRN Store - Terpercaya & Profesional*`
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "rules", nil)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🏠 Menu Utama", "main_menu"),
-			tgbotapi.NewInlineKeyboardButtonData("❓ Bantuan", "help"),
+			templateButton(lang, "button_main_menu", "main_menu"),
+			templateButton(lang, "button_help", "help"),
 		),
 	)
 
@@ -2967,11 +4749,140 @@ func sendRulesMessage(bot *tgbotapi.BotAPI, chatID int64) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending rules message: %v", err)
 	}
 }
 
+// templateButton is an inline button whose label is a template key
+func templateButton(lang, key, data string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(service.RenderTemplate(lang, key, nil), data)
+}
+
+func handleLanguageCommand(bot *tgbotapi.BotAPI, chatID int64) {
+	lang := service.GetUserLanguage(chatID)
+	text := service.RenderTemplate(lang, "language_prompt", map[string]string{"Current": service.LanguageName(lang)})
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, code := range service.SupportedLanguages() {
+		label := service.LanguageName(code)
+		if code == lang {
+			label = "✅ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "lang:"+code),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending language menu: %v", err)
+	}
+}
+
+func handleLanguageSelect(bot *tgbotapi.BotAPI, chatID int64, code string) {
+	if err := service.SetUserLanguage(chatID, code); err != nil {
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+		return
+	}
+
+	sendMarkdownMessage(bot, chatID, service.RenderTemplate(code, "language_changed", map[string]string{"Language": service.LanguageName(code)}))
+	showMainMenu(bot, chatID)
+}
+
+const templateUsage = "📝 *Template Pesan*\n\n" +
+	"*Penggunaan:*\n" +
+	"• /template - Daftar template per bahasa\n" +
+	"• /template lihat <bahasa> <key> - Tampilkan isi template\n" +
+	"• /template ubah <bahasa> <key>, isi template di baris berikutnya - Ganti teks template\n" +
+	"• /template reset <bahasa> <key> - Kembali ke teks bawaan\n\n" +
+	"Template memakai Go text/template, misalnya `{{.VoucherCode}}` atau `{{rupiah .MinAmount}}`. " +
+	"Key yang tidak ada di suatu bahasa memakai bahasa default."
+
+func handleTemplateCommand(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	// The body of "ubah" starts on the second line and may span many lines
+	firstLine, body, _ := strings.Cut(message.CommandArguments(), "\n")
+	args := strings.Fields(firstLine)
+
+	if len(args) == 0 {
+		sendTemplateList(bot, chatID)
+		return
+	}
+	if len(args) < 3 {
+		sendMarkdownMessage(bot, chatID, templateUsage)
+		return
+	}
+	lang, key := strings.ToLower(args[1]), args[2]
+
+	switch strings.ToLower(args[0]) {
+	case "lihat":
+		entries, err := service.GetMessageTemplates(lang)
+		if err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		for _, entry := range entries {
+			if entry.Key == key {
+				// Sent without parse mode so the template source is shown exactly
+				msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("%s/%s:\n\n%s", lang, key, entry.Body))
+				if _, err := service.SendWithFallback(bot, msg); err != nil {
+					log.Printf("Error sending template: %v", err)
+				}
+				return
+			}
+		}
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Template %s tidak dikenal", key))
+	case "ubah":
+		if err := service.SetMessageTemplate(lang, key, body, chatID); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Template `%s/%s` diperbarui.", lang, key))
+	case "reset":
+		if err := service.ResetMessageTemplate(lang, key); err != nil {
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %v", err))
+			return
+		}
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("✅ Template `%s/%s` kembali ke teks bawaan.", lang, key))
+	default:
+		sendMarkdownMessage(bot, chatID, templateUsage)
+	}
+}
+
+func sendTemplateList(bot *tgbotapi.BotAPI, chatID int64) {
+	entries, err := service.GetMessageTemplates("")
+	if err != nil {
+		log.Printf("Error loading templates: %v", err)
+		sendErrorMessage(bot, chatID, "❌ Gagal memuat template.")
+		return
+	}
+
+	keys := make(map[string][]string)
+	var languages []string
+	for _, entry := range entries {
+		if _, ok := keys[entry.Language]; !ok {
+			languages = append(languages, entry.Language)
+		}
+		key := "`" + entry.Key + "`"
+		if entry.Overridden {
+			key += " ✏️"
+		}
+		keys[entry.Language] = append(keys[entry.Language], key)
+	}
+
+	text := "📝 *Template Pesan*\n\n"
+	for _, lang := range languages {
+		text += fmt.Sprintf("*%s*\n%s\n\n", service.LanguageName(lang), strings.Join(keys[lang], ", "))
+	}
+	text += "✏️ = sudah diubah admin\n\n" + templateUsage
+
+	sendMarkdownMessage(bot, chatID, text)
+}
+
 func handleTopUpCommand(bot *tgbotapi.BotAPI, chatID int64) {
 	text := `╔══════════════════════════╗
 ║     💳 *TOP UP SALDO*    ║
@@ -3023,7 +4934,7 @@ func handleTopUpCommand(bot *tgbotapi.BotAPI, chatID int64) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending topup message: %v", err)
 	}
 }
@@ -3058,7 +4969,7 @@ Mulai berbelanja sekarang untuk melihat riwayat transaksi Anda!
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending empty history message: %v", err)
 		}
 		return
@@ -3071,15 +4982,16 @@ Mulai berbelanja sekarang untuk melihat riwayat transaksi Anda!
 func handleApproveTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID string) {
 	// Check if user is admin
 	if !config.IsAdmin(chatID) {
-		bot.Request(tgbotapi.NewCallback("", "❌ Anda tidak memiliki akses admin."))
+		sendErrorMessage(bot, chatID, "❌ Anda tidak memiliki akses admin.")
 		return
 	}
 
-	// Confirm transaction
+	// Confirm transaction; another admin or the API may have processed it already, the
+	// notice then shows who did
 	err := service.ConfirmTopUp(transactionID, chatID)
 	if err != nil {
 		log.Printf("Error confirming top up: %v", err)
-		bot.Request(tgbotapi.NewCallback("", "❌ Gagal approve transaksi."))
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal approve %s: %s", transactionID, err.Error()))
 		return
 	}
 
@@ -3107,54 +5019,95 @@ User telah mendapat notifikasi dan saldo telah ditambahkan.`,
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending approve confirmation: %v", err)
 	}
 }
 
-// handleRejectTransaction handles transaction rejection via inline button
+// handleRejectTransaction asks the admin why a top up is rejected, with one-tap reasons
 func handleRejectTransaction(bot *tgbotapi.BotAPI, chatID int64, transactionID string) {
 	// Check if user is admin
 	if !config.IsAdmin(chatID) {
-		bot.Request(tgbotapi.NewCallback("", "❌ Anda tidak memiliki akses admin."))
+		sendErrorMessage(bot, chatID, "❌ Anda tidak memiliki akses admin.")
 		return
 	}
 
-	// Reject transaction
-	err := service.RejectTopUp(transactionID, chatID)
-	if err != nil {
-		log.Printf("Error rejecting top up: %v", err)
-		bot.Request(tgbotapi.NewCallback("", "❌ Gagal reject transaksi."))
+	service.TxMutex.RLock()
+	tx, exists := service.Transactions[transactionID]
+	pending := exists && tx.Status == "pending"
+	service.TxMutex.RUnlock()
+	if !pending {
+		sendErrorMessage(bot, chatID, "❌ Transaksi tidak ditemukan atau sudah diproses.")
+		service.RefreshTopupNotices(bot, transactionID)
 		return
 	}
 
-	// Send success message
-	text := fmt.Sprintf(`❌ *Transaksi Berhasil Di-Reject*
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, reason := range service.TopupRejectReasons {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(reason, fmt.Sprintf("rejectr:%d:%s", i, transactionID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Tanpa alasan", "rejectr:x:"+transactionID),
+	))
 
-🆔 *Transaction ID:* `+"`%s`"+`
-👤 *Rejected by:* Admin
-⏰ *Waktu:* %s
+	setRejectReason(chatID, transactionID)
+	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ *Tolak Top Up*\n\n🆔 `%s`\n\nPilih alasan di bawah atau ketik alasan penolakan. Alasan dikirim ke user.", transactionID))
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
+		log.Printf("Error sending reject reasons: %v", err)
+	}
+}
 
-User telah mendapat notifikasi penolakan.`,
-		transactionID,
-		time.Now().Format("02/01/2006 15:04:05"))
+// handleRejectReasonSelect rejects a top up with a reason picked from TopupRejectReasons;
+// choice is the index of the reason, or "x" for none
+func handleRejectReasonSelect(bot *tgbotapi.BotAPI, chatID int64, choice, transactionID string) {
+	if !config.IsAdmin(chatID) {
+		return
+	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("📋 Lihat Pending", "admin_pending"),
-		),
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔙 Panel Admin", "admin_panel"),
-		),
-	)
+	var reason string
+	if i, err := strconv.Atoi(choice); err == nil && i >= 0 && i < len(service.TopupRejectReasons) {
+		reason = service.TopupRejectReasons[i]
+	}
+	setUserState(chatID, "start")
+	rejectTopUp(bot, chatID, transactionID, reason)
+}
 
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = keyboard
+// handleRejectReasonInput rejects the top up picked with the reject button, with the typed reason
+func handleRejectReasonInput(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	transactionID := getRejectReason(chatID)
+	setUserState(chatID, "start")
+	if !config.IsAdmin(chatID) || transactionID == "" {
+		showMainMenu(bot, chatID)
+		return
+	}
+	rejectTopUp(bot, chatID, transactionID, text)
+}
 
-	if _, err := bot.Send(msg); err != nil {
-		log.Printf("Error sending reject confirmation: %v", err)
+// handleAskPaymentProof asks the user of a top up for the transfer screenshot
+func handleAskPaymentProof(bot *tgbotapi.BotAPI, chatID int64, transactionID string) {
+	if !config.IsAdmin(chatID) {
+		sendErrorMessage(bot, chatID, "❌ Anda tidak memiliki akses admin.")
+		return
+	}
+
+	userID, err := service.RequestPaymentProof(bot, transactionID)
+	if err != nil {
+		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ Gagal meminta bukti: %s", err.Error()))
+		service.RefreshTopupNotices(bot, transactionID)
+		return
+	}
+
+	// The next photo the user sends is the transfer screenshot, unless they are busy with
+	// something else; then the button in the request switches them over
+	if !setUserStateIf(userID, "start", "waiting_payment_proof") {
+		sendMarkdownMessage(bot, chatID, fmt.Sprintf("📎 Permintaan bukti transfer untuk `%s` sudah dikirim ke user. User sedang di menu lain, jadi bukti baru diterima setelah user menekan tombol *Kirim Bukti Transfer*.", transactionID))
+		return
 	}
+	sendMarkdownMessage(bot, chatID, fmt.Sprintf("📎 Permintaan bukti transfer untuk `%s` sudah dikirim ke user.", transactionID))
 }
 
 // VPN Functions
@@ -3190,7 +5143,7 @@ Silakan top up saldo terlebih dahulu.`,
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending VPN insufficient balance: %v", err)
 		}
 		return
@@ -3242,7 +5195,7 @@ Beli sesuai kebutuhan - 1 hari, 7 hari, 30 hari, atau custom!`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN menu: %v", err)
 	}
 }
@@ -3250,6 +5203,7 @@ Beli sesuai kebutuhan - 1 hari, 7 hari, 30 hari, atau custom!`
 func handleVPNCreateStart(bot *tgbotapi.BotAPI, chatID int64, protocol string) {
 	// Store protocol in user state
 	setUserVPNData(chatID, protocol, "", "", "")
+	setUserVoucher(chatID, "", "")
 	setUserState(chatID, "waiting_vpn_email")
 
 	protocolName := map[string]string{
@@ -3282,7 +5236,7 @@ Ketik email Anda:`, protocolName[protocol])
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN create start: %v", err)
 	}
 }
@@ -3303,7 +5257,7 @@ Ketik email Anda:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid email message: %v", err)
 		}
 		return
@@ -3336,7 +5290,7 @@ Ketik password Anda:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN password request: %v", err)
 	}
 }
@@ -3357,7 +5311,7 @@ Ketik password Anda:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid password message: %v", err)
 		}
 		return
@@ -3402,7 +5356,7 @@ Ketik jumlah hari:`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN days request: %v", err)
 	}
 }
@@ -3421,7 +5375,7 @@ Ketik jumlah hari:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid days message: %v", err)
 		}
 		return
@@ -3437,7 +5391,7 @@ Ketik jumlah hari (1-365):`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending max days message: %v", err)
 		}
 		return
@@ -3460,6 +5414,20 @@ Ketik jumlah hari (1-365):`
 	// Calculate price
 	price := service.CalculateVPNPrice(days)
 
+	voucherCode := getUserVoucher(chatID, service.VoucherScopeVPN)
+	voucherLine := ""
+	if voucherCode != "" {
+		_, discount, err := service.CheckVoucher(voucherCode, chatID, service.VoucherScopeVPN, protocol, price)
+		if err != nil {
+			setUserVoucher(chatID, "", "")
+			voucherCode = ""
+			sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %s", err.Error()))
+		} else {
+			price -= discount
+			voucherLine = fmt.Sprintf("\n🎟️ *Voucher* `%s` - hemat %s", voucherCode, formatPrice(discount))
+		}
+	}
+
 	// Check balance
 	balance := service.GetUserBalance(chatID)
 	if balance.Balance < price {
@@ -3485,7 +5453,7 @@ Silakan top up saldo terlebih dahulu.`,
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending VPN insufficient balance: %v", err)
 		}
 		return
@@ -3505,24 +5473,25 @@ Silakan top up saldo terlebih dahulu.`,
 📧 *Email:* %s
 🔑 *Password:* %s
 📅 *Durasi:* %d hari
-💰 *Harga:* %s
+💰 *Harga:* %s%s
 💳 *Saldo Tersisa:* %s
 
 Apakah Anda yakin ingin membeli VPN ini?`,
-		protocolName[protocol], email, password, days, formatPrice(price), formatPrice(balance.Balance-price))
+		protocolName[protocol], service.EscapeMarkdown(email), service.EscapeMarkdown(password), days, formatPrice(price), voucherLine, formatPrice(balance.Balance-price))
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("✅ Ya, Beli Sekarang", fmt.Sprintf("vpn_confirm:%d", days)),
 			tgbotapi.NewInlineKeyboardButtonData("❌ Batal", "vpn_menu"),
 		),
+		tgbotapi.NewInlineKeyboardRow(voucherButton(voucherCode, fmt.Sprintf("%s:%d", service.VoucherScopeVPN, days))),
 	)
 
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN confirmation: %v", err)
 	}
 }
@@ -3555,7 +5524,7 @@ Buat VPN pertama Anda sekarang!`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending empty VPN list: %v", err)
 		}
 		return
@@ -3595,7 +5564,7 @@ Buat VPN pertama Anda sekarang!`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN list: %v", err)
 	}
 }
@@ -3628,7 +5597,7 @@ Buat VPN pertama Anda sekarang!`
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending empty VPN history: %v", err)
 		}
 		return
@@ -3653,7 +5622,7 @@ Buat VPN pertama Anda sekarang!`
    📅 %d hari - %s
    💰 %s - %s
 
-`, i+1, statusIcon, action, strings.ToUpper(tx.Protocol), tx.Days, formatPrice(tx.Price), tx.CreatedAt.Format("02/01/06"))
+`, i+1, statusIcon, action, strings.ToUpper(tx.Protocol), tx.Days, service.EscapeMarkdown(tx.Username), formatPrice(tx.Price), tx.CreatedAt.Format("02/01/06"))
 	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -3670,7 +5639,7 @@ Buat VPN pertama Anda sekarang!`
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN history: %v", err)
 	}
 }
@@ -3698,18 +5667,18 @@ func handleVPNConfirm(bot *tgbotapi.BotAPI, chatID int64, daysStr string) {
 
 	// Send processing message
 	processingMsg := tgbotapi.NewMessage(chatID, "⏳ Sedang membuat VPN Anda, mohon tunggu...")
-	sentMsg, err := bot.Send(processingMsg)
+	sentMsg, err := service.SendWithFallback(bot, processingMsg)
 	if err != nil {
 		log.Printf("Error sending processing message: %v", err)
 	}
 
 	// Create VPN
-	vpnTx, err := service.CreateVPNUser(chatID, "", email, password, protocol, days)
+	vpnTx, err := service.CreateVPNUser(chatID, "", email, password, protocol, days, getUserVoucher(chatID, service.VoucherScopeVPN))
 	if err != nil {
 		// Delete processing message
 		if sentMsg.MessageID != 0 {
 			deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-			bot.Send(deleteMsg)
+			service.SendWithFallback(bot, deleteMsg)
 		}
 
 		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %s", err.Error()))
@@ -3720,11 +5689,12 @@ func handleVPNConfirm(bot *tgbotapi.BotAPI, chatID int64, daysStr string) {
 	// Delete processing message
 	if sentMsg.MessageID != 0 {
 		deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-		bot.Send(deleteMsg)
+		service.SendWithFallback(bot, deleteMsg)
 	}
 
 	// Reset user state
 	setUserState(chatID, "start")
+	setUserVoucher(chatID, "", "")
 
 	// Get updated balance
 	balance := service.GetUserBalance(chatID)
@@ -3752,7 +5722,7 @@ func handleVPNConfirm(bot *tgbotapi.BotAPI, chatID int64, daysStr string) {
 %s
 
 🎉 VPN Anda sudah aktif dan siap digunakan!`,
-		strings.ToUpper(protocol), vpnTx.Username, password, days,
+		strings.ToUpper(protocol), service.EscapeMarkdown(vpnTx.Username), service.EscapeMarkdown(password), days,
 		formatPrice(vpnTx.Price), formatPrice(balance.Balance), configText)
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
@@ -3769,7 +5739,7 @@ func handleVPNConfirm(bot *tgbotapi.BotAPI, chatID int64, daysStr string) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN success message: %v", err)
 	}
 
@@ -3787,7 +5757,7 @@ VPN berhasil dibuat dan aktif.`,
 		chatID, strings.ToUpper(protocol), vpnTx.Username, days,
 		formatPrice(vpnTx.Price), formatPrice(balance.Balance))
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 func handleVPNDetail(bot *tgbotapi.BotAPI, chatID int64, vpnUsername string) {
@@ -3870,7 +5840,7 @@ func handleVPNDetail(bot *tgbotapi.BotAPI, chatID int64, vpnUsername string) {
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN detail: %v", err)
 	}
 }
@@ -3915,7 +5885,7 @@ Ketik jumlah hari:`, vpnUsername)
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN extend start: %v", err)
 	}
 }
@@ -3934,7 +5904,7 @@ Ketik jumlah hari:`
 		msg := tgbotapi.NewMessage(chatID, text)
 		msg.ParseMode = "Markdown"
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending invalid extend days: %v", err)
 		}
 		return
@@ -3985,7 +5955,7 @@ Silakan top up saldo terlebih dahulu.`,
 		msg.ParseMode = "Markdown"
 		msg.ReplyMarkup = keyboard
 
-		if _, err := bot.Send(msg); err != nil {
+		if _, err := service.SendWithFallback(bot, msg); err != nil {
 			log.Printf("Error sending VPN extend insufficient balance: %v", err)
 		}
 		return
@@ -3993,7 +5963,7 @@ Silakan top up saldo terlebih dahulu.`,
 
 	// Send processing message
 	processingMsg := tgbotapi.NewMessage(chatID, "⏳ Sedang memperpanjang VPN Anda, mohon tunggu...")
-	sentMsg, err := bot.Send(processingMsg)
+	sentMsg, err := service.SendWithFallback(bot, processingMsg)
 	if err != nil {
 		log.Printf("Error sending processing message: %v", err)
 	}
@@ -4004,7 +5974,7 @@ Silakan top up saldo terlebih dahulu.`,
 		// Delete processing message
 		if sentMsg.MessageID != 0 {
 			deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-			bot.Send(deleteMsg)
+			service.SendWithFallback(bot, deleteMsg)
 		}
 
 		sendErrorMessage(bot, chatID, fmt.Sprintf("❌ %s", err.Error()))
@@ -4015,7 +5985,7 @@ Silakan top up saldo terlebih dahulu.`,
 	// Delete processing message
 	if sentMsg.MessageID != 0 {
 		deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
-		bot.Send(deleteMsg)
+		service.SendWithFallback(bot, deleteMsg)
 	}
 
 	// Reset user state
@@ -4049,7 +6019,7 @@ Silakan top up saldo terlebih dahulu.`,
 	msg.ParseMode = "Markdown"
 	msg.ReplyMarkup = keyboard
 
-	if _, err := bot.Send(msg); err != nil {
+	if _, err := service.SendWithFallback(bot, msg); err != nil {
 		log.Printf("Error sending VPN extend success: %v", err)
 	}
 
@@ -4065,7 +6035,7 @@ Saldo Tersisa: %s
 VPN berhasil diperpanjang.`,
 		chatID, vpnUsername, days, formatPrice(price), formatPrice(balance.Balance))
 
-	service.SendWhatsAppNotification(whatsappMsg)
+	service.NotifyAdminActivity(whatsappMsg)
 }
 
 // formatVPNConfig formats VPN configuration from API response
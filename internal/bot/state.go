@@ -2,20 +2,28 @@ package bot
 
 import (
 	"log"
+	"strings"
 	"sync"
+
+	"github.com/nabilulilalbab/bottele/service"
 )
 
 // UserState untuk tracking state user
 type UserState struct {
-	State       string // "waiting_phone", "waiting_otp", "verified", "waiting_admin_message", etc
-	PhoneNumber string
-	AuthID      string
-	ProductCode string
-	VPNProtocol string
-	VPNEmail    string
-	VPNPassword string
-	VPNUsername string
-	mu          sync.RWMutex
+	State         string // "waiting_phone", "waiting_otp", "verified", "waiting_admin_message", etc
+	PhoneNumber   string
+	AuthID        string
+	ProductCode   string
+	VPNProtocol   string
+	VPNEmail      string
+	VPNPassword   string
+	VPNUsername   string
+	VoucherCode   string // voucher applied to the current order
+	VoucherTarget string // order the voucher belongs to: "package", "vpn:<days>" or "topup"
+	Broadcast     *broadcastDraft
+	TicketID      uint   // ticket answered by the next message in "waiting_ticket_reply"
+	TransactionID string // top up rejected with the next message in "waiting_reject_reason"
+	mu            sync.RWMutex
 }
 
 var userStates = make(map[int64]*UserState)
@@ -48,6 +56,30 @@ func setUserState(chatID int64, state string) {
 	}
 }
 
+// setUserStateIf moves a user to state only while they are in from, so a flow the user is
+// in the middle of is not cut off; it reports whether the state changed
+func setUserStateIf(chatID int64, from, state string) bool {
+	statesMutex.Lock()
+	defer statesMutex.Unlock()
+
+	userState, exists := userStates[chatID]
+	if !exists {
+		if from != "start" {
+			return false
+		}
+		userStates[chatID] = &UserState{State: state}
+		return true
+	}
+
+	userState.mu.Lock()
+	defer userState.mu.Unlock()
+	if userState.State != from {
+		return false
+	}
+	userState.State = state
+	return true
+}
+
 func setUserData(chatID int64, phone, authID, productCode string) {
 	statesMutex.Lock()
 	defer statesMutex.Unlock()
@@ -109,6 +141,110 @@ func setUserVPNData(chatID int64, protocol, email, password, username string) {
 	}
 }
 
+func setUserVoucher(chatID int64, code, target string) {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	userState.VoucherCode = code
+	userState.VoucherTarget = target
+	userState.mu.Unlock()
+}
+
+// getUserVoucher returns the voucher the user applied to an order of the given scope
+func getUserVoucher(chatID int64, scope string) string {
+	userState := getUserState(chatID)
+	userState.mu.RLock()
+	defer userState.mu.RUnlock()
+	
+	if userState.VoucherCode == "" || strings.SplitN(userState.VoucherTarget, ":", 2)[0] != scope {
+		return ""
+	}
+	return userState.VoucherCode
+}
+
+// broadcastDraft is a broadcast waiting for the admin's confirmation
+type broadcastDraft struct {
+	Content service.BroadcastContent
+	Segment string // segment spec, empty for every user
+}
+
+// setBroadcastDraft starts a new draft, dropping the segment of an earlier one
+func setBroadcastDraft(chatID int64, content service.BroadcastContent) {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	userState.Broadcast = &broadcastDraft{Content: content}
+	userState.mu.Unlock()
+}
+
+// updateBroadcastDraft changes the current draft; it reports false when there is none
+func updateBroadcastDraft(chatID int64, update func(draft *broadcastDraft)) bool {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	defer userState.mu.Unlock()
+
+	if userState.Broadcast == nil {
+		return false
+	}
+	update(userState.Broadcast)
+	return true
+}
+
+func getBroadcastDraft(chatID int64) (broadcastDraft, bool) {
+	userState := getUserState(chatID)
+	userState.mu.RLock()
+	defer userState.mu.RUnlock()
+
+	if userState.Broadcast == nil {
+		return broadcastDraft{}, false
+	}
+	return *userState.Broadcast, true
+}
+
+// takeBroadcastDraft returns the draft once, so a double tap on the confirm button
+// does not queue the broadcast twice
+func takeBroadcastDraft(chatID int64) (broadcastDraft, bool) {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	defer userState.mu.Unlock()
+
+	if userState.Broadcast == nil {
+		return broadcastDraft{}, false
+	}
+	draft := *userState.Broadcast
+	userState.Broadcast = nil
+	return draft, true
+}
+
+// setTicketReply makes the next message of the user or admin a reply to a ticket
+func setTicketReply(chatID int64, ticketID uint) {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	userState.State = "waiting_ticket_reply"
+	userState.TicketID = ticketID
+	userState.mu.Unlock()
+}
+
+func getTicketReply(chatID int64) uint {
+	userState := getUserState(chatID)
+	userState.mu.RLock()
+	defer userState.mu.RUnlock()
+	return userState.TicketID
+}
+
+func setRejectReason(chatID int64, transactionID string) {
+	userState := getUserState(chatID)
+	userState.mu.Lock()
+	userState.State = "waiting_reject_reason"
+	userState.TransactionID = transactionID
+	userState.mu.Unlock()
+}
+
+func getRejectReason(chatID int64) string {
+	userState := getUserState(chatID)
+	userState.mu.RLock()
+	defer userState.mu.RUnlock()
+	return userState.TransactionID
+}
+
 func clearUserState(chatID int64) {
 	statesMutex.Lock()
 	defer statesMutex.Unlock()
@@ -20,17 +20,20 @@ type User struct {
 
 // Transaction model untuk top-up transactions
 type Transaction struct {
-	ID          string     `gorm:"primaryKey" json:"id"`
-	UserID      int64      `gorm:"not null" json:"user_id"`
-	Username    string     `gorm:"not null" json:"username"`
-	Amount      int64      `gorm:"not null" json:"amount"`
-	Status      string     `gorm:"default:pending" json:"status"`
-	QRISCode    string     `json:"qris_code"`
-	CreatedAt   time.Time  `json:"created_at"`
-	ApprovedBy  *int64     `json:"approved_by"`
-	ApprovedAt  *time.Time `json:"approved_at"`
-	ExpiredAt   time.Time  `json:"expired_at"`
-	User        User       `gorm:"foreignKey:UserID;references:ChatID" json:"user"`
+	ID           string     `gorm:"primaryKey" json:"id"`
+	UserID       int64      `gorm:"not null" json:"user_id"`
+	Username     string     `gorm:"not null" json:"username"`
+	Amount       int64      `gorm:"not null" json:"amount"`
+	Status       string     `gorm:"default:pending" json:"status"`
+	QRISCode     string     `json:"qris_code"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ApprovedBy   *int64     `json:"approved_by"`
+	ApprovedAt   *time.Time `json:"approved_at"`
+	ExpiredAt    time.Time  `json:"expired_at"`
+	VoucherCode  string     `json:"voucher_code"`                  // top-up bonus voucher, redeemed on confirmation
+	BonusAmount  int64      `gorm:"default:0" json:"bonus_amount"` // bonus tier credit, locked in when the QRIS is created
+	RejectReason string     `json:"reject_reason"`                 // sent to the user with the rejection
+	User         User       `gorm:"foreignKey:UserID;references:ChatID" json:"user"`
 }
 
 // UserBalance model untuk saldo user
@@ -49,17 +52,31 @@ type PurchaseTransaction struct {
 	PackageName  string    `gorm:"not null" json:"package_name"`
 	PaymentMethod string   `gorm:"not null" json:"payment_method"`
 	PhoneNumber  string    `gorm:"not null" json:"phone_number"`
-	Price        int64     `gorm:"not null" json:"price"`
+	Price        int64     `gorm:"not null" json:"price"` // Sell price charged to the user
+	CostPrice    int64     `gorm:"default:0" json:"cost_price"` // Upstream price at the time of purchase
+	VoucherCode  string    `json:"voucher_code"`
+	Discount     int64     `gorm:"default:0" json:"discount"` // Voucher discount already taken off Price
 	Status       string    `gorm:"default:pending" json:"status"`
 	ResponseData string    `json:"response_data"` // JSON response from API
 	CreatedAt    time.Time `json:"created_at"`
 	User         User      `gorm:"foreignKey:UserID;references:ChatID" json:"user"`
 }
 
+// Margin returns the profit made on this purchase
+func (p PurchaseTransaction) Margin() int64 {
+	return p.Price - p.CostPrice
+}
+
 // ActiveUser model untuk tracking user interactions
 type ActiveUser struct {
 	UserID          int64     `gorm:"primaryKey" json:"user_id"`
 	LastInteraction time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_interaction"`
+	ReferredBy      int64     `gorm:"index;default:0" json:"referred_by"` // first-touch referrer chat ID
+	Campaign        string    `gorm:"index" json:"campaign"`              // first-touch campaign code
+	AttributedAt    *time.Time `json:"attributed_at"`
+	LanguageCode    string    `json:"language_code"` // language reported by the Telegram client
+	Language        string    `json:"language"`      // language chosen with /language, overrides LanguageCode
+	BlockedAt       *time.Time `json:"blocked_at"`   // set when a send fails because the user blocked the bot
 }
 
 // OTPSession model untuk tracking OTP sessions
@@ -83,6 +100,9 @@ type VPNTransaction struct {
 	Protocol     string    `gorm:"not null" json:"protocol"` // ssh, trojan, vless, vmess
 	Days         int       `gorm:"not null" json:"days"`
 	Price        int64     `gorm:"not null" json:"price"`
+	CostPrice    int64     `gorm:"default:0" json:"cost_price"` // VPN panel cost at the time of sale
+	VoucherCode  string    `json:"voucher_code"`
+	Discount     int64     `gorm:"default:0" json:"discount"`
 	Status       string    `gorm:"default:pending" json:"status"` // pending, success, failed
 	ResponseData string    `json:"response_data"` // JSON response from VPN API
 	CreatedAt    time.Time `json:"created_at"`
@@ -103,9 +123,336 @@ type VPNUser struct {
 	ExpiredAt    time.Time `gorm:"not null" json:"expired_at"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"` // soft delete keeps the account for history but out of lists and segments
 	User         User      `gorm:"foreignKey:UserID;references:ChatID" json:"user"`
 }
 
+// PricingRule model untuk aturan markup harga jual
+// Empty match fields act as wildcards; the most specific matching rule wins
+type PricingRule struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `json:"name"`
+	PackageCode   string    `gorm:"index" json:"package_code"`
+	NamePattern   string    `json:"name_pattern"` // case-insensitive substring of the package name
+	Category      string    `json:"category"`
+	PaymentMethod string    `json:"payment_method"`
+	MarkupType    string    `gorm:"not null" json:"markup_type"` // fixed, percent
+	MarkupValue   float64   `json:"markup_value"`
+	RoundTo       int64     `json:"round_to"` // round the sell price up to a multiple of this value
+	Priority      int       `json:"priority"` // tie-breaker between equally specific rules
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CatalogOverride model untuk pengaturan lokal tampilan produk upstream
+type CatalogOverride struct {
+	PackageCode string    `gorm:"primaryKey" json:"package_code"`
+	Hidden      bool      `json:"hidden"`
+	DisplayName string    `json:"display_name"`
+	SortWeight  int       `json:"sort_weight"` // higher weight is shown first
+	Category    string    `json:"category"`
+	Featured    bool      `json:"featured"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Campaign model untuk tracking link kampanye (/start c_<code>)
+type Campaign struct {
+	Code      string    `gorm:"primaryKey" json:"code"`
+	Name      string    `json:"name"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Referral model untuk relasi pengundang dan teman yang diundang
+type Referral struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ReferrerID      int64     `gorm:"index;not null" json:"referrer_id"`
+	RefereeID       int64     `gorm:"uniqueIndex;not null" json:"referee_id"`
+	Status          string    `gorm:"default:active" json:"status"` // active, blocked
+	BlockReason     string    `json:"block_reason"`                 // same_phone, rapid_churn
+	RewardedEvents  int       `json:"rewarded_events"`
+	TotalCommission int64     `json:"total_commission"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ReferralCommission model untuk komisi yang sudah dikreditkan ke saldo pengundang
+type ReferralCommission struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ReferralID uint      `gorm:"index;not null" json:"referral_id"`
+	ReferrerID int64     `gorm:"index;not null" json:"referrer_id"`
+	RefereeID  int64     `gorm:"not null" json:"referee_id"`
+	SourceType string    `gorm:"uniqueIndex:idx_commission_source;not null" json:"source_type"` // purchase, vpn, topup
+	SourceID   string    `gorm:"uniqueIndex:idx_commission_source;not null" json:"source_id"`
+	BaseAmount int64     `json:"base_amount"`
+	Amount     int64     `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Voucher model untuk kode promo diskon paket/VPN atau bonus top-up
+type Voucher struct {
+	Code             string     `gorm:"primaryKey" json:"code"`
+	Description      string     `json:"description"`
+	Scope            string     `gorm:"not null" json:"scope"`         // package, vpn, topup
+	DiscountType     string     `gorm:"not null" json:"discount_type"` // fixed, percent
+	DiscountValue    float64    `gorm:"not null" json:"discount_value"`
+	MaxDiscount      int64      `json:"max_discount"`      // Cap for percent vouchers, 0 = no cap
+	MinSpend         int64      `json:"min_spend"`         // Minimum price or top-up amount
+	EligibleProducts string     `json:"eligible_products"` // Comma separated package codes or VPN protocols, empty = all
+	MaxUses          int        `json:"max_uses"`          // Global cap, 0 = unlimited
+	MaxUsesPerUser   int        `json:"max_uses_per_user"` // 0 = unlimited
+	UsedCount        int        `json:"used_count"`
+	StartsAt         *time.Time `json:"starts_at"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	Active           bool       `json:"active"`
+	CreatedBy        int64      `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// VoucherRedemption model untuk pemakaian voucher per transaksi
+type VoucherRedemption struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	VoucherCode string    `gorm:"index;not null" json:"voucher_code"`
+	UserID      int64     `gorm:"index;not null" json:"user_id"`
+	Scope       string    `gorm:"not null" json:"scope"`
+	ProductCode string    `json:"product_code"`
+	SourceID    string    `gorm:"index" json:"source_id"` // Purchase, VPN or top-up transaction ID; empty while reserved
+	BaseAmount  int64     `json:"base_amount"`
+	Discount    int64     `json:"discount"` // Price reduction, or the bonus credited for top-up vouchers
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TopupBonusTier model untuk bonus saldo top up berdasarkan nominal
+type TopupBonusTier struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `json:"name"`
+	MinAmount  int64      `gorm:"not null" json:"min_amount"`
+	BonusType  string     `gorm:"not null" json:"bonus_type"` // fixed, percent
+	BonusValue float64    `gorm:"not null" json:"bonus_value"`
+	MaxBonus   int64      `json:"max_bonus"` // Cap for percent tiers, 0 = no cap
+	StartsAt   *time.Time `json:"starts_at"` // Campaign window, nil = open ended
+	EndsAt     *time.Time `json:"ends_at"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// UserTier model untuk level harga user (retail, reseller, agent)
+type UserTier struct {
+	UserID       int64     `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Tier         string    `gorm:"not null;index" json:"tier"`
+	AutoPromoted bool      `json:"auto_promoted"` // set by monthly spend rather than an admin
+	PromotedBy   int64     `json:"promoted_by"`   // admin chat ID, 0 when automatic or set through the API
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TierPrice model untuk daftar harga atau diskon khusus per tier
+type TierPrice struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Tier          string    `gorm:"not null;index" json:"tier"`
+	PackageCode   string    `gorm:"index" json:"package_code"` // empty = every package
+	Price         int64     `json:"price"`                      // fixed sell price, 0 = use the discount instead
+	DiscountType  string    `json:"discount_type"`              // fixed, percent
+	DiscountValue float64   `json:"discount_value"`
+	IsActive      bool      `json:"is_active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Partner model untuk reseller host-to-host (H2H) yang membeli lewat API
+type Partner struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"not null" json:"name"`
+	UserID         int64     `gorm:"uniqueIndex;not null" json:"user_id"` // bot user whose balance, session and tier are used
+	APIKeyHash     string    `gorm:"uniqueIndex;not null" json:"-"`       // SHA-256 of the API key, the key itself is shown once
+	APIKeyPrefix   string    `json:"api_key_prefix"`
+	CallbackSecret string    `json:"-"`           // HMAC key for callback signatures
+	CallbackURL    string    `json:"callback_url"`
+	AllowedIPs     string    `json:"allowed_ips"` // comma separated IPs or CIDRs, empty = any
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PartnerOrder model untuk pesanan H2H, unik per partner dan ref ID
+type PartnerOrder struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	PartnerID        uint       `gorm:"not null;uniqueIndex:idx_partner_ref" json:"partner_id"`
+	RefID            string     `gorm:"not null;uniqueIndex:idx_partner_ref" json:"ref_id"`
+	TrxID            string     `gorm:"index" json:"trx_id"`
+	PackageCode      string     `gorm:"not null" json:"package_code"`
+	PaymentMethod    string     `json:"payment_method"`
+	Price            int64      `json:"price"`
+	Status           string     `gorm:"not null;index" json:"status"` // processing, pending, success, failed
+	Message          string     `json:"message"`
+	CallbackStatus   string     `gorm:"index" json:"callback_status"` // empty until final, then pending, sent, failed
+	CallbackAttempts int        `json:"callback_attempts"`
+	NextCallbackAt   *time.Time `json:"next_callback_at"`
+	CallbackError    string     `json:"callback_error"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// WebhookSubscription model untuk endpoint yang menerima event bisnis
+type WebhookSubscription struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `gorm:"not null" json:"url"`
+	Secret     string    `json:"-"`           // HMAC key for the X-Signature header
+	EventTypes string    `json:"event_types"` // comma separated, "*" = every event
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery model untuk log pengiriman webhook per subscription
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscription_id"`
+	EventID        string     `gorm:"not null;index" json:"event_id"`
+	EventType      string     `gorm:"not null;index" json:"event_type"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"not null;index" json:"status"` // pending, sent, failed
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at"`
+	ResponseCode   int        `json:"response_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// OutboxMessage model untuk notifikasi yang menunggu dikirim oleh dispatcher
+type OutboxMessage struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Channel       string     `gorm:"not null;index" json:"channel"` // telegram, whatsapp, email, webhook
+	Recipient     string     `gorm:"not null" json:"recipient"`     // chat ID, phone number, email addresses or URL
+	Subject       string     `json:"subject"`
+	Message       string     `gorm:"type:text" json:"message"`
+	ParseMode     string     `json:"parse_mode"`
+	Status        string     `gorm:"not null;index" json:"status"` // pending, sent, dead
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// MessageTemplate model untuk teks template yang diubah admin, menimpa template bawaan
+type MessageTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Language  string    `gorm:"not null;uniqueIndex:idx_message_template" json:"language"`
+	Key       string    `gorm:"not null;uniqueIndex:idx_message_template" json:"key"`
+	Body      string    `gorm:"type:text" json:"body"`
+	UpdatedBy int64     `json:"updated_by"` // admin chat ID, 0 when edited through the API
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BroadcastJob model untuk broadcast yang dikirim bertahap oleh worker
+type BroadcastJob struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	Message           string     `gorm:"type:text" json:"message"` // text, or the caption of the media
+	ParseMode         string     `json:"parse_mode"`
+	MediaType         string     `json:"media_type"`                   // "", photo or document
+	Media             string     `json:"media"`                        // Telegram file_id or URL of the media
+	Buttons           string     `gorm:"type:text" json:"buttons"`     // JSON list of inline buttons
+	Segment           string     `json:"segment"`                      // segment spec such as "topup:30 tier:reseller", empty for every user
+	Status            string     `gorm:"not null;index" json:"status"` // scheduled, queued, running, paused, completed, cancelled
+	ScheduledAt       *time.Time `gorm:"index" json:"scheduled_at"`    // when a scheduled job starts
+	Repeat            string     `json:"repeat"`                       // "", daily or weekly; the next run is scheduled when this one starts
+	SeriesID          uint       `gorm:"index" json:"series_id"`       // first job of a repeating series, 0 on that job itself
+	Total             int        `json:"total"`
+	Sent              int        `json:"sent"`
+	Failed            int        `json:"failed"`
+	Blocked           int        `json:"blocked"`
+	CreatedBy         int64      `json:"created_by"`          // admin chat ID, 0 when created through the API
+	ProgressChatID    int64      `json:"progress_chat_id"`    // chat of the live progress message
+	ProgressMessageID int        `json:"progress_message_id"` // edited as the job advances
+	StartedAt         *time.Time `json:"started_at"`
+	FinishedAt        *time.Time `json:"finished_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// BroadcastRecipient model untuk status pengiriman broadcast per user
+type BroadcastRecipient struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	JobID         uint       `gorm:"not null;uniqueIndex:idx_broadcast_recipient;index:idx_broadcast_pending" json:"job_id"`
+	ChatID        int64      `gorm:"not null;uniqueIndex:idx_broadcast_recipient" json:"chat_id"`
+	Status        string     `gorm:"not null;index:idx_broadcast_pending" json:"status"` // pending, sent, failed, blocked
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LastError     string     `json:"last_error"`
+	SentAt        *time.Time `json:"sent_at"`
+}
+
+// Ticket model untuk percakapan support antara user dan admin
+type Ticket struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        int64      `gorm:"not null;index" json:"user_id"`
+	UserName      string     `json:"user_name"`                    // display name and username when the ticket was opened
+	Subject       string     `json:"subject"`                      // start of the first message
+	Status        string     `gorm:"not null;index" json:"status"` // open (waiting for an admin), pending (waiting for the user), closed
+	AssignedTo    int64      `gorm:"index" json:"assigned_to"`     // admin chat ID, 0 when unassigned
+	LastMessageAt time.Time  `json:"last_message_at"`
+	ClosedAt      *time.Time `json:"closed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TicketMessage model untuk satu pesan dalam tiket
+type TicketMessage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	TicketID  uint      `gorm:"not null;index" json:"ticket_id"`
+	SenderID  int64     `json:"sender_id"` // chat ID of the user or admin, 0 when sent through the API
+	FromAdmin bool      `json:"from_admin"`
+	Text      string    `gorm:"type:text" json:"text"`
+	PhotoID   string    `json:"photo_id"` // Telegram file_id of an attached photo
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TicketNotice model untuk pesan tiket yang dikirim ke chat admin, supaya reply ke pesan
+// itu masuk ke tiket yang benar
+type TicketNotice struct {
+	ID        uint  `gorm:"primaryKey"`
+	TicketID  uint  `gorm:"not null;index"`
+	ChatID    int64 `gorm:"not null;uniqueIndex:idx_ticket_notice"`
+	MessageID int   `gorm:"not null;uniqueIndex:idx_ticket_notice"`
+}
+
+// PaymentProof model untuk bukti transfer top up yang dikirim user. Hash disimpan
+// selamanya supaya gambar yang sama tidak bisa dipakai lagi, file gambarnya dihapus
+// setelah masa retensi.
+type PaymentProof struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	TransactionID string     `gorm:"not null;index" json:"transaction_id"`
+	UserID        int64      `gorm:"not null;index" json:"user_id"`
+	SHA256        string     `gorm:"not null;uniqueIndex" json:"sha256"`
+	FileID        string     `json:"file_id"` // Telegram file_id of the upload
+	Path          string     `json:"path"`    // local copy, empty once purged
+	Size          int64      `json:"size"`
+	PurgedAt      *time.Time `json:"purged_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// TopupNotice model untuk pesan top up yang dikirim ke chat admin (notifikasi approval
+// dan bukti transfer), supaya pesan itu bisa diedit setelah top up diproses
+type TopupNotice struct {
+	ID            uint   `gorm:"primaryKey"`
+	TransactionID string `gorm:"not null;index"`
+	ChatID        int64  `gorm:"not null"`
+	MessageID     int    `gorm:"not null"`
+	Kind          string `gorm:"not null"`  // approval, proof
+	Text          string `gorm:"type:text"` // original text or caption, MarkdownV2
+	ResolvedAt    *time.Time
+	CreatedAt     time.Time
+}
+
 // AutoMigrate runs database migrations
 func AutoMigrate(db *gorm.DB) error {
 	return db.AutoMigrate(
@@ -117,5 +464,28 @@ func AutoMigrate(db *gorm.DB) error {
 		&OTPSession{},
 		&VPNTransaction{},
 		&VPNUser{},
+		&PricingRule{},
+		&CatalogOverride{},
+		&Campaign{},
+		&Referral{},
+		&ReferralCommission{},
+		&Voucher{},
+		&VoucherRedemption{},
+		&TopupBonusTier{},
+		&UserTier{},
+		&TierPrice{},
+		&Partner{},
+		&PartnerOrder{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&OutboxMessage{},
+		&MessageTemplate{},
+		&BroadcastJob{},
+		&BroadcastRecipient{},
+		&Ticket{},
+		&TicketMessage{},
+		&TicketNotice{},
+		&PaymentProof{},
+		&TopupNotice{},
 	)
 }
\ No newline at end of file
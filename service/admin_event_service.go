@@ -0,0 +1,115 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+)
+
+// Admin feed event types, published next to the webhook events
+const (
+	EventTopupPending  = "topup.pending"
+	EventTopupRejected = "topup.rejected"
+	EventSystemError   = "system.error"
+)
+
+// adminEventQueue is how many events a subscriber may lag behind before it is dropped
+const adminEventQueue = 64
+
+// AdminEvent is one entry of the live admin dashboard feed
+type AdminEvent struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+var adminEvents = struct {
+	sync.Mutex
+	lastID      uint64
+	buffer      []AdminEvent
+	subscribers map[chan AdminEvent]struct{}
+}{
+	// IDs start at the boot time in milliseconds, so an ID a client kept from before a
+	// restart is older than the buffer and the client is told to reload
+	lastID:      uint64(time.Now().UnixMilli()),
+	subscribers: make(map[chan AdminEvent]struct{}),
+}
+
+// PublishAdminEvent adds an event to the admin feed and the resume buffer. A subscriber
+// that falls behind is disconnected and resumes from the buffer with Last-Event-ID.
+func PublishAdminEvent(eventType string, data interface{}) {
+	adminEvents.Lock()
+	defer adminEvents.Unlock()
+
+	adminEvents.lastID++
+	event := AdminEvent{ID: adminEvents.lastID, Type: eventType, CreatedAt: time.Now(), Data: data}
+
+	adminEvents.buffer = append(adminEvents.buffer, event)
+	if limit := config.GetAdminEventBuffer(); limit >= 0 && len(adminEvents.buffer) > limit {
+		adminEvents.buffer = append([]AdminEvent(nil), adminEvents.buffer[len(adminEvents.buffer)-limit:]...)
+	}
+
+	for ch := range adminEvents.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(adminEvents.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// AdminEventSubscription receives admin events until it is closed
+type AdminEventSubscription struct {
+	// Backlog holds the buffered events after the Last-Event-ID the client resumed from
+	Backlog []AdminEvent
+	// Reset is set when the events after Last-Event-ID are no longer buffered, so the
+	// client has to reload what it shows
+	Reset bool
+	// Events is closed when the subscription is closed or dropped for lagging behind
+	Events <-chan AdminEvent
+
+	ch chan AdminEvent
+}
+
+// SubscribeAdminEvents subscribes to the admin feed. lastEventID is the last event the
+// client saw, or 0 for a new client.
+func SubscribeAdminEvents(lastEventID uint64) *AdminEventSubscription {
+	adminEvents.Lock()
+	defer adminEvents.Unlock()
+
+	sub := &AdminEventSubscription{ch: make(chan AdminEvent, adminEventQueue)}
+	sub.Events = sub.ch
+
+	if lastEventID != 0 {
+		firstID := adminEvents.lastID + 1
+		if len(adminEvents.buffer) > 0 {
+			firstID = adminEvents.buffer[0].ID
+		}
+		if lastEventID+1 < firstID || lastEventID > adminEvents.lastID {
+			sub.Reset = true
+		} else {
+			for _, event := range adminEvents.buffer {
+				if event.ID > lastEventID {
+					sub.Backlog = append(sub.Backlog, event)
+				}
+			}
+		}
+	}
+
+	adminEvents.subscribers[sub.ch] = struct{}{}
+	return sub
+}
+
+// Close stops the subscription
+func (s *AdminEventSubscription) Close() {
+	adminEvents.Lock()
+	defer adminEvents.Unlock()
+
+	if _, ok := adminEvents.subscribers[s.ch]; ok {
+		delete(adminEvents.subscribers, s.ch)
+		close(s.ch)
+	}
+}
@@ -14,40 +14,6 @@ import (
 // Reference to variables from topup_service
 // These will be linked at runtime through import
 
-// SendMessageToAdmin mengirim pesan ke admin
-func SendMessageToAdmin(bot *tgbotapi.BotAPI, message string, fromUser *tgbotapi.User) error {
-	adminChatID := config.GetAdminChatID()
-	if adminChatID == 0 {
-		return fmt.Errorf("admin chat ID tidak dikonfigurasi")
-	}
-
-	// Format pesan untuk admin
-	adminMessage := fmt.Sprintf(`📩 *Pesan dari User*
-
-👤 *User:* %s (@%s)
-🆔 *User ID:* %d
-🕐 *Waktu:* %s
-
-💬 *Pesan:*
-%s`,
-		getUserDisplayName(fromUser),
-		fromUser.UserName,
-		fromUser.ID,
-		time.Now().Format("02/01/2006 15:04:05"),
-		message)
-
-	msg := tgbotapi.NewMessage(adminChatID, adminMessage)
-	msg.ParseMode = "Markdown"
-
-	_, err := bot.Send(msg)
-	if err != nil {
-		log.Printf("Error sending message to admin: %v", err)
-		return err
-	}
-
-	return nil
-}
-
 // SendAdminNotification mengirim notifikasi ke admin
 func SendAdminNotification(bot *tgbotapi.BotAPI, notification string) error {
 	adminChatID := config.GetAdminChatID()
@@ -58,7 +24,7 @@ func SendAdminNotification(bot *tgbotapi.BotAPI, notification string) error {
 	msg := tgbotapi.NewMessage(adminChatID, notification)
 	msg.ParseMode = "Markdown"
 
-	_, err := bot.Send(msg)
+	_, err := SendWithFallback(bot, msg)
 	if err != nil {
 		log.Printf("Error sending notification to admin: %v", err)
 		return err
@@ -67,41 +33,6 @@ func SendAdminNotification(bot *tgbotapi.BotAPI, notification string) error {
 	return nil
 }
 
-// BroadcastMessage mengirim pesan broadcast (hanya admin yang bisa)
-func BroadcastMessage(bot *tgbotapi.BotAPI, message string, userIDs []int64) error {
-	successCount := 0
-	failCount := 0
-
-	for _, userID := range userIDs {
-		msg := tgbotapi.NewMessage(userID, message)
-		msg.ParseMode = "Markdown"
-
-		_, err := bot.Send(msg)
-		if err != nil {
-			log.Printf("Error sending broadcast to user %d: %v", userID, err)
-			failCount++
-		} else {
-			successCount++
-		}
-	}
-
-	// Kirim laporan ke admin
-	report := fmt.Sprintf(`📊 *Laporan Broadcast*
-
-✅ Berhasil: %d user
-❌ Gagal: %d user
-📊 Total: %d user`, successCount, failCount, len(userIDs))
-
-	adminChatID := config.GetAdminChatID()
-	if adminChatID != 0 {
-		reportMsg := tgbotapi.NewMessage(adminChatID, report)
-		reportMsg.ParseMode = "Markdown"
-		bot.Send(reportMsg)
-	}
-
-	return nil
-}
-
 // GetAllUserIDs mendapatkan semua user ID yang pernah berinteraksi dengan bot
 func GetAllUserIDs() []int64 {
 	var userIDs []int64
@@ -117,8 +48,13 @@ func GetAllUserIDs() []int64 {
 	}
 	TxMutex.RUnlock()
 
-	// Also get from active users in database
+	// Also get from active users, in memory and in the database; the in-memory list is
+	// empty after a restart
 	activeUserIDs := GetAllUserIDsFromData()
+	var storedUserIDs []int64
+	if err := config.DB.Model(&models.ActiveUser{}).Pluck("user_id", &storedUserIDs).Error; err == nil {
+		activeUserIDs = append(activeUserIDs, storedUserIDs...)
+	}
 	for _, userID := range activeUserIDs {
 		if !userMap[userID] {
 			userIDs = append(userIDs, userID)
@@ -154,62 +90,66 @@ func GetAllTransactions() []*dto.Transaction {
 	return transactions
 }
 
-// GetUserStats mendapatkan statistik user untuk admin
+// GetUserStats mendapatkan statistik user untuk admin. Top up dihitung dari database,
+// karena map in-memory hanya berisi transaksi sejak bot terakhir dijalankan.
 func GetUserStats() string {
-	// Get transaction statistics
-	allTransactions := GetAllTransactions()
-	totalTransactions := len(allTransactions)
-	confirmedCount := 0
-	rejectedCount := 0
-	pendingCount := 0
-	expiredCount := 0
-	totalRevenue := int64(0)
-
-	for _, tx := range allTransactions {
-		switch tx.Status {
-		case "confirmed":
-			confirmedCount++
-			totalRevenue += tx.Amount
-		case "rejected":
-			rejectedCount++
-		case "pending":
-			pendingCount++
-		case "expired":
-			expiredCount++
-		}
+	var topups struct {
+		Total     int64
+		Confirmed int64
+		Pending   int64
+		Rejected  int64
+		Expired   int64
+		Amount    int64
+	}
+	// Expiry is only recorded in memory, so a pending top up past its expiry counts as expired
+	now := time.Now()
+	err := config.DB.Model(&models.Transaction{}).
+		Select(`COUNT(*) AS total,
+			COALESCE(SUM(CASE WHEN status = 'confirmed' THEN 1 ELSE 0 END), 0) AS confirmed,
+			COALESCE(SUM(CASE WHEN status = 'pending' AND expired_at >= ? THEN 1 ELSE 0 END), 0) AS pending,
+			COALESCE(SUM(CASE WHEN status = 'rejected' THEN 1 ELSE 0 END), 0) AS rejected,
+			COALESCE(SUM(CASE WHEN status = 'expired' OR (status = 'pending' AND expired_at < ?) THEN 1 ELSE 0 END), 0) AS expired,
+			COALESCE(SUM(CASE WHEN status = 'confirmed' THEN amount ELSE 0 END), 0) AS amount`, now, now).
+		Scan(&topups).Error
+	if err != nil {
+		log.Printf("Warning: Failed to load top up statistics: %v", err)
 	}
 
-	// Get user count from transactions
-	userIDs := GetAllUserIDs()
-	totalUsers := len(userIDs)
+	totalUsers := len(GetAllUserIDs())
+	var activeUsers int64
+	if err := config.DB.Model(&models.ActiveUser{}).
+		Where("last_interaction >= ?", now.AddDate(0, 0, -30)).
+		Count(&activeUsers).Error; err != nil {
+		log.Printf("Warning: Failed to count active users: %v", err)
+	}
 
 	return fmt.Sprintf(`📊 *Statistik Bot GRN Store*
 
 👥 *User Statistics:*
 • Total User: %d
-• User Aktif: %d
+• User Aktif (30 hari): %d
 
-💰 *Transaction Statistics:*
+💰 *Top Up Statistics:*
 • Total Transaksi: %d
 • ✅ Confirmed: %d
 • ⏳ Pending: %d
 • ❌ Rejected: %d
 • ⏰ Expired: %d
 
-💵 *Revenue Statistics:*
-• Total Revenue: %s
-• Rata-rata per Transaksi: %s
+💵 *Top Up Masuk:*
+• Total Top Up Masuk: %s
+• Rata-rata per Top Up: %s
 
-📈 *Status:* Real-time data`,
-		totalUsers,
+📈 Penjualan, modal dan margin: /report`,
 		totalUsers,
-		totalTransactions,
-		confirmedCount,
-		pendingCount,
-		rejectedCount,
-		expiredCount,
-		formatPrice(totalRevenue),
-		formatPrice(getAverageTransaction(totalRevenue, confirmedCount)))
+		activeUsers,
+		topups.Total,
+		topups.Confirmed,
+		topups.Pending,
+		topups.Rejected,
+		topups.Expired,
+		formatPrice(topups.Amount),
+		formatPrice(getAverageTransaction(topups.Amount, int(topups.Confirmed))))
 }
 
 func getAverageTransaction(total int64, count int) int64 {
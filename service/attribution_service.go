@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// campaignCodePattern keeps codes usable inside a /start payload (max 64 chars, [A-Za-z0-9_-])
+var campaignCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,40}$`)
+
+// CampaignReport summarizes the users acquired through a campaign and what they spent
+type CampaignReport struct {
+	Code            string `json:"code"`
+	Name            string `json:"name"`
+	Users           int64  `json:"users"`
+	Buyers          int64  `json:"buyers"`
+	Purchases       int64  `json:"purchases"`
+	PurchaseRevenue int64  `json:"purchase_revenue"`
+	TopUpAmount     int64  `json:"topup_amount"`
+}
+
+// RecordReferral attributes a new user to the referrer from a ref_<id> link.
+// Only users the bot has never seen before can be referred, and the first referral wins.
+func RecordReferral(userID, referrerID int64) error {
+	if referrerID == 0 || referrerID == userID {
+		return fmt.Errorf("invalid referrer")
+	}
+
+	var referrer models.ActiveUser
+	if err := config.DB.Where("user_id = ?", referrerID).First(&referrer).Error; err != nil {
+		return fmt.Errorf("referrer not found")
+	}
+
+	var existing models.ActiveUser
+	err := config.DB.Where("user_id = ?", userID).First(&existing).Error
+	if err == nil {
+		return fmt.Errorf("user already registered")
+	}
+	if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	now := time.Now()
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.ActiveUser{
+			UserID:          userID,
+			LastInteraction: now,
+			ReferredBy:      referrerID,
+			AttributedAt:    &now,
+		}).Error; err != nil {
+			return err
+		}
+		return createReferral(tx, referrerID, userID)
+	})
+}
+
+// RecordCampaign attributes a user to a campaign from a c_<code> link; the first campaign wins
+func RecordCampaign(userID int64, code string) error {
+	var campaign models.Campaign
+	if err := config.DB.Where("code = ?", code).First(&campaign).Error; err != nil {
+		return fmt.Errorf("campaign not found")
+	}
+
+	var existing models.ActiveUser
+	err := config.DB.Where("user_id = ?", userID).First(&existing).Error
+	now := time.Now()
+
+	if err == gorm.ErrRecordNotFound {
+		return config.DB.Create(&models.ActiveUser{
+			UserID:          userID,
+			LastInteraction: now,
+			Campaign:        campaign.Code,
+			AttributedAt:    &now,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if existing.Campaign != "" {
+		return nil
+	}
+
+	updates := map[string]interface{}{"campaign": campaign.Code}
+	if existing.AttributedAt == nil {
+		updates["attributed_at"] = now
+	}
+	return config.DB.Model(&models.ActiveUser{}).Where("user_id = ? AND (campaign = '' OR campaign IS NULL)", userID).Updates(updates).Error
+}
+
+// CreateCampaign registers a campaign code that can be shared as a deep link
+func CreateCampaign(code, name string, createdBy int64) (*models.Campaign, error) {
+	if !campaignCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("kode kampanye hanya boleh huruf, angka, _ atau - (maks 40 karakter)")
+	}
+
+	if name == "" {
+		name = code
+	}
+
+	campaign := models.Campaign{
+		Code:      code,
+		Name:      name,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+
+	if err := config.DB.Create(&campaign).Error; err != nil {
+		return nil, fmt.Errorf("kampanye %s sudah ada", code)
+	}
+	return &campaign, nil
+}
+
+// DeleteCampaign removes a campaign; users keep their attribution
+func DeleteCampaign(code string) error {
+	result := config.DB.Where("code = ?", code).Delete(&models.Campaign{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("kampanye tidak ditemukan")
+	}
+	return nil
+}
+
+// GetCampaignReports returns conversion numbers for every campaign
+func GetCampaignReports() ([]CampaignReport, error) {
+	var campaigns []models.Campaign
+	if err := config.DB.Order("created_at DESC").Find(&campaigns).Error; err != nil {
+		return nil, err
+	}
+
+	reports := make([]CampaignReport, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		report, err := GetCampaignReport(campaign)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// GetCampaignReport counts acquired users, buyers, purchases and top-ups for one campaign
+func GetCampaignReport(campaign models.Campaign) (*CampaignReport, error) {
+	report := &CampaignReport{Code: campaign.Code, Name: campaign.Name}
+
+	attributed := config.DB.Model(&models.ActiveUser{}).Select("user_id").Where("campaign = ?", campaign.Code)
+
+	if err := config.DB.Model(&models.ActiveUser{}).Where("campaign = ?", campaign.Code).Count(&report.Users).Error; err != nil {
+		return nil, err
+	}
+
+	purchases := config.DB.Model(&models.PurchaseTransaction{}).
+		Where("user_id IN (?) AND status <> ?", attributed, "failed")
+
+	if err := purchases.Session(&gorm.Session{}).Distinct("user_id").Count(&report.Buyers).Error; err != nil {
+		return nil, err
+	}
+
+	var purchaseTotals struct {
+		Count   int64
+		Revenue int64
+	}
+	if err := purchases.Session(&gorm.Session{}).Select("COUNT(*) AS count, COALESCE(SUM(price), 0) AS revenue").Scan(&purchaseTotals).Error; err != nil {
+		return nil, err
+	}
+	report.Purchases = purchaseTotals.Count
+	report.PurchaseRevenue = purchaseTotals.Revenue
+
+	if err := config.DB.Model(&models.Transaction{}).
+		Where("user_id IN (?) AND status = ?", attributed, "confirmed").
+		Select("COALESCE(SUM(amount), 0)").Scan(&report.TopUpAmount).Error; err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/nabilulilalbab/bottele/config"
 	"github.com/nabilulilalbab/bottele/dto"
 	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -138,8 +139,12 @@ func AddActiveUserToDB(userID int64) error {
 		LastInteraction: time.Now(),
 	}
 
-	// Upsert active user
-	return config.DB.Save(&activeUser).Error
+	// Upsert active user, touching only last_interaction so attribution fields are preserved;
+	// a user who talks to the bot again has unblocked it, so blocked_at is cleared
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_interaction", "blocked_at"}),
+	}).Create(&activeUser).Error
 }
 
 // GetAllUserIDsFromDB gets all user IDs from database
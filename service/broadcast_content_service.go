@@ -0,0 +1,275 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// Broadcast media types
+const (
+	BroadcastMediaPhoto    = "photo"
+	BroadcastMediaDocument = "document"
+)
+
+// Broadcast repeat intervals
+const (
+	BroadcastRepeatDaily  = "daily"
+	BroadcastRepeatWeekly = "weekly"
+)
+
+// Telegram limits for a message text and a media caption
+const (
+	maxBroadcastText    = 4096
+	maxBroadcastCaption = 1024
+	maxBroadcastButtons = 10
+)
+
+// BroadcastScheduleLayout is how admins type the time of a scheduled broadcast
+const BroadcastScheduleLayout = "2006-01-02 15:04"
+
+// BroadcastLocation is WIB, the time zone admins type and read broadcast schedules in,
+// whatever the server's local zone is
+var BroadcastLocation = loadBroadcastLocation()
+
+func loadBroadcastLocation() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Jakarta"); err == nil {
+		return loc
+	}
+	// No tz database on the host; WIB has no daylight saving
+	return time.FixedZone("WIB", 7*60*60)
+}
+
+// BroadcastButton is an inline button under a broadcast: a link, or a product opened
+// in the bot
+type BroadcastButton struct {
+	Text    string `json:"text"`
+	URL     string `json:"url,omitempty"`
+	Product string `json:"product,omitempty"`
+}
+
+// BroadcastContent is what a broadcast sends: text, or a photo or document with the
+// text as caption, and optional inline buttons
+type BroadcastContent struct {
+	Message   string            `json:"message"`
+	ParseMode string            `json:"parse_mode"`
+	MediaType string            `json:"media_type,omitempty"`
+	Media     string            `json:"media,omitempty"` // Telegram file_id or http(s) URL
+	Buttons   []BroadcastButton `json:"buttons,omitempty"`
+}
+
+// Validate checks the content against Telegram's limits before a job is created
+func (c BroadcastContent) Validate() error {
+	switch c.MediaType {
+	case "":
+		if strings.TrimSpace(c.Message) == "" {
+			return fmt.Errorf("pesan broadcast tidak boleh kosong")
+		}
+		if utf8.RuneCountInString(c.Message) > maxBroadcastText {
+			return fmt.Errorf("pesan broadcast maksimal %d karakter", maxBroadcastText)
+		}
+	case BroadcastMediaPhoto, BroadcastMediaDocument:
+		if c.Media == "" {
+			return fmt.Errorf("media broadcast tidak boleh kosong")
+		}
+		if utf8.RuneCountInString(c.Message) > maxBroadcastCaption {
+			return fmt.Errorf("caption media maksimal %d karakter", maxBroadcastCaption)
+		}
+	default:
+		return fmt.Errorf("jenis media tidak dikenal: %s (photo, document)", c.MediaType)
+	}
+
+	if len(c.Buttons) > maxBroadcastButtons {
+		return fmt.Errorf("maksimal %d tombol", maxBroadcastButtons)
+	}
+	for _, button := range c.Buttons {
+		if strings.TrimSpace(button.Text) == "" || (button.URL == "") == (button.Product == "") {
+			return fmt.Errorf("tombol %q harus punya teks dan salah satu dari url atau product", button.Text)
+		}
+		if button.URL != "" && !isButtonURL(button.URL) {
+			return fmt.Errorf("url tombol tidak valid: %s", button.URL)
+		}
+	}
+	return nil
+}
+
+// Chattable returns the message that delivers the content to a chat
+func (c BroadcastContent) Chattable(chatID int64) tgbotapi.Chattable {
+	var markup interface{}
+	if len(c.Buttons) > 0 {
+		markup = c.keyboard()
+	}
+
+	switch c.MediaType {
+	case BroadcastMediaPhoto:
+		photo := tgbotapi.NewPhoto(chatID, broadcastFile(c.Media))
+		photo.Caption = c.Message
+		photo.ParseMode = c.ParseMode
+		photo.ReplyMarkup = markup
+		return photo
+	case BroadcastMediaDocument:
+		document := tgbotapi.NewDocument(chatID, broadcastFile(c.Media))
+		document.Caption = c.Message
+		document.ParseMode = c.ParseMode
+		document.ReplyMarkup = markup
+		return document
+	default:
+		msg := tgbotapi.NewMessage(chatID, c.Message)
+		msg.ParseMode = c.ParseMode
+		msg.ReplyMarkup = markup
+		return msg
+	}
+}
+
+// keyboard lays the buttons out one per row; product buttons open the product detail
+func (c BroadcastContent) keyboard() tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, button := range c.Buttons {
+		if button.Product != "" {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(button.Text, "detail:"+button.Product),
+			))
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL(button.Text, button.URL),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func broadcastFile(media string) tgbotapi.RequestFileData {
+	if strings.HasPrefix(media, "http://") || strings.HasPrefix(media, "https://") {
+		return tgbotapi.FileURL(media)
+	}
+	return tgbotapi.FileID(media)
+}
+
+func isButtonURL(url string) bool {
+	return strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "tg://")
+}
+
+// ParseBroadcastButtons reads one button per line as "Text | https://..." for a link or
+// "Text | product:CODE" for a product opened in the bot
+func ParseBroadcastButtons(text string) ([]BroadcastButton, error) {
+	var buttons []BroadcastButton
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		label, target, ok := strings.Cut(line, "|")
+		label, target = strings.TrimSpace(label), strings.TrimSpace(target)
+		if !ok || label == "" || target == "" {
+			return nil, fmt.Errorf("format tombol salah: %s", line)
+		}
+
+		button := BroadcastButton{Text: label}
+		if code, isProduct := strings.CutPrefix(target, "product:"); isProduct {
+			button.Product = strings.TrimSpace(code)
+		} else {
+			button.URL = target
+		}
+		buttons = append(buttons, button)
+	}
+	if len(buttons) == 0 {
+		return nil, fmt.Errorf("tidak ada tombol")
+	}
+
+	if err := (BroadcastContent{Message: "-", Buttons: buttons}).Validate(); err != nil {
+		return nil, err
+	}
+	return buttons, nil
+}
+
+// ParseBroadcastSchedule reads "2006-01-02 15:04" in WIB, optionally followed
+// by "daily"/"harian" or "weekly"/"mingguan"
+func ParseBroadcastSchedule(text string) (time.Time, string, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return time.Time{}, "", fmt.Errorf("format jadwal salah, gunakan YYYY-MM-DD HH:MM")
+	}
+
+	at, err := time.ParseInLocation(BroadcastScheduleLayout, fields[0]+" "+fields[1], BroadcastLocation)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("format jadwal salah, gunakan YYYY-MM-DD HH:MM")
+	}
+	if !at.After(time.Now()) {
+		return time.Time{}, "", fmt.Errorf("jadwal harus di masa depan")
+	}
+
+	repeat := ""
+	if len(fields) > 2 {
+		repeat, err = NormalizeBroadcastRepeat(strings.Join(fields[2:], " "))
+		if err != nil {
+			return time.Time{}, "", err
+		}
+	}
+	return at, repeat, nil
+}
+
+// NormalizeBroadcastRepeat maps user input (including Indonesian names) to a repeat interval
+func NormalizeBroadcastRepeat(repeat string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(repeat)) {
+	case "", "none", "sekali":
+		return "", nil
+	case "daily", "harian":
+		return BroadcastRepeatDaily, nil
+	case "weekly", "mingguan":
+		return BroadcastRepeatWeekly, nil
+	}
+	return "", fmt.Errorf("pengulangan tidak dikenal: %s (daily, weekly)", repeat)
+}
+
+// broadcastRepeatInterval returns the time between runs of a repeating broadcast
+func broadcastRepeatInterval(repeat string) time.Duration {
+	switch repeat {
+	case BroadcastRepeatDaily:
+		return 24 * time.Hour
+	case BroadcastRepeatWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// BroadcastRepeatName returns the display name of a repeat interval
+func BroadcastRepeatName(repeat string) string {
+	switch repeat {
+	case BroadcastRepeatDaily:
+		return "setiap hari"
+	case BroadcastRepeatWeekly:
+		return "setiap minggu"
+	}
+	return "sekali"
+}
+
+// BroadcastJobContent returns what a job sends
+func BroadcastJobContent(job *models.BroadcastJob) BroadcastContent {
+	content := BroadcastContent{
+		Message:   job.Message,
+		ParseMode: job.ParseMode,
+		MediaType: job.MediaType,
+		Media:     job.Media,
+	}
+	if job.Buttons != "" {
+		if err := json.Unmarshal([]byte(job.Buttons), &content.Buttons); err != nil {
+			content.Buttons = nil
+		}
+	}
+	return content
+}
+
+// SendBroadcastPreview sends the content to one chat, so the admin sees exactly what
+// users will receive
+func SendBroadcastPreview(sender MessageSender, chatID int64, content BroadcastContent) error {
+	if err := content.Validate(); err != nil {
+		return err
+	}
+	_, err := SendWithFallback(sender, content.Chattable(chatID))
+	return err
+}
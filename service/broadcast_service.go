@@ -0,0 +1,666 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// Broadcast job statuses
+const (
+	BroadcastScheduled = "scheduled"
+	BroadcastQueued    = "queued"
+	BroadcastRunning   = "running"
+	BroadcastPaused    = "paused"
+	BroadcastCompleted = "completed"
+	BroadcastCancelled = "cancelled"
+)
+
+// Broadcast recipient statuses; blocked recipients blocked the bot or deleted their account
+const (
+	RecipientPending = "pending"
+	RecipientSent    = "sent"
+	RecipientFailed  = "failed"
+	RecipientBlocked = "blocked"
+)
+
+const (
+	broadcastMaxAttempts      = 3
+	broadcastBaseBackoff      = 5 * time.Second
+	broadcastMaxBackoff       = 5 * time.Minute
+	broadcastBatchSize        = 50
+	broadcastPollInterval     = 5 * time.Second
+	broadcastProgressInterval = 3 * time.Second
+)
+
+var (
+	broadcastWake    = make(chan struct{}, 1)
+	broadcastLimiter = &rateLimiter{chats: make(map[int64]time.Time)}
+)
+
+// rateLimiter spaces sends to stay under BROADCAST_RATE messages per second overall
+// and BROADCAST_CHAT_INTERVAL_MS between messages to one chat
+type rateLimiter struct {
+	mu    sync.Mutex
+	next  time.Time
+	chats map[int64]time.Time
+}
+
+// wait blocks until a message to chatID may be sent
+func (l *rateLimiter) wait(chatID int64) {
+	rate := config.GetBroadcastRate()
+	if rate <= 0 {
+		rate = 1
+	}
+	chatInterval := config.GetBroadcastChatInterval()
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if last, ok := l.chats[chatID]; ok && last.Add(chatInterval).After(at) {
+		at = last.Add(chatInterval)
+	}
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(time.Second / time.Duration(rate))
+	l.chats[chatID] = at
+
+	if len(l.chats) > 10000 {
+		for id, last := range l.chats {
+			if now.Sub(last) > chatInterval {
+				delete(l.chats, id)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// holdUntil stops every send until t, used for Telegram's retry_after
+func (l *rateLimiter) holdUntil(t time.Time) {
+	l.mu.Lock()
+	if t.After(l.next) {
+		l.next = t
+	}
+	l.mu.Unlock()
+}
+
+// CreateBroadcastJob queues a message for the given chats. Users flagged as having
+// blocked the bot are skipped. The worker sends it in the background.
+func CreateBroadcastJob(message, parseMode string, createdBy int64, chatIDs []int64) (*models.BroadcastJob, error) {
+	return createBroadcastJob(BroadcastContent{Message: message, ParseMode: parseMode}, createdBy, "", chatIDs)
+}
+
+// CreateSegmentBroadcastJob queues content for the users of a segment
+func CreateSegmentBroadcastJob(content BroadcastContent, createdBy int64, segment BroadcastSegment) (*models.BroadcastJob, error) {
+	if err := content.Validate(); err != nil {
+		return nil, err
+	}
+	chatIDs, err := ResolveBroadcastSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	if len(chatIDs) == 0 {
+		return nil, fmt.Errorf("tidak ada user di segmen %s", segment.Describe())
+	}
+	return createBroadcastJob(content, createdBy, segment.String(), chatIDs)
+}
+
+// ScheduleBroadcastJob stores content to be sent to a segment at a later time, once or
+// repeating. The recipients are resolved when the job starts, so a repeating broadcast
+// reaches the users in the segment at that moment.
+func ScheduleBroadcastJob(content BroadcastContent, createdBy int64, segment BroadcastSegment, at time.Time, repeat string) (*models.BroadcastJob, error) {
+	if err := content.Validate(); err != nil {
+		return nil, err
+	}
+	repeat, err := NormalizeBroadcastRepeat(repeat)
+	if err != nil {
+		return nil, err
+	}
+	if !at.After(time.Now()) {
+		return nil, fmt.Errorf("jadwal harus di masa depan")
+	}
+
+	job := newBroadcastJob(content, createdBy, segment.String())
+	job.Status = BroadcastScheduled
+	job.ScheduledAt = &at
+	job.Repeat = repeat
+	if err := config.DB.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func newBroadcastJob(content BroadcastContent, createdBy int64, segment string) *models.BroadcastJob {
+	job := &models.BroadcastJob{
+		Message:   content.Message,
+		ParseMode: content.ParseMode,
+		MediaType: content.MediaType,
+		Media:     content.Media,
+		Segment:   segment,
+		Status:    BroadcastQueued,
+		CreatedBy: createdBy,
+	}
+	if len(content.Buttons) > 0 {
+		buttons, _ := json.Marshal(content.Buttons)
+		job.Buttons = string(buttons)
+	}
+	return job
+}
+
+func createBroadcastJob(content BroadcastContent, createdBy int64, segment string, chatIDs []int64) (*models.BroadcastJob, error) {
+	if err := content.Validate(); err != nil {
+		return nil, err
+	}
+
+	recipients, err := broadcastRecipients(chatIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("tidak ada user untuk broadcast")
+	}
+
+	job := newBroadcastJob(content, createdBy, segment)
+	job.Total = len(recipients)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		return insertBroadcastRecipients(tx, job.ID, recipients)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	WakeBroadcastWorker()
+	return job, nil
+}
+
+// broadcastRecipients builds one pending recipient per chat, leaving out duplicates and
+// users flagged as having blocked the bot
+func broadcastRecipients(chatIDs []int64) ([]models.BroadcastRecipient, error) {
+	skip, err := blockedUserIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []models.BroadcastRecipient
+	for _, chatID := range chatIDs {
+		if chatID == 0 || skip[chatID] {
+			continue
+		}
+		skip[chatID] = true
+		recipients = append(recipients, models.BroadcastRecipient{ChatID: chatID, Status: RecipientPending})
+	}
+	return recipients, nil
+}
+
+func insertBroadcastRecipients(tx *gorm.DB, jobID uint, recipients []models.BroadcastRecipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	for i := range recipients {
+		recipients[i].JobID = jobID
+	}
+	return tx.CreateInBatches(recipients, 500).Error
+}
+
+// blockedUserIDs returns the users flagged as having blocked the bot
+func blockedUserIDs() (map[int64]bool, error) {
+	var ids []int64
+	if err := config.DB.Model(&models.ActiveUser{}).Where("blocked_at IS NOT NULL").Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	blocked := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		blocked[id] = true
+	}
+	return blocked, nil
+}
+
+// SetBroadcastProgressMessage records the message the worker keeps up to date with the job's progress
+func SetBroadcastProgressMessage(jobID uint, chatID int64, messageID int) error {
+	return config.DB.Model(&models.BroadcastJob{}).Where("id = ?", jobID).Updates(map[string]interface{}{
+		"progress_chat_id":    chatID,
+		"progress_message_id": messageID,
+	}).Error
+}
+
+// GetBroadcastJob returns a job with its current counters
+func GetBroadcastJob(id uint) (*models.BroadcastJob, error) {
+	var job models.BroadcastJob
+	if err := config.DB.First(&job, id).Error; err != nil {
+		return nil, fmt.Errorf("broadcast #%d tidak ditemukan", id)
+	}
+	return &job, nil
+}
+
+// GetBroadcastJobs returns the latest jobs
+func GetBroadcastJobs(limit int) ([]models.BroadcastJob, error) {
+	var jobs []models.BroadcastJob
+	err := config.DB.Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// PauseBroadcastJob stops a job after the message being sent; ResumeBroadcastJob continues it
+func PauseBroadcastJob(id uint) error {
+	return setBroadcastStatus(id, BroadcastPaused, []string{BroadcastQueued, BroadcastRunning}, "broadcast tidak sedang berjalan")
+}
+
+// ResumeBroadcastJob queues a paused job again
+func ResumeBroadcastJob(id uint) error {
+	if err := setBroadcastStatus(id, BroadcastQueued, []string{BroadcastPaused}, "broadcast tidak sedang dijeda"); err != nil {
+		return err
+	}
+	WakeBroadcastWorker()
+	return nil
+}
+
+// CancelBroadcastJob stops a job for good; recipients not reached yet stay pending and a
+// scheduled job does not run. Cancelling any run of a repeating broadcast stops the whole
+// series, including the next run already scheduled when this one started.
+func CancelBroadcastJob(id uint) error {
+	if err := setBroadcastStatus(id, BroadcastCancelled, []string{BroadcastScheduled, BroadcastQueued, BroadcastRunning, BroadcastPaused}, "broadcast sudah selesai"); err != nil {
+		return err
+	}
+
+	job, err := GetBroadcastJob(id)
+	if err != nil || job.Repeat == "" {
+		return err
+	}
+	series := broadcastSeriesID(job)
+	return config.DB.Model(&models.BroadcastJob{}).
+		Where("status = ? AND (id = ? OR series_id = ?)", BroadcastScheduled, series, series).
+		Updates(map[string]interface{}{"status": BroadcastCancelled, "finished_at": time.Now()}).Error
+}
+
+// broadcastSeriesID returns the first job of the series a repeating job belongs to
+func broadcastSeriesID(job *models.BroadcastJob) uint {
+	if job.SeriesID != 0 {
+		return job.SeriesID
+	}
+	return job.ID
+}
+
+func setBroadcastStatus(id uint, status string, from []string, notAllowed string) error {
+	updates := map[string]interface{}{"status": status}
+	if status == BroadcastCancelled {
+		updates["finished_at"] = time.Now()
+	}
+
+	result := config.DB.Model(&models.BroadcastJob{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := GetBroadcastJob(id); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", notAllowed)
+	}
+	return nil
+}
+
+// MarkUserBlocked flags a user whose chat rejected a message because the bot was
+// blocked; the flag is cleared when the user talks to the bot again
+func MarkUserBlocked(chatID int64) {
+	now := time.Now()
+	err := config.DB.Model(&models.ActiveUser{}).Where("user_id = ? AND blocked_at IS NULL", chatID).Update("blocked_at", &now).Error
+	if err != nil {
+		log.Printf("Warning: failed to flag user %d as blocked: %v", chatID, err)
+	}
+}
+
+// WakeBroadcastWorker makes the worker look for jobs without waiting for its ticker
+func WakeBroadcastWorker() {
+	select {
+	case broadcastWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartBroadcastWorker runs queued and interrupted broadcast jobs in the background.
+// Jobs that were running when the process stopped continue where they left off.
+func StartBroadcastWorker() {
+	go func() {
+		ticker := time.NewTicker(broadcastPollInterval)
+		defer ticker.Stop()
+
+		for {
+			if config.DB != nil && config.BotInstance != nil {
+				RunBroadcastWorker(config.BotInstance)
+			}
+			select {
+			case <-ticker.C:
+			case <-broadcastWake:
+			}
+		}
+	}()
+}
+
+// RunBroadcastWorker starts the scheduled jobs that are due and advances every queued or
+// running job, oldest first
+func RunBroadcastWorker(sender MessageSender) {
+	var due []models.BroadcastJob
+	config.DB.Where("status = ? AND scheduled_at <= ?", BroadcastScheduled, time.Now()).Order("scheduled_at ASC").Find(&due)
+	for i := range due {
+		if err := startScheduledBroadcast(sender, &due[i]); err != nil {
+			log.Printf("Broadcast #%d: failed to start scheduled run: %v", due[i].ID, err)
+		}
+	}
+
+	var jobs []models.BroadcastJob
+	config.DB.Select("id").Where("status IN ?", []string{BroadcastQueued, BroadcastRunning}).Order("id ASC").Find(&jobs)
+
+	for _, job := range jobs {
+		if err := RunBroadcastJob(sender, job.ID); err != nil {
+			log.Printf("Broadcast #%d: %v", job.ID, err)
+		}
+	}
+}
+
+// startScheduledBroadcast resolves the recipients of a due scheduled job and queues it.
+// A repeating job schedules its next run at the same time, so a missed run while the
+// bot was down is sent once rather than repeatedly.
+func startScheduledBroadcast(sender MessageSender, job *models.BroadcastJob) error {
+	segment, err := ParseBroadcastSegment(job.Segment)
+	if err != nil {
+		return err
+	}
+	chatIDs, err := ResolveBroadcastSegment(segment)
+	if err != nil {
+		return err
+	}
+	recipients, err := broadcastRecipients(chatIDs)
+	if err != nil {
+		return err
+	}
+
+	started := false
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"status": BroadcastQueued, "total": len(recipients)}
+		if len(recipients) == 0 {
+			now := time.Now()
+			updates["status"] = BroadcastCompleted
+			updates["started_at"] = now
+			updates["finished_at"] = now
+		}
+		result := tx.Model(&models.BroadcastJob{}).Where("id = ? AND status = ?", job.ID, BroadcastScheduled).Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		started = true
+
+		if err := insertBroadcastRecipients(tx, job.ID, recipients); err != nil {
+			return err
+		}
+
+		interval := broadcastRepeatInterval(job.Repeat)
+		if interval == 0 || job.ScheduledAt == nil {
+			return nil
+		}
+		next := *job.ScheduledAt
+		for !next.After(time.Now()) {
+			next = next.Add(interval)
+		}
+		repeat := newBroadcastJob(BroadcastJobContent(job), job.CreatedBy, job.Segment)
+		repeat.Status = BroadcastScheduled
+		repeat.ScheduledAt = &next
+		repeat.Repeat = job.Repeat
+		repeat.SeriesID = broadcastSeriesID(job)
+		return tx.Create(repeat).Error
+	})
+	if err != nil || !started {
+		return err
+	}
+
+	// The admin who scheduled it sees the run start, in the message posted when it was
+	// scheduled or, for a repeat, in a new one
+	if job.ProgressMessageID == 0 && job.CreatedBy != 0 {
+		job, err = GetBroadcastJob(job.ID)
+		if err != nil {
+			return err
+		}
+		text, keyboard := BroadcastProgressMessage(job)
+		msg := tgbotapi.NewMessage(job.CreatedBy, text)
+		msg.ParseMode = ParseModeMarkdown
+		msg.ReplyMarkup = keyboard
+		if sent, err := SendWithFallback(sender, msg); err == nil {
+			SetBroadcastProgressMessage(job.ID, job.CreatedBy, sent.MessageID)
+		}
+	} else {
+		refreshBroadcastProgress(sender, job.ID)
+	}
+	return nil
+}
+
+// RunBroadcastJob sends a job to its pending recipients whose next attempt is due. It
+// returns when the job is done, paused or cancelled, or only has retries left that are
+// not due yet.
+func RunBroadcastJob(sender MessageSender, jobID uint) error {
+	job, err := GetBroadcastJob(jobID)
+	if err != nil {
+		return err
+	}
+	if job.Status != BroadcastQueued && job.Status != BroadcastRunning {
+		return nil
+	}
+
+	updates := map[string]interface{}{"status": BroadcastRunning}
+	if job.StartedAt == nil {
+		updates["started_at"] = time.Now()
+	}
+	if err := config.DB.Model(job).Where("status IN ?", []string{BroadcastQueued, BroadcastRunning}).Updates(updates).Error; err != nil {
+		return err
+	}
+	refreshBroadcastProgress(sender, jobID)
+	lastProgress := time.Now()
+	content := BroadcastJobContent(job)
+
+	for {
+		var batch []models.BroadcastRecipient
+		err := config.DB.Where("job_id = ? AND status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", jobID, RecipientPending, time.Now()).
+			Order("id ASC").Limit(broadcastBatchSize).Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for i := range batch {
+			if status := broadcastStatus(jobID); status != BroadcastRunning {
+				refreshBroadcastProgress(sender, jobID)
+				return nil
+			}
+
+			broadcastLimiter.wait(batch[i].ChatID)
+			deliverBroadcast(sender, job.ID, content, &batch[i])
+
+			if time.Since(lastProgress) >= broadcastProgressInterval {
+				refreshBroadcastProgress(sender, jobID)
+				lastProgress = time.Now()
+			}
+		}
+	}
+
+	var pending int64
+	if err := config.DB.Model(&models.BroadcastRecipient{}).Where("job_id = ? AND status = ?", jobID, RecipientPending).Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending == 0 {
+		config.DB.Model(&models.BroadcastJob{}).Where("id = ? AND status = ?", jobID, BroadcastRunning).
+			Updates(map[string]interface{}{"status": BroadcastCompleted, "finished_at": time.Now()})
+	}
+	refreshBroadcastProgress(sender, jobID)
+	return nil
+}
+
+func broadcastStatus(jobID uint) string {
+	var job models.BroadcastJob
+	if err := config.DB.Select("status").First(&job, jobID).Error; err != nil {
+		return ""
+	}
+	return job.Status
+}
+
+// deliverBroadcast sends the job's message to one recipient and records the outcome
+// on the recipient and the job counters
+func deliverBroadcast(sender MessageSender, jobID uint, content BroadcastContent, r *models.BroadcastRecipient) {
+	_, err := SendWithFallback(sender, content.Chattable(r.ChatID))
+
+	now := time.Now()
+	counter := ""
+	if err == nil {
+		r.Attempts++
+		r.Status = RecipientSent
+		r.SentAt = &now
+		r.NextAttemptAt = nil
+		r.LastError = ""
+		counter = "sent"
+	} else {
+		r.LastError = err.Error()
+		retryAfter, blocked, permanent := classifyBroadcastError(err)
+		switch {
+		case retryAfter > 0:
+			// Flood control is not the recipient's fault, so the attempt is not counted
+			broadcastLimiter.holdUntil(now.Add(retryAfter))
+			next := now.Add(retryAfter)
+			r.NextAttemptAt = &next
+		case blocked:
+			r.Attempts++
+			r.Status = RecipientBlocked
+			r.NextAttemptAt = nil
+			counter = "blocked"
+			MarkUserBlocked(r.ChatID)
+		default:
+			r.Attempts++
+			if permanent || r.Attempts >= broadcastMaxAttempts {
+				r.Status = RecipientFailed
+				r.NextAttemptAt = nil
+				counter = "failed"
+			} else {
+				next := now.Add(exponentialBackoff(broadcastBaseBackoff, broadcastMaxBackoff, r.Attempts))
+				r.NextAttemptAt = &next
+			}
+		}
+		log.Printf("Broadcast #%d to %d failed (attempt %d): %v", jobID, r.ChatID, r.Attempts, err)
+	}
+
+	if saveErr := config.DB.Save(r).Error; saveErr != nil {
+		log.Printf("Warning: failed to save broadcast recipient %d: %v", r.ID, saveErr)
+	}
+	if counter != "" {
+		config.DB.Model(&models.BroadcastJob{}).Where("id = ?", jobID).Update(counter, gorm.Expr(counter+" + 1"))
+	}
+}
+
+// classifyBroadcastError reads Telegram's flood wait and tells apart users who blocked
+// the bot from other errors no retry will fix
+func classifyBroadcastError(err error) (retryAfter time.Duration, blocked, permanent bool) {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return 0, false, false
+	}
+	if tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second, false, false
+	}
+	return 0, tgErr.Code == 403, tgErr.Code == 400
+}
+
+// RefreshBroadcastProgress updates the live progress message of a job right away
+func RefreshBroadcastProgress(bot MessageSender, jobID uint) {
+	refreshBroadcastProgress(bot, jobID)
+}
+
+func refreshBroadcastProgress(sender MessageSender, jobID uint) {
+	job, err := GetBroadcastJob(jobID)
+	if err != nil || job.ProgressMessageID == 0 {
+		return
+	}
+
+	text, keyboard := BroadcastProgressMessage(job)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(job.ProgressChatID, job.ProgressMessageID, text, keyboard)
+	edit.ParseMode = ParseModeMarkdown
+	if _, err := SendWithFallback(sender, edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		log.Printf("Warning: failed to update progress of broadcast #%d: %v", jobID, err)
+	}
+}
+
+var broadcastStatusNames = map[string]string{
+	BroadcastScheduled: "⏰ Terjadwal",
+	BroadcastQueued:    "⏳ Menunggu",
+	BroadcastRunning:   "🚀 Berjalan",
+	BroadcastPaused:    "⏸️ Dijeda",
+	BroadcastCompleted: "✅ Selesai",
+	BroadcastCancelled: "✖️ Dibatalkan",
+}
+
+// BroadcastProgressMessage renders the progress of a job as Telegram Markdown, with the
+// buttons that control it
+func BroadcastProgressMessage(job *models.BroadcastJob) (string, tgbotapi.InlineKeyboardMarkup) {
+	done := job.Sent + job.Failed + job.Blocked
+	percent := 0
+	if job.Total > 0 {
+		percent = done * 100 / job.Total
+	}
+	bar := strings.Repeat("█", percent/10) + strings.Repeat("░", 10-percent/10)
+
+	segment := "semua user"
+	if parsed, err := ParseBroadcastSegment(job.Segment); err == nil {
+		segment = parsed.Describe()
+	}
+
+	text := fmt.Sprintf("📢 *Broadcast #%d* - %s\n🎯 Segmen: %s\n", job.ID, broadcastStatusNames[job.Status], EscapeMarkdown(segment))
+	if job.MediaType != "" {
+		text += fmt.Sprintf("📎 Media: %s\n", job.MediaType)
+	}
+	if job.ScheduledAt != nil {
+		text += fmt.Sprintf("⏰ Jadwal: %s WIB (%s)\n", job.ScheduledAt.In(BroadcastLocation).Format(BroadcastScheduleLayout), BroadcastRepeatName(job.Repeat))
+	}
+	if job.Status != BroadcastScheduled {
+		text += fmt.Sprintf(`
+✅ Terkirim: %d
+❌ Gagal: %d
+🚫 Memblokir bot: %d
+⏳ Sisa: %d dari %d
+
+%s %d%%`,
+			job.Sent, job.Failed, job.Blocked, job.Total-done, job.Total,
+			bar, percent)
+	}
+
+	id := fmt.Sprint(job.ID)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	switch job.Status {
+	case BroadcastScheduled:
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✖️ Batalkan", "bc_cancel:"+id),
+		))
+	case BroadcastQueued, BroadcastRunning:
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⏸️ Jeda", "bc_pause:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("✖️ Batalkan", "bc_cancel:"+id),
+		), tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", "bc_refresh:"+id),
+		))
+	case BroadcastPaused:
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ Lanjutkan", "bc_resume:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("✖️ Batalkan", "bc_cancel:"+id),
+		))
+	}
+	return text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: append([][]tgbotapi.InlineKeyboardButton{}, rows...)}
+}
@@ -0,0 +1,12 @@
+package service
+
+// ResetCaches drops the in-memory caches that are filled lazily from config.DB (user tiers,
+// tier prices, pricing rules, catalog overrides, template overrides and search results),
+// so the next use loads them from the current database. Call it after replacing config.DB.
+func ResetCaches() {
+	resetTierCache()
+	resetPricingRules()
+	resetCatalogOverrides()
+	invalidateTemplateOverrides()
+	resetSearchCache()
+}
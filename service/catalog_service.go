@@ -0,0 +1,209 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+)
+
+// catalogCache keeps the last upstream product list in memory
+type catalogCache struct {
+	mu         sync.RWMutex
+	packages   []dto.Package
+	byCode     map[string]dto.Package
+	fetchedAt  time.Time
+	version    uint64 // bumped on every successful refresh
+	refreshing bool
+	refreshMu  sync.Mutex
+}
+
+var catalog = &catalogCache{byCode: make(map[string]dto.Package)}
+
+// GetCatalog returns the cached catalog.
+// Fresh data is returned as-is, stale data is returned while a background refresh runs,
+// and an empty or too-old cache is refreshed synchronously.
+func GetCatalog() ([]dto.Package, error) {
+	catalog.mu.RLock()
+	packages := catalog.packages
+	age := time.Since(catalog.fetchedAt)
+	hasData := !catalog.fetchedAt.IsZero()
+	catalog.mu.RUnlock()
+
+	ttl := config.GetCatalogCacheTTL()
+	if hasData && age < ttl {
+		return packages, nil
+	}
+
+	if hasData && age < ttl+config.GetCatalogStaleTTL() {
+		refreshCatalogInBackground()
+		return packages, nil
+	}
+
+	if err := RefreshCatalog(); err != nil {
+		if hasData {
+			log.Printf("Warning: catalog refresh failed, serving stale data: %v", err)
+			return packages, nil
+		}
+		return nil, err
+	}
+
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return catalog.packages, nil
+}
+
+// GetCatalogPackage looks up a single package by its code
+func GetCatalogPackage(packageCode string) (*dto.Package, error) {
+	if _, err := GetCatalog(); err != nil {
+		return nil, err
+	}
+
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+
+	pkg, exists := catalog.byCode[packageCode]
+	if !exists {
+		return nil, fmt.Errorf("package not found")
+	}
+
+	return &pkg, nil
+}
+
+// RefreshCatalog fetches the catalog from upstream and replaces the cache
+func RefreshCatalog() error {
+	catalog.refreshMu.Lock()
+	defer catalog.refreshMu.Unlock()
+
+	packages, err := fetchPackagesFromAPI()
+	if err != nil {
+		return err
+	}
+
+	byCode := make(map[string]dto.Package, len(packages))
+	for _, pkg := range packages {
+		byCode[pkg.PackageCode] = pkg
+	}
+
+	catalog.mu.Lock()
+	catalog.packages = packages
+	catalog.byCode = byCode
+	catalog.fetchedAt = time.Now()
+	catalog.version++
+	catalog.mu.Unlock()
+
+	log.Printf("Catalog refreshed: %d packages", len(packages))
+	return nil
+}
+
+// ResetCatalogCache drops the cached catalog, so the next read fetches it again
+func ResetCatalogCache() {
+	catalog.refreshMu.Lock()
+	defer catalog.refreshMu.Unlock()
+
+	catalog.mu.Lock()
+	catalog.packages = nil
+	catalog.byCode = make(map[string]dto.Package)
+	catalog.fetchedAt = time.Time{}
+	catalog.version++
+	catalog.mu.Unlock()
+}
+
+// GetCatalogStatus returns the number of cached packages and when they were fetched
+func GetCatalogStatus() (int, time.Time) {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return len(catalog.packages), catalog.fetchedAt
+}
+
+// getCatalogVersion returns a counter that changes whenever the cached catalog is replaced
+func getCatalogVersion() uint64 {
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+	return catalog.version
+}
+
+// refreshCatalogInBackground starts a refresh unless one is already running
+func refreshCatalogInBackground() {
+	catalog.mu.Lock()
+	if catalog.refreshing {
+		catalog.mu.Unlock()
+		return
+	}
+	catalog.refreshing = true
+	catalog.mu.Unlock()
+
+	go func() {
+		defer func() {
+			catalog.mu.Lock()
+			catalog.refreshing = false
+			catalog.mu.Unlock()
+		}()
+
+		if err := RefreshCatalog(); err != nil {
+			log.Printf("Warning: background catalog refresh failed: %v", err)
+		}
+	}()
+}
+
+// StartCatalogRefreshRoutine warms the cache and keeps it fresh in the background
+func StartCatalogRefreshRoutine() {
+	go func() {
+		if err := RefreshCatalog(); err != nil {
+			log.Printf("Warning: initial catalog load failed: %v", err)
+		}
+
+		ticker := time.NewTicker(config.GetCatalogCacheTTL())
+		defer ticker.Stop()
+
+		for range ticker.C {
+			refreshCatalogInBackground()
+		}
+	}()
+}
+
+// categoryKeywords maps keywords found in package names to a storefront category.
+// The first matching entry wins, so more specific keywords come first.
+var categoryKeywords = []struct {
+	keyword  string
+	category string
+}{
+	{"axis", "Axis"},
+	{"akrab", "Akrab"},
+	{"circle", "Circle"},
+	{"bebas puas", "Bebas Puas"},
+	{"combo", "Combo"},
+	{"masa aktif", "Masa Aktif"},
+	{"unlimited", "Unlimited"},
+	{"unli", "Unlimited"},
+	{"vidio", "Aplikasi"},
+	{"youtube", "Aplikasi"},
+	{"tiktok", "Aplikasi"},
+	{"netflix", "Aplikasi"},
+	{"bonus", "Bonus"},
+	// Most of the catalog is XL; other XL packages fall back to the brand
+	{"xl", "XL"},
+}
+
+// PackageCategory returns the category of a package, preferring the local override
+func PackageCategory(pkg dto.Package) string {
+	if override, exists := getCatalogOverride(pkg.PackageCode); exists && override.Category != "" {
+		return override.Category
+	}
+	return inferPackageCategory(pkg)
+}
+
+// inferPackageCategory guesses a category from the package name
+func inferPackageCategory(pkg dto.Package) string {
+	name := strings.ToLower(pkg.PackageName + " " + pkg.PackageNameAliasShort)
+	for _, entry := range categoryKeywords {
+		if strings.Contains(name, entry.keyword) {
+			return entry.category
+		}
+	}
+	return "Lainnya"
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// DailyReport summarises one day of business for the admin
+type DailyReport struct {
+	Date            time.Time `json:"date"`
+	TopupCount      int64     `json:"topup_count"`
+	TopupAmount     int64     `json:"topup_amount"`
+	PurchaseCount   int64     `json:"purchase_count"`   // purchases that did not fail, pending ones included
+	PurchasePending int64     `json:"purchase_pending"` // part of PurchaseCount
+	PurchaseRevenue int64     `json:"purchase_revenue"`
+	PurchaseMargin  int64     `json:"purchase_margin"`
+	PurchaseFailed  int64     `json:"purchase_failed"`
+	VPNCount        int64     `json:"vpn_count"`
+	VPNRevenue      int64     `json:"vpn_revenue"`
+}
+
+// BuildDailyReport totals confirmed top-ups, purchases and VPN sales of the day containing day
+func BuildDailyReport(day time.Time) (*DailyReport, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+	report := &DailyReport{Date: start}
+
+	var topups struct {
+		Count  int64
+		Amount int64
+	}
+	err := config.DB.Model(&models.Transaction{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount").
+		Where("status = ? AND approved_at >= ? AND approved_at < ?", "confirmed", start, end).
+		Scan(&topups).Error
+	if err != nil {
+		return nil, err
+	}
+	report.TopupCount = topups.Count
+	report.TopupAmount = topups.Amount
+
+	// Pending purchases are paid already, so they count like in BuildReport
+	var purchases struct {
+		Count   int64
+		Pending int64
+		Revenue int64
+		Margin  int64
+		Failed  int64
+	}
+	err = config.DB.Model(&models.PurchaseTransaction{}).
+		Select(`COALESCE(SUM(CASE WHEN status <> 'failed' THEN 1 ELSE 0 END), 0) AS count,
+			COALESCE(SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END), 0) AS pending,
+			COALESCE(SUM(CASE WHEN status <> 'failed' THEN price ELSE 0 END), 0) AS revenue,
+			COALESCE(SUM(CASE WHEN status <> 'failed' THEN price - cost_price ELSE 0 END), 0) AS margin,
+			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) AS failed`).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Scan(&purchases).Error
+	if err != nil {
+		return nil, err
+	}
+	report.PurchaseCount = purchases.Count
+	report.PurchasePending = purchases.Pending
+	report.PurchaseRevenue = purchases.Revenue
+	report.PurchaseMargin = purchases.Margin
+	report.PurchaseFailed = purchases.Failed
+
+	var vpn struct {
+		Count   int64
+		Revenue int64
+	}
+	err = config.DB.Model(&models.VPNTransaction{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(price), 0) AS revenue").
+		Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", start, end).
+		Scan(&vpn).Error
+	if err != nil {
+		return nil, err
+	}
+	report.VPNCount = vpn.Count
+	report.VPNRevenue = vpn.Revenue
+
+	return report, nil
+}
+
+// FormatDailyReport renders a report as Telegram Markdown
+func FormatDailyReport(r *DailyReport) string {
+	return fmt.Sprintf(`📊 *Laporan Harian %s*
+
+💳 *Top Up:* %d transaksi, Rp %s
+🛒 *Pembelian:* %d terjual (%d diproses), %d gagal
+💰 *Omzet Paket:* Rp %s
+📈 *Margin Paket:* Rp %s
+🔐 *VPN:* %d transaksi, Rp %s`,
+		r.Date.Format("02/01/2006"),
+		r.TopupCount, formatRupiah(r.TopupAmount),
+		r.PurchaseCount, r.PurchasePending, r.PurchaseFailed,
+		formatRupiah(r.PurchaseRevenue),
+		formatRupiah(r.PurchaseMargin),
+		r.VPNCount, formatRupiah(r.VPNRevenue))
+}
+
+// SendDailyReport builds the report of a day and routes it as a daily_report notification
+func SendDailyReport(day time.Time) error {
+	report, err := BuildDailyReport(day)
+	if err != nil {
+		return err
+	}
+
+	subject := "Laporan Harian " + report.Date.Format("02/01/2006")
+	NotifyAdmin(NotifyDailyReport, subject, FormatDailyReport(report))
+	return nil
+}
+
+// StartDailyReportRoutine sends the previous day's report every day at DAILY_REPORT_HOUR
+func StartDailyReportRoutine() {
+	hour := config.GetDailyReportHour()
+	if hour < 0 || hour > 23 {
+		log.Printf("Daily report disabled (DAILY_REPORT_HOUR=%d)", hour)
+		return
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			if config.DB == nil {
+				continue
+			}
+			if err := SendDailyReport(next.AddDate(0, 0, -1)); err != nil {
+				log.Printf("Warning: failed to send daily report: %v", err)
+			}
+		}
+	}()
+}
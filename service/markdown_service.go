@@ -0,0 +1,374 @@
+package service
+
+import (
+	"html"
+	"strings"
+)
+
+// Telegram parse modes understood by the converters
+const (
+	ParseModeMarkdown   = "Markdown"
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+)
+
+// zeroWidthSpace stops WhatsApp from pairing a literal marker with another one;
+// WhatsApp has no escape character of its own
+const zeroWidthSpace = "\u200b"
+
+// markdownTarget describes how Telegram entities are written in another format
+type markdownTarget struct {
+	bold, italic, strike string // markers placed around styled text, "" drops the style
+	code                 func(string) string
+	pre                  func(string) string
+	link                 func(text, url string) string
+	literal              func(rune) string
+}
+
+var whatsappTarget = &markdownTarget{
+	bold:   "*",
+	italic: "_",
+	strike: "~",
+	code:   func(s string) string { return "```" + s + "```" },
+	pre:    func(s string) string { return "```" + s + "```" },
+	link:   plainLink,
+	literal: func(r rune) string {
+		if strings.ContainsRune("*_~`", r) {
+			return string(r) + zeroWidthSpace
+		}
+		return string(r)
+	},
+}
+
+var plainTarget = &markdownTarget{
+	code:    func(s string) string { return s },
+	pre:     func(s string) string { return s },
+	link:    plainLink,
+	literal: func(r rune) string { return string(r) },
+}
+
+func plainLink(text, url string) string {
+	if text == "" || text == url {
+		return url
+	}
+	return text + " (" + url + ")"
+}
+
+// MarkdownToWhatsApp converts a message written for a Telegram parse mode to WhatsApp
+// formatting: *bold*, _italic_, ~strike~ and ```monospace```. Underline and spoilers
+// become plain text and links are written as "text (url)". Text without a parse mode
+// is returned unchanged.
+func MarkdownToWhatsApp(text, parseMode string) string {
+	return convertMarkdown(text, parseMode, whatsappTarget)
+}
+
+// MarkdownToPlain strips the formatting of a message written for a Telegram parse mode,
+// keeping escaped characters and writing links as "text (url)"
+func MarkdownToPlain(text, parseMode string) string {
+	return convertMarkdown(text, parseMode, plainTarget)
+}
+
+func convertMarkdown(text, parseMode string, target *markdownTarget) string {
+	if parseMode == ParseModeHTML {
+		return convertHTML(text, target)
+	}
+	if parseMode != ParseModeMarkdown && parseMode != ParseModeMarkdownV2 {
+		return text
+	}
+	v2 := parseMode == ParseModeMarkdownV2
+
+	runes := []rune(text)
+	open := make(map[string]bool)
+	var out strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case r == '\\' && markdownEscapable(next, v2):
+			i++
+			out.WriteString(target.literal(next))
+		case r == '`' && hasRunePrefix(runes[i:], "```"):
+			end := indexCodeEnd(runes, i+3, "```", v2)
+			if end < 0 {
+				out.WriteString(target.literal(r))
+				continue
+			}
+			out.WriteString(target.pre(preContent(runes[i+3:end], v2)))
+			i = end + 2
+		case r == '`':
+			end := indexCodeEnd(runes, i+1, "`", v2)
+			if end < 0 {
+				out.WriteString(target.literal(r))
+				continue
+			}
+			out.WriteString(target.code(codeContent(runes[i+1:end], v2)))
+			i = end
+		case r == '*' || r == '_' && !(v2 && next == '_') || r == '~' && v2:
+			// a marker Telegram cannot pair is shown as is; that is what the
+			// plain-text fallback of a rejected message needs
+			marker := string(r)
+			if !open[marker] && !markerCloses(runes, i+1, marker, v2) {
+				out.WriteString(target.literal(r))
+				continue
+			}
+			open[marker] = !open[marker]
+			switch r {
+			case '*':
+				out.WriteString(target.bold)
+			case '_':
+				out.WriteString(target.italic)
+			default:
+				out.WriteString(target.strike)
+			}
+		case r == '_' || r == '|' && v2 && next == '|':
+			// __underline__ has no equivalent outside Telegram and ||spoiler|| is shown as plain text
+			marker := string([]rune{r, r})
+			i++
+			if !open[marker] && !markerCloses(runes, i+1, marker, v2) {
+				out.WriteString(target.literal(r) + target.literal(r))
+				continue
+			}
+			open[marker] = !open[marker]
+		case r == '[':
+			linkText, url, end, ok := parseMarkdownLink(runes, i, v2)
+			if !ok {
+				out.WriteString(target.literal(r))
+				continue
+			}
+			out.WriteString(target.link(convertMarkdown(linkText, parseMode, target), url))
+			i = end
+		default:
+			out.WriteString(target.literal(r))
+		}
+	}
+	return out.String()
+}
+
+// htmlFrame collects the content of an element that is rendered as a whole: a link,
+// inline code or a pre block
+type htmlFrame struct {
+	tag  string
+	href string
+	out  strings.Builder
+}
+
+// convertHTML converts a message written for Telegram's HTML parse mode. Tags Telegram
+// does not support are dropped and entities are decoded.
+func convertHTML(text string, target *markdownTarget) string {
+	frames := []*htmlFrame{{}}
+	inCode := func() bool {
+		tag := frames[len(frames)-1].tag
+		return tag == "code" || tag == "pre"
+	}
+
+	for i := 0; i < len(text); {
+		top := frames[len(frames)-1]
+		if text[i] != '<' {
+			end := strings.IndexByte(text[i:], '<')
+			if end < 0 {
+				end = len(text) - i
+			}
+			segment := html.UnescapeString(text[i : i+end])
+			if inCode() {
+				top.out.WriteString(segment)
+			} else {
+				for _, r := range segment {
+					top.out.WriteString(target.literal(r))
+				}
+			}
+			i += end
+			continue
+		}
+
+		end := strings.IndexByte(text[i:], '>')
+		if end < 0 {
+			top.out.WriteString(target.literal('<'))
+			i++
+			continue
+		}
+		tag := text[i+1 : i+end]
+		i += end + 1
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimPrefix(tag, "/"))
+		if fields := strings.Fields(name); len(fields) > 0 {
+			name = fields[0]
+		}
+
+		switch name {
+		case "b", "strong":
+			if !inCode() {
+				top.out.WriteString(target.bold)
+			}
+		case "i", "em":
+			if !inCode() {
+				top.out.WriteString(target.italic)
+			}
+		case "s", "strike", "del":
+			if !inCode() {
+				top.out.WriteString(target.strike)
+			}
+		case "a", "code", "pre":
+			if !closing {
+				// <pre><code class="language-go"> is a single block
+				if !inCode() {
+					frames = append(frames, &htmlFrame{tag: name, href: htmlAttribute(tag, "href")})
+				}
+				continue
+			}
+			if top.tag != name || len(frames) == 1 {
+				continue
+			}
+			frames = frames[:len(frames)-1]
+			parent := frames[len(frames)-1]
+			content := top.out.String()
+			switch name {
+			case "a":
+				parent.out.WriteString(target.link(content, top.href))
+			case "code":
+				parent.out.WriteString(target.code(content))
+			case "pre":
+				parent.out.WriteString(target.pre(content))
+			}
+		}
+		// u, ins, span, tg-spoiler, blockquote and unknown tags keep only their text
+	}
+
+	for len(frames) > 1 {
+		top := frames[len(frames)-1]
+		frames = frames[:len(frames)-1]
+		frames[len(frames)-1].out.WriteString(top.out.String())
+	}
+	return frames[0].out.String()
+}
+
+// htmlAttribute returns the value of a quoted attribute of a start tag
+func htmlAttribute(tag, name string) string {
+	idx := strings.Index(strings.ToLower(tag), name+"=")
+	if idx < 0 {
+		return ""
+	}
+	value := tag[idx+len(name)+1:]
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		if fields := strings.Fields(value); len(fields) > 0 {
+			return html.UnescapeString(fields[0])
+		}
+		return ""
+	}
+	end := strings.IndexByte(value[1:], value[0])
+	if end < 0 {
+		return ""
+	}
+	return html.UnescapeString(value[1 : end+1])
+}
+
+// markerCloses reports whether an unescaped marker follows from
+func markerCloses(runes []rune, from int, marker string, v2 bool) bool {
+	for j := from; j < len(runes); j++ {
+		if runes[j] == '\\' && j+1 < len(runes) && markdownEscapable(runes[j+1], v2) {
+			j++
+			continue
+		}
+		if hasRunePrefix(runes[j:], marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownEscapable reports whether a backslash before r is an escape. MarkdownV2 lets any
+// ASCII character be escaped; legacy Markdown only the entity markers.
+func markdownEscapable(r rune, v2 bool) bool {
+	if v2 {
+		return r >= 1 && r <= 126
+	}
+	return r == '_' || r == '*' || r == '`' || r == '['
+}
+
+// parseMarkdownLink reads [text](url) starting at the '[' at start and returns the raw
+// link text, the URL and the index of the closing ')'
+func parseMarkdownLink(runes []rune, start int, v2 bool) (string, string, int, bool) {
+	textEnd := -1
+	for j := start + 1; j < len(runes); j++ {
+		if runes[j] == '\\' && v2 {
+			j++
+			continue
+		}
+		if runes[j] == ']' {
+			textEnd = j
+			break
+		}
+	}
+	if textEnd < 0 || textEnd+1 >= len(runes) || runes[textEnd+1] != '(' {
+		return "", "", 0, false
+	}
+
+	var url strings.Builder
+	for j := textEnd + 2; j < len(runes); j++ {
+		switch {
+		case runes[j] == '\\' && v2 && j+1 < len(runes):
+			j++
+			url.WriteRune(runes[j])
+		case runes[j] == ')':
+			return string(runes[start+1 : textEnd]), url.String(), j, true
+		default:
+			url.WriteRune(runes[j])
+		}
+	}
+	return "", "", 0, false
+}
+
+// preContent drops the language tag of a ```lang block and, in MarkdownV2, the escapes of ` and \
+func preContent(runes []rune, v2 bool) string {
+	content := codeContent(runes, v2)
+	if newline := strings.IndexByte(content, '\n'); newline > 0 && !strings.ContainsAny(content[:newline], " \t") {
+		return content[newline+1:]
+	}
+	return strings.TrimPrefix(content, "\n")
+}
+
+func codeContent(runes []rune, v2 bool) string {
+	if !v2 {
+		return string(runes)
+	}
+	var out strings.Builder
+	for j := 0; j < len(runes); j++ {
+		if runes[j] == '\\' && j+1 < len(runes) && (runes[j+1] == '`' || runes[j+1] == '\\') {
+			j++
+		}
+		out.WriteRune(runes[j])
+	}
+	return out.String()
+}
+
+func hasRunePrefix(runes []rune, prefix string) bool {
+	p := []rune(prefix)
+	if len(runes) < len(p) {
+		return false
+	}
+	for i := range p {
+		if runes[i] != p[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexCodeEnd finds the closing delimiter of a code span; in MarkdownV2 escaped
+// backticks and backslashes inside the span do not count
+func indexCodeEnd(runes []rune, from int, delimiter string, v2 bool) int {
+	for i := from; i < len(runes); i++ {
+		if v2 && runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '`' || runes[i+1] == '\\') {
+			i++
+			continue
+		}
+		if hasRunePrefix(runes[i:], delimiter) {
+			return i
+		}
+	}
+	return -1
+}
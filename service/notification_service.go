@@ -6,8 +6,9 @@ import (
 	"sync"
 	"time"
 
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"gorm.io/gorm"
 )
 
 var (
@@ -42,7 +43,12 @@ func NotifyAdminError(userID int64, operation, details string) {
 		details,
 	)
 
-	sendToTelegramAdmin(message)
+	NotifyAdmin(NotifyError, "System Error Alert", message)
+	PublishAdminEvent(EventSystemError, map[string]interface{}{
+		"user_id":   userID,
+		"operation": operation,
+		"details":   details,
+	})
 }
 
 // NotifyAdminApprovalNeeded sends approval notification to admin
@@ -72,74 +78,42 @@ func NotifyAdminApprovalNeeded(userID int64, operation, details string) {
 		details,
 	)
 
-	// Send to both Telegram and WhatsApp for approval
-	sendToTelegramAdmin(message)
-	sendToWhatsAppAdmin(message)
+	NotifyAdmin(NotifyApproval, "Approval Required", message)
 }
 
-// NotifyAdminTopupApproval sends topup approval notification
-func NotifyAdminTopupApproval(userID int64, amount int64, method string) {
+// NotifyAdminTopupApproval sends topup approval notification. In Telegram the admins get
+// the top up with approve, reject and ask-for-proof buttons; other channels get the text.
+func NotifyAdminTopupApproval(tx *dto.Transaction, method string) {
 	message := fmt.Sprintf(
 		"💰 *TOPUP APPROVAL NEEDED*\n\n"+
 			"⏰ Time: %s\n"+
 			"👤 User ID: %d\n"+
 			"💵 Amount: Rp %s\n"+
-			"💳 Method: %s\n\n"+
+			"💳 Method: %s\n"+
+			"🆔 Transaction ID: %s\n\n"+
 			"✅ Please approve this topup request.",
 		time.Now().Format("2006-01-02 15:04:05"),
-		userID,
-		formatRupiah(amount),
+		tx.UserID,
+		formatRupiah(tx.Amount),
 		method,
+		EscapeMarkdown(tx.ID),
 	)
-
-	// Send to both Telegram and WhatsApp for topup approval
-	sendToTelegramAdmin(message)
-	sendToWhatsAppAdmin(message)
-}
-
-// sendToTelegramAdmin sends message to admin via Telegram
-func sendToTelegramAdmin(message string) {
-	if config.BotInstance == nil {
-		log.Printf("Bot instance not available for admin notification")
-		return
-	}
-
-	adminID := config.GetAdminTelegramID()
-	if adminID == 0 {
-		log.Printf("Admin Telegram ID not configured")
-		return
-	}
-
-	msg := tgbotapi.NewMessage(adminID, message)
-	msg.ParseMode = "Markdown"
-
-	if _, err := config.BotInstance.Send(msg); err != nil {
-		log.Printf("Failed to send admin notification to Telegram: %v", err)
-	}
-}
-
-// sendToWhatsAppAdmin sends message to admin via WhatsApp (only for approvals)
-func sendToWhatsAppAdmin(message string) {
-	adminPhone := config.GetAdminWhatsAppNumber()
-	if adminPhone == "" {
-		log.Printf("Admin WhatsApp number not configured")
-		return
-	}
-
-	// Convert markdown to plain text for WhatsApp
-	plainMessage := convertMarkdownToPlain(message)
-
-	if err := SendWhatsAppMessage(adminPhone, plainMessage); err != nil {
-		log.Printf("Failed to send admin notification to WhatsApp: %v", err)
+	n := Notification{Subject: "Topup Approval Needed", Text: message, ParseMode: "Markdown"}
+
+	for _, channel := range NotifyRoute(NotifyTopupApproval) {
+		if channel == ChannelTelegram && config.BotInstance != nil && config.DB != nil {
+			if err := SendTopupApprovalNotices(config.BotInstance, tx.ID); err != nil {
+				log.Printf("Warning: failed to send approval notices of %s: %v", tx.ID, err)
+			}
+			continue
+		}
+		notifyAdminChannel(NotifyTopupApproval, channel, n)
 	}
 }
 
-// convertMarkdownToPlain converts markdown formatting to plain text
-func convertMarkdownToPlain(text string) string {
-	// Simple conversion - remove markdown formatting
-	result := text
-	result = fmt.Sprintf("> grnstore: %s", result)
-	return result
+// NotifyAdminActivity reports user activity such as new top-ups and purchases to the admin
+func NotifyAdminActivity(message string) {
+	routeAdminNotification(NotifyActivity, Notification{Text: message})
 }
 
 // formatRupiah formats number to Rupiah currency
@@ -162,29 +136,57 @@ func formatRupiah(amount int64) string {
 	return result
 }
 
-// NotifyUserTopupSuccess sends notification to user when topup is approved
-func NotifyUserTopupSuccess(userID int64, amount int64, transactionID string) {
-	if config.BotInstance == nil {
-		log.Printf("Bot instance not available for user notification")
-		return
+// queueTopupRejected queues the rejection notice for the user inside the rejecting transaction
+func queueTopupRejected(db *gorm.DB, userID int64, amount int64, transactionID, reason string) error {
+	if reason == "" {
+		reason = "-"
+	}
+
+	text := fmt.Sprintf(`❌ *Top-Up Ditolak*
+
+💳 *Nominal:* %s
+🆔 *Transaction ID:* `+"`%s`"+`
+📝 *Alasan:* %s
+
+Maaf, top-up Anda ditolak oleh admin. Jika Anda sudah membayar, hubungi admin lewat menu Hubungi Admin.`,
+		formatRupiah(amount),
+		transactionID,
+		EscapeMarkdown(reason))
+
+	return QueueTelegramMessage(db, userID, text, "Markdown")
+}
+
+// queueTopupSuccess queues the top-up confirmation for the user inside the confirming transaction.
+// bonus is the tier bonus credited alongside the top-up, 0 when none applied.
+func queueTopupSuccess(db *gorm.DB, userID int64, amount int64, bonus int64, transactionID string, balance int64) error {
+	var bonusLine string
+	if bonus > 0 {
+		bonusLine = fmt.Sprintf("\n🎁 *Bonus Top Up:* %s", formatRupiah(bonus))
 	}
 
-	balance := GetUserBalance(userID)
 	text := fmt.Sprintf(`✅ *Top-Up Berhasil!*
 
-💰 *Nominal:* %s
+💰 *Nominal:* %s%s
 🆔 *Transaction ID:* `+"`%s`"+`
 💳 *Saldo Terkini:* %s
 
 Terima kasih telah menggunakan layanan kami! 🙏`,
 		formatRupiah(amount),
+		bonusLine,
 		transactionID,
-		formatRupiah(balance.Balance))
+		formatRupiah(balance))
 
-	msg := tgbotapi.NewMessage(userID, text)
-	msg.ParseMode = "Markdown"
+	return QueueTelegramMessage(db, userID, text, "Markdown")
+}
 
-	if _, err := config.BotInstance.Send(msg); err != nil {
-		log.Printf("Failed to notify user %d about topup success: %v", userID, err)
+// NotifyUserTopupVoucher tells the user whether the voucher of a confirmed top-up was applied
+func NotifyUserTopupVoucher(userID int64, voucherCode string, bonus int64, voucherErr error) {
+	var text string
+	if voucherErr != nil {
+		text = fmt.Sprintf("⚠️ Voucher %s tidak dapat dipakai untuk top-up ini: %v", voucherCode, voucherErr)
+	} else {
+		text = fmt.Sprintf("🎟️ Bonus voucher %s sebesar %s sudah ditambahkan ke saldo Anda.", voucherCode, formatRupiah(bonus))
 	}
+
+	notifyTelegram(userID, text, "")
 }
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+)
+
+// Notification channels, used in NOTIFY_ROUTES and as the outbox channel
+const (
+	ChannelTelegram = "telegram"
+	ChannelWhatsApp = "whatsapp"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+)
+
+// Admin notification kinds, the keys of NOTIFY_ROUTES
+const (
+	NotifyError         = "error"
+	NotifyApproval      = "approval"
+	NotifyTopupApproval = "topup_approval"
+	NotifyActivity      = "activity"
+	NotifyDailyReport   = "daily_report"
+)
+
+// defaultNotifyRoutes keeps the channels admins got before routing was configurable
+var defaultNotifyRoutes = map[string][]string{
+	NotifyError:         {ChannelTelegram},
+	NotifyApproval:      {ChannelTelegram, ChannelWhatsApp},
+	NotifyTopupApproval: {ChannelTelegram, ChannelWhatsApp},
+	NotifyActivity:      {ChannelWhatsApp},
+	NotifyDailyReport:   {ChannelTelegram},
+}
+
+// Notification is a message for one recipient. Text is written in Telegram Markdown
+// when ParseMode is set; other channels convert it to plain text.
+type Notification struct {
+	Subject   string
+	Text      string
+	ParseMode string
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	// Channel returns the channel name used in routes and the outbox
+	Channel() string
+	// AdminRecipient returns where admin notifications go, or "" when the channel is not configured
+	AdminRecipient() string
+	// Send delivers a notification to a recipient of this channel
+	Send(recipient string, n Notification) error
+}
+
+// NewNotifier returns the notifier of a channel, configured from the environment
+func NewNotifier(channel string) (Notifier, error) {
+	switch channel {
+	case ChannelTelegram:
+		return TelegramNotifier{}, nil
+	case ChannelWhatsApp:
+		return WhatsAppNotifier{}, nil
+	case ChannelEmail:
+		return EmailNotifier{
+			Host:     config.GetSMTPHost(),
+			Port:     config.GetSMTPPort(),
+			Username: config.GetSMTPUsername(),
+			Password: config.GetSMTPPassword(),
+			From:     config.GetSMTPFrom(),
+		}, nil
+	case ChannelWebhook:
+		return WebhookNotifier{URL: config.GetNotifyWebhookURL(), Secret: config.GetNotifyWebhookSecret()}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification channel %q", channel)
+	}
+}
+
+// NotifyRoute returns the channels a notification kind is sent to
+func NotifyRoute(kind string) []string {
+	if channels, ok := config.GetNotifyRoutes()[kind]; ok {
+		return channels
+	}
+	return defaultNotifyRoutes[kind]
+}
+
+// CheckNotifyRoutes warns about notification kinds routed to a channel without an admin
+// recipient, since those notifications are dropped, and returns them as "kind → channel".
+// Called once at startup.
+func CheckNotifyRoutes() []string {
+	var unrouted []string
+	for _, kind := range []string{NotifyError, NotifyApproval, NotifyTopupApproval, NotifyActivity, NotifyDailyReport} {
+		for _, channel := range NotifyRoute(kind) {
+			notifier, err := NewNotifier(channel)
+			if err != nil {
+				log.Printf("Warning: %s notification route: %v", kind, err)
+				unrouted = append(unrouted, kind+" → "+channel)
+				continue
+			}
+			if notifier.AdminRecipient() == "" {
+				log.Printf("Warning: %s notifications are routed to %s, but no admin %s recipient is configured; they will be dropped (set NOTIFY_ROUTES or the channel's recipient)", kind, channel, channel)
+				unrouted = append(unrouted, kind+" → "+channel)
+			}
+		}
+	}
+	return unrouted
+}
+
+// NotifyAdmin queues an admin notification on every channel routed for its kind.
+// text is Telegram Markdown.
+func NotifyAdmin(kind, subject, text string) {
+	routeAdminNotification(kind, Notification{Subject: subject, Text: text, ParseMode: "Markdown"})
+}
+
+func routeAdminNotification(kind string, n Notification) {
+	for _, channel := range NotifyRoute(kind) {
+		notifyAdminChannel(kind, channel, n)
+	}
+}
+
+// notifyAdminChannel queues an admin notification on one channel
+func notifyAdminChannel(kind, channel string, n Notification) {
+	notifier, err := NewNotifier(channel)
+	if err != nil {
+		log.Printf("Warning: %s notification route: %v", kind, err)
+		return
+	}
+
+	recipient := notifier.AdminRecipient()
+	if recipient == "" {
+		log.Printf("Admin %s recipient not configured, skipping %s notification", channel, kind)
+		return
+	}
+
+	notify(channel, recipient, n)
+}
+
+// TelegramNotifier sends through the bot; recipients are chat IDs
+type TelegramNotifier struct{}
+
+func (TelegramNotifier) Channel() string { return ChannelTelegram }
+
+func (TelegramNotifier) AdminRecipient() string {
+	if adminID := config.GetAdminTelegramID(); adminID != 0 {
+		return strconv.FormatInt(adminID, 10)
+	}
+	return ""
+}
+
+func (TelegramNotifier) Send(recipient string, n Notification) error {
+	if config.BotInstance == nil {
+		return fmt.Errorf("bot instance not available")
+	}
+	chatID, err := strconv.ParseInt(recipient, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID %q", recipient)
+	}
+
+	msg := tgbotapi.NewMessage(chatID, n.Text)
+	msg.ParseMode = n.ParseMode
+	_, err = SendWithFallback(config.BotInstance, msg)
+	return err
+}
+
+// WhatsAppNotifier sends through the WhatsApp gateway; recipients are phone numbers
+type WhatsAppNotifier struct{}
+
+func (WhatsAppNotifier) Channel() string { return ChannelWhatsApp }
+
+func (WhatsAppNotifier) AdminRecipient() string { return config.GetAdminWhatsAppNumber() }
+
+func (WhatsAppNotifier) Send(recipient string, n Notification) error {
+	return SendWhatsAppMessage(recipient, MarkdownToWhatsApp(n.Text, n.ParseMode))
+}
+
+// EmailNotifier sends plain-text email over SMTP; recipients are comma separated addresses
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (EmailNotifier) Channel() string { return ChannelEmail }
+
+func (e EmailNotifier) AdminRecipient() string {
+	if e.Host == "" {
+		return ""
+	}
+	return strings.Join(config.GetAdminEmails(), ",")
+}
+
+func (e EmailNotifier) Send(recipient string, n Notification) error {
+	if e.Host == "" {
+		return fmt.Errorf("SMTP not configured")
+	}
+
+	var to []string
+	for _, address := range strings.Split(recipient, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			to = append(to, address)
+		}
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no email recipient")
+	}
+
+	subject := n.Subject
+	if subject == "" {
+		subject = "Notifikasi grnstore"
+	}
+	text := MarkdownToPlain(n.Text, n.ParseMode)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", e.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	addr := fmt.Sprintf("%s:%d", e.Host, e.Port)
+	return smtp.SendMail(addr, auth, e.From, to, body.Bytes())
+}
+
+// WebhookNotifier posts notifications as JSON, signed with Secret when one is set;
+// the recipient is the URL
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+}
+
+func (WebhookNotifier) Channel() string { return ChannelWebhook }
+
+func (w WebhookNotifier) AdminRecipient() string { return w.URL }
+
+func (w WebhookNotifier) Send(recipient string, n Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"subject":    n.Subject,
+		"text":       MarkdownToPlain(n.Text, n.ParseMode),
+		"markdown":   n.Text,
+		"parse_mode": n.ParseMode,
+		"timestamp":  time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", recipient, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set("X-Signature", SignPayload(w.Secret, body))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
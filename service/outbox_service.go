@@ -0,0 +1,304 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// Outbox message statuses; dead messages ran out of attempts and wait for an admin retry
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+const (
+	outboxBaseBackoff    = 10 * time.Second
+	outboxMaxBackoff     = time.Hour
+	outboxClaimTimeout   = time.Minute
+	outboxWorkerInterval = 5 * time.Second
+	outboxBatchLimit     = 50
+)
+
+var (
+	outboxWake = make(chan struct{}, 1)
+
+	outboxDelivered    atomic.Int64
+	outboxRetried      atomic.Int64
+	outboxDeadLettered atomic.Int64
+)
+
+// OutboxStats summarises the outbox. The counters are totals since the process started.
+type OutboxStats struct {
+	Pending              int64 `json:"pending"`
+	Sent                 int64 `json:"sent"`
+	Dead                 int64 `json:"dead"`
+	OldestPendingSeconds int64 `json:"oldest_pending_seconds"`
+	Delivered            int64 `json:"delivered"`
+	Retried              int64 `json:"retried"`
+	DeadLettered         int64 `json:"dead_lettered"`
+}
+
+// QueueNotification writes a message for one channel to the outbox. Pass the gorm
+// transaction of the business change so the message is only sent when that change commits.
+func QueueNotification(db *gorm.DB, channel, recipient string, n Notification) error {
+	now := time.Now()
+	return db.Create(&models.OutboxMessage{
+		Channel:       channel,
+		Recipient:     recipient,
+		Subject:       n.Subject,
+		Message:       n.Text,
+		ParseMode:     n.ParseMode,
+		Status:        OutboxPending,
+		NextAttemptAt: &now,
+	}).Error
+}
+
+// QueueTelegramMessage queues a Telegram message to a chat
+func QueueTelegramMessage(db *gorm.DB, chatID int64, message, parseMode string) error {
+	return QueueNotification(db, ChannelTelegram, strconv.FormatInt(chatID, 10), Notification{Text: message, ParseMode: parseMode})
+}
+
+// QueueWhatsAppMessage queues a WhatsApp message to a phone number
+func QueueWhatsAppMessage(db *gorm.DB, phoneNumber, message string) error {
+	return QueueNotification(db, ChannelWhatsApp, phoneNumber, Notification{Text: message})
+}
+
+// notify queues a message that is not tied to a business transaction and wakes the
+// dispatcher. Without a database the message is sent right away.
+func notify(channel, recipient string, n Notification) {
+	if config.DB != nil {
+		err := QueueNotification(config.DB, channel, recipient, n)
+		if err == nil {
+			WakeOutboxDispatcher()
+			return
+		}
+		log.Printf("Warning: failed to queue %s notification for %s, sending directly: %v", channel, recipient, err)
+	}
+
+	if err := sendOutboxMessage(channel, recipient, n); err != nil {
+		log.Printf("Failed to send %s notification to %s: %v", channel, recipient, err)
+	}
+}
+
+func notifyTelegram(chatID int64, message, parseMode string) {
+	notify(ChannelTelegram, strconv.FormatInt(chatID, 10), Notification{Text: message, ParseMode: parseMode})
+}
+
+// WakeOutboxDispatcher makes the dispatcher look for due messages without waiting for its ticker.
+// Call it after committing a transaction that queued messages.
+func WakeOutboxDispatcher() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func sendOutboxMessage(channel, recipient string, n Notification) error {
+	notifier, err := NewNotifier(channel)
+	if err != nil {
+		return err
+	}
+	return notifier.Send(recipient, n)
+}
+
+// DeliverOutboxMessage sends a message and records the outcome. Failures are retried
+// with exponential backoff; after OUTBOX_MAX_ATTEMPTS, or on an error retrying cannot
+// fix, the message is dead-lettered.
+func DeliverOutboxMessage(msg *models.OutboxMessage) error {
+	err := sendOutboxMessage(msg.Channel, msg.Recipient, Notification{Subject: msg.Subject, Text: msg.Message, ParseMode: msg.ParseMode})
+	msg.Attempts++
+
+	if err == nil {
+		now := time.Now()
+		msg.Status = OutboxSent
+		msg.SentAt = &now
+		msg.NextAttemptAt = nil
+		msg.LastError = ""
+		outboxDelivered.Add(1)
+	} else {
+		msg.LastError = err.Error()
+		retryAfter, permanent := classifyOutboxError(err)
+		if permanent || msg.Attempts >= config.GetOutboxMaxAttempts() {
+			msg.Status = OutboxDead
+			msg.NextAttemptAt = nil
+			outboxDeadLettered.Add(1)
+			log.Printf("Outbox message %d (%s to %s) dead-lettered after %d attempts: %v", msg.ID, msg.Channel, msg.Recipient, msg.Attempts, err)
+			if _, blocked, _ := classifyBroadcastError(err); blocked && msg.Channel == ChannelTelegram {
+				if chatID, parseErr := strconv.ParseInt(msg.Recipient, 10, 64); parseErr == nil {
+					MarkUserBlocked(chatID)
+				}
+			}
+		} else {
+			if retryAfter == 0 {
+				retryAfter = OutboxBackoff(msg.Attempts)
+			}
+			next := time.Now().Add(retryAfter)
+			msg.NextAttemptAt = &next
+			outboxRetried.Add(1)
+		}
+	}
+
+	if saveErr := config.DB.Save(msg).Error; saveErr != nil {
+		log.Printf("Warning: failed to save outbox message %d: %v", msg.ID, saveErr)
+	}
+	return err
+}
+
+// classifyOutboxError reads Telegram's flood wait and recognises errors such as a
+// blocked bot or a missing chat, which no retry will fix
+func classifyOutboxError(err error) (retryAfter time.Duration, permanent bool) {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return 0, false
+	}
+	if tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second, false
+	}
+	return 0, tgErr.Code == 400 || tgErr.Code == 403
+}
+
+// OutboxBackoff returns the wait after the given number of failed attempts:
+// 10s, 20s, 40s, ... capped at one hour
+func OutboxBackoff(attempts int) time.Duration {
+	return exponentialBackoff(outboxBaseBackoff, outboxMaxBackoff, attempts)
+}
+
+func exponentialBackoff(base, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// deliverOutboxIfDue claims a due message by pushing its next attempt out, so two
+// dispatcher runs never send the same message, then delivers it
+func deliverOutboxIfDue(id uint) {
+	now := time.Now()
+	result := config.DB.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, OutboxPending, now).
+		Update("next_attempt_at", now.Add(outboxClaimTimeout))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var msg models.OutboxMessage
+	if err := config.DB.First(&msg, id).Error; err != nil {
+		return
+	}
+	if err := DeliverOutboxMessage(&msg); err != nil {
+		log.Printf("Outbox message %d (%s) failed, attempt %d: %v", msg.ID, msg.Channel, msg.Attempts, err)
+	}
+}
+
+// RunOutboxDispatcher sends every pending message whose next attempt is due, oldest first
+func RunOutboxDispatcher() {
+	var due []models.OutboxMessage
+	config.DB.Select("id").
+		Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+		Order("id ASC").Limit(outboxBatchLimit).Find(&due)
+
+	for _, msg := range due {
+		deliverOutboxIfDue(msg.ID)
+	}
+}
+
+// StartOutboxDispatcher runs RunOutboxDispatcher in the background, on a ticker and
+// whenever WakeOutboxDispatcher is called
+func StartOutboxDispatcher() {
+	go func() {
+		ticker := time.NewTicker(outboxWorkerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-outboxWake:
+			}
+			if config.DB != nil {
+				RunOutboxDispatcher()
+			}
+		}
+	}()
+}
+
+// RetryOutboxMessage moves a dead-lettered message back to the queue with a fresh attempt budget
+func RetryOutboxMessage(id uint) error {
+	now := time.Now()
+	result := config.DB.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, OutboxDead).
+		Updates(map[string]interface{}{
+			"status":          OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("pesan tidak ditemukan di dead letter")
+	}
+
+	WakeOutboxDispatcher()
+	return nil
+}
+
+// GetOutboxMessages returns the latest messages, optionally filtered by status
+func GetOutboxMessages(status string, limit int) ([]models.OutboxMessage, error) {
+	query := config.DB.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var messages []models.OutboxMessage
+	err := query.Find(&messages).Error
+	return messages, err
+}
+
+// GetOutboxStats counts messages per status and reports the dispatcher counters
+func GetOutboxStats() (*OutboxStats, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := config.DB.Model(&models.OutboxMessage{}).
+		Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	stats := &OutboxStats{
+		Delivered:    outboxDelivered.Load(),
+		Retried:      outboxRetried.Load(),
+		DeadLettered: outboxDeadLettered.Load(),
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case OutboxPending:
+			stats.Pending = row.Count
+		case OutboxSent:
+			stats.Sent = row.Count
+		case OutboxDead:
+			stats.Dead = row.Count
+		}
+	}
+
+	var oldest []models.OutboxMessage
+	config.DB.Where("status = ?", OutboxPending).Order("created_at ASC").Limit(1).Find(&oldest)
+	if len(oldest) > 0 {
+		stats.OldestPendingSeconds = int64(time.Since(oldest[0].CreatedAt).Seconds())
+	}
+	return stats, nil
+}
@@ -2,35 +2,40 @@ package service
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/nabilulilalbab/bottele/config"
 	"github.com/nabilulilalbab/bottele/dto"
 )
 
-// di service/package_service.go
-type PackageAlias struct {
-	Name  string
-	Price int64
+// FetchPackages returns the product catalog, served from the local cache when possible
+func FetchPackages() ([]dto.Package, error) {
+	return GetCatalog()
 }
 
-const apiURL = "https://grnstore.domcloud.dev/api/user/products?limit=100"
-
-func FetchPackages() ([]dto.Package, error) {
-	req, err := http.NewRequest("GET", apiURL, nil)
+// fetchPackagesFromAPI always hits the upstream product endpoint
+func fetchPackagesFromAPI() ([]dto.Package, error) {
+	req, err := http.NewRequest("GET", config.GetProductsAPIURL(), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("accept", "application/json")
-	req.Header.Set("X-API-Key", "nadia-admin-2024-secure-key")
+	req.Header.Set("X-API-Key", apiKey)
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("products API returned status %d", resp.StatusCode)
+	}
+
 	var apiResp dto.ApiResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
 		return nil, err
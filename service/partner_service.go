@@ -0,0 +1,552 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// Partner order statuses
+const (
+	PartnerOrderProcessing = "processing" // reserved, upstream call in flight
+	PartnerOrderPending    = "pending"    // accepted upstream, waiting for the final status
+	PartnerOrderSuccess    = "success"
+	PartnerOrderFailed     = "failed"
+)
+
+// Partner callback delivery statuses
+const (
+	PartnerCallbackPending = "pending"
+	PartnerCallbackSent    = "sent"
+	PartnerCallbackFailed  = "failed"
+)
+
+// partnerCallbackBackoff is the wait before each retry of a failed callback;
+// once it is exhausted the callback is marked failed.
+var partnerCallbackBackoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+}
+
+const (
+	partnerKeyPrefix        = "h2h_"
+	partnerStatusPollAfter  = time.Minute
+	partnerStatusGiveUp     = 24 * time.Hour
+	partnerWorkerInterval   = 30 * time.Second
+	partnerCallbackTimeout  = 10 * time.Second
+	partnerRefIDMaxLength   = 64
+	partnerWorkerBatchLimit = 50
+	// An order still processing after this was interrupted, e.g. by a restart, since the
+	// upstream call times out after 30 seconds
+	partnerProcessingTimeout = 5 * time.Minute
+)
+
+// PartnerCallback is the body posted to a partner's callback URL.
+// It is signed with HMAC-SHA256 of the raw body in the X-Signature header.
+type PartnerCallback struct {
+	RefID       string `json:"ref_id"`
+	TrxID       string `json:"trx_id"`
+	PackageCode string `json:"package_code"`
+	Price       int64  `json:"price"`
+	Status      string `json:"status"`
+	Message     string `json:"message"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// PartnerCatalogItem is a package with the partner's price for each payment method
+type PartnerCatalogItem struct {
+	PackageCode string           `json:"package_code"`
+	Name        string           `json:"name"`
+	Category    string           `json:"category"`
+	Prices      map[string]int64 `json:"prices"` // payment method -> price
+}
+
+// HashPartnerKey returns the stored form of a partner API key
+func HashPartnerKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignPayload returns the hex HMAC-SHA256 of a callback or webhook body
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomToken(bytes int) (string, error) {
+	buf := make([]byte, bytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreatePartner stores a new partner and returns its API key and callback secret.
+// Only a hash of the key is kept, so it cannot be shown again later.
+func CreatePartner(partner *models.Partner) (apiKey, secret string, err error) {
+	if err := validatePartner(partner); err != nil {
+		return "", "", err
+	}
+
+	apiKey, err = assignPartnerKey(partner)
+	if err != nil {
+		return "", "", err
+	}
+	if partner.CallbackSecret, err = randomToken(32); err != nil {
+		return "", "", err
+	}
+
+	if err := config.DB.Create(partner).Error; err != nil {
+		return "", "", err
+	}
+	return apiKey, partner.CallbackSecret, nil
+}
+
+// RotatePartnerKey replaces a partner's API key and callback secret
+func RotatePartnerKey(id uint) (apiKey, secret string, err error) {
+	var partner models.Partner
+	if err := config.DB.First(&partner, id).Error; err != nil {
+		return "", "", fmt.Errorf("partner tidak ditemukan")
+	}
+
+	if apiKey, err = assignPartnerKey(&partner); err != nil {
+		return "", "", err
+	}
+	if partner.CallbackSecret, err = randomToken(32); err != nil {
+		return "", "", err
+	}
+
+	if err := config.DB.Save(&partner).Error; err != nil {
+		return "", "", err
+	}
+	return apiKey, partner.CallbackSecret, nil
+}
+
+func assignPartnerKey(partner *models.Partner) (string, error) {
+	token, err := randomToken(24)
+	if err != nil {
+		return "", err
+	}
+
+	apiKey := partnerKeyPrefix + token
+	partner.APIKeyHash = HashPartnerKey(apiKey)
+	partner.APIKeyPrefix = apiKey[:len(partnerKeyPrefix)+6]
+	return apiKey, nil
+}
+
+// UpdatePartner loads a partner, applies fn and saves it
+func UpdatePartner(id uint, fn func(*models.Partner)) (*models.Partner, error) {
+	var partner models.Partner
+	if err := config.DB.First(&partner, id).Error; err != nil {
+		return nil, fmt.Errorf("partner tidak ditemukan")
+	}
+
+	fn(&partner)
+	partner.ID = id
+
+	if err := validatePartner(&partner); err != nil {
+		return nil, err
+	}
+	if err := config.DB.Save(&partner).Error; err != nil {
+		return nil, err
+	}
+	return &partner, nil
+}
+
+// GetPartners returns all partners
+func GetPartners() ([]models.Partner, error) {
+	var partners []models.Partner
+	err := config.DB.Order("id ASC").Find(&partners).Error
+	return partners, err
+}
+
+// GetPartnerOrders returns a partner's latest orders
+func GetPartnerOrders(partnerID uint, limit int) ([]models.PartnerOrder, error) {
+	var orders []models.PartnerOrder
+	err := config.DB.Where("partner_id = ?", partnerID).Order("id DESC").Limit(limit).Find(&orders).Error
+	return orders, err
+}
+
+func validatePartner(partner *models.Partner) error {
+	partner.Name = strings.TrimSpace(partner.Name)
+	if partner.Name == "" {
+		return fmt.Errorf("nama partner wajib diisi")
+	}
+	if partner.UserID == 0 {
+		return fmt.Errorf("user_id partner wajib diisi")
+	}
+
+	if partner.CallbackURL != "" {
+		u, err := url.Parse(partner.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("callback_url tidak valid")
+		}
+	}
+
+	var entries []string
+	for _, entry := range strings.Split(partner.AllowedIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("IP tidak valid: %s", entry)
+		}
+		entries = append(entries, entry)
+	}
+	partner.AllowedIPs = strings.Join(entries, ",")
+	return nil
+}
+
+// PartnerIPAllowed reports whether ip matches a comma separated allowlist of IPs and CIDRs.
+// An empty allowlist allows any address.
+func PartnerIPAllowed(allowlist, ip string) bool {
+	if strings.TrimSpace(allowlist) == "" {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatePartner finds the active partner owning apiKey and checks the caller's IP
+func AuthenticatePartner(apiKey, ip string) (*models.Partner, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key wajib diisi")
+	}
+
+	var partner models.Partner
+	if err := config.DB.Where("api_key_hash = ?", HashPartnerKey(apiKey)).First(&partner).Error; err != nil {
+		return nil, fmt.Errorf("API key tidak valid")
+	}
+	if !partner.Active {
+		return nil, fmt.Errorf("partner nonaktif")
+	}
+	if !PartnerIPAllowed(partner.AllowedIPs, ip) {
+		log.Printf("Partner %d rejected request from %s", partner.ID, ip)
+		return nil, fmt.Errorf("IP %s tidak diizinkan", ip)
+	}
+	return &partner, nil
+}
+
+// GetPartnerCatalog lists the storefront with the partner's tier price per payment method
+func GetPartnerCatalog(partner *models.Partner) ([]PartnerCatalogItem, error) {
+	entries, err := GetStorefront()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]PartnerCatalogItem, 0, len(entries))
+	for i := range entries {
+		pkg := &entries[i].Package
+		item := PartnerCatalogItem{
+			PackageCode: pkg.PackageCode,
+			Name:        entries[i].DisplayName,
+			Category:    entries[i].Category,
+			Prices:      make(map[string]int64),
+		}
+		for _, pm := range pkg.AvailablePaymentMethods {
+			item.Prices[pm.PaymentMethod] = QuotePackagePriceForUser(partner.UserID, pkg, pm.PaymentMethod).SellPrice
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// GetPartnerOrder returns a partner's order by its ref ID
+func GetPartnerOrder(partnerID uint, refID string) (*models.PartnerOrder, error) {
+	var order models.PartnerOrder
+	if err := config.DB.Where("partner_id = ? AND ref_id = ?", partnerID, refID).First(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// PartnerPurchase buys a package for a partner against the balance of its bot user.
+// Purchases are idempotent by ref ID: repeating a ref ID returns the existing order
+// with duplicate set instead of buying again.
+func PartnerPurchase(partner *models.Partner, refID, packageCode, paymentMethod string) (order *models.PartnerOrder, duplicate bool, err error) {
+	refID = strings.TrimSpace(refID)
+	if refID == "" || len(refID) > partnerRefIDMaxLength {
+		return nil, false, fmt.Errorf("ref_id wajib diisi (maksimal %d karakter)", partnerRefIDMaxLength)
+	}
+
+	if existing, err := GetPartnerOrder(partner.ID, refID); err == nil {
+		return existing, true, nil
+	}
+
+	if paymentMethod == "" {
+		paymentMethod = "BALANCE"
+	}
+
+	quote, err := QuotePriceForUser(partner.UserID, packageCode, paymentMethod)
+	if err != nil {
+		return nil, false, fmt.Errorf("produk tidak ditemukan")
+	}
+	if IsPackageHidden(packageCode) {
+		return nil, false, fmt.Errorf("produk sedang tidak tersedia")
+	}
+
+	// Orders of one partner run one at a time under its user's transaction lock, so the
+	// balance checked here is still there when the order is charged. Partners are not
+	// held to the bot's per-user cooldown.
+	lock := AcquireTransactionLock(partner.UserID)
+	defer ReleaseTransactionLock(lock)
+
+	if balance := GetUserBalance(partner.UserID); balance.Balance < quote.SellPrice {
+		return nil, false, fmt.Errorf("saldo tidak mencukupi: saldo %d, harga %d", balance.Balance, quote.SellPrice)
+	}
+
+	// Reserve the ref ID first; the unique index settles concurrent requests with the same ref ID
+	order = &models.PartnerOrder{
+		PartnerID:     partner.ID,
+		RefID:         refID,
+		PackageCode:   packageCode,
+		PaymentMethod: paymentMethod,
+		Price:         quote.SellPrice,
+		Status:        PartnerOrderProcessing,
+	}
+	if err := config.DB.Create(order).Error; err != nil {
+		if existing, findErr := GetPartnerOrder(partner.ID, refID); findErr == nil {
+			return existing, true, nil
+		}
+		return nil, false, err
+	}
+
+	purchaseResp, err := purchaseProductLocked(partner.UserID, packageCode, paymentMethod, "")
+	if err != nil {
+		finishPartnerOrder(order, PartnerOrderFailed, err.Error())
+		return order, false, nil
+	}
+
+	order.TrxID = purchaseResp.Data.TrxID
+	order.Price = purchaseResp.Data.Price
+	order.Status = PartnerOrderPending
+	order.Message = purchaseResp.Message
+
+	if err := ChargePurchase(partner.UserID, purchaseResp); err != nil {
+		NotifyAdminError(partner.UserID, "H2H Balance Deduction", fmt.Sprintf("Failed to deduct balance for partner %d ref %s trx %s: %v", partner.ID, refID, order.TrxID, err))
+		order.Message = "pembelian diproses, pemotongan saldo menunggu admin"
+	}
+
+	if err := config.DB.Save(order).Error; err != nil {
+		log.Printf("Warning: failed to save partner order %d: %v", order.ID, err)
+	}
+	return order, false, nil
+}
+
+// RefreshPartnerOrder checks the upstream status of a pending order and records a final status
+func RefreshPartnerOrder(order *models.PartnerOrder) error {
+	if order.Status != PartnerOrderPending || order.TrxID == "" {
+		return nil
+	}
+
+	checkResp, err := CheckTransactionStatus(order.TrxID)
+	if err != nil {
+		return err
+	}
+	if !checkResp.Success {
+		return fmt.Errorf("cek transaksi gagal: %s", checkResp.Message)
+	}
+
+	switch outcome := PurchaseOutcome(&checkResp.Data); outcome {
+	case PartnerOrderPending:
+		if time.Since(order.CreatedAt) > partnerStatusGiveUp {
+			NotifyAdminError(0, "H2H Status", fmt.Sprintf("Partner order %d (trx %s) still pending after %s", order.ID, order.TrxID, partnerStatusGiveUp))
+		}
+	default:
+		finishPartnerOrder(order, outcome, checkResp.Data.RCMessage)
+	}
+	return nil
+}
+
+// finishPartnerOrder records a final status and queues the callback, if the partner has one
+func finishPartnerOrder(order *models.PartnerOrder, status, message string) {
+	order.Status = status
+	order.Message = message
+
+	var partner models.Partner
+	if err := config.DB.First(&partner, order.PartnerID).Error; err == nil && partner.CallbackURL != "" {
+		now := time.Now()
+		order.CallbackStatus = PartnerCallbackPending
+		order.NextCallbackAt = &now
+	}
+
+	if err := config.DB.Save(order).Error; err != nil {
+		log.Printf("Warning: failed to save partner order %d: %v", order.ID, err)
+	}
+}
+
+// DeliverPartnerCallback posts the final status of an order to the partner and
+// schedules a retry with backoff when the partner does not answer with 2xx
+func DeliverPartnerCallback(order *models.PartnerOrder) error {
+	var partner models.Partner
+	if err := config.DB.First(&partner, order.PartnerID).Error; err != nil {
+		return err
+	}
+
+	err := postPartnerCallback(&partner, order)
+	order.CallbackAttempts++
+
+	if err == nil {
+		order.CallbackStatus = PartnerCallbackSent
+		order.NextCallbackAt = nil
+		order.CallbackError = ""
+	} else {
+		order.CallbackError = err.Error()
+		if order.CallbackAttempts > len(partnerCallbackBackoff) {
+			order.CallbackStatus = PartnerCallbackFailed
+			order.NextCallbackAt = nil
+			log.Printf("Giving up partner callback for order %d after %d attempts: %v", order.ID, order.CallbackAttempts, err)
+		} else {
+			next := time.Now().Add(partnerCallbackBackoff[order.CallbackAttempts-1])
+			order.NextCallbackAt = &next
+		}
+	}
+
+	if saveErr := config.DB.Save(order).Error; saveErr != nil {
+		log.Printf("Warning: failed to save partner order %d: %v", order.ID, saveErr)
+	}
+	return err
+}
+
+func postPartnerCallback(partner *models.Partner, order *models.PartnerOrder) error {
+	if partner.CallbackURL == "" {
+		return fmt.Errorf("partner has no callback URL")
+	}
+
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(PartnerCallback{
+		RefID:       order.RefID,
+		TrxID:       order.TrxID,
+		PackageCode: order.PackageCode,
+		Price:       order.Price,
+		Status:      order.Status,
+		Message:     order.Message,
+		Timestamp:   timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", partner.CallbackURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", SignPayload(partner.CallbackSecret, body))
+	req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
+
+	client := &http.Client{Timeout: partnerCallbackTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RunPartnerWork fails interrupted orders, polls pending orders for their final status
+// and delivers due callbacks
+func RunPartnerWork() {
+	var interrupted []models.PartnerOrder
+	config.DB.Where("status = ? AND updated_at <= ?", PartnerOrderProcessing, time.Now().Add(-partnerProcessingTimeout)).
+		Order("id ASC").Limit(partnerWorkerBatchLimit).Find(&interrupted)
+	for i := range interrupted {
+		// The balance was not charged, but upstream may have accepted the order
+		NotifyAdminError(0, "H2H Order", fmt.Sprintf("Partner order %d (ref %s, %s) was interrupted while processing; check upstream for an order of partner user and refund or charge manually",
+			interrupted[i].ID, interrupted[i].RefID, interrupted[i].PackageCode))
+		finishPartnerOrder(&interrupted[i], PartnerOrderFailed, "pesanan terputus, hubungi admin")
+	}
+
+	var pending []models.PartnerOrder
+	config.DB.Where("status = ? AND trx_id <> '' AND updated_at <= ?", PartnerOrderPending, time.Now().Add(-partnerStatusPollAfter)).
+		Order("id ASC").Limit(partnerWorkerBatchLimit).Find(&pending)
+	for i := range pending {
+		if err := RefreshPartnerOrder(&pending[i]); err != nil {
+			log.Printf("Warning: failed to refresh partner order %d: %v", pending[i].ID, err)
+		}
+		// Touch the row so the next poll waits another interval
+		config.DB.Model(&pending[i]).Update("updated_at", time.Now())
+	}
+
+	var due []models.PartnerOrder
+	config.DB.Where("callback_status = ? AND next_callback_at <= ?", PartnerCallbackPending, time.Now()).
+		Order("next_callback_at ASC").Limit(partnerWorkerBatchLimit).Find(&due)
+	for i := range due {
+		if err := DeliverPartnerCallback(&due[i]); err != nil {
+			log.Printf("Partner callback for order %d failed (attempt %d): %v", due[i].ID, due[i].CallbackAttempts, err)
+		}
+	}
+}
+
+// StartPartnerWorker runs RunPartnerWork in the background
+func StartPartnerWorker() {
+	go func() {
+		ticker := time.NewTicker(partnerWorkerInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if config.DB != nil {
+				RunPartnerWork()
+			}
+		}
+	}()
+}
+
+// ResendPartnerCallback queues the callback of a finished order again
+func ResendPartnerCallback(orderID uint) error {
+	now := time.Now()
+	result := config.DB.Model(&models.PartnerOrder{}).
+		Where("id = ? AND status IN ?", orderID, []string{PartnerOrderSuccess, PartnerOrderFailed}).
+		Updates(map[string]interface{}{
+			"callback_status":   PartnerCallbackPending,
+			"callback_attempts": 0,
+			"next_callback_at":  &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("pesanan belum final atau tidak ditemukan")
+	}
+	return nil
+}
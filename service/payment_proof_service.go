@@ -0,0 +1,218 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+const (
+	maxPaymentProofSize         = 10 << 20
+	paymentProofDownloadTimeout = 30 * time.Second
+	paymentProofCleanupInterval = 6 * time.Hour
+)
+
+// paymentProofTypes are the image types accepted as payment proof, with their file extension
+var paymentProofTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// DownloadTelegramFile fetches a file the user sent to the bot
+func DownloadTelegramFile(bot *tgbotapi.BotAPI, fileID string) ([]byte, error) {
+	url, err := bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: paymentProofDownloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPaymentProofSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPaymentProofSize {
+		return nil, fmt.Errorf("ukuran gambar maksimal %d MB", maxPaymentProofSize>>20)
+	}
+	return data, nil
+}
+
+// SubmitPaymentProof attaches a transfer screenshot to the user's pending top up, stores
+// it and forwards it to the admins with approve/reject buttons, whose captions are updated
+// once the top up is processed. An image that was already sent, for this or another top
+// up, is refused.
+func SubmitPaymentProof(sender MessageSender, userID int64, fileID string, data []byte) (*models.PaymentProof, error) {
+	tx := GetTransactionByUserID(userID)
+	if tx == nil {
+		return nil, fmt.Errorf("tidak ada top up yang menunggu pembayaran")
+	}
+	TxMutex.RLock()
+	transactionID, amount, username, expiredAt := tx.ID, tx.Amount, tx.Username, tx.ExpiredAt
+	TxMutex.RUnlock()
+	if expiry, err := time.ParseInLocation("2006-01-02 15:04:05", expiredAt, time.Local); err == nil && time.Now().After(expiry) {
+		return nil, fmt.Errorf("top up %s sudah expired. Jika Anda sudah membayar, hubungi admin lewat menu Hubungi Admin", transactionID)
+	}
+
+	if len(data) > maxPaymentProofSize {
+		return nil, fmt.Errorf("ukuran gambar maksimal %d MB", maxPaymentProofSize>>20)
+	}
+	ext, ok := paymentProofTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, fmt.Errorf("bukti transfer harus berupa gambar JPG, PNG atau WEBP")
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if err := checkPaymentProofReuse(userID, transactionID, hash); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(config.GetPaymentProofDir(), time.Now().Format("2006-01"))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("gagal menyimpan bukti transfer: %v", err)
+	}
+	path := filepath.Join(dir, transactionID+"_"+hash[:12]+ext)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, fmt.Errorf("gagal menyimpan bukti transfer: %v", err)
+	}
+
+	proof := models.PaymentProof{
+		TransactionID: transactionID,
+		UserID:        userID,
+		SHA256:        hash,
+		FileID:        fileID,
+		Path:          path,
+		Size:          int64(len(data)),
+	}
+	if err := config.DB.Create(&proof).Error; err != nil {
+		os.Remove(path)
+		// The unique hash index catches the same image sent twice at once
+		if reuseErr := checkPaymentProofReuse(userID, transactionID, hash); reuseErr != nil {
+			return nil, reuseErr
+		}
+		return nil, err
+	}
+
+	var count int64
+	config.DB.Model(&models.PaymentProof{}).Where("transaction_id = ?", transactionID).Count(&count)
+
+	b := NewMessageBuilder(ParseModeMarkdownV2).
+		Raw("🧾 ").Bold("Bukti Transfer Top Up").Raw("\n\n").
+		Field("👤", "User", fmt.Sprintf("%s (%d)", username, userID)).
+		Field("💳", "Nominal", "Rp "+formatRupiah(amount)).
+		Raw("🆔 ").Bold("Transaction ID:").Raw(" ").Code(transactionID).Raw("\n").
+		Field("🕐", "Waktu", proof.CreatedAt.Format("02/01/2006 15:04:05"))
+	if count > 1 {
+		b.Field("📎", "Bukti ke", fmt.Sprintf("%d", count))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Approve", "approve_tx:"+transactionID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Reject", "reject_tx:"+transactionID),
+		),
+	)
+	for _, adminID := range config.GetAdminChatIDs() {
+		photo := tgbotapi.NewPhoto(adminID, tgbotapi.FileBytes{Name: filepath.Base(path), Bytes: data})
+		photo.Caption = b.String()
+		photo.ParseMode = b.ParseMode()
+		photo.ReplyMarkup = keyboard
+		if err := sendTopupNotice(sender, adminID, photo, transactionID, TopupNoticeProof, b.String()); err != nil {
+			log.Printf("Warning: failed to forward payment proof of %s to admin %d: %v", transactionID, adminID, err)
+		}
+	}
+	return &proof, nil
+}
+
+// checkPaymentProofReuse refuses an image that is already attached to a top up, and
+// alerts the admins when it belongs to another one
+func checkPaymentProofReuse(userID int64, transactionID, hash string) error {
+	var existing models.PaymentProof
+	if err := config.DB.Where("sha256 = ?", hash).First(&existing).Error; err != nil {
+		return nil
+	}
+	if existing.TransactionID == transactionID {
+		return fmt.Errorf("bukti transfer ini sudah dikirim untuk top up %s", transactionID)
+	}
+
+	NotifyAdminApprovalNeeded(userID, "Payment Proof Reuse", fmt.Sprintf(
+		"Bukti transfer untuk %s sama dengan bukti top up %s (user %d, %s)",
+		transactionID, existing.TransactionID, existing.UserID, existing.CreatedAt.Format("02/01/2006 15:04")))
+	return fmt.Errorf("bukti transfer ini sudah pernah dipakai. Kirim bukti pembayaran top up yang sekarang")
+}
+
+// GetPaymentProofs returns the proofs sent for a top up, oldest first
+func GetPaymentProofs(transactionID string) ([]models.PaymentProof, error) {
+	var proofs []models.PaymentProof
+	err := config.DB.Where("transaction_id = ?", transactionID).Order("id").Find(&proofs).Error
+	return proofs, err
+}
+
+// HasPaymentProof reports whether the user sent a proof for a top up
+func HasPaymentProof(transactionID string) bool {
+	var count int64
+	config.DB.Model(&models.PaymentProof{}).Where("transaction_id = ?", transactionID).Count(&count)
+	return count > 0
+}
+
+// PurgePaymentProofs deletes the images of proofs sent before the given time. The rows
+// and their hashes stay, so the images can still not be reused.
+func PurgePaymentProofs(before time.Time) (int, error) {
+	var proofs []models.PaymentProof
+	if err := config.DB.Where("path <> '' AND created_at < ?", before).Find(&proofs).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, proof := range proofs {
+		if err := os.Remove(proof.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to delete payment proof %s: %v", proof.Path, err)
+			continue
+		}
+		now := time.Now()
+		if err := config.DB.Model(&proof).Updates(map[string]interface{}{"path": "", "purged_at": &now}).Error; err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartPaymentProofCleanup deletes payment proof images older than PAYMENT_PROOF_RETENTION_DAYS
+func StartPaymentProofCleanup() {
+	go func() {
+		ticker := time.NewTicker(paymentProofCleanupInterval)
+		defer ticker.Stop()
+
+		for ; ; <-ticker.C {
+			if config.DB == nil {
+				continue
+			}
+			purged, err := PurgePaymentProofs(time.Now().Add(-config.GetPaymentProofRetention()))
+			if err != nil {
+				log.Printf("Warning: failed to purge payment proofs: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d payment proof images", purged)
+			}
+		}
+	}()
+}
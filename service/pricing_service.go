@@ -0,0 +1,288 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+const (
+	MarkupFixed   = "fixed"
+	MarkupPercent = "percent"
+)
+
+// ErrPricingRuleNotFound is returned for a pricing rule ID that does not exist
+var ErrPricingRuleNotFound = errors.New("pricing rule not found")
+
+// PriceQuote is the result of applying pricing rules to a package
+type PriceQuote struct {
+	PackageCode   string `json:"package_code"`
+	PaymentMethod string `json:"payment_method"`
+	CostPrice     int64  `json:"cost_price"`
+	SellPrice     int64  `json:"sell_price"`
+	RuleID        uint   `json:"rule_id"` // 0 when the default markup was used
+	Tier          string `json:"tier,omitempty"`
+	RetailPrice   int64  `json:"retail_price,omitempty"` // sell price before the tier price was applied
+}
+
+// Margin returns the difference between sell and cost price
+func (q PriceQuote) Margin() int64 {
+	return q.SellPrice - q.CostPrice
+}
+
+var (
+	pricingRules       []models.PricingRule
+	pricingRulesLoaded bool
+	pricingVersion     uint64 // bumped on every reload
+	pricingMutex       sync.RWMutex
+)
+
+// QuotePrice calculates the sell price of a package for the given payment method
+func QuotePrice(packageCode, paymentMethod string) (*PriceQuote, error) {
+	pkg, err := GetCatalogPackage(packageCode)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := QuotePackagePrice(pkg, paymentMethod)
+	return &quote, nil
+}
+
+// QuotePackagePrice applies the active pricing rules to an already loaded package
+func QuotePackagePrice(pkg *dto.Package, paymentMethod string) PriceQuote {
+	quote := PriceQuote{
+		PackageCode:   pkg.PackageCode,
+		PaymentMethod: paymentMethod,
+		CostPrice:     pkg.Price,
+	}
+
+	rule := SelectPricingRule(getActivePricingRules(), pkg, PackageCategory(*pkg), paymentMethod)
+	if rule == nil {
+		quote.SellPrice = ApplyMarkup(pkg.Price, models.PricingRule{
+			MarkupType:  config.GetDefaultMarkupType(),
+			MarkupValue: config.GetDefaultMarkupValue(),
+		})
+		return quote
+	}
+
+	quote.RuleID = rule.ID
+	quote.SellPrice = ApplyMarkup(pkg.Price, *rule)
+	return quote
+}
+
+// GetStartingPrice returns the lowest sell price across the package's payment methods
+func GetStartingPrice(pkg *dto.Package) int64 {
+	return startingPrice(pkg, func(paymentMethod string) int64 {
+		return QuotePackagePrice(pkg, paymentMethod).SellPrice
+	})
+}
+
+func startingPrice(pkg *dto.Package, price func(paymentMethod string) int64) int64 {
+	if len(pkg.AvailablePaymentMethods) == 0 {
+		return price("")
+	}
+
+	var lowest int64 = -1
+	for _, pm := range pkg.AvailablePaymentMethods {
+		price := price(pm.PaymentMethod)
+		if lowest < 0 || price < lowest {
+			lowest = price
+		}
+	}
+	return lowest
+}
+
+// SelectPricingRule picks the most specific rule matching the package.
+// Package code beats name pattern, which beats category, which beats payment method;
+// equally specific rules are ordered by priority.
+func SelectPricingRule(rules []models.PricingRule, pkg *dto.Package, category, paymentMethod string) *models.PricingRule {
+	var best *models.PricingRule
+	bestScore := -1
+
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.IsActive || !pricingRuleMatches(rule, pkg, category, paymentMethod) {
+			continue
+		}
+
+		score := pricingRuleSpecificity(rule)
+		if score > bestScore || (score == bestScore && rule.Priority > best.Priority) {
+			best = rule
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func pricingRuleMatches(rule *models.PricingRule, pkg *dto.Package, category, paymentMethod string) bool {
+	if rule.PackageCode != "" && rule.PackageCode != pkg.PackageCode {
+		return false
+	}
+	if rule.NamePattern != "" && !strings.Contains(strings.ToLower(pkg.PackageName), strings.ToLower(rule.NamePattern)) {
+		return false
+	}
+	if rule.Category != "" && !strings.EqualFold(rule.Category, category) {
+		return false
+	}
+	if rule.PaymentMethod != "" && !strings.EqualFold(rule.PaymentMethod, paymentMethod) {
+		return false
+	}
+	return true
+}
+
+func pricingRuleSpecificity(rule *models.PricingRule) int {
+	score := 0
+	if rule.PackageCode != "" {
+		score += 8
+	}
+	if rule.NamePattern != "" {
+		score += 4
+	}
+	if rule.Category != "" {
+		score += 2
+	}
+	if rule.PaymentMethod != "" {
+		score++
+	}
+	return score
+}
+
+// ApplyMarkup adds the rule's markup to the cost price and rounds the result up
+func ApplyMarkup(cost int64, rule models.PricingRule) int64 {
+	var price int64
+	switch rule.MarkupType {
+	case MarkupPercent:
+		price = cost + int64(math.Round(float64(cost)*rule.MarkupValue/100))
+	default:
+		price = cost + int64(math.Round(rule.MarkupValue))
+	}
+
+	if rule.RoundTo > 0 && price%rule.RoundTo != 0 {
+		price = (price/rule.RoundTo + 1) * rule.RoundTo
+	}
+
+	if price < 0 {
+		return 0
+	}
+	return price
+}
+
+// getActivePricingRules returns the cached active rules, loading them from the database on first use
+func getActivePricingRules() []models.PricingRule {
+	pricingMutex.RLock()
+	if pricingRulesLoaded {
+		rules := pricingRules
+		pricingMutex.RUnlock()
+		return rules
+	}
+	pricingMutex.RUnlock()
+
+	if config.DB == nil {
+		return nil
+	}
+
+	if err := ReloadPricingRules(); err != nil {
+		log.Printf("Warning: failed to load pricing rules: %v", err)
+	}
+
+	pricingMutex.RLock()
+	defer pricingMutex.RUnlock()
+	return pricingRules
+}
+
+// resetPricingRules drops the cached rules so they are loaded again on next use
+func resetPricingRules() {
+	pricingMutex.Lock()
+	pricingRules = nil
+	pricingRulesLoaded = false
+	pricingVersion++
+	pricingMutex.Unlock()
+}
+
+// getPricingVersion returns a counter that changes whenever pricing rules are reloaded
+func getPricingVersion() uint64 {
+	pricingMutex.RLock()
+	defer pricingMutex.RUnlock()
+	return pricingVersion
+}
+
+// ReloadPricingRules refreshes the in-memory rule cache from the database
+func ReloadPricingRules() error {
+	if config.DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	var rules []models.PricingRule
+	if err := config.DB.Where("is_active = ?", true).Order("priority DESC, id ASC").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	pricingMutex.Lock()
+	pricingRules = rules
+	pricingRulesLoaded = true
+	pricingVersion++
+	pricingMutex.Unlock()
+	return nil
+}
+
+// GetPricingRules returns all pricing rules including inactive ones
+func GetPricingRules() ([]models.PricingRule, error) {
+	var rules []models.PricingRule
+	err := config.DB.Order("priority DESC, id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetPricingRule returns one pricing rule
+func GetPricingRule(id uint) (*models.PricingRule, error) {
+	var rule models.PricingRule
+	if err := config.DB.First(&rule, id).Error; err == gorm.ErrRecordNotFound {
+		return nil, ErrPricingRuleNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load pricing rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// SavePricingRule creates or updates a pricing rule
+func SavePricingRule(rule *models.PricingRule) error {
+	if err := validatePricingRule(rule); err != nil {
+		return err
+	}
+
+	if err := config.DB.Save(rule).Error; err != nil {
+		return err
+	}
+	return ReloadPricingRules()
+}
+
+// DeletePricingRule removes a pricing rule
+func DeletePricingRule(id uint) error {
+	result := config.DB.Delete(&models.PricingRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPricingRuleNotFound
+	}
+	return ReloadPricingRules()
+}
+
+func validatePricingRule(rule *models.PricingRule) error {
+	rule.MarkupType = strings.ToLower(strings.TrimSpace(rule.MarkupType))
+	if rule.MarkupType != MarkupFixed && rule.MarkupType != MarkupPercent {
+		return fmt.Errorf("markup_type must be '%s' or '%s'", MarkupFixed, MarkupPercent)
+	}
+	if rule.RoundTo < 0 {
+		return fmt.Errorf("round_to must not be negative")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -12,13 +13,9 @@ import (
 	"github.com/nabilulilalbab/bottele/models"
 )
 
-const (
-	purchaseURL         = "https://grnstore.domcloud.dev/api/purchase"
-	transactionCheckURL = "https://grnstore.domcloud.dev/api/transaction/check"
-)
-
-// PurchaseProduct makes a purchase using access token
-func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.PurchaseResponse, error) {
+// PurchaseProduct makes a purchase using access token.
+// voucherCode is optional; its discount is taken off the charged price.
+func PurchaseProduct(userID int64, packageCode, paymentMethod, voucherCode string) (*dto.PurchaseResponse, error) {
 	// Check cooldown to prevent spam
 	if err := CheckUserActionCooldown(userID, 10); err != nil {
 		return nil, err
@@ -31,6 +28,12 @@ func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.Purc
 	// Set action time after acquiring lock
 	SetUserActionTime(userID)
 
+	return purchaseProductLocked(userID, packageCode, paymentMethod, voucherCode)
+}
+
+// purchaseProductLocked places an order upstream. The caller holds the user's transaction
+// lock; H2H partners call it directly, without the per-user cooldown of the bot.
+func purchaseProductLocked(userID int64, packageCode, paymentMethod, voucherCode string) (*dto.PurchaseResponse, error) {
 	// Get user session
 	user, err := GetUserSession(userID)
 	if err != nil {
@@ -43,6 +46,33 @@ func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.Purc
 		return nil, fmt.Errorf("sesi login tidak valid, silakan login ulang")
 	}
 
+	// Hidden packages stay out of the storefront and cannot be bought through old buttons either
+	if IsPackageHidden(packageCode) {
+		return nil, fmt.Errorf("produk sedang tidak tersedia, silakan pilih produk lain")
+	}
+
+	// Quote the user's tier price before calling upstream so the charge never relies on a guessed price
+	quote, err := QuotePriceForUser(userID, packageCode, paymentMethod)
+	if err != nil {
+		NotifyAdminError(userID, "Purchase", fmt.Sprintf("Price quote failed for %s: %v", packageCode, err))
+		return nil, fmt.Errorf("produk tidak ditemukan, silakan pilih produk lain")
+	}
+
+	// Reserve the voucher up front so its caps hold while upstream processes the order
+	var redemption *models.VoucherRedemption
+	if voucherCode != "" {
+		redemption, err = ReserveVoucher(voucherCode, userID, VoucherScopePackage, packageCode, quote.SellPrice)
+		if err != nil {
+			return nil, err
+		}
+	}
+	purchased := false
+	defer func() {
+		if redemption != nil && !purchased {
+			CancelVoucherRedemption(redemption)
+		}
+	}()
+
 	// Create purchase request
 	purchaseReq := dto.PurchaseRequest{
 		AccessToken:   user.AccessToken,
@@ -57,7 +87,7 @@ func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.Purc
 		return nil, fmt.Errorf("gagal marshal request: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", purchaseURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", config.GetPurchaseAPIURL(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("gagal membuat request: %v", err)
 	}
@@ -87,18 +117,16 @@ func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.Purc
 		return nil, fmt.Errorf("pembelian tidak dapat diproses saat ini, silakan coba lagi nanti")
 	}
 
-	// Get package price from API (already includes +1500)
-	packagePrice, err := GetPackagePrice(packageCode)
-	if err != nil {
-		fmt.Printf("Warning: failed to get package price: %v\n", err)
-		packagePrice = 1500 // Default fallback
+	// Charge the quoted sell price rather than whatever upstream reports
+	purchaseResp.Data.Price = quote.SellPrice
+	if redemption != nil {
+		purchaseResp.Data.Price -= redemption.Discount
+		ConfirmVoucherRedemption(redemption, purchaseResp.Data.TrxID)
 	}
-
-	// Set the correct price (from API that already includes +1500)
-	purchaseResp.Data.Price = packagePrice
+	purchased = true
 
 	// Save purchase transaction to database
-	err = SavePurchaseTransaction(userID, packageCode, paymentMethod, user.PhoneNumber, &purchaseResp)
+	err = SavePurchaseTransaction(userID, packageCode, paymentMethod, user.PhoneNumber, quote.CostPrice, redemption, &purchaseResp)
 	if err != nil {
 		// Log error to admin but don't fail the purchase
 		NotifyAdminError(userID, "Database", fmt.Sprintf("Failed to save purchase transaction: %v", err))
@@ -107,8 +135,9 @@ func PurchaseProduct(userID int64, packageCode, paymentMethod string) (*dto.Purc
 	return &purchaseResp, nil
 }
 
-// SavePurchaseTransaction saves purchase transaction to database
-func SavePurchaseTransaction(userID int64, packageCode, paymentMethod, phoneNumber string, response *dto.PurchaseResponse) error {
+// SavePurchaseTransaction saves purchase transaction to database.
+// redemption is the voucher used for the purchase, or nil.
+func SavePurchaseTransaction(userID int64, packageCode, paymentMethod, phoneNumber string, costPrice int64, redemption *models.VoucherRedemption, response *dto.PurchaseResponse) error {
 	responseData, _ := json.Marshal(response)
 
 	transaction := models.PurchaseTransaction{
@@ -118,11 +147,16 @@ func SavePurchaseTransaction(userID int64, packageCode, paymentMethod, phoneNumb
 		PackageName:   response.Data.PackageName,
 		PaymentMethod: paymentMethod,
 		PhoneNumber:   phoneNumber,
-		Price:         response.Data.Price, // Use the corrected price
+		Price:         response.Data.Price, // Sell price from the pricing engine, after any voucher discount
+		CostPrice:     costPrice,
 		Status:        "pending",
 		ResponseData:  string(responseData),
 		CreatedAt:     time.Now(),
 	}
+	if redemption != nil {
+		transaction.VoucherCode = redemption.VoucherCode
+		transaction.Discount = redemption.Discount
+	}
 
 	return config.DB.Create(&transaction).Error
 }
@@ -138,7 +172,7 @@ func CheckTransactionStatus(transactionID string) (*dto.TransactionCheckResponse
 		return nil, fmt.Errorf("gagal marshal request: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", transactionCheckURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", config.GetTransactionCheckAPIURL(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("gagal membuat request: %v", err)
 	}
@@ -159,49 +193,101 @@ func CheckTransactionStatus(transactionID string) (*dto.TransactionCheckResponse
 		return nil, fmt.Errorf("gagal decode response: %v", err)
 	}
 
-	// Update transaction status in database
-	if checkResp.Success {
-		status := "success"
-		if checkResp.Data.Status != 1 {
-			status = "failed"
-		}
+	UpdatePurchaseStatus(transactionID, &checkResp)
+	return &checkResp, nil
+}
 
-		config.DB.Model(&models.PurchaseTransaction{}).Where("id = ?", transactionID).Update("status", status)
+// UpdatePurchaseStatus records the upstream status of a purchase. Only the update that
+// moves the status publishes the event and, on success, pays the referral commission.
+func UpdatePurchaseStatus(transactionID string, checkResp *dto.TransactionCheckResponse) {
+	if !checkResp.Success {
+		return
 	}
 
-	return &checkResp, nil
-}
+	// Orders still in progress keep their pending status until upstream settles them
+	status := PurchaseOutcome(&checkResp.Data)
+	if status == "pending" {
+		return
+	}
 
-// GetPackagePrice gets the original price of a package
-func GetPackagePrice(packageCode string) (int64, error) {
-	packages, err := FetchPackages()
+	result := config.DB.Model(&models.PurchaseTransaction{}).Where("id = ? AND status <> ?", transactionID, status).Update("status", status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	transaction, err := GetPurchaseTransaction(transactionID)
 	if err != nil {
-		return 0, err
+		return
 	}
+	publishPurchaseEvent(transaction, status, checkResp.Message)
 
-	for _, pkg := range packages {
-		if pkg.PackageCode == packageCode {
-			return pkg.Price, nil
+	// Commission is only earned on purchases that went through
+	if status == "success" {
+		if _, err := CreditReferralCommission(transaction.UserID, ReferralSourcePurchase, transaction.ID, transaction.Price); err != nil {
+			log.Printf("Warning: failed to credit referral commission for purchase %s: %v", transaction.ID, err)
 		}
 	}
+}
+
+// PurchaseOutcome maps an upstream status to "success", "pending" or "failed", the
+// statuses of purchases and partner orders. A response without a response code is
+// still being processed.
+func PurchaseOutcome(data *dto.TransactionCheckData) string {
+	if data.Status == 1 && data.RC == "00" {
+		return "success"
+	}
+	if data.RC == "" {
+		return "pending"
+	}
+	return "failed"
+}
+
+func publishPurchaseEvent(transaction *models.PurchaseTransaction, status, message string) {
+	eventType := EventPurchaseSuccess
+	if status != "success" {
+		eventType = EventPurchaseFailed
+	}
+	PublishEvent(eventType, map[string]interface{}{
+		"transaction_id": transaction.ID,
+		"user_id":        transaction.UserID,
+		"package_code":   transaction.PackageCode,
+		"package_name":   transaction.PackageName,
+		"payment_method": transaction.PaymentMethod,
+		"price":          transaction.Price,
+		"status":         status,
+		"message":        message,
+	})
+}
+
+// ChargePurchase deducts the quoted sell price of a purchase from the user's balance and
+// checks for a tier promotion. The referral commission follows once the purchase succeeds.
+func ChargePurchase(userID int64, purchaseResp *dto.PurchaseResponse) error {
+	if err := DeductUserBalance(userID, purchaseResp.Data.Price); err != nil {
+		return err
+	}
 
-	return 0, fmt.Errorf("package not found")
+	promoteTierIfEligible(userID)
+	return nil
+}
+
+// GetPackagePrice gets the sell price of a package for the given payment method
+func GetPackagePrice(packageCode, paymentMethod string) (int64, error) {
+	quote, err := QuotePrice(packageCode, paymentMethod)
+	if err != nil {
+		return 0, err
+	}
+
+	return quote.SellPrice, nil
 }
 
 // GetAvailablePaymentMethods gets available payment methods for a package
 func GetAvailablePaymentMethods(packageCode string) ([]dto.PaymentMethod, error) {
-	packages, err := FetchPackages()
+	pkg, err := GetCatalogPackage(packageCode)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, pkg := range packages {
-		if pkg.PackageCode == packageCode {
-			return pkg.AvailablePaymentMethods, nil
-		}
-	}
-
-	return nil, fmt.Errorf("package not found")
+	return pkg.AvailablePaymentMethods, nil
 }
 
 // GetPurchaseTransaction gets a purchase transaction from database by transaction ID
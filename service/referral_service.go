@@ -0,0 +1,263 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// Referral commission sources
+const (
+	ReferralSourcePurchase = "purchase"
+	ReferralSourceVPN      = "vpn"
+	ReferralSourceTopUp    = "topup"
+)
+
+// Referral statuses and block reasons
+const (
+	ReferralActive  = "active"
+	ReferralBlocked = "blocked"
+
+	ReferralBlockSamePhone  = "same_phone"
+	ReferralBlockRapidChurn = "rapid_churn"
+)
+
+var errReferralNotEligible = fmt.Errorf("referral not eligible")
+
+// ReferralSummary is what a user sees about their own referrals
+type ReferralSummary struct {
+	UserID          int64 `json:"user_id"`
+	Referred        int64 `json:"referred"`
+	Active          int64 `json:"active"`
+	Blocked         int64 `json:"blocked"`
+	RewardedEvents  int64 `json:"rewarded_events"`
+	TotalCommission int64 `json:"total_commission"`
+}
+
+// ReferralReport is one referrer's row in the admin report
+type ReferralReport struct {
+	ReferrerID      int64 `json:"referrer_id"`
+	Referred        int64 `json:"referred"`
+	Blocked         int64 `json:"blocked"`
+	RewardedEvents  int64 `json:"rewarded_events"`
+	TotalCommission int64 `json:"total_commission"`
+}
+
+// createReferral stores the referral relation for a freshly referred user.
+// Referrers that collect more than REFERRAL_MAX_PER_HOUR new users in an hour
+// get the extra referrals blocked, so churned throwaway accounts earn nothing.
+func createReferral(tx *gorm.DB, referrerID, refereeID int64) error {
+	referral := models.Referral{
+		ReferrerID: referrerID,
+		RefereeID:  refereeID,
+		Status:     ReferralActive,
+	}
+
+	var recent int64
+	if err := tx.Model(&models.Referral{}).
+		Where("referrer_id = ? AND created_at > ?", referrerID, time.Now().Add(-time.Hour)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if limit := config.GetReferralMaxPerHour(); limit > 0 && recent >= int64(limit) {
+		referral.Status = ReferralBlocked
+		referral.BlockReason = ReferralBlockRapidChurn
+		log.Printf("Referral %d -> %d blocked: %d referrals in the last hour", referrerID, refereeID, recent)
+	}
+
+	return tx.Create(&referral).Error
+}
+
+// CalculateReferralCommission applies the configured fixed or percent commission to an amount
+func CalculateReferralCommission(baseAmount int64) int64 {
+	value := config.GetReferralCommissionValue()
+	if value <= 0 || baseAmount <= 0 {
+		return 0
+	}
+
+	if config.GetReferralCommissionType() == MarkupPercent {
+		return int64(math.Floor(float64(baseAmount) * value / 100))
+	}
+	return int64(value)
+}
+
+// CreditReferralCommission pays the referrer of userID for one of the user's first
+// REFERRAL_MAX_REWARDED_EVENTS purchases or top-ups. sourceType and sourceID identify
+// the event, so crediting the same event twice is a no-op. Returns the amount credited.
+func CreditReferralCommission(userID int64, sourceType, sourceID string, baseAmount int64) (int64, error) {
+	if config.DB == nil {
+		return 0, nil
+	}
+
+	var referral models.Referral
+	err := config.DB.Where("referee_id = ?", userID).First(&referral).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if referral.Status != ReferralActive {
+		return 0, nil
+	}
+
+	maxEvents := config.GetReferralMaxRewardedEvents()
+	if referral.RewardedEvents >= maxEvents {
+		return 0, nil
+	}
+
+	if sharesPhoneNumber(referral.ReferrerID, referral.RefereeID) {
+		blockReferral(referral.ID, ReferralBlockSamePhone)
+		return 0, nil
+	}
+
+	amount := CalculateReferralCommission(baseAmount)
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	var balance int64
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Guard against concurrent events pushing the count past the limit
+		result := tx.Model(&models.Referral{}).
+			Where("id = ? AND status = ? AND rewarded_events < ?", referral.ID, ReferralActive, maxEvents).
+			Updates(map[string]interface{}{
+				"rewarded_events":  gorm.Expr("rewarded_events + 1"),
+				"total_commission": gorm.Expr("total_commission + ?", amount),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errReferralNotEligible
+		}
+
+		err := tx.Create(&models.ReferralCommission{
+			ReferralID: referral.ID,
+			ReferrerID: referral.ReferrerID,
+			RefereeID:  referral.RefereeID,
+			SourceType: sourceType,
+			SourceID:   sourceID,
+			BaseAmount: baseAmount,
+			Amount:     amount,
+			CreatedAt:  time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		balance, err = addUserBalance(tx, referral.ReferrerID, amount)
+		if err != nil {
+			return err
+		}
+		return queueReferralCommission(tx, referral.ReferrerID, amount, balance)
+	})
+	if err == errReferralNotEligible {
+		return 0, nil
+	}
+	if err != nil {
+		// The unique index on source rejects an event that was already credited
+		var existing int64
+		config.DB.Model(&models.ReferralCommission{}).
+			Where("source_type = ? AND source_id = ?", sourceType, sourceID).Count(&existing)
+		if existing > 0 {
+			return 0, nil
+		}
+		NotifyAdminError(referral.ReferrerID, "Referral Commission", fmt.Sprintf("Failed to credit %d for %s %s: %v", amount, sourceType, sourceID, err))
+		return 0, fmt.Errorf("gagal menambah saldo komisi")
+	}
+
+	WakeOutboxDispatcher()
+	publishBalanceAdjusted(referral.ReferrerID, amount, balance)
+	return amount, nil
+}
+
+// creditReferral credits a commission, logging a failure instead of failing the caller's flow
+func creditReferral(userID int64, sourceType, sourceID string, baseAmount int64) {
+	if _, err := CreditReferralCommission(userID, sourceType, sourceID, baseAmount); err != nil {
+		log.Printf("Warning: failed to credit referral commission for %s %s: %v", sourceType, sourceID, err)
+	}
+}
+
+// sharesPhoneNumber reports whether both users logged in with the same phone number
+func sharesPhoneNumber(referrerID, refereeID int64) bool {
+	var users []models.User
+	if err := config.DB.Where("chat_id IN ?", []int64{referrerID, refereeID}).Find(&users).Error; err != nil {
+		return false
+	}
+
+	return len(users) == 2 && users[0].PhoneNumber != "" && users[0].PhoneNumber == users[1].PhoneNumber
+}
+
+func blockReferral(referralID uint, reason string) {
+	err := config.DB.Model(&models.Referral{}).Where("id = ?", referralID).Updates(map[string]interface{}{
+		"status":       ReferralBlocked,
+		"block_reason": reason,
+	}).Error
+	if err != nil {
+		log.Printf("Warning: failed to block referral %d: %v", referralID, err)
+	}
+}
+
+func queueReferralCommission(db *gorm.DB, referrerID int64, amount int64, balance int64) error {
+	text := fmt.Sprintf(`🎁 *Komisi Referral Masuk!*
+
+Teman yang Anda undang baru saja bertransaksi.
+💰 *Komisi:* %s
+💳 *Saldo Terkini:* %s
+
+Ketik /referral untuk melihat ringkasan referral Anda.`,
+		formatRupiah(amount),
+		formatRupiah(balance))
+
+	return QueueTelegramMessage(db, referrerID, text, "Markdown")
+}
+
+// GetReferralSummary returns how many users someone referred and what they earned
+func GetReferralSummary(userID int64) (*ReferralSummary, error) {
+	summary := &ReferralSummary{UserID: userID}
+
+	err := config.DB.Model(&models.Referral{}).
+		Select(`COUNT(*) AS referred,
+			COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0) AS active,
+			COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0) AS blocked,
+			COALESCE(SUM(rewarded_events), 0) AS rewarded_events,
+			COALESCE(SUM(total_commission), 0) AS total_commission`, ReferralActive, ReferralBlocked).
+		Where("referrer_id = ?", userID).
+		Scan(summary).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary.UserID = userID
+	return summary, nil
+}
+
+// GetReferralReport returns every referrer ordered by commission earned
+func GetReferralReport() ([]ReferralReport, error) {
+	var reports []ReferralReport
+	err := config.DB.Model(&models.Referral{}).
+		Select(`referrer_id,
+			COUNT(*) AS referred,
+			COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0) AS blocked,
+			COALESCE(SUM(rewarded_events), 0) AS rewarded_events,
+			COALESCE(SUM(total_commission), 0) AS total_commission`, ReferralBlocked).
+		Group("referrer_id").
+		Order("total_commission DESC, referred DESC").
+		Scan(&reports).Error
+	return reports, err
+}
+
+// GetBlockedReferrals returns referrals stopped by the abuse checks, newest first
+func GetBlockedReferrals(limit int) ([]models.Referral, error) {
+	var referrals []models.Referral
+	err := config.DB.Where("status = ?", ReferralBlocked).
+		Order("updated_at DESC").Limit(limit).Find(&referrals).Error
+	return referrals, err
+}
@@ -0,0 +1,547 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// Report grouping periods
+const (
+	ReportDay   = "day"
+	ReportWeek  = "week"
+	ReportMonth = "month"
+)
+
+const (
+	reportDateLayout   = "2006-01-02"
+	defaultReportDays  = 30
+	maxReportDays      = 366 // bounds the per-period queries of one report
+	maxReportTopN      = 50
+	reportVPNPayMethod = "BALANCE" // VPN is always paid from the balance
+)
+
+// ReportRange bounds a report; From is inclusive, To exclusive
+type ReportRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// TopupReport is the top up inflow of a range. Confirmed top ups count by approval
+// time, the others by creation time.
+type TopupReport struct {
+	Count    int64 `json:"count"`
+	Amount   int64 `json:"amount"`
+	Bonus    int64 `json:"bonus"`
+	Pending  int64 `json:"pending"`
+	Rejected int64 `json:"rejected"`
+	Expired  int64 `json:"expired"`
+}
+
+// SalesReport totals the sales that did not fail; Revenue is the sell price after discounts.
+// A purchase still pending upstream is paid already, so it counts until it fails.
+type SalesReport struct {
+	Count    int64 `json:"count"`
+	Pending  int64 `json:"pending"` // part of Count, still waiting for the upstream result
+	Failed   int64 `json:"failed"`
+	Revenue  int64 `json:"revenue"`
+	Cost     int64 `json:"cost"`
+	Margin   int64 `json:"margin"`
+	Discount int64 `json:"discount"`
+}
+
+// ProductSales is one line of the best sellers; VPN is listed per protocol as vpn:<protocol>
+type ProductSales struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Count   int64  `json:"count"`
+	Revenue int64  `json:"revenue"`
+	Cost    int64  `json:"cost"`
+	Margin  int64  `json:"margin"`
+}
+
+// PaymentMethodShare is the part of sales paid with one method
+type PaymentMethodShare struct {
+	Method  string  `json:"method"`
+	Count   int64   `json:"count"`
+	Amount  int64   `json:"amount"`
+	Percent float64 `json:"percent"` // share of the sales amount
+}
+
+// ActiveUsersPoint counts the users active in one period: users with a confirmed top up
+// or a package or VPN sale that did not fail
+type ActiveUsersPoint struct {
+	Period string    `json:"period"` // 2006-01-02, 2006-W01 or 2006-01
+	Start  time.Time `json:"start"`
+	Users  int64     `json:"users"`
+}
+
+// Report is the business report of a range
+type Report struct {
+	ReportRange
+	Period         string               `json:"period"`
+	Topups         TopupReport          `json:"topups"`
+	Packages       SalesReport          `json:"packages"`
+	VPN            SalesReport          `json:"vpn"`
+	Revenue        int64                `json:"revenue"`
+	Cost           int64                `json:"cost"`
+	Margin         int64                `json:"margin"`
+	ActiveUsers    int64                `json:"active_users"`
+	ActivePeriods  []ActiveUsersPoint   `json:"active_users_by_period"`
+	TopProducts    []ProductSales       `json:"top_products"`
+	PaymentMethods []PaymentMethodShare `json:"payment_methods"`
+}
+
+// NewReportRange builds a range from inclusive YYYY-MM-DD dates; an empty from or to
+// defaults to the last 30 days ending today
+func NewReportRange(from, to string, now time.Time) (ReportRange, error) {
+	end := startOfDay(now).AddDate(0, 0, 1)
+	if to != "" {
+		day, err := time.ParseInLocation(reportDateLayout, to, now.Location())
+		if err != nil {
+			return ReportRange{}, fmt.Errorf("tanggal akhir harus berformat YYYY-MM-DD")
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+
+	start := end.AddDate(0, 0, -defaultReportDays)
+	if from != "" {
+		day, err := time.ParseInLocation(reportDateLayout, from, now.Location())
+		if err != nil {
+			return ReportRange{}, fmt.Errorf("tanggal awal harus berformat YYYY-MM-DD")
+		}
+		start = day
+	}
+
+	if !start.Before(end) {
+		return ReportRange{}, fmt.Errorf("tanggal awal harus sebelum tanggal akhir")
+	}
+	if start.AddDate(0, 0, maxReportDays).Before(end) {
+		return ReportRange{}, fmt.Errorf("rentang laporan maksimal %d hari", maxReportDays)
+	}
+	return ReportRange{From: start, To: end}, nil
+}
+
+// ParseReportArgs reads the range of /report: "hari" (today), "minggu" (this week),
+// "bulan" (this month), "<n>d" (last n days) or "<from> <to>" dates. No argument is the
+// last 30 days.
+func ParseReportArgs(args string, now time.Time) (ReportRange, error) {
+	fields := strings.Fields(strings.ToLower(args))
+	today := startOfDay(now)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	switch {
+	case len(fields) == 0:
+		return NewReportRange("", "", now)
+	case len(fields) == 2:
+		return NewReportRange(fields[0], fields[1], now)
+	case len(fields) > 2:
+		return ReportRange{}, fmt.Errorf("terlalu banyak argumen")
+	}
+
+	switch arg := fields[0]; arg {
+	case "hari", "today":
+		return ReportRange{From: today, To: tomorrow}, nil
+	case "minggu", "week":
+		return ReportRange{From: periodStart(now, ReportWeek), To: tomorrow}, nil
+	case "bulan", "month":
+		return ReportRange{From: periodStart(now, ReportMonth), To: tomorrow}, nil
+	default:
+		days, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
+		if err != nil || days < 1 || days > maxReportDays {
+			return ReportRange{}, fmt.Errorf("periode tidak dikenal: %s", arg)
+		}
+		return ReportRange{From: tomorrow.AddDate(0, 0, -days), To: tomorrow}, nil
+	}
+}
+
+// DefaultReportPeriod groups up to a month by day, up to half a year by week and longer
+// ranges by month
+func DefaultReportPeriod(r ReportRange) string {
+	days := r.To.Sub(r.From).Hours() / 24
+	switch {
+	case days <= 31:
+		return ReportDay
+	case days <= 183:
+		return ReportWeek
+	default:
+		return ReportMonth
+	}
+}
+
+// BuildReport computes the report of a range from the database. period is ReportDay,
+// ReportWeek or ReportMonth, or empty for DefaultReportPeriod; topN limits the best sellers.
+func BuildReport(r ReportRange, period string, topN int) (*Report, error) {
+	if period == "" {
+		period = DefaultReportPeriod(r)
+	}
+	report := &Report{ReportRange: r, Period: period}
+
+	var err error
+	if report.Topups, err = reportTopups(r); err != nil {
+		return nil, err
+	}
+	if report.Packages, err = reportPackageSales(r); err != nil {
+		return nil, err
+	}
+	if report.VPN, err = reportVPNSales(r); err != nil {
+		return nil, err
+	}
+	report.Revenue = report.Packages.Revenue + report.VPN.Revenue
+	report.Cost = report.Packages.Cost + report.VPN.Cost
+	report.Margin = report.Packages.Margin + report.VPN.Margin
+
+	if report.ActiveUsers, report.ActivePeriods, err = GetActiveUsers(r, period); err != nil {
+		return nil, err
+	}
+	if report.TopProducts, err = GetTopProducts(r, topN); err != nil {
+		return nil, err
+	}
+	if report.PaymentMethods, err = GetPaymentMethodMix(r); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func reportTopups(r ReportRange) (TopupReport, error) {
+	var report TopupReport
+
+	var confirmed struct {
+		Count  int64
+		Amount int64
+		Bonus  int64
+	}
+	err := config.DB.Model(&models.Transaction{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(bonus_amount), 0) AS bonus").
+		Where("status = ? AND approved_at >= ? AND approved_at < ?", "confirmed", r.From, r.To).
+		Scan(&confirmed).Error
+	if err != nil {
+		return report, err
+	}
+	report.Count, report.Amount, report.Bonus = confirmed.Count, confirmed.Amount, confirmed.Bonus
+
+	// Expiry is only recorded in memory, so a pending top up past its expiry counts as expired
+	var others struct {
+		Pending  int64
+		Rejected int64
+		Expired  int64
+	}
+	err = config.DB.Model(&models.Transaction{}).
+		Select(`COALESCE(SUM(CASE WHEN status = 'pending' AND expired_at >= ? THEN 1 ELSE 0 END), 0) AS pending,
+			COALESCE(SUM(CASE WHEN status = 'rejected' THEN 1 ELSE 0 END), 0) AS rejected,
+			COALESCE(SUM(CASE WHEN status = 'expired' OR (status = 'pending' AND expired_at < ?) THEN 1 ELSE 0 END), 0) AS expired`,
+			time.Now(), time.Now()).
+		Where("created_at >= ? AND created_at < ?", r.From, r.To).
+		Scan(&others).Error
+	if err != nil {
+		return report, err
+	}
+	report.Pending, report.Rejected, report.Expired = others.Pending, others.Rejected, others.Expired
+	return report, nil
+}
+
+// salesColumns sums a sales table with price, cost_price and discount columns
+const salesColumns = `COALESCE(SUM(CASE WHEN status <> 'failed' THEN 1 ELSE 0 END), 0) AS count,
+	COALESCE(SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END), 0) AS pending,
+	COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) AS failed,
+	COALESCE(SUM(CASE WHEN status <> 'failed' THEN price ELSE 0 END), 0) AS revenue,
+	COALESCE(SUM(CASE WHEN status <> 'failed' THEN cost_price ELSE 0 END), 0) AS cost,
+	COALESCE(SUM(CASE WHEN status <> 'failed' THEN discount ELSE 0 END), 0) AS discount`
+
+func reportPackageSales(r ReportRange) (SalesReport, error) {
+	var report SalesReport
+	err := config.DB.Model(&models.PurchaseTransaction{}).
+		Select(salesColumns).
+		Where("created_at >= ? AND created_at < ?", r.From, r.To).
+		Scan(&report).Error
+	report.Margin = report.Revenue - report.Cost
+	return report, err
+}
+
+func reportVPNSales(r ReportRange) (SalesReport, error) {
+	var report SalesReport
+	err := config.DB.Model(&models.VPNTransaction{}).
+		Select(salesColumns).
+		Where("created_at >= ? AND created_at < ?", r.From, r.To).
+		Scan(&report).Error
+	report.Margin = report.Revenue - report.Cost
+	return report, err
+}
+
+// GetTopProducts returns the best selling packages and VPN protocols by number of sales
+func GetTopProducts(r ReportRange, limit int) ([]ProductSales, error) {
+	if limit <= 0 || limit > maxReportTopN {
+		limit = 10
+	}
+
+	var products []ProductSales
+	err := config.DB.Model(&models.PurchaseTransaction{}).
+		Select("package_code AS code, MAX(package_name) AS name, COUNT(*) AS count, SUM(price) AS revenue, SUM(cost_price) AS cost").
+		Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", r.From, r.To).
+		Group("package_code").
+		Scan(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var vpn []ProductSales
+	err = config.DB.Model(&models.VPNTransaction{}).
+		Select("protocol AS code, COUNT(*) AS count, SUM(price) AS revenue, SUM(cost_price) AS cost").
+		Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", r.From, r.To).
+		Group("protocol").
+		Scan(&vpn).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range vpn {
+		p.Name = "VPN " + strings.ToUpper(p.Code)
+		p.Code = "vpn:" + p.Code
+		products = append(products, p)
+	}
+
+	for i := range products {
+		products[i].Margin = products[i].Revenue - products[i].Cost
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if products[i].Count != products[j].Count {
+			return products[i].Count > products[j].Count
+		}
+		if products[i].Revenue != products[j].Revenue {
+			return products[i].Revenue > products[j].Revenue
+		}
+		return products[i].Code < products[j].Code
+	})
+	if len(products) > limit {
+		products = products[:limit]
+	}
+	return products, nil
+}
+
+// GetPaymentMethodMix splits the sales that did not fail by payment method, largest amount first
+func GetPaymentMethodMix(r ReportRange) ([]PaymentMethodShare, error) {
+	var shares []PaymentMethodShare
+	err := config.DB.Model(&models.PurchaseTransaction{}).
+		Select("payment_method AS method, COUNT(*) AS count, SUM(price) AS amount").
+		Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", r.From, r.To).
+		Group("payment_method").
+		Scan(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var vpn PaymentMethodShare
+	err = config.DB.Model(&models.VPNTransaction{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(price), 0) AS amount").
+		Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", r.From, r.To).
+		Scan(&vpn).Error
+	if err != nil {
+		return nil, err
+	}
+	if vpn.Count > 0 {
+		merged := false
+		for i := range shares {
+			if strings.EqualFold(shares[i].Method, reportVPNPayMethod) {
+				shares[i].Count += vpn.Count
+				shares[i].Amount += vpn.Amount
+				merged = true
+			}
+		}
+		if !merged {
+			vpn.Method = reportVPNPayMethod
+			shares = append(shares, vpn)
+		}
+	}
+
+	var total int64
+	for _, share := range shares {
+		total += share.Amount
+	}
+	for i := range shares {
+		if total > 0 {
+			shares[i].Percent = float64(shares[i].Amount) * 100 / float64(total)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Amount != shares[j].Amount {
+			return shares[i].Amount > shares[j].Amount
+		}
+		return shares[i].Method < shares[j].Method
+	})
+	return shares, nil
+}
+
+// GetActiveUsers counts the users with a confirmed top up or a sale that did not fail in the
+// range, in total and per period. Every period of the range is listed, also empty ones.
+func GetActiveUsers(r ReportRange, period string) (int64, []ActiveUsersPoint, error) {
+	type activity struct {
+		UserID int64
+		At     time.Time
+	}
+	var activities []activity
+
+	var topups []activity
+	err := config.DB.Model(&models.Transaction{}).
+		Select("user_id, approved_at AS at").
+		Where("status = ? AND approved_at >= ? AND approved_at < ?", "confirmed", r.From, r.To).
+		Scan(&topups).Error
+	if err != nil {
+		return 0, nil, err
+	}
+	activities = append(activities, topups...)
+
+	for _, model := range []interface{}{&models.PurchaseTransaction{}, &models.VPNTransaction{}} {
+		var sales []activity
+		err := config.DB.Model(model).
+			Select("user_id, created_at AS at").
+			Where("status <> ? AND created_at >= ? AND created_at < ?", "failed", r.From, r.To).
+			Scan(&sales).Error
+		if err != nil {
+			return 0, nil, err
+		}
+		activities = append(activities, sales...)
+	}
+
+	var points []ActiveUsersPoint
+	users := make(map[string]map[int64]bool)
+	for start := periodStart(r.From, period); start.Before(r.To); start = nextPeriod(start, period) {
+		key := periodKey(start, period)
+		points = append(points, ActiveUsersPoint{Period: key, Start: start})
+		users[key] = make(map[int64]bool)
+	}
+
+	all := make(map[int64]bool)
+	for _, a := range activities {
+		all[a.UserID] = true
+		if bucket, ok := users[periodKey(a.At.In(r.From.Location()), period)]; ok {
+			bucket[a.UserID] = true
+		}
+	}
+	for i := range points {
+		points[i].Users = int64(len(users[points[i].Period]))
+	}
+	return int64(len(all)), points, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// periodStart returns the start of the day, the week (from Monday) or the month containing t
+func periodStart(t time.Time, period string) time.Time {
+	day := startOfDay(t)
+	switch period {
+	case ReportWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case ReportMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day
+	}
+}
+
+func nextPeriod(start time.Time, period string) time.Time {
+	switch period {
+	case ReportWeek:
+		return start.AddDate(0, 0, 7)
+	case ReportMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func periodKey(t time.Time, period string) string {
+	switch period {
+	case ReportWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case ReportMonth:
+		return t.Format("2006-01")
+	default:
+		return t.Format(reportDateLayout)
+	}
+}
+
+// IsReportPeriod reports whether period is ReportDay, ReportWeek or ReportMonth
+func IsReportPeriod(period string) bool {
+	return period == ReportDay || period == ReportWeek || period == ReportMonth
+}
+
+// FormatReport renders a report as Telegram Markdown for /report
+func FormatReport(r *Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 *Laporan %s - %s*\n\n",
+		r.From.Format("02/01/2006"), r.To.AddDate(0, 0, -1).Format("02/01/2006"))
+
+	fmt.Fprintf(&b, "💳 *Top Up Masuk:* %d transaksi, Rp %s", r.Topups.Count, formatRupiah(r.Topups.Amount))
+	if r.Topups.Bonus > 0 {
+		fmt.Fprintf(&b, " (+ bonus Rp %s)", formatRupiah(r.Topups.Bonus))
+	}
+	fmt.Fprintf(&b, "\n• ⏳ Pending: %d • ❌ Ditolak: %d • ⏰ Expired: %d\n\n",
+		r.Topups.Pending, r.Topups.Rejected, r.Topups.Expired)
+
+	for _, sales := range []struct {
+		label string
+		SalesReport
+	}{{"🛒 *Paket Data*", r.Packages}, {"🔐 *VPN*", r.VPN}} {
+		fmt.Fprintf(&b, "%s: %d terjual, %d gagal", sales.label, sales.Count, sales.Failed)
+		if sales.Pending > 0 {
+			fmt.Fprintf(&b, " (%d masih diproses)", sales.Pending)
+		}
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "• Omzet: Rp %s • Modal: Rp %s • Margin: Rp %s\n",
+			formatRupiah(sales.Revenue), formatRupiah(sales.Cost), formatSignedRupiah(sales.Margin))
+		if sales.Discount > 0 {
+			fmt.Fprintf(&b, "• Diskon voucher: Rp %s\n", formatRupiah(sales.Discount))
+		}
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "💰 *Total Penjualan:* Rp %s\n📦 *Total Modal:* Rp %s\n📈 *Total Margin:* Rp %s",
+		formatRupiah(r.Revenue), formatRupiah(r.Cost), formatSignedRupiah(r.Margin))
+	if r.Revenue > 0 {
+		fmt.Fprintf(&b, " (%.1f%%)", float64(r.Margin)*100/float64(r.Revenue))
+	}
+	b.WriteString("\n\n")
+
+	if len(r.TopProducts) > 0 {
+		b.WriteString("🏆 *Produk Terlaris:*\n")
+		for i, p := range r.TopProducts {
+			fmt.Fprintf(&b, "%d. %s - %dx, Rp %s\n", i+1, EscapeMarkdown(p.Name), p.Count, formatRupiah(p.Revenue))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.PaymentMethods) > 0 {
+		b.WriteString("💳 *Metode Pembayaran:*\n")
+		for _, m := range r.PaymentMethods {
+			fmt.Fprintf(&b, "• %s: %dx, Rp %s (%.0f%%)\n", EscapeMarkdown(m.Method), m.Count, formatRupiah(m.Amount), m.Percent)
+		}
+		b.WriteString("\n")
+	}
+
+	periodNames := map[string]string{ReportDay: "hari", ReportWeek: "minggu", ReportMonth: "bulan"}
+	fmt.Fprintf(&b, "👥 *User Aktif:* %d\n", r.ActiveUsers)
+	points := r.ActivePeriods
+	if len(points) > 7 {
+		points = points[len(points)-7:]
+		fmt.Fprintf(&b, "_%d %s terakhir:_\n", len(points), periodNames[r.Period])
+	}
+	for _, p := range points {
+		fmt.Fprintf(&b, "• %s: %d\n", EscapeMarkdown(p.Period), p.Users)
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func formatSignedRupiah(amount int64) string {
+	if amount < 0 {
+		return "-" + formatRupiah(-amount)
+	}
+	return formatRupiah(amount)
+}
@@ -1,56 +1,433 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/nabilulilalbab/bottele/dto"
 )
 
-const (
-	searchURL = "https://grnstore.domcloud.dev/api/user/products/search"
+// searchSynonyms maps common spellings to a single canonical token
+var searchSynonyms = map[string]string{
+	"giga":      "gb",
+	"gigabyte":  "gb",
+	"mega":      "mb",
+	"megabyte":  "mb",
+	"unli":      "unlimited",
+	"unlimit":   "unlimited",
+	"unlimted":  "unlimited",
+	"sepuasnya": "unlimited",
+	"hr":        "hari",
+	"day":       "hari",
+	"days":      "hari",
+	"bln":       "bulan",
+	"month":     "bulan",
+	"mgg":       "minggu",
+	"week":      "minggu",
+}
+
+// searchStopwords are dropped from queries unless nothing else is left
+var searchStopwords = map[string]bool{
+	"paket": true,
+	"kuota": true,
+	"data":  true,
+	"yang":  true,
+	"dan":   true,
+	"untuk": true,
+}
+
+// SearchIndex is an in-memory index over catalog entries
+type SearchIndex struct {
+	docs []searchDoc
+}
+
+type searchDoc struct {
+	entry  CatalogEntry
+	tokens []string
+	phrase string // normalized tokens joined by spaces, for phrase matching
+}
+
+type searchHit struct {
+	entry CatalogEntry
+	score int
+	price int64
+}
+
+var (
+	searchIndex        *SearchIndex
+	searchIndexVersion [2]uint64
+	searchIndexMutex   sync.Mutex
 )
 
-// SearchProducts searches for products based on criteria
-func SearchProducts(query string, minPrice, maxPrice int64, paymentMethod string) (*dto.ApiResponse, error) {
-	searchReq := dto.SearchRequest{
-		Query:         query,
-		MinPrice:      minPrice,
-		MaxPrice:      maxPrice,
-		PaymentMethod: paymentMethod,
+// NewSearchIndex tokenizes the entries into a new index
+func NewSearchIndex(entries []CatalogEntry) *SearchIndex {
+	idx := &SearchIndex{docs: make([]searchDoc, 0, len(entries))}
+	for _, entry := range entries {
+		text := strings.Join([]string{
+			entry.DisplayName,
+			entry.Package.PackageName,
+			entry.Package.PackageNameAliasShort,
+			entry.Category,
+			entry.Package.PackageCode,
+		}, " ")
+
+		tokens := uniqueTokens(NormalizeSearchText(text))
+		idx.docs = append(idx.docs, searchDoc{
+			entry:  entry,
+			tokens: tokens,
+			phrase: " " + strings.Join(NormalizeSearchText(entry.DisplayName+" "+entry.Package.PackageName), " ") + " ",
+		})
 	}
+	return idx
+}
 
-	jsonData, err := json.Marshal(searchReq)
-	if err != nil {
-		return nil, fmt.Errorf("gagal marshal request: %v", err)
+// Search returns the entries matching every query token, best matches first.
+// An empty query matches everything so price and payment filters can be used alone.
+func (idx *SearchIndex) Search(req dto.SearchRequest) []CatalogEntry {
+	queryTokens := searchQueryTokens(req.Query)
+	queryPhrase := " " + strings.Join(queryTokens, " ") + " "
+
+	// Filter and sort on the price the viewer actually pays
+	tier := TierRetail
+	if req.UserID != 0 {
+		tier = GetUserTier(req.UserID)
 	}
 
-	req, err := http.NewRequest("POST", searchURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("gagal membuat request: %v", err)
+	var hits []searchHit
+	for _, doc := range idx.docs {
+		if req.PaymentMethod != "" && !packageHasPaymentMethod(doc.entry.Package, req.PaymentMethod) {
+			continue
+		}
+
+		score := 0
+		matched := true
+		for _, qt := range queryTokens {
+			tokenScore := bestTokenScore(qt, doc.tokens)
+			if tokenScore == 0 {
+				matched = false
+				break
+			}
+			score += tokenScore
+		}
+		if !matched {
+			continue
+		}
+
+		if len(queryTokens) > 1 && strings.Contains(doc.phrase, queryPhrase) {
+			score += 2 * len(queryTokens)
+		}
+		if doc.entry.Featured {
+			score++
+		}
+
+		var price int64
+		if req.PaymentMethod != "" {
+			quote := QuotePackagePrice(&doc.entry.Package, req.PaymentMethod)
+			ApplyTierPrice(&quote, tier)
+			price = quote.SellPrice
+		} else {
+			price = startingPriceForTier(&doc.entry.Package, tier)
+		}
+		if req.MinPrice > 0 && price < req.MinPrice {
+			continue
+		}
+		if req.MaxPrice > 0 && price > req.MaxPrice {
+			continue
+		}
+
+		hits = append(hits, searchHit{entry: doc.entry, score: score, price: price})
 	}
 
-	req.Header.Set("accept", "application/json")
-	req.Header.Set("X-API-Key", apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].price < hits[j].price
+	})
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	results := make([]CatalogEntry, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, hit.entry)
+	}
+	return results
+}
+
+// SearchCatalog searches the visible storefront, rebuilding the index when the catalog or overrides change
+func SearchCatalog(req dto.SearchRequest) ([]CatalogEntry, error) {
+	entries, err := GetStorefront()
 	if err != nil {
-		return nil, fmt.Errorf("gagal mengirim request: %v", err)
+		return nil, err
+	}
+
+	version := [2]uint64{getCatalogVersion(), getOverrideVersion()}
+
+	searchIndexMutex.Lock()
+	if searchIndex == nil || searchIndexVersion != version {
+		searchIndex = NewSearchIndex(entries)
+		searchIndexVersion = version
+	}
+	idx := searchIndex
+	searchIndexMutex.Unlock()
+
+	return idx.Search(req), nil
+}
+
+// ParseSearchQuery extracts "min:", "max:" and "bayar:" filters from a free-text query
+func ParseSearchQuery(text string) dto.SearchRequest {
+	var req dto.SearchRequest
+	var words []string
+
+	for _, word := range strings.Fields(text) {
+		lower := strings.ToLower(word)
+		switch {
+		case strings.HasPrefix(lower, "min:"):
+			req.MinPrice = parseSearchPrice(lower[4:])
+		case strings.HasPrefix(lower, "max:"):
+			req.MaxPrice = parseSearchPrice(lower[4:])
+		case strings.HasPrefix(lower, "bayar:"):
+			req.PaymentMethod = strings.ToUpper(word[6:])
+		default:
+			words = append(words, word)
+		}
+	}
+
+	req.Query = strings.Join(words, " ")
+	return req
+}
+
+// parseSearchPrice accepts "50000", "50.000" and "50k"
+func parseSearchPrice(value string) int64 {
+	multiplier := int64(1)
+	if strings.HasSuffix(value, "k") || strings.HasSuffix(value, "rb") {
+		multiplier = 1000
+		value = strings.TrimRight(value, "krb")
+	}
+
+	var price int64
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			price = price*10 + int64(r-'0')
+		}
+	}
+	return price * multiplier
+}
+
+// NormalizeSearchText lowercases, splits letters from digits and applies synonyms.
+// "Kuota 75GB Unli" becomes ["kuota", "75", "gb", "unlimited"].
+func NormalizeSearchText(text string) []string {
+	var tokens []string
+	var current []rune
+	var currentIsDigit bool
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		token := string(current)
+		if canonical, ok := searchSynonyms[token]; ok {
+			token = canonical
+		}
+		tokens = append(tokens, token)
+		current = current[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsDigit(r):
+			if len(current) > 0 && !currentIsDigit {
+				flush()
+			}
+			currentIsDigit = true
+			current = append(current, r)
+		case unicode.IsLetter(r):
+			if len(current) > 0 && currentIsDigit {
+				flush()
+			}
+			currentIsDigit = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+func searchQueryTokens(query string) []string {
+	tokens := NormalizeSearchText(query)
+
+	var filtered []string
+	for _, token := range tokens {
+		if !searchStopwords[token] {
+			filtered = append(filtered, token)
+		}
+	}
+	if len(filtered) == 0 {
+		return tokens
+	}
+	return filtered
+}
+
+// bestTokenScore scores a query token against a document: 3 for an exact match,
+// 2 for a prefix match and 1 for a match within the typo tolerance
+func bestTokenScore(queryToken string, docTokens []string) int {
+	best := 0
+	isNumber := isDigits(queryToken)
+
+	for _, token := range docTokens {
+		if token == queryToken {
+			return 3
+		}
+		if isNumber {
+			continue // numbers only match exactly, "7" must not find "75"
+		}
+		if len(queryToken) >= 2 && strings.HasPrefix(token, queryToken) {
+			best = 2
+			continue
+		}
+		if best < 1 && withinTypoTolerance(queryToken, token) {
+			best = 1
+		}
+	}
+	return best
+}
+
+// withinTypoTolerance allows one edit for words of 4-6 letters and two for longer words
+func withinTypoTolerance(a, b string) bool {
+	maxEdits := 0
+	switch {
+	case len(a) >= 7:
+		maxEdits = 2
+	case len(a) >= 4:
+		maxEdits = 1
+	}
+	if maxEdits == 0 || isDigits(b) {
+		return false
+	}
+	if diff := len(a) - len(b); diff > maxEdits || -diff > maxEdits {
+		return false
+	}
+	return editDistance(a, b) <= maxEdits
+}
+
+// editDistance is the Damerau-Levenshtein (optimal string alignment) distance
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+func packageHasPaymentMethod(pkg dto.Package, paymentMethod string) bool {
+	for _, pm := range pkg.AvailablePaymentMethods {
+		if strings.EqualFold(pm.PaymentMethod, paymentMethod) {
+			return true
+		}
 	}
-	defer resp.Body.Close()
+	return false
+}
 
-	var searchResp dto.ApiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&searchResp); err != nil {
-		return nil, fmt.Errorf("gagal decode response: %v", err)
+func uniqueTokens(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	unique := tokens[:0]
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			unique = append(unique, token)
+		}
 	}
+	return unique
+}
 
-	if !searchResp.Success {
-		return nil, fmt.Errorf("pencarian gagal: %s", searchResp.Message)
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type cachedSearch struct {
+	results   []CatalogEntry
+	version   [4]uint64
+	expiresAt time.Time
+}
+
+var (
+	searchCache      = make(map[string]cachedSearch)
+	searchCacheMutex sync.Mutex
+)
+
+// resetSearchCache drops all cached search results
+func resetSearchCache() {
+	searchCacheMutex.Lock()
+	searchCache = make(map[string]cachedSearch)
+	searchCacheMutex.Unlock()
+}
+
+// maxSearchCacheEntries bounds the result cache; it is cleared when full
+const maxSearchCacheEntries = 1000
+
+// SearchCatalogCached is SearchCatalog with a short-lived result cache keyed by the normalized query
+// and the user's tier. Used by inline mode, where Telegram sends a query on almost every keystroke.
+func SearchCatalogCached(query string, userID int64, ttl time.Duration) ([]CatalogEntry, error) {
+	req := ParseSearchQuery(query)
+	req.UserID = userID
+	key := fmt.Sprintf("%s|%d|%d|%s|%s", strings.Join(searchQueryTokens(req.Query), " "), req.MinPrice, req.MaxPrice, req.PaymentMethod, GetUserTier(userID))
+	// Results are filtered and ordered by price, so pricing changes invalidate them too
+	version := [4]uint64{getCatalogVersion(), getOverrideVersion(), getPricingVersion(), getTierPriceVersion()}
+
+	searchCacheMutex.Lock()
+	cached, exists := searchCache[key]
+	searchCacheMutex.Unlock()
+
+	if exists && cached.version == version && time.Now().Before(cached.expiresAt) {
+		return cached.results, nil
+	}
+
+	results, err := SearchCatalog(req)
+	if err != nil {
+		return nil, err
+	}
+
+	searchCacheMutex.Lock()
+	if len(searchCache) >= maxSearchCacheEntries {
+		searchCache = make(map[string]cachedSearch)
+	}
+	searchCache[key] = cachedSearch{
+		results:   results,
+		version:   version,
+		expiresAt: time.Now().Add(ttl),
 	}
+	searchCacheMutex.Unlock()
 
-	return &searchResp, nil
-}
\ No newline at end of file
+	return results, nil
+}
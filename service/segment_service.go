@@ -0,0 +1,216 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// BroadcastSegment selects the users a broadcast goes to. Every condition that is set
+// must hold; a segment without conditions is every user.
+type BroadcastSegment struct {
+	ToppedUpWithinDays    int      `json:"topped_up_within_days,omitempty"`    // confirmed top up in the last N days
+	MinBalance            int64    `json:"min_balance,omitempty"`              // balance of at least this amount
+	VPNExpiringWithinDays int      `json:"vpn_expiring_within_days,omitempty"` // an active VPN expiring in the next N days
+	Tiers                 []string `json:"tiers,omitempty"`                    // price tier is one of these
+	NeverPurchased        bool     `json:"never_purchased,omitempty"`          // no successful package or VPN purchase
+}
+
+// BroadcastSegmentPreset is a segment offered as a button in the broadcast flow
+type BroadcastSegmentPreset struct {
+	Label   string
+	Segment BroadcastSegment
+}
+
+// BroadcastSegmentPresets are the segments admins pick from most often
+var BroadcastSegmentPresets = []BroadcastSegmentPreset{
+	{Label: "👥 Semua user"},
+	{Label: "💳 Top up 30 hari terakhir", Segment: BroadcastSegment{ToppedUpWithinDays: 30}},
+	{Label: "💰 Saldo ≥ 50.000", Segment: BroadcastSegment{MinBalance: 50000}},
+	{Label: "🔐 VPN habis minggu ini", Segment: BroadcastSegment{VPNExpiringWithinDays: 7}},
+	{Label: "🏪 Reseller & Agen", Segment: BroadcastSegment{Tiers: []string{TierReseller, TierAgent}}},
+	{Label: "🆕 Belum pernah beli", Segment: BroadcastSegment{NeverPurchased: true}},
+}
+
+// ParseBroadcastSegment reads a segment spec: space separated conditions
+// "topup:<days>", "balance:<min>", "vpn:<days>", "tier:<tier>[,<tier>]" and
+// "nopurchase". An empty spec, or "all", is every user.
+func ParseBroadcastSegment(spec string) (BroadcastSegment, error) {
+	var segment BroadcastSegment
+	for _, field := range strings.Fields(strings.ToLower(spec)) {
+		key, value, _ := strings.Cut(field, ":")
+		switch key {
+		case "all", "semua":
+		case "nopurchase":
+			segment.NeverPurchased = true
+		case "topup", "vpn":
+			days, err := strconv.Atoi(value)
+			if err != nil || days <= 0 {
+				return segment, fmt.Errorf("jumlah hari tidak valid: %s", field)
+			}
+			if key == "topup" {
+				segment.ToppedUpWithinDays = days
+			} else {
+				segment.VPNExpiringWithinDays = days
+			}
+		case "balance", "saldo":
+			amount, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || amount <= 0 {
+				return segment, fmt.Errorf("nominal saldo tidak valid: %s", field)
+			}
+			segment.MinBalance = amount
+		case "tier":
+			for _, name := range strings.Split(value, ",") {
+				tier, err := NormalizeTier(name)
+				if err != nil || name == "" {
+					return segment, fmt.Errorf("tier tidak dikenal: %s (retail, reseller, agent)", name)
+				}
+				segment.Tiers = append(segment.Tiers, tier)
+			}
+		default:
+			return segment, fmt.Errorf("kondisi segmen tidak dikenal: %s", field)
+		}
+	}
+	return segment, nil
+}
+
+// IsEmpty reports whether the segment has no conditions
+func (s BroadcastSegment) IsEmpty() bool {
+	return s.ToppedUpWithinDays == 0 && s.MinBalance == 0 && s.VPNExpiringWithinDays == 0 &&
+		len(s.Tiers) == 0 && !s.NeverPurchased
+}
+
+// String returns the spec ParseBroadcastSegment reads back
+func (s BroadcastSegment) String() string {
+	var fields []string
+	if s.ToppedUpWithinDays > 0 {
+		fields = append(fields, fmt.Sprintf("topup:%d", s.ToppedUpWithinDays))
+	}
+	if s.MinBalance > 0 {
+		fields = append(fields, fmt.Sprintf("balance:%d", s.MinBalance))
+	}
+	if s.VPNExpiringWithinDays > 0 {
+		fields = append(fields, fmt.Sprintf("vpn:%d", s.VPNExpiringWithinDays))
+	}
+	if len(s.Tiers) > 0 {
+		fields = append(fields, "tier:"+strings.Join(s.Tiers, ","))
+	}
+	if s.NeverPurchased {
+		fields = append(fields, "nopurchase")
+	}
+	return strings.Join(fields, " ")
+}
+
+// Describe returns the segment in words for admins
+func (s BroadcastSegment) Describe() string {
+	if s.IsEmpty() {
+		return "semua user"
+	}
+	var parts []string
+	if s.ToppedUpWithinDays > 0 {
+		parts = append(parts, fmt.Sprintf("top up dalam %d hari terakhir", s.ToppedUpWithinDays))
+	}
+	if s.MinBalance > 0 {
+		parts = append(parts, "saldo minimal Rp "+formatRupiah(s.MinBalance))
+	}
+	if s.VPNExpiringWithinDays > 0 {
+		parts = append(parts, fmt.Sprintf("VPN habis dalam %d hari", s.VPNExpiringWithinDays))
+	}
+	if len(s.Tiers) > 0 {
+		names := make([]string, len(s.Tiers))
+		for i, tier := range s.Tiers {
+			names[i] = TierName(tier)
+		}
+		parts = append(parts, "tier "+strings.Join(names, "/"))
+	}
+	if s.NeverPurchased {
+		parts = append(parts, "belum pernah beli")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// query selects the user IDs of the segment from active users who have not blocked the bot
+func (s BroadcastSegment) query() *gorm.DB {
+	now := time.Now()
+	query := config.DB.Model(&models.ActiveUser{}).Where("blocked_at IS NULL")
+
+	if s.ToppedUpWithinDays > 0 {
+		since := now.AddDate(0, 0, -s.ToppedUpWithinDays)
+		query = query.Where("user_id IN (?)", config.DB.Model(&models.Transaction{}).
+			Select("user_id").Where("status = ? AND approved_at >= ?", "confirmed", since))
+	}
+	if s.MinBalance > 0 {
+		query = query.Where("user_id IN (?)", config.DB.Model(&models.UserBalance{}).
+			Select("user_id").Where("balance >= ?", s.MinBalance))
+	}
+	if s.VPNExpiringWithinDays > 0 {
+		until := now.AddDate(0, 0, s.VPNExpiringWithinDays)
+		// The soft delete scope of the model leaves deleted VPN accounts out
+		query = query.Where("user_id IN (?)", config.DB.Model(&models.VPNUser{}).
+			Select("user_id").Where("expired_at > ? AND expired_at <= ?", now, until))
+	}
+	if len(s.Tiers) > 0 {
+		tiers := config.DB.Model(&models.UserTier{}).Select("user_id").Where("tier IN ?", s.Tiers)
+		// Users without a tier row are retail
+		if containsString(s.Tiers, TierRetail) {
+			query = query.Where("(user_id IN (?) OR user_id NOT IN (?))", tiers, config.DB.Model(&models.UserTier{}).Select("user_id"))
+		} else {
+			query = query.Where("user_id IN (?)", tiers)
+		}
+	}
+	if s.NeverPurchased {
+		// A purchase still pending upstream counts as bought
+		query = query.
+			Where("user_id NOT IN (?)", config.DB.Model(&models.PurchaseTransaction{}).Select("user_id").Where("status <> ?", "failed")).
+			Where("user_id NOT IN (?)", config.DB.Model(&models.VPNTransaction{}).Select("user_id").Where("status <> ?", "failed"))
+	}
+	return query
+}
+
+// ResolveBroadcastSegment returns the chat IDs of the users in a segment. Users flagged
+// as having blocked the bot are left out.
+func ResolveBroadcastSegment(s BroadcastSegment) ([]int64, error) {
+	if s.IsEmpty() {
+		blocked, err := blockedUserIDs()
+		if err != nil {
+			return nil, err
+		}
+		var userIDs []int64
+		for _, id := range GetAllUserIDs() {
+			if !blocked[id] {
+				userIDs = append(userIDs, id)
+			}
+		}
+		return userIDs, nil
+	}
+
+	var userIDs []int64
+	err := s.query().Order("user_id").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// CountBroadcastSegment returns how many users a broadcast to the segment would reach
+func CountBroadcastSegment(s BroadcastSegment) (int, error) {
+	if s.IsEmpty() {
+		userIDs, err := ResolveBroadcastSegment(s)
+		return len(userIDs), err
+	}
+
+	var count int64
+	err := s.query().Count(&count).Error
+	return int(count), err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
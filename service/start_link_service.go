@@ -0,0 +1,60 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Telegram /start payloads allow at most 64 characters from [A-Za-z0-9_-]
+const maxStartPayloadLength = 64
+
+var startPayloadPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,62}$`)
+
+// EncodeProductStartPayload builds a /start payload that opens a product. Codes with
+// characters Telegram does not accept are base64 encoded, and codes too long for that are
+// replaced by a hash that is looked up in the catalog.
+func EncodeProductStartPayload(productCode string) string {
+	if startPayloadPattern.MatchString(productCode) {
+		return "p_" + productCode
+	}
+	if payload := "pb_" + base64.RawURLEncoding.EncodeToString([]byte(productCode)); len(payload) <= maxStartPayloadLength {
+		return payload
+	}
+	return "ph_" + productCodeHash(productCode)
+}
+
+// DecodeProductStartPayload returns the product code of a payload from
+// EncodeProductStartPayload, and false when the payload does not open a product
+func DecodeProductStartPayload(payload string) (string, bool) {
+	switch {
+	case strings.HasPrefix(payload, "ph_"):
+		hash := strings.TrimPrefix(payload, "ph_")
+		packages, err := GetCatalog()
+		if err == nil {
+			for _, pkg := range packages {
+				if productCodeHash(pkg.PackageCode) == hash {
+					return pkg.PackageCode, true
+				}
+			}
+		}
+		// Unknown or no longer in the catalog: the product detail reports it as not found
+		return hash, true
+	case strings.HasPrefix(payload, "pb_"):
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payload, "pb_"))
+		if err != nil {
+			return "", false
+		}
+		return string(decoded), true
+	case strings.HasPrefix(payload, "p_"):
+		return strings.TrimPrefix(payload, "p_"), true
+	}
+	return "", false
+}
+
+func productCodeHash(productCode string) string {
+	sum := sha1.Sum([]byte(productCode))
+	return hex.EncodeToString(sum[:8])
+}
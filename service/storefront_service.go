@@ -0,0 +1,293 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// CatalogEntry is an upstream package combined with its local override
+type CatalogEntry struct {
+	Package     dto.Package `json:"package"`
+	DisplayName string      `json:"display_name"`
+	Category    string      `json:"category"`
+	Featured    bool        `json:"featured"`
+	Hidden      bool        `json:"hidden"`
+	SortWeight  int         `json:"sort_weight"`
+}
+
+// CategorySummary is a storefront category with the number of visible packages in it
+type CategorySummary struct {
+	Name  string `json:"name"`
+	Key   string `json:"key"` // short stable ID for callback data, see CategoryKey
+	Count int    `json:"count"`
+}
+
+var (
+	catalogOverrides       = make(map[string]models.CatalogOverride)
+	catalogOverridesLoaded bool
+	overrideVersion        uint64 // bumped on every reload
+	overrideMutex          sync.RWMutex
+)
+
+// GetStorefront returns the visible catalog, featured packages first, then by sort weight
+func GetStorefront() ([]CatalogEntry, error) {
+	entries, err := GetCatalogEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]CatalogEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Hidden {
+			visible = append(visible, entry)
+		}
+	}
+
+	sort.SliceStable(visible, func(i, j int) bool {
+		if visible[i].Featured != visible[j].Featured {
+			return visible[i].Featured
+		}
+		return visible[i].SortWeight > visible[j].SortWeight
+	})
+
+	return visible, nil
+}
+
+// GetStorefrontByCategory returns the visible packages of a single category
+func GetStorefrontByCategory(category string) ([]CatalogEntry, error) {
+	entries, err := GetStorefront()
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []CatalogEntry
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Category, category) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	return filtered, nil
+}
+
+// GetStorefrontCategories returns the categories that have at least one visible package.
+// Names differing only in case are one category, shown with the spelling seen first.
+func GetStorefrontCategories() ([]CategorySummary, error) {
+	entries, err := GetStorefront()
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*CategorySummary)
+	var keys []string
+	for _, entry := range entries {
+		key := CategoryKey(entry.Category)
+		summary, exists := byKey[key]
+		if !exists {
+			summary = &CategorySummary{Name: entry.Category, Key: key}
+			byKey[key] = summary
+			keys = append(keys, key)
+		}
+		summary.Count++
+	}
+
+	categories := make([]CategorySummary, 0, len(keys))
+	for _, key := range keys {
+		categories = append(categories, *byKey[key])
+	}
+
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+
+	return categories, nil
+}
+
+// CategoryKey returns a short ID for a category name. Admins may pick long or multibyte
+// names, which do not fit in Telegram's 64 byte callback data.
+func CategoryKey(name string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(name)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// FindStorefrontCategory returns the name of the visible category with the given key
+func FindStorefrontCategory(key string) (string, bool, error) {
+	categories, err := GetStorefrontCategories()
+	if err != nil {
+		return "", false, err
+	}
+	for _, category := range categories {
+		if category.Key == key {
+			return category.Name, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// GetCatalogEntries returns every cached package with its override applied, including hidden ones
+func GetCatalogEntries() ([]CatalogEntry, error) {
+	packages, err := GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]CatalogEntry, 0, len(packages))
+	for _, pkg := range packages {
+		entries = append(entries, buildCatalogEntry(pkg))
+	}
+
+	return entries, nil
+}
+
+// GetStorefrontEntry looks up a visible package by its code
+func GetStorefrontEntry(packageCode string) (*CatalogEntry, error) {
+	pkg, err := GetCatalogPackage(packageCode)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := buildCatalogEntry(*pkg)
+	if entry.Hidden {
+		return nil, fmt.Errorf("package not available")
+	}
+
+	return &entry, nil
+}
+
+// IsPackageHidden reports whether an admin has hidden the package
+func IsPackageHidden(packageCode string) bool {
+	override, exists := getCatalogOverride(packageCode)
+	return exists && override.Hidden
+}
+
+func buildCatalogEntry(pkg dto.Package) CatalogEntry {
+	entry := CatalogEntry{
+		Package:     pkg,
+		DisplayName: pkg.PackageNameAliasShort,
+		Category:    inferPackageCategory(pkg),
+	}
+	if entry.DisplayName == "" {
+		entry.DisplayName = pkg.PackageName
+	}
+
+	if override, exists := getCatalogOverride(pkg.PackageCode); exists {
+		if override.DisplayName != "" {
+			entry.DisplayName = override.DisplayName
+		}
+		if override.Category != "" {
+			entry.Category = override.Category
+		}
+		entry.Featured = override.Featured
+		entry.Hidden = override.Hidden
+		entry.SortWeight = override.SortWeight
+	}
+
+	return entry
+}
+
+// getCatalogOverride returns the cached override for a package, loading overrides on first use
+func getCatalogOverride(packageCode string) (models.CatalogOverride, bool) {
+	overrideMutex.RLock()
+	loaded := catalogOverridesLoaded
+	overrideMutex.RUnlock()
+
+	if !loaded && config.DB != nil {
+		if err := ReloadCatalogOverrides(); err != nil {
+			log.Printf("Warning: failed to load catalog overrides: %v", err)
+		}
+	}
+
+	overrideMutex.RLock()
+	defer overrideMutex.RUnlock()
+	override, exists := catalogOverrides[packageCode]
+	return override, exists
+}
+
+// getOverrideVersion returns a counter that changes whenever overrides are reloaded
+func getOverrideVersion() uint64 {
+	overrideMutex.RLock()
+	defer overrideMutex.RUnlock()
+	return overrideVersion
+}
+
+// resetCatalogOverrides drops the cached overrides so they are loaded again on next use
+func resetCatalogOverrides() {
+	overrideMutex.Lock()
+	catalogOverrides = make(map[string]models.CatalogOverride)
+	catalogOverridesLoaded = false
+	overrideVersion++
+	overrideMutex.Unlock()
+}
+
+// ReloadCatalogOverrides refreshes the in-memory override cache from the database
+func ReloadCatalogOverrides() error {
+	var overrides []models.CatalogOverride
+	if err := config.DB.Find(&overrides).Error; err != nil {
+		return err
+	}
+
+	byCode := make(map[string]models.CatalogOverride, len(overrides))
+	for _, override := range overrides {
+		byCode[override.PackageCode] = override
+	}
+
+	overrideMutex.Lock()
+	catalogOverrides = byCode
+	catalogOverridesLoaded = true
+	overrideVersion++
+	overrideMutex.Unlock()
+	return nil
+}
+
+// GetCatalogOverrides returns all stored overrides
+func GetCatalogOverrides() ([]models.CatalogOverride, error) {
+	var overrides []models.CatalogOverride
+	err := config.DB.Order("package_code ASC").Find(&overrides).Error
+	return overrides, err
+}
+
+// UpdateCatalogOverride loads the override for a package (or a blank one), applies fn and saves it
+func UpdateCatalogOverride(packageCode string, fn func(*models.CatalogOverride)) (*models.CatalogOverride, error) {
+	packageCode = strings.TrimSpace(packageCode)
+	if packageCode == "" {
+		return nil, fmt.Errorf("package code is required")
+	}
+
+	var override models.CatalogOverride
+	if err := config.DB.Where("package_code = ?", packageCode).First(&override).Error; err != nil {
+		override = models.CatalogOverride{PackageCode: packageCode}
+	}
+
+	fn(&override)
+	override.PackageCode = packageCode
+
+	if err := config.DB.Save(&override).Error; err != nil {
+		return nil, err
+	}
+
+	if err := ReloadCatalogOverrides(); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// DeleteCatalogOverride removes the override so the package is shown as upstream sends it
+func DeleteCatalogOverride(packageCode string) error {
+	result := config.DB.Where("package_code = ?", packageCode).Delete(&models.CatalogOverride{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("catalog override not found")
+	}
+	return ReloadCatalogOverrides()
+}
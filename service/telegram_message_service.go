@@ -0,0 +1,270 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// MessageSender is the part of the bot API used to send messages; *tgbotapi.BotAPI implements it
+type MessageSender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// MessageBuilder assembles a Telegram message in MarkdownV2 or HTML. Every piece of
+// text goes through the escaping of the parse mode, so user content such as names,
+// package names or emails can never break the message.
+type MessageBuilder struct {
+	parseMode string
+	b         strings.Builder
+}
+
+// NewMessageBuilder returns a builder for ParseModeHTML or, for any other value, ParseModeMarkdownV2
+func NewMessageBuilder(parseMode string) *MessageBuilder {
+	if parseMode != ParseModeHTML {
+		parseMode = ParseModeMarkdownV2
+	}
+	return &MessageBuilder{parseMode: parseMode}
+}
+
+// Text appends escaped text
+func (m *MessageBuilder) Text(s string) *MessageBuilder {
+	m.b.WriteString(m.escape(s))
+	return m
+}
+
+// Textf appends escaped formatted text
+func (m *MessageBuilder) Textf(format string, args ...interface{}) *MessageBuilder {
+	return m.Text(fmt.Sprintf(format, args...))
+}
+
+// Line appends escaped text followed by a newline
+func (m *MessageBuilder) Line(s string) *MessageBuilder {
+	return m.Text(s).Raw("\n")
+}
+
+// Bold appends bold text
+func (m *MessageBuilder) Bold(s string) *MessageBuilder {
+	if m.parseMode == ParseModeHTML {
+		return m.Raw("<b>" + m.escape(s) + "</b>")
+	}
+	return m.Raw("*" + m.escape(s) + "*")
+}
+
+// Italic appends italic text
+func (m *MessageBuilder) Italic(s string) *MessageBuilder {
+	if m.parseMode == ParseModeHTML {
+		return m.Raw("<i>" + m.escape(s) + "</i>")
+	}
+	return m.Raw("_" + m.escape(s) + "_")
+}
+
+// Code appends inline monospace text
+func (m *MessageBuilder) Code(s string) *MessageBuilder {
+	if m.parseMode == ParseModeHTML {
+		return m.Raw("<code>" + m.escape(s) + "</code>")
+	}
+	return m.Raw("`" + escapeMarkdownV2Code(s) + "`")
+}
+
+// Pre appends a preformatted block on its own lines
+func (m *MessageBuilder) Pre(s string) *MessageBuilder {
+	if m.parseMode == ParseModeHTML {
+		return m.Raw("<pre>" + m.escape(s) + "</pre>\n")
+	}
+	return m.Raw("```\n" + escapeMarkdownV2Code(s) + "\n```\n")
+}
+
+// Link appends a link with escaped text
+func (m *MessageBuilder) Link(text, url string) *MessageBuilder {
+	if m.parseMode == ParseModeHTML {
+		return m.Raw(`<a href="` + html.EscapeString(url) + `">` + m.escape(text) + "</a>")
+	}
+	url = strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(url)
+	return m.Raw("[" + m.escape(text) + "](" + url + ")")
+}
+
+// Field appends a "label: value" line with a bold label, the layout used across the bot
+func (m *MessageBuilder) Field(emoji, label, value string) *MessageBuilder {
+	if emoji != "" {
+		m.Raw(emoji + " ")
+	}
+	return m.Bold(label + ":").Text(" ").Line(value)
+}
+
+// Table appends rows as a monospace table with padded columns. Column widths count
+// runes, so wide characters such as emoji may still misalign.
+func (m *MessageBuilder) Table(headers []string, rows [][]string) *MessageBuilder {
+	columns := len(headers)
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	widths := make([]int, columns)
+	measure := func(row []string) {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	measure(headers)
+	for _, row := range rows {
+		measure(row)
+	}
+
+	var table strings.Builder
+	writeRow := func(row []string) {
+		cells := make([]string, columns)
+		for i := range cells {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cells[i] = cell + strings.Repeat(" ", widths[i]-len([]rune(cell)))
+		}
+		table.WriteString(strings.TrimRight(strings.Join(cells, "  "), " "))
+		table.WriteString("\n")
+	}
+	if len(headers) > 0 {
+		writeRow(headers)
+		separators := make([]string, columns)
+		for i, w := range widths {
+			separators[i] = strings.Repeat("-", w)
+		}
+		writeRow(separators)
+	}
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return m.Pre(strings.TrimSuffix(table.String(), "\n"))
+}
+
+// Raw appends markup as is; it must already be valid for the parse mode
+func (m *MessageBuilder) Raw(markup string) *MessageBuilder {
+	m.b.WriteString(markup)
+	return m
+}
+
+// ParseMode returns the parse mode the message is written for
+func (m *MessageBuilder) ParseMode() string {
+	return m.parseMode
+}
+
+// String returns the message markup
+func (m *MessageBuilder) String() string {
+	return m.b.String()
+}
+
+// Message returns a message config for a chat with the parse mode set
+func (m *MessageBuilder) Message(chatID int64) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, m.String())
+	msg.ParseMode = m.parseMode
+	return msg
+}
+
+func (m *MessageBuilder) escape(s string) string {
+	if m.parseMode == ParseModeHTML {
+		return html.EscapeString(s)
+	}
+	return EscapeMarkdownV2(s)
+}
+
+var (
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownEscaper       = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+)
+
+// EscapeMarkdownV2 escapes text for use outside entities in a MarkdownV2 message
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+func escapeMarkdownV2Code(s string) string {
+	return markdownV2CodeEscaper.Replace(s)
+}
+
+// EscapeMarkdown escapes text for use outside entities in a legacy Markdown message.
+// Legacy Markdown cannot escape inside an entity, so user text must not be placed
+// between * or _ markers.
+func EscapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// SendWithFallback sends a message and, when Telegram rejects its formatting, sends it
+// again as plain text with the markup stripped, so the recipient still gets it
+func SendWithFallback(bot MessageSender, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	sent, err := bot.Send(c)
+	if err == nil || !isParseEntitiesError(err) {
+		return sent, err
+	}
+
+	plain, ok := withoutParseMode(c)
+	if !ok {
+		return sent, err
+	}
+	log.Printf("Warning: Telegram could not parse message entities, resending as plain text: %v", err)
+	return bot.Send(plain)
+}
+
+func isParseEntitiesError(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.Code != 400 {
+		return false
+	}
+	message := strings.ToLower(tgErr.Message)
+	return strings.Contains(message, "can't parse entities") || strings.Contains(message, "can't find end of")
+}
+
+// withoutParseMode returns a copy of a formatted message with its markup stripped
+func withoutParseMode(c tgbotapi.Chattable) (tgbotapi.Chattable, bool) {
+	switch msg := c.(type) {
+	case tgbotapi.MessageConfig:
+		if msg.ParseMode == "" {
+			return nil, false
+		}
+		msg.Text = MarkdownToPlain(msg.Text, msg.ParseMode)
+		msg.ParseMode = ""
+		return msg, true
+	case tgbotapi.EditMessageTextConfig:
+		if msg.ParseMode == "" {
+			return nil, false
+		}
+		msg.Text = MarkdownToPlain(msg.Text, msg.ParseMode)
+		msg.ParseMode = ""
+		return msg, true
+	case tgbotapi.PhotoConfig:
+		if msg.ParseMode == "" {
+			return nil, false
+		}
+		msg.Caption = MarkdownToPlain(msg.Caption, msg.ParseMode)
+		msg.ParseMode = ""
+		return msg, true
+	case tgbotapi.DocumentConfig:
+		if msg.ParseMode == "" {
+			return nil, false
+		}
+		msg.Caption = MarkdownToPlain(msg.Caption, msg.ParseMode)
+		msg.ParseMode = ""
+		return msg, true
+	case tgbotapi.EditMessageCaptionConfig:
+		if msg.ParseMode == "" {
+			return nil, false
+		}
+		msg.Caption = MarkdownToPlain(msg.Caption, msg.ParseMode)
+		msg.ParseMode = ""
+		return msg, true
+	default:
+		return nil, false
+	}
+}
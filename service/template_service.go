@@ -0,0 +1,353 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/templates"
+	"gorm.io/gorm/clause"
+)
+
+// languageNames are shown by /language; a language is only offered when templates/<code> exists
+var languageNames = map[string]string{
+	"id": "🇮🇩 Bahasa Indonesia",
+	"en": "🇬🇧 English",
+}
+
+var templateFuncs = template.FuncMap{
+	"rupiah": formatRupiah,
+	"md":     EscapeMarkdown,
+}
+
+var (
+	fileTemplatesOnce sync.Once
+	fileTemplates     map[string]*template.Template // bundled templates per language
+
+	templateMu        sync.RWMutex
+	overridesLoaded   bool
+	overrideTemplates map[string]*template.Template // compiled admin edits by "<language>/<key>"
+)
+
+// TemplateEntry is a template key of one language as shown to admins
+type TemplateEntry struct {
+	Language   string     `json:"language"`
+	Key        string     `json:"key"`
+	Body       string     `json:"body"`
+	Default    string     `json:"default"`
+	Overridden bool       `json:"overridden"`
+	UpdatedAt  *time.Time `json:"updated_at"`
+}
+
+func loadFileTemplates() map[string]*template.Template {
+	fileTemplatesOnce.Do(func() {
+		fileTemplates = make(map[string]*template.Template)
+		dirs, err := fs.ReadDir(templates.FS, ".")
+		if err != nil {
+			log.Printf("Warning: failed to read bundled templates: %v", err)
+			return
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			set, err := template.New(dir.Name()).Funcs(templateFuncs).ParseFS(templates.FS, dir.Name()+"/*.tmpl")
+			if err != nil {
+				log.Printf("Warning: failed to parse %s templates: %v", dir.Name(), err)
+				continue
+			}
+			fileTemplates[dir.Name()] = set
+		}
+	})
+	return fileTemplates
+}
+
+// SupportedLanguages returns the codes of the languages that have templates
+func SupportedLanguages() []string {
+	var languages []string
+	for language := range loadFileTemplates() {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// LanguageName returns the display name of a language code
+func LanguageName(language string) string {
+	if name, ok := languageNames[language]; ok {
+		return name
+	}
+	return language
+}
+
+// DetectLanguage maps a Telegram language code such as "en-US" to a supported
+// language, or "" when there is none
+func DetectLanguage(languageCode string) string {
+	language := strings.ToLower(strings.TrimSpace(languageCode))
+	if idx := strings.IndexAny(language, "-_"); idx >= 0 {
+		language = language[:idx]
+	}
+	if _, ok := loadFileTemplates()[language]; ok {
+		return language
+	}
+	return ""
+}
+
+// GetUserLanguage returns the language chosen with /language, else the one of the
+// user's Telegram client, else DEFAULT_LANGUAGE
+func GetUserLanguage(userID int64) string {
+	if config.DB != nil {
+		var user models.ActiveUser
+		if err := config.DB.Select("language", "language_code").Where("user_id = ?", userID).Limit(1).Find(&user).Error; err == nil {
+			if _, ok := loadFileTemplates()[user.Language]; ok {
+				return user.Language
+			}
+			if language := DetectLanguage(user.LanguageCode); language != "" {
+				return language
+			}
+		}
+	}
+	return config.GetDefaultLanguage()
+}
+
+// SetUserLanguage stores the language a user picked with /language
+func SetUserLanguage(userID int64, language string) error {
+	if _, ok := loadFileTemplates()[language]; !ok {
+		return fmt.Errorf("bahasa %s tidak tersedia", language)
+	}
+	return config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"language"}),
+	}).Create(&models.ActiveUser{UserID: userID, LastInteraction: time.Now(), Language: language}).Error
+}
+
+// RecordLanguageCode stores the language reported by the user's Telegram client
+func RecordLanguageCode(userID int64, languageCode string) error {
+	if languageCode == "" {
+		return nil
+	}
+	return config.DB.Model(&models.ActiveUser{}).
+		Where("user_id = ? AND (language_code IS NULL OR language_code <> ?)", userID, languageCode).
+		Update("language_code", languageCode).Error
+}
+
+// RenderTemplate renders a template key in a language. Keys missing in that language,
+// or failing to render, fall back to DEFAULT_LANGUAGE; a key that exists nowhere is
+// returned as is so the gap is visible.
+func RenderTemplate(language, key string, data interface{}) string {
+	languages := []string{language}
+	if fallback := config.GetDefaultLanguage(); fallback != language {
+		languages = append(languages, fallback)
+	}
+
+	for _, lang := range languages {
+		if override := overrideTemplate(lang, key); override != nil {
+			text, err := executeTemplate(override, key, data)
+			if err == nil {
+				return text
+			}
+			log.Printf("Warning: edited template %s/%s failed, using the bundled one: %v", lang, key, err)
+		}
+
+		set, ok := loadFileTemplates()[lang]
+		if !ok || set.Lookup(key) == nil {
+			continue
+		}
+		text, err := executeTemplate(set, key, data)
+		if err == nil {
+			return text
+		}
+		log.Printf("Warning: template %s/%s failed: %v", lang, key, err)
+	}
+
+	log.Printf("Warning: template %s not found for language %s", key, language)
+	return key
+}
+
+// RenderUserTemplate renders a template key in the user's language
+func RenderUserTemplate(userID int64, key string, data interface{}) string {
+	return RenderTemplate(GetUserLanguage(userID), key, data)
+}
+
+func executeTemplate(set *template.Template, key string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := set.ExecuteTemplate(&buf, key, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// overrideTemplate returns the compiled admin edit of a key, or nil when there is none
+func overrideTemplate(language, key string) *template.Template {
+	if config.DB == nil {
+		return nil
+	}
+	id := language + "/" + key
+
+	templateMu.RLock()
+	loaded := overridesLoaded
+	compiled := overrideTemplates[id]
+	templateMu.RUnlock()
+	if loaded {
+		return compiled
+	}
+
+	var rows []models.MessageTemplate
+	if err := config.DB.Find(&rows).Error; err != nil {
+		log.Printf("Warning: failed to load edited templates: %v", err)
+		return nil
+	}
+
+	templateMu.Lock()
+	defer templateMu.Unlock()
+	overridesLoaded = true
+	overrideTemplates = make(map[string]*template.Template)
+	for _, row := range rows {
+		set, err := compileOverride(row.Language, row.Key, row.Body)
+		if err != nil {
+			log.Printf("Warning: edited template %s/%s is invalid: %v", row.Language, row.Key, err)
+			continue
+		}
+		overrideTemplates[row.Language+"/"+row.Key] = set
+	}
+	return overrideTemplates[id]
+}
+
+// compileOverride parses an edited body in a copy of the bundled set of its language,
+// so it can still use {{template}} with the other keys
+func compileOverride(language, key, body string) (*template.Template, error) {
+	base, ok := loadFileTemplates()[language]
+	if !ok {
+		return nil, fmt.Errorf("bahasa %s tidak tersedia", language)
+	}
+	set, err := base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := set.New(key).Parse(body); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func invalidateTemplateOverrides() {
+	templateMu.Lock()
+	overridesLoaded = false
+	overrideTemplates = nil
+	templateMu.Unlock()
+}
+
+// templateKeys returns the keys defined by the bundled templates of a language
+func templateKeys(language string) []string {
+	set, ok := loadFileTemplates()[language]
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, t := range set.Templates() {
+		name := t.Name()
+		if name == language || strings.HasSuffix(name, ".tmpl") {
+			continue
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isTemplateKey(key string) bool {
+	for _, set := range loadFileTemplates() {
+		if set.Lookup(key) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMessageTemplates lists every template key of a language, or of all languages when
+// language is empty, with the admin edit if there is one
+func GetMessageTemplates(language string) ([]TemplateEntry, error) {
+	var rows []models.MessageTemplate
+	if err := config.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	edited := make(map[string]models.MessageTemplate)
+	for _, row := range rows {
+		edited[row.Language+"/"+row.Key] = row
+	}
+
+	languages := SupportedLanguages()
+	if language != "" {
+		if _, ok := loadFileTemplates()[language]; !ok {
+			return nil, fmt.Errorf("bahasa %s tidak tersedia", language)
+		}
+		languages = []string{language}
+	}
+
+	var entries []TemplateEntry
+	for _, lang := range languages {
+		set := loadFileTemplates()[lang]
+		for _, key := range templateKeys(lang) {
+			entry := TemplateEntry{Language: lang, Key: key}
+			if tree := set.Lookup(key).Tree; tree != nil && tree.Root != nil {
+				entry.Default = tree.Root.String()
+			}
+			entry.Body = entry.Default
+			if row, ok := edited[lang+"/"+key]; ok {
+				updatedAt := row.UpdatedAt
+				entry.Body = row.Body
+				entry.Overridden = true
+				entry.UpdatedAt = &updatedAt
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// SetMessageTemplate replaces the text of a template key in one language. The body is
+// a Go text/template and is checked before it is saved.
+func SetMessageTemplate(language, key, body string, adminID int64) error {
+	if !isTemplateKey(key) {
+		return fmt.Errorf("template %s tidak dikenal", key)
+	}
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("isi template tidak boleh kosong")
+	}
+	if _, err := compileOverride(language, key, body); err != nil {
+		return fmt.Errorf("template tidak valid: %v", err)
+	}
+
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "language"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"body", "updated_by", "updated_at"}),
+	}).Create(&models.MessageTemplate{Language: language, Key: key, Body: body, UpdatedBy: adminID}).Error
+	if err != nil {
+		return err
+	}
+
+	invalidateTemplateOverrides()
+	return nil
+}
+
+// ResetMessageTemplate removes the admin edit of a key so the bundled text is used again
+func ResetMessageTemplate(language, key string) error {
+	result := config.DB.Where(&models.MessageTemplate{Language: language, Key: key}).Delete(&models.MessageTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("template %s/%s belum pernah diubah", language, key)
+	}
+
+	invalidateTemplateOverrides()
+	return nil
+}
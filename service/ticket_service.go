@@ -0,0 +1,355 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// Ticket statuses
+const (
+	TicketOpen    = "open"    // waiting for an admin
+	TicketPending = "pending" // an admin replied, waiting for the user
+	TicketClosed  = "closed"
+)
+
+// ErrTicketAssignConflict is returned when another admin took or closed a ticket while it
+// was being assigned
+var ErrTicketAssignConflict = errors.New("muat ulang tiket sebelum menugaskannya lagi")
+
+const (
+	maxTicketSubject = 60
+	// Leaves room in the 1024 character caption for the ticket header
+	maxTicketCaptionText = 800
+)
+
+// OpenTicket starts a ticket with the user's first message and notifies the admins
+func OpenTicket(sender MessageSender, user *tgbotapi.User, text, photoID string) (*models.Ticket, error) {
+	text = strings.TrimSpace(text)
+	if text == "" && photoID == "" {
+		return nil, fmt.Errorf("pesan tiket tidak boleh kosong")
+	}
+	if len(config.GetAdminChatIDs()) == 0 {
+		return nil, fmt.Errorf("admin chat ID tidak dikonfigurasi")
+	}
+
+	username := "-"
+	if user.UserName != "" {
+		username = "@" + user.UserName
+	}
+	now := time.Now()
+	ticket := models.Ticket{
+		UserID:        user.ID,
+		UserName:      fmt.Sprintf("%s (%s)", getUserDisplayName(user), username),
+		Subject:       ticketSubject(text),
+		Status:        TicketOpen,
+		LastMessageAt: now,
+	}
+	message := models.TicketMessage{SenderID: user.ID, Text: text, PhotoID: photoID}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ticket).Error; err != nil {
+			return err
+		}
+		message.TicketID = ticket.ID
+		return tx.Create(&message).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifyTicketAdmins(sender, &ticket, &message, "Tiket Baru")
+	return &ticket, nil
+}
+
+// AddUserTicketMessage adds a follow-up from the user to their ticket; a closed ticket
+// is reopened
+func AddUserTicketMessage(sender MessageSender, ticketID uint, userID int64, text, photoID string) (*models.Ticket, error) {
+	text = strings.TrimSpace(text)
+	if text == "" && photoID == "" {
+		return nil, fmt.Errorf("pesan tiket tidak boleh kosong")
+	}
+	ticket, err := GetTicket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.UserID != userID {
+		return nil, fmt.Errorf("tiket #%d tidak ditemukan", ticketID)
+	}
+
+	message := models.TicketMessage{TicketID: ticket.ID, SenderID: userID, Text: text, PhotoID: photoID}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		return tx.Model(ticket).Updates(map[string]interface{}{
+			"status":          TicketOpen,
+			"last_message_at": message.CreatedAt,
+			"closed_at":       nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifyTicketAdmins(sender, ticket, &message, "Balasan User")
+	return ticket, nil
+}
+
+// ReplyTicket sends an admin's reply to the user and records it. An unassigned ticket is
+// assigned to the admin who answers it; adminID is 0 for replies through the API.
+func ReplyTicket(sender MessageSender, ticketID uint, adminID int64, text, photoID string) (*models.Ticket, error) {
+	text = strings.TrimSpace(text)
+	if text == "" && photoID == "" {
+		return nil, fmt.Errorf("balasan tidak boleh kosong")
+	}
+	ticket, err := GetTicket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Status == TicketClosed {
+		return nil, fmt.Errorf("tiket #%d sudah ditutup", ticketID)
+	}
+
+	b := NewMessageBuilder(ParseModeMarkdownV2).
+		Raw("💬 ").Bold(fmt.Sprintf("Balasan Admin - Tiket #%d", ticket.ID)).Raw("\n\n")
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("↩️ Balas", fmt.Sprintf("ticket_reply:%d", ticket.ID)),
+			tgbotapi.NewInlineKeyboardButtonData("✅ Selesai", fmt.Sprintf("ticket_close:%d", ticket.ID)),
+		),
+	)
+	if _, err := SendWithFallback(sender, ticketChattable(ticket.UserID, b, text, photoID, keyboard)); err != nil {
+		return nil, fmt.Errorf("gagal mengirim balasan ke user: %v", err)
+	}
+
+	message := models.TicketMessage{TicketID: ticket.ID, SenderID: adminID, FromAdmin: true, Text: text, PhotoID: photoID}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"status": TicketPending, "last_message_at": message.CreatedAt}
+		if ticket.AssignedTo == 0 && adminID != 0 {
+			updates["assigned_to"] = adminID
+		}
+		return tx.Model(ticket).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
+
+// AssignTicket hands a ticket to an admin, who from then on is the only one notified
+// about it
+func AssignTicket(sender MessageSender, ticketID uint, adminID int64) (*models.Ticket, error) {
+	if !config.IsAdmin(adminID) {
+		return nil, fmt.Errorf("%d bukan admin", adminID)
+	}
+	ticket, err := GetTicket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Status == TicketClosed {
+		return nil, fmt.Errorf("tiket #%d sudah ditutup", ticketID)
+	}
+	if ticket.AssignedTo == adminID {
+		return ticket, nil
+	}
+
+	// Only take the ticket from the admin it was read with, so two admins grabbing it at
+	// once do not silently overwrite each other
+	result := config.DB.Model(&models.Ticket{}).
+		Where("id = ? AND assigned_to = ? AND status <> ?", ticket.ID, ticket.AssignedTo, TicketClosed).
+		Update("assigned_to", adminID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		current, err := GetTicket(ticketID)
+		if err != nil {
+			return nil, err
+		}
+		if current.Status == TicketClosed {
+			return nil, fmt.Errorf("tiket #%d baru saja ditutup: %w", ticketID, ErrTicketAssignConflict)
+		}
+		return nil, fmt.Errorf("tiket #%d baru saja diambil admin %d: %w", ticketID, current.AssignedTo, ErrTicketAssignConflict)
+	}
+	ticket.AssignedTo = adminID
+
+	// The new assignee gets the latest message, so they can reply to it directly
+	var last models.TicketMessage
+	if err := config.DB.Where("ticket_id = ?", ticket.ID).Order("id DESC").First(&last).Error; err == nil {
+		sendTicketNotice(sender, adminID, ticket, &last, "Tiket Ditugaskan ke Anda")
+	}
+	return ticket, nil
+}
+
+// CloseTicket closes a ticket. When an admin or the API closes it the user is told;
+// closedBy is the chat ID of whoever closed it.
+func CloseTicket(sender MessageSender, ticketID uint, closedBy int64) (*models.Ticket, error) {
+	ticket, err := GetTicket(ticketID)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Status == TicketClosed {
+		return nil, fmt.Errorf("tiket #%d sudah ditutup", ticketID)
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(ticket).Updates(map[string]interface{}{"status": TicketClosed, "closed_at": &now}).Error; err != nil {
+		return nil, err
+	}
+
+	if closedBy != ticket.UserID {
+		b := NewMessageBuilder(ParseModeMarkdownV2).
+			Raw("✅ ").Bold(fmt.Sprintf("Tiket #%d ditutup", ticket.ID)).Raw("\n\n").
+			Text("Terima kasih telah menghubungi kami. Balas lewat /tickets jika masih ada kendala.")
+		if _, err := SendWithFallback(sender, b.Message(ticket.UserID)); err != nil {
+			log.Printf("Warning: failed to tell user %d that ticket #%d was closed: %v", ticket.UserID, ticket.ID, err)
+		}
+	}
+	return ticket, nil
+}
+
+// GetTicket returns one ticket
+func GetTicket(id uint) (*models.Ticket, error) {
+	var ticket models.Ticket
+	if err := config.DB.First(&ticket, id).Error; err != nil {
+		return nil, fmt.Errorf("tiket #%d tidak ditemukan", id)
+	}
+	return &ticket, nil
+}
+
+// GetTicketMessages returns the thread of a ticket, oldest first
+func GetTicketMessages(ticketID uint) ([]models.TicketMessage, error) {
+	var messages []models.TicketMessage
+	err := config.DB.Where("ticket_id = ?", ticketID).Order("id").Find(&messages).Error
+	return messages, err
+}
+
+// GetUserTickets returns a user's latest tickets
+func GetUserTickets(userID int64, limit int) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	err := config.DB.Where("user_id = ?", userID).Order("last_message_at DESC").Limit(limit).Find(&tickets).Error
+	return tickets, err
+}
+
+// GetTickets returns tickets for the admin queue, optionally filtered by status, most
+// recently active first
+func GetTickets(status string, limit int) ([]models.Ticket, error) {
+	var tickets []models.Ticket
+	query := config.DB.Order("last_message_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&tickets).Error
+	return tickets, err
+}
+
+// TicketForAdminMessage returns the ticket a message in an admin chat belongs to, so
+// an admin can answer a ticket by replying to its notification
+func TicketForAdminMessage(chatID int64, messageID int) (uint, bool) {
+	var notice models.TicketNotice
+	if err := config.DB.Where("chat_id = ? AND message_id = ?", chatID, messageID).First(&notice).Error; err != nil {
+		return 0, false
+	}
+	return notice.TicketID, true
+}
+
+// TicketStatusName returns the display name of a ticket status
+func TicketStatusName(status string) string {
+	switch status {
+	case TicketOpen:
+		return "🟢 Menunggu admin"
+	case TicketPending:
+		return "🟡 Menunggu balasan Anda"
+	case TicketClosed:
+		return "⚪ Ditutup"
+	}
+	return status
+}
+
+// notifyTicketAdmins sends a ticket message to the assigned admin, or to every admin
+// while the ticket is unassigned
+func notifyTicketAdmins(sender MessageSender, ticket *models.Ticket, message *models.TicketMessage, title string) {
+	adminIDs := config.GetAdminChatIDs()
+	if ticket.AssignedTo != 0 {
+		adminIDs = []int64{ticket.AssignedTo}
+	}
+	for _, adminID := range adminIDs {
+		sendTicketNotice(sender, adminID, ticket, message, title)
+	}
+}
+
+func sendTicketNotice(sender MessageSender, adminID int64, ticket *models.Ticket, message *models.TicketMessage, title string) {
+	b := NewMessageBuilder(ParseModeMarkdownV2).
+		Raw("🎫 ").Bold(fmt.Sprintf("%s #%d", title, ticket.ID)).Raw("\n\n").
+		Field("👤", "User", ticket.UserName).
+		Field("🆔", "User ID", fmt.Sprintf("%d", ticket.UserID)).
+		Field("🕐", "Waktu", message.CreatedAt.Format("02/01/2006 15:04:05"))
+	if ticket.AssignedTo != 0 {
+		b.Field("🙋", "Ditangani", fmt.Sprintf("%d", ticket.AssignedTo))
+	}
+	b.Raw("\n").Text("↩️ Reply pesan ini untuk membalas user.").Raw("\n\n")
+
+	buttons := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData("✅ Tutup", fmt.Sprintf("ticket_close:%d", ticket.ID)),
+	}
+	if ticket.AssignedTo == 0 {
+		buttons = append([]tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("🙋 Ambil", fmt.Sprintf("ticket_assign:%d", ticket.ID)),
+		}, buttons...)
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+
+	sent, err := SendWithFallback(sender, ticketChattable(adminID, b, message.Text, message.PhotoID, keyboard))
+	if err != nil {
+		log.Printf("Warning: failed to send ticket #%d to admin %d: %v", ticket.ID, adminID, err)
+		return
+	}
+	notice := models.TicketNotice{TicketID: ticket.ID, ChatID: adminID, MessageID: sent.MessageID}
+	if err := config.DB.Create(&notice).Error; err != nil {
+		log.Printf("Warning: failed to record notice of ticket #%d: %v", ticket.ID, err)
+	}
+}
+
+// ticketChattable appends the message text to the header and sends it as a message, or
+// as the caption of the attached photo
+func ticketChattable(chatID int64, b *MessageBuilder, text, photoID string, keyboard tgbotapi.InlineKeyboardMarkup) tgbotapi.Chattable {
+	if photoID == "" {
+		b.Text(text)
+		msg := b.Message(chatID)
+		msg.ReplyMarkup = keyboard
+		return msg
+	}
+
+	if utf8.RuneCountInString(text) > maxTicketCaptionText {
+		text = string([]rune(text)[:maxTicketCaptionText]) + "…"
+	}
+	b.Text(text)
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(photoID))
+	photo.Caption = b.String()
+	photo.ParseMode = b.ParseMode()
+	photo.ReplyMarkup = keyboard
+	return photo
+}
+
+func ticketSubject(text string) string {
+	if text == "" {
+		return "📷 Foto"
+	}
+	line, _, _ := strings.Cut(text, "\n")
+	if utf8.RuneCountInString(line) > maxTicketSubject {
+		line = string([]rune(line)[:maxTicketSubject]) + "…"
+	}
+	return line
+}
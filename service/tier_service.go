@@ -0,0 +1,479 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// User tiers, lowest first
+const (
+	TierRetail   = "retail"
+	TierReseller = "reseller"
+	TierAgent    = "agent"
+)
+
+var tierRanks = map[string]int{
+	TierRetail:   0,
+	TierReseller: 1,
+	TierAgent:    2,
+}
+
+var (
+	userTierCache    = make(map[int64]string)
+	tierPrices       []models.TierPrice
+	tierPriceLoaded  bool
+	tierPriceVersion uint64 // bumped on every tier price reload
+	tierMutex        sync.RWMutex
+)
+
+// TierMember is a user with a non-retail tier and their spend this month
+type TierMember struct {
+	models.UserTier
+	MonthlySpend int64 `json:"monthly_spend"`
+}
+
+// NormalizeTier maps user input (including Indonesian names) to a tier constant
+func NormalizeTier(tier string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(tier)) {
+	case "retail", "biasa", "":
+		return TierRetail, nil
+	case "reseller":
+		return TierReseller, nil
+	case "agent", "agen":
+		return TierAgent, nil
+	}
+	return "", fmt.Errorf("tier tidak dikenal: %s (retail, reseller, agent)", tier)
+}
+
+// TierName returns the display name of a tier
+func TierName(tier string) string {
+	switch tier {
+	case TierReseller:
+		return "Reseller"
+	case TierAgent:
+		return "Agen"
+	}
+	return "Retail"
+}
+
+// GetUserTier returns the user's tier, retail when none was assigned
+func GetUserTier(userID int64) string {
+	tierMutex.RLock()
+	tier, cached := userTierCache[userID]
+	tierMutex.RUnlock()
+	if cached {
+		return tier
+	}
+
+	if config.DB == nil {
+		return TierRetail
+	}
+
+	tier = TierRetail
+	var userTier models.UserTier
+	err := config.DB.Where("user_id = ?", userID).First(&userTier).Error
+	if err == nil {
+		tier = userTier.Tier
+	} else if err != gorm.ErrRecordNotFound {
+		log.Printf("Warning: failed to load tier of user %d: %v", userID, err)
+		return TierRetail
+	}
+
+	tierMutex.Lock()
+	userTierCache[userID] = tier
+	tierMutex.Unlock()
+	return tier
+}
+
+// SetUserTier lets an admin assign a tier to a user. adminID may be 0 when the change
+// comes through the admin API.
+func SetUserTier(userID int64, tier string, adminID int64) error {
+	tier, err := NormalizeTier(tier)
+	if err != nil {
+		return err
+	}
+	return saveUserTier(models.UserTier{UserID: userID, Tier: tier, PromotedBy: adminID})
+}
+
+func saveUserTier(userTier models.UserTier) error {
+	userID := userTier.UserID
+
+	var existing models.UserTier
+	if err := config.DB.Where("user_id = ?", userID).First(&existing).Error; err == nil {
+		userTier.CreatedAt = existing.CreatedAt
+	}
+
+	if err := config.DB.Save(&userTier).Error; err != nil {
+		return err
+	}
+
+	tierMutex.Lock()
+	userTierCache[userID] = userTier.Tier
+	tierMutex.Unlock()
+	return nil
+}
+
+// GetTierMembers returns every user above retail, highest tier first
+func GetTierMembers() ([]TierMember, error) {
+	var tiers []models.UserTier
+	err := config.DB.Where("tier <> ?", TierRetail).
+		Order("CASE tier WHEN 'agent' THEN 0 ELSE 1 END, updated_at DESC").
+		Find(&tiers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	since := startOfMonth(time.Now())
+	members := make([]TierMember, 0, len(tiers))
+	for _, tier := range tiers {
+		members = append(members, TierMember{UserTier: tier, MonthlySpend: GetUserSpendSince(tier.UserID, since)})
+	}
+	return members, nil
+}
+
+// QuotePriceForUser quotes a package at the price of the user's tier
+func QuotePriceForUser(userID int64, packageCode, paymentMethod string) (*PriceQuote, error) {
+	quote, err := QuotePrice(packageCode, paymentMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	ApplyTierPrice(quote, GetUserTier(userID))
+	return quote, nil
+}
+
+// QuotePackagePriceForUser applies pricing rules and the user's tier price to a loaded package
+func QuotePackagePriceForUser(userID int64, pkg *dto.Package, paymentMethod string) PriceQuote {
+	quote := QuotePackagePrice(pkg, paymentMethod)
+	ApplyTierPrice(&quote, GetUserTier(userID))
+	return quote
+}
+
+// GetStartingPriceForUser returns the lowest price of a package for the user's tier
+func GetStartingPriceForUser(userID int64, pkg *dto.Package) int64 {
+	return startingPriceForTier(pkg, GetUserTier(userID))
+}
+
+// startingPriceForTier returns the lowest price of a package at the given tier
+func startingPriceForTier(pkg *dto.Package, tier string) int64 {
+	return startingPrice(pkg, func(paymentMethod string) int64 {
+		quote := QuotePackagePrice(pkg, paymentMethod)
+		ApplyTierPrice(&quote, tier)
+		return quote.SellPrice
+	})
+}
+
+// ApplyTierPrice replaces the retail sell price of a quote with the tier's price.
+// A package-specific entry beats a tier-wide one; the result never drops below cost.
+func ApplyTierPrice(quote *PriceQuote, tier string) {
+	quote.Tier = tier
+	quote.RetailPrice = quote.SellPrice
+	if tier == TierRetail {
+		return
+	}
+
+	entry := selectTierPrice(getTierPrices(), tier, quote.PackageCode)
+	if entry == nil {
+		return
+	}
+
+	price := quote.SellPrice
+	switch {
+	case entry.Price > 0:
+		price = entry.Price
+	case entry.DiscountType == MarkupPercent:
+		price -= int64(math.Floor(float64(quote.SellPrice) * entry.DiscountValue / 100))
+	default:
+		price -= int64(math.Round(entry.DiscountValue))
+	}
+
+	if price < quote.CostPrice {
+		price = quote.CostPrice
+	}
+	quote.SellPrice = price
+}
+
+func selectTierPrice(entries []models.TierPrice, tier, packageCode string) *models.TierPrice {
+	var tierWide *models.TierPrice
+	for i := range entries {
+		entry := &entries[i]
+		if !entry.IsActive || entry.Tier != tier {
+			continue
+		}
+		if entry.PackageCode == packageCode {
+			return entry
+		}
+		if entry.PackageCode == "" && tierWide == nil {
+			tierWide = entry
+		}
+	}
+	return tierWide
+}
+
+// resetTierCache drops the cached user tiers and tier prices
+func resetTierCache() {
+	tierMutex.Lock()
+	userTierCache = make(map[int64]string)
+	tierPrices = nil
+	tierPriceLoaded = false
+	tierPriceVersion++
+	tierMutex.Unlock()
+}
+
+// getTierPriceVersion returns a counter that changes whenever tier prices are reloaded
+func getTierPriceVersion() uint64 {
+	tierMutex.RLock()
+	defer tierMutex.RUnlock()
+	return tierPriceVersion
+}
+
+// getTierPrices returns the cached active tier prices, loading them on first use
+func getTierPrices() []models.TierPrice {
+	tierMutex.RLock()
+	if tierPriceLoaded {
+		entries := tierPrices
+		tierMutex.RUnlock()
+		return entries
+	}
+	tierMutex.RUnlock()
+
+	if config.DB == nil {
+		return nil
+	}
+
+	if err := ReloadTierPrices(); err != nil {
+		log.Printf("Warning: failed to load tier prices: %v", err)
+	}
+
+	tierMutex.RLock()
+	defer tierMutex.RUnlock()
+	return tierPrices
+}
+
+// ReloadTierPrices refreshes the tier price cache from the database
+func ReloadTierPrices() error {
+	if config.DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	var entries []models.TierPrice
+	if err := config.DB.Where("is_active = ?", true).Order("id ASC").Find(&entries).Error; err != nil {
+		return err
+	}
+
+	tierMutex.Lock()
+	tierPrices = entries
+	tierPriceLoaded = true
+	tierPriceVersion++
+	tierMutex.Unlock()
+	return nil
+}
+
+// GetTierPrices returns all tier prices including inactive ones
+func GetTierPrices() ([]models.TierPrice, error) {
+	var entries []models.TierPrice
+	err := config.DB.Order("tier ASC, package_code ASC, id ASC").Find(&entries).Error
+	return entries, err
+}
+
+// SaveTierPrice creates or updates a tier price. Saving a price for a tier and
+// package that already has one replaces the existing entry.
+func SaveTierPrice(entry *models.TierPrice) error {
+	if err := validateTierPrice(entry); err != nil {
+		return err
+	}
+
+	if entry.ID == 0 {
+		var existing models.TierPrice
+		if err := config.DB.Where("tier = ? AND package_code = ?", entry.Tier, entry.PackageCode).First(&existing).Error; err == nil {
+			entry.ID = existing.ID
+			entry.CreatedAt = existing.CreatedAt
+		}
+	}
+
+	if err := config.DB.Save(entry).Error; err != nil {
+		return err
+	}
+	return ReloadTierPrices()
+}
+
+// UpdateTierPrice loads a tier price, applies fn and saves it
+func UpdateTierPrice(id uint, fn func(*models.TierPrice)) (*models.TierPrice, error) {
+	var entry models.TierPrice
+	if err := config.DB.First(&entry, id).Error; err != nil {
+		return nil, fmt.Errorf("harga tier tidak ditemukan")
+	}
+
+	fn(&entry)
+	entry.ID = id
+
+	if err := SaveTierPrice(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// DeleteTierPrice removes a tier price
+func DeleteTierPrice(id uint) error {
+	result := config.DB.Delete(&models.TierPrice{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("harga tier tidak ditemukan")
+	}
+	return ReloadTierPrices()
+}
+
+func validateTierPrice(entry *models.TierPrice) error {
+	tier, err := NormalizeTier(entry.Tier)
+	if err != nil {
+		return err
+	}
+	if tier == TierRetail {
+		return fmt.Errorf("harga retail diatur lewat pricing rule")
+	}
+	entry.Tier = tier
+	entry.PackageCode = strings.TrimSpace(entry.PackageCode)
+
+	if entry.Price < 0 {
+		return fmt.Errorf("harga tidak boleh negatif")
+	}
+	if entry.Price > 0 {
+		if entry.PackageCode == "" {
+			return fmt.Errorf("harga tetap hanya untuk satu kode paket")
+		}
+		return nil
+	}
+
+	entry.DiscountType = strings.ToLower(strings.TrimSpace(entry.DiscountType))
+	if entry.DiscountType != MarkupFixed && entry.DiscountType != MarkupPercent {
+		return fmt.Errorf("tipe diskon harus fixed atau percent")
+	}
+	if entry.DiscountValue <= 0 {
+		return fmt.Errorf("nilai diskon harus lebih dari 0")
+	}
+	if entry.DiscountType == MarkupPercent && entry.DiscountValue > 100 {
+		return fmt.Errorf("diskon persen maksimal 100")
+	}
+	return nil
+}
+
+// ParseTierDiscount reads a discount such as "5%" or "2000" into a tier price
+func ParseTierDiscount(entry *models.TierPrice, value string) error {
+	entry.Price = 0
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return fmt.Errorf("nilai diskon tidak valid: %s", value)
+		}
+		entry.DiscountType = MarkupPercent
+		entry.DiscountValue = percent
+		return nil
+	}
+
+	amount := parseSearchPrice(strings.ToLower(value))
+	if amount <= 0 {
+		return fmt.Errorf("nilai diskon tidak valid: %s", value)
+	}
+	entry.DiscountType = MarkupFixed
+	entry.DiscountValue = float64(amount)
+	return nil
+}
+
+// DescribeTierPrice returns a short description such as "AKRAB_L Rp 45.000" or "semua paket diskon 5%"
+func DescribeTierPrice(entry *models.TierPrice) string {
+	target := "semua paket"
+	if entry.PackageCode != "" {
+		target = entry.PackageCode
+	}
+
+	if entry.Price > 0 {
+		return fmt.Sprintf("%s %s", target, formatRupiah(entry.Price))
+	}
+	if entry.DiscountType == MarkupPercent {
+		return fmt.Sprintf("%s diskon %g%%", target, entry.DiscountValue)
+	}
+	return fmt.Sprintf("%s diskon %s", target, formatRupiah(int64(entry.DiscountValue)))
+}
+
+// GetUserSpendSince sums the user's package purchases and VPN orders since a point in time
+func GetUserSpendSince(userID int64, since time.Time) int64 {
+	var purchases, vpn int64
+	config.DB.Model(&models.PurchaseTransaction{}).
+		Select("COALESCE(SUM(price), 0)").
+		Where("user_id = ? AND status <> ? AND created_at >= ?", userID, "failed", since).
+		Scan(&purchases)
+	config.DB.Model(&models.VPNTransaction{}).
+		Select("COALESCE(SUM(price), 0)").
+		Where("user_id = ? AND status <> ? AND created_at >= ?", userID, "failed", since).
+		Scan(&vpn)
+	return purchases + vpn
+}
+
+// CheckTierPromotion promotes a user whose spend this month reaches TIER_RESELLER_MONTHLY_SPEND
+// or TIER_AGENT_MONTHLY_SPEND. Users are never demoted automatically. Returns the new tier, or
+// an empty string when nothing changed.
+func CheckTierPromotion(userID int64) (string, error) {
+	if config.DB == nil {
+		return "", nil
+	}
+
+	resellerSpend := config.GetTierResellerMonthlySpend()
+	agentSpend := config.GetTierAgentMonthlySpend()
+	if resellerSpend <= 0 && agentSpend <= 0 {
+		return "", nil
+	}
+
+	current := GetUserTier(userID)
+	spend := GetUserSpendSince(userID, startOfMonth(time.Now()))
+
+	target := current
+	if agentSpend > 0 && spend >= agentSpend {
+		target = TierAgent
+	} else if resellerSpend > 0 && spend >= resellerSpend && tierRanks[current] < tierRanks[TierReseller] {
+		target = TierReseller
+	}
+
+	if tierRanks[target] <= tierRanks[current] {
+		return "", nil
+	}
+
+	if err := saveUserTier(models.UserTier{UserID: userID, Tier: target, AutoPromoted: true}); err != nil {
+		return "", err
+	}
+
+	log.Printf("User %d promoted to %s after spending %d this month", userID, target, spend)
+	notifyTierPromotion(userID, target)
+	return target, nil
+}
+
+// promoteTierIfEligible runs the promotion check, logging a failure instead of failing the caller's flow
+func promoteTierIfEligible(userID int64) {
+	if _, err := CheckTierPromotion(userID); err != nil {
+		log.Printf("Warning: failed to check tier promotion for user %d: %v", userID, err)
+	}
+}
+
+func notifyTierPromotion(userID int64, tier string) {
+	text := fmt.Sprintf(`🏅 *Selamat! Level Anda Naik*
+
+Anda sekarang menjadi *%s* berkat total belanja bulan ini.
+Harga khusus %s otomatis berlaku di daftar produk.`, TierName(tier), TierName(tier))
+
+	notifyTelegram(userID, text, "Markdown")
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// Kinds of top up messages sent to the admin chats
+const (
+	TopupNoticeApproval = "approval"
+	TopupNoticeProof    = "proof"
+)
+
+// TopupRejectReasons are offered as one-tap reasons when an admin rejects a top up
+var TopupRejectReasons = []string{
+	"Pembayaran belum kami terima",
+	"Nominal transfer tidak sesuai",
+	"Bukti transfer tidak valid",
+}
+
+// SendTopupApprovalNotices sends a pending top up to every admin chat with buttons to
+// approve it, reject it or ask the user for the transfer proof
+func SendTopupApprovalNotices(sender MessageSender, transactionID string) error {
+	TxMutex.RLock()
+	tx, exists := Transactions[transactionID]
+	var snapshot dto.Transaction
+	if exists {
+		snapshot = *tx
+	}
+	TxMutex.RUnlock()
+	if !exists {
+		return fmt.Errorf("transaksi tidak ditemukan")
+	}
+
+	b := NewMessageBuilder(ParseModeMarkdownV2).
+		Raw("💰 ").Bold("Top Up Menunggu Approval").Raw("\n\n").
+		Field("👤", "User", fmt.Sprintf("%s (%d)", snapshot.Username, snapshot.UserID)).
+		Field("💳", "Nominal", "Rp "+formatRupiah(snapshot.Amount))
+	if snapshot.BonusAmount > 0 {
+		b.Field("🎁", "Bonus", "Rp "+formatRupiah(snapshot.BonusAmount))
+	}
+	if snapshot.VoucherCode != "" {
+		b.Field("🎟️", "Voucher", snapshot.VoucherCode)
+	}
+	b.Raw("🆔 ").Bold("Transaction ID:").Raw(" ").Code(transactionID).Raw("\n").
+		Field("⏰", "Expired", snapshot.ExpiredAt)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Approve", "approve_tx:"+transactionID),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Reject", "reject_tx:"+transactionID),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📎 Minta Bukti", "askproof_tx:"+transactionID),
+		),
+	)
+
+	var lastErr error
+	for _, adminID := range config.GetAdminChatIDs() {
+		msg := b.Message(adminID)
+		msg.ReplyMarkup = keyboard
+		if err := sendTopupNotice(sender, adminID, msg, transactionID, TopupNoticeApproval, b.String()); err != nil {
+			log.Printf("Warning: failed to send approval notice of %s to admin %d: %v", transactionID, adminID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// sendTopupNotice sends a top up message to an admin and remembers it, so it can be
+// edited once the top up is processed
+func sendTopupNotice(sender MessageSender, chatID int64, c tgbotapi.Chattable, transactionID, kind, text string) error {
+	sent, err := SendWithFallback(sender, c)
+	if err != nil {
+		return err
+	}
+	return config.DB.Create(&models.TopupNotice{
+		TransactionID: transactionID,
+		ChatID:        chatID,
+		MessageID:     sent.MessageID,
+		Kind:          kind,
+		Text:          text,
+	}).Error
+}
+
+// RefreshTopupNotices edits the admin messages of a processed top up in place: the
+// buttons are removed and a line tells who approved or rejected it, so another admin
+// does not handle it again. Nothing changes while the top up is still pending.
+func RefreshTopupNotices(sender MessageSender, transactionID string) {
+	TxMutex.RLock()
+	tx, exists := Transactions[transactionID]
+	var snapshot dto.Transaction
+	if exists {
+		snapshot = *tx
+	}
+	TxMutex.RUnlock()
+	if !exists || snapshot.Status == "pending" {
+		return
+	}
+
+	var notices []models.TopupNotice
+	if err := config.DB.Where("transaction_id = ? AND resolved_at IS NULL", transactionID).Find(&notices).Error; err != nil {
+		log.Printf("Warning: failed to load notices of %s: %v", transactionID, err)
+		return
+	}
+	if len(notices) == 0 {
+		return
+	}
+
+	status := topupNoticeStatus(&snapshot)
+	for _, notice := range notices {
+		text := strings.TrimRight(notice.Text, "\n") + "\n\n" + status
+		var edit tgbotapi.Chattable
+		if notice.Kind == TopupNoticeProof {
+			caption := tgbotapi.NewEditMessageCaption(notice.ChatID, notice.MessageID, text)
+			caption.ParseMode = ParseModeMarkdownV2
+			edit = caption
+		} else {
+			message := tgbotapi.NewEditMessageText(notice.ChatID, notice.MessageID, text)
+			message.ParseMode = ParseModeMarkdownV2
+			edit = message
+		}
+		if _, err := SendWithFallback(sender, edit); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+			log.Printf("Warning: failed to update notice of %s in chat %d: %v", transactionID, notice.ChatID, err)
+		}
+	}
+
+	now := time.Now()
+	ids := make([]uint, len(notices))
+	for i, notice := range notices {
+		ids[i] = notice.ID
+	}
+	if err := config.DB.Model(&models.TopupNotice{}).Where("id IN ?", ids).Update("resolved_at", &now).Error; err != nil {
+		log.Printf("Warning: failed to resolve notices of %s: %v", transactionID, err)
+	}
+}
+
+// topupNoticeStatus is the MarkdownV2 line appended to the admin messages of a processed top up
+func topupNoticeStatus(tx *dto.Transaction) string {
+	by := "API"
+	if tx.ApprovedBy != 0 {
+		by = fmt.Sprintf("admin %d", tx.ApprovedBy)
+	}
+
+	b := NewMessageBuilder(ParseModeMarkdownV2)
+	switch tx.Status {
+	case "confirmed":
+		b.Raw("✅ ").Bold("Di-approve").Textf(" oleh %s, %s", by, tx.ApprovedAt)
+	case "rejected":
+		b.Raw("❌ ").Bold("Ditolak").Textf(" oleh %s, %s", by, tx.ApprovedAt)
+		if tx.RejectReason != "" {
+			b.Raw("\n").Field("📝", "Alasan", tx.RejectReason)
+		}
+	case "expired":
+		b.Raw("⏰ ").Bold("Expired")
+	default:
+		b.Text(tx.Status)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// RequestPaymentProof asks the user of a pending top up to send the transfer screenshot
+// and returns the user's chat ID
+func RequestPaymentProof(sender MessageSender, transactionID string) (int64, error) {
+	TxMutex.RLock()
+	tx, exists := Transactions[transactionID]
+	var userID, amount int64
+	var status string
+	if exists {
+		userID, amount, status = tx.UserID, tx.Amount, tx.Status
+	}
+	TxMutex.RUnlock()
+	if !exists {
+		return 0, fmt.Errorf("transaksi tidak ditemukan")
+	}
+	if status != "pending" {
+		return 0, fmt.Errorf("transaksi sudah diproses atau expired")
+	}
+
+	msg := NewMessageBuilder(ParseModeMarkdownV2).
+		Raw("📎 ").Bold("Admin Meminta Bukti Transfer").Raw("\n\n").
+		Textf("Admin belum bisa memastikan pembayaran top up Anda sebesar Rp %s ", formatRupiah(amount)).
+		Raw("\\(").Code(transactionID).Raw("\\)").
+		Text(". Kirim screenshot bukti transfer sebagai foto di chat ini.").
+		Message(userID)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📤 Kirim Bukti Transfer", "topup_proof"),
+		),
+	)
+	if _, err := SendWithFallback(sender, msg); err != nil {
+		return userID, fmt.Errorf("gagal mengirim pesan ke user: %v", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// GetActiveTopupBonusTiers returns the tiers that apply right now, lowest minimum first
+func GetActiveTopupBonusTiers() ([]models.TopupBonusTier, error) {
+	if config.DB == nil {
+		return nil, nil
+	}
+
+	var tiers []models.TopupBonusTier
+	if err := config.DB.Where("active = ?", true).Order("min_amount ASC").Find(&tiers).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := tiers[:0]
+	for _, tier := range tiers {
+		if topupBonusTierRunning(&tier, now) {
+			active = append(active, tier)
+		}
+	}
+	return active, nil
+}
+
+// GetTopupBonus picks the tier giving the largest bonus for a top-up amount.
+// Returns nil and 0 when no tier applies.
+func GetTopupBonus(amount int64) (*models.TopupBonusTier, int64, error) {
+	tiers, err := GetActiveTopupBonusTiers()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var best *models.TopupBonusTier
+	var bestBonus int64
+	for i := range tiers {
+		if amount < tiers[i].MinAmount {
+			continue
+		}
+		if bonus := CalculateTopupBonus(&tiers[i], amount); bonus > bestBonus {
+			best = &tiers[i]
+			bestBonus = bonus
+		}
+	}
+	return best, bestBonus, nil
+}
+
+// CalculateTopupBonus applies a tier to a top-up amount
+func CalculateTopupBonus(tier *models.TopupBonusTier, amount int64) int64 {
+	var bonus int64
+	if tier.BonusType == MarkupPercent {
+		bonus = int64(math.Floor(float64(amount) * tier.BonusValue / 100))
+	} else {
+		bonus = int64(tier.BonusValue)
+	}
+
+	if tier.MaxBonus > 0 && bonus > tier.MaxBonus {
+		bonus = tier.MaxBonus
+	}
+	if bonus < 0 {
+		bonus = 0
+	}
+	return bonus
+}
+
+func topupBonusTierRunning(tier *models.TopupBonusTier, now time.Time) bool {
+	if tier.StartsAt != nil && now.Before(*tier.StartsAt) {
+		return false
+	}
+	if tier.EndsAt != nil && now.After(*tier.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// DescribeTopupBonusTier returns a short Indonesian description, e.g. "min Rp 500.000 bonus 5%"
+func DescribeTopupBonusTier(tier *models.TopupBonusTier) string {
+	var value string
+	if tier.BonusType == MarkupPercent {
+		value = fmt.Sprintf("%g%%", tier.BonusValue)
+		if tier.MaxBonus > 0 {
+			value += " (maks " + formatRupiah(tier.MaxBonus) + ")"
+		}
+	} else {
+		value = formatRupiah(int64(tier.BonusValue))
+	}
+
+	text := fmt.Sprintf("min %s bonus %s", formatRupiah(tier.MinAmount), value)
+	if tier.EndsAt != nil {
+		text += " s/d " + tier.EndsAt.Format("02/01/2006")
+	}
+	return text
+}
+
+// GetTopupBonusTiers returns every tier, including inactive and finished ones
+func GetTopupBonusTiers() ([]models.TopupBonusTier, error) {
+	var tiers []models.TopupBonusTier
+	err := config.DB.Order("min_amount ASC, id ASC").Find(&tiers).Error
+	return tiers, err
+}
+
+// SaveTopupBonusTier validates and creates or updates a tier
+func SaveTopupBonusTier(tier *models.TopupBonusTier) error {
+	if err := validateTopupBonusTier(tier); err != nil {
+		return err
+	}
+	return config.DB.Save(tier).Error
+}
+
+// UpdateTopupBonusTier loads a tier, applies fn and saves it
+func UpdateTopupBonusTier(id uint, fn func(*models.TopupBonusTier)) (*models.TopupBonusTier, error) {
+	var tier models.TopupBonusTier
+	if err := config.DB.First(&tier, id).Error; err != nil {
+		return nil, fmt.Errorf("bonus top up tidak ditemukan")
+	}
+
+	fn(&tier)
+	tier.ID = id
+
+	if err := SaveTopupBonusTier(&tier); err != nil {
+		return nil, err
+	}
+	return &tier, nil
+}
+
+// DeleteTopupBonusTier removes a tier; pending top-ups keep the bonus they were promised
+func DeleteTopupBonusTier(id uint) error {
+	result := config.DB.Delete(&models.TopupBonusTier{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("bonus top up tidak ditemukan")
+	}
+	return nil
+}
+
+func validateTopupBonusTier(tier *models.TopupBonusTier) error {
+	if tier.MinAmount <= 0 {
+		return fmt.Errorf("minimal top up harus lebih dari 0")
+	}
+	if tier.BonusType != MarkupFixed && tier.BonusType != MarkupPercent {
+		return fmt.Errorf("tipe bonus harus fixed atau percent")
+	}
+	if tier.BonusValue <= 0 {
+		return fmt.Errorf("nilai bonus harus lebih dari 0")
+	}
+	if tier.MaxBonus < 0 {
+		return fmt.Errorf("maksimal bonus tidak boleh negatif")
+	}
+	if tier.StartsAt != nil && tier.EndsAt != nil && tier.EndsAt.Before(*tier.StartsAt) {
+		return fmt.Errorf("tanggal berakhir harus setelah tanggal mulai")
+	}
+	return nil
+}
+
+// ParseTopupBonusSpec builds a tier from admin command arguments:
+// <min> <value> [maks=..] [mulai=YYYY-MM-DD] [sampai=YYYY-MM-DD] [nama=..].
+// A value ending in "%" is a percentage, anything else a fixed rupiah amount.
+func ParseTopupBonusSpec(args []string) (*models.TopupBonusTier, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("format: <minimal> <nilai> [opsi]")
+	}
+
+	tier := &models.TopupBonusTier{
+		MinAmount: parseSearchPrice(strings.ToLower(args[0])),
+		BonusType: MarkupFixed,
+		Active:    true,
+	}
+
+	value := args[1]
+	if strings.HasSuffix(value, "%") {
+		tier.BonusType = MarkupPercent
+		bonusValue, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("nilai bonus tidak valid: %s", value)
+		}
+		tier.BonusValue = bonusValue
+	} else {
+		tier.BonusValue = float64(parseSearchPrice(strings.ToLower(value)))
+	}
+
+	for _, option := range args[2:] {
+		key, raw, found := strings.Cut(option, "=")
+		if !found {
+			return nil, fmt.Errorf("opsi tidak valid: %s", option)
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "maks", "max":
+			tier.MaxBonus = parseSearchPrice(strings.ToLower(raw))
+		case "mulai":
+			var t time.Time
+			t, err = time.ParseInLocation("2006-01-02", raw, time.Local)
+			tier.StartsAt = &t
+		case "sampai":
+			var t time.Time
+			t, err = time.ParseInLocation("2006-01-02", raw, time.Local)
+			end := t.Add(24*time.Hour - time.Second)
+			tier.EndsAt = &end
+		case "nama":
+			tier.Name = strings.ReplaceAll(raw, "_", " ")
+		default:
+			return nil, fmt.Errorf("opsi tidak dikenal: %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("opsi %s tidak valid: %s", key, raw)
+		}
+	}
+
+	return tier, nil
+}
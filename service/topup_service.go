@@ -1,11 +1,9 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,8 +23,9 @@ var (
 	userMutex    sync.RWMutex
 )
 
-// CreateTopUpTransaction membuat transaksi top-up baru dengan QRIS dinamis
-func CreateTopUpTransaction(userID int64, username string, amount int64) (*dto.TopUpResponse, error) {
+// CreateTopUpTransaction membuat transaksi top-up baru dengan QRIS dinamis.
+// voucherCode opsional; bonusnya dikreditkan saat top-up dikonfirmasi admin.
+func CreateTopUpTransaction(userID int64, username string, amount int64, voucherCode string) (*dto.TopUpResponse, error) {
 	// Check cooldown to prevent spam
 	if err := CheckUserActionCooldown(userID, 30); err != nil {
 		return nil, err
@@ -39,6 +38,31 @@ func CreateTopUpTransaction(userID int64, username string, amount int64) (*dto.T
 	// Set action time after acquiring lock
 	SetUserActionTime(userID)
 
+	// Validate the voucher now so the user knows before paying; it is redeemed on confirmation
+	var voucherBonus int64
+	if voucherCode != "" {
+		voucher, bonus, err := CheckVoucher(voucherCode, userID, VoucherScopeTopUp, "", amount)
+		if err != nil {
+			return nil, err
+		}
+		voucherCode = voucher.Code
+		voucherBonus = bonus
+	}
+
+	// Lock in the bonus tier now so a campaign ending before confirmation does not drop it
+	var bonusAmount int64
+	var bonusTierName string
+	bonusTier, bonus, err := GetTopupBonus(amount)
+	if err != nil {
+		log.Printf("Warning: failed to load topup bonus tiers: %v", err)
+	} else if bonusTier != nil {
+		bonusAmount = bonus
+		bonusTierName = bonusTier.Name
+		if bonusTierName == "" {
+			bonusTierName = DescribeTopupBonusTier(bonusTier)
+		}
+	}
+
 	// Generate transaction ID
 	transactionID := fmt.Sprintf("TXN_%d_%d", userID, time.Now().Unix())
 
@@ -54,14 +78,16 @@ func CreateTopUpTransaction(userID int64, username string, amount int64) (*dto.T
 
 	// Create transaction
 	transaction := &dto.Transaction{
-		ID:        transactionID,
-		UserID:    userID,
-		Username:  username,
-		Amount:    amount,
-		Status:    "pending",
-		QRISCode:  qrisCode,
-		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
-		ExpiredAt: expiredAt.Format("2006-01-02 15:04:05"),
+		ID:          transactionID,
+		UserID:      userID,
+		Username:    username,
+		Amount:      amount,
+		Status:      "pending",
+		QRISCode:    qrisCode,
+		CreatedAt:   time.Now().Format("2006-01-02 15:04:05"),
+		ExpiredAt:   expiredAt.Format("2006-01-02 15:04:05"),
+		VoucherCode: voucherCode,
+		BonusAmount: bonusAmount,
 	}
 
 	// Store transaction
@@ -77,8 +103,16 @@ func CreateTopUpTransaction(userID int64, username string, amount int64) (*dto.T
 	// Debug log
 	log.Printf("Transaction created: ID=%s, UserID=%d, Amount=%d", transactionID, userID, amount)
 
-	// Notify admin about topup request
-	NotifyAdminTopupApproval(userID, amount, "QRIS")
+	// Notify admin about topup request; Telegram is slow, so the user does not wait for it
+	go NotifyAdminTopupApproval(transaction, "QRIS")
+	PublishAdminEvent(EventTopupPending, map[string]interface{}{
+		"transaction_id": transactionID,
+		"user_id":        userID,
+		"username":       username,
+		"amount":         amount,
+		"bonus":          bonusAmount,
+		"expired_at":     transaction.ExpiredAt,
+	})
 
 	// Return response
 	response := &dto.TopUpResponse{
@@ -90,6 +124,10 @@ func CreateTopUpTransaction(userID int64, username string, amount int64) (*dto.T
 			QRISCode:      qrisCode,
 			Amount:        amount,
 			ExpiredAt:     expiredAt.Format("2006-01-02 15:04:05"),
+			VoucherCode:   voucherCode,
+			VoucherBonus:  voucherBonus,
+			BonusAmount:   bonusAmount,
+			BonusTier:     bonusTierName,
 		},
 	}
 
@@ -119,8 +157,15 @@ func GetPendingTransactions() []*dto.Transaction {
 	return pending
 }
 
-// ConfirmTopUp mengkonfirmasi top-up oleh admin
+// ConfirmTopUp mengkonfirmasi top-up oleh admin. Pesan top up di chat admin ikut
+// diperbarui, juga ketika top up ternyata sudah diproses admin lain.
 func ConfirmTopUp(transactionID string, adminID int64) error {
+	err := confirmTopUp(transactionID, adminID)
+	refreshTopupNotices(transactionID)
+	return err
+}
+
+func confirmTopUp(transactionID string, adminID int64) error {
 	TxMutex.Lock()
 	defer TxMutex.Unlock()
 
@@ -154,27 +199,64 @@ func ConfirmTopUp(transactionID string, adminID int64) error {
 	tx.ApprovedBy = adminID
 	tx.ApprovedAt = time.Now().Format("2006-01-02 15:04:05")
 
-	// Sync to database
-	if err := SyncTransactionToDatabase(tx); err != nil {
-		log.Printf("Warning: Failed to sync transaction to database: %v", err)
-	}
+	// The status, the credit (top-up plus tier bonus) and the user's notification are
+	// written in one database transaction, so a confirmed top-up is never left without
+	// its balance or its message
+	credit := tx.Amount + tx.BonusAmount
+	var balance int64
+	err = config.DB.Transaction(func(db *gorm.DB) error {
+		if err := syncTransaction(db, tx); err != nil {
+			return err
+		}
+
+		var err error
+		balance, err = addUserBalance(db, tx.UserID, credit)
+		if err != nil {
+			return err
+		}
 
-	// Update user balance using AddUserBalance function
-	err = AddUserBalance(tx.UserID, tx.Amount)
+		return queueTopupSuccess(db, tx.UserID, tx.Amount, tx.BonusAmount, transactionID, balance)
+	})
 	if err != nil {
-		log.Printf("Error adding balance for user %d: %v", tx.UserID, err)
-		NotifyAdminError(tx.UserID, "Balance Update", fmt.Sprintf("Failed to add balance for topup %s: %v", transactionID, err))
+		tx.Status = "pending"
+		tx.ApprovedBy = 0
+		tx.ApprovedAt = ""
+		log.Printf("Error confirming topup %s for user %d: %v", transactionID, tx.UserID, err)
+		NotifyAdminError(tx.UserID, "Balance Update", fmt.Sprintf("Failed to confirm topup %s: %v", transactionID, err))
 		return fmt.Errorf("gagal menambah saldo user")
 	}
-
-	// Notify user about successful topup
-	NotifyUserTopupSuccess(tx.UserID, tx.Amount, transactionID)
+	WakeOutboxDispatcher()
+
+	publishBalanceAdjusted(tx.UserID, credit, balance)
+	PublishEvent(EventTopupConfirmed, map[string]interface{}{
+		"transaction_id": transactionID,
+		"user_id":        tx.UserID,
+		"amount":         tx.Amount,
+		"bonus":          tx.BonusAmount,
+		"approved_by":    adminID,
+	})
+
+	if tx.VoucherCode != "" {
+		bonus, err := redeemTopUpVoucher(tx.UserID, tx.VoucherCode, transactionID, tx.Amount)
+		if err != nil {
+			log.Printf("Voucher %s not applied to topup %s: %v", tx.VoucherCode, transactionID, err)
+		}
+		NotifyUserTopupVoucher(tx.UserID, tx.VoucherCode, bonus, err)
+	}
+	creditReferral(tx.UserID, ReferralSourceTopUp, transactionID, tx.Amount)
 
 	return nil
 }
 
-// RejectTopUp menolak top-up oleh admin
-func RejectTopUp(transactionID string, adminID int64) error {
+// RejectTopUp menolak top-up oleh admin. reason dikirim ke user bersama pemberitahuan
+// penolakan dan ditampilkan di pesan top up di chat admin.
+func RejectTopUp(transactionID string, adminID int64, reason string) error {
+	err := rejectTopUp(transactionID, adminID, strings.TrimSpace(reason))
+	refreshTopupNotices(transactionID)
+	return err
+}
+
+func rejectTopUp(transactionID string, adminID int64, reason string) error {
 	TxMutex.Lock()
 	defer TxMutex.Unlock()
 
@@ -192,15 +274,43 @@ func RejectTopUp(transactionID string, adminID int64) error {
 	tx.Status = "rejected"
 	tx.ApprovedBy = adminID
 	tx.ApprovedAt = time.Now().Format("2006-01-02 15:04:05")
+	tx.RejectReason = reason
 
-	// Sync to database
-	if err := SyncTransactionToDatabase(tx); err != nil {
-		log.Printf("Warning: Failed to sync transaction to database: %v", err)
-	}
+	// The status and the user's notification are written together, like a confirmation
+	err := config.DB.Transaction(func(db *gorm.DB) error {
+		if err := syncTransaction(db, tx); err != nil {
+			return err
+		}
+		return queueTopupRejected(db, tx.UserID, tx.Amount, transactionID, reason)
+	})
+	if err != nil {
+		tx.Status = "pending"
+		tx.ApprovedBy = 0
+		tx.ApprovedAt = ""
+		tx.RejectReason = ""
+		log.Printf("Error rejecting topup %s for user %d: %v", transactionID, tx.UserID, err)
+		return fmt.Errorf("gagal menolak transaksi")
+	}
+	WakeOutboxDispatcher()
+
+	PublishAdminEvent(EventTopupRejected, map[string]interface{}{
+		"transaction_id": transactionID,
+		"user_id":        tx.UserID,
+		"amount":         tx.Amount,
+		"reason":         reason,
+		"rejected_by":    adminID,
+	})
 
 	return nil
 }
 
+// refreshTopupNotices updates the admin messages of a top up when the bot is running
+func refreshTopupNotices(transactionID string) {
+	if config.BotInstance != nil && config.DB != nil {
+		RefreshTopupNotices(config.BotInstance, transactionID)
+	}
+}
+
 // GetUserBalance mendapatkan saldo user dari database
 func GetUserBalance(userID int64) *dto.UserBalance {
 	var userBalance models.UserBalance
@@ -260,13 +370,29 @@ func DeductUserBalance(userID int64, amount int64) error {
 		return fmt.Errorf("insufficient balance or concurrent modification")
 	}
 
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	publishBalanceAdjusted(userID, -amount, userBalance.Balance-amount)
+	return nil
 }
 
 // AddUserBalance menambah saldo user (untuk testing dan topup confirmation)
 func AddUserBalance(userID int64, amount int64) error {
+	balance, err := addUserBalance(config.DB, userID, amount)
+	if err != nil {
+		return err
+	}
+
+	publishBalanceAdjusted(userID, amount, balance)
+	return nil
+}
+
+// addUserBalance credits a balance using db, which may be a transaction, and returns the new balance
+func addUserBalance(db *gorm.DB, userID int64, amount int64) (int64, error) {
 	var userBalance models.UserBalance
-	err := config.DB.Where("user_id = ?", userID).First(&userBalance).Error
+	err := db.Where("user_id = ?", userID).First(&userBalance).Error
 	if err != nil {
 		// Create new balance record if not exists
 		userBalance = models.UserBalance{
@@ -274,14 +400,28 @@ func AddUserBalance(userID int64, amount int64) error {
 			Balance:   amount,
 			UpdatedAt: time.Now(),
 		}
-		return config.DB.Create(&userBalance).Error
+		if err := db.Create(&userBalance).Error; err != nil {
+			return 0, err
+		}
+		return userBalance.Balance, nil
 	}
 
 	// Add to existing balance
 	userBalance.Balance += amount
 	userBalance.UpdatedAt = time.Now()
 
-	return config.DB.Save(&userBalance).Error
+	if err := db.Save(&userBalance).Error; err != nil {
+		return 0, err
+	}
+	return userBalance.Balance, nil
+}
+
+func publishBalanceAdjusted(userID, delta, balance int64) {
+	PublishEvent(EventBalanceAdjusted, map[string]interface{}{
+		"user_id": userID,
+		"delta":   delta,
+		"balance": balance,
+	})
 }
 
 // GetTransactionByUserID mendapatkan transaksi berdasarkan user ID
@@ -306,42 +446,6 @@ func GetTransactionByUserID(userID int64) *dto.Transaction {
 	return latestTx
 }
 
-// SendWhatsAppNotification mengirim notifikasi WhatsApp ke admin
-func SendWhatsAppNotification(message string) error {
-	whatsappURL := "http://128.199.109.211:25120/send-message"
-	adminNumber := "6285150588080"
-
-	payload := map[string]string{
-		"number":  adminNumber,
-		"message": message,
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Error marshaling WhatsApp payload: %v", err)
-		return err
-	}
-
-	// Send HTTP request to WhatsApp API
-	req, err := http.NewRequest("POST", whatsappURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		log.Printf("Error creating WhatsApp request: %v", err)
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error sending WhatsApp notification: %v", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	log.Printf("WhatsApp notification sent successfully to %s", adminNumber)
-	return nil
-}
-
 // AddActiveUser menambahkan user ke daftar active users
 func AddActiveUser(userID int64) {
 	userMutex.Lock()
@@ -365,6 +469,11 @@ func GetAllUserIDsFromData() []int64 {
 
 // SyncTransactionToDatabase menyinkronkan transaksi dari in-memory ke database
 func SyncTransactionToDatabase(tx *dto.Transaction) error {
+	return syncTransaction(config.DB, tx)
+}
+
+// syncTransaction upserts a top-up transaction using db, which may be a transaction
+func syncTransaction(db *gorm.DB, tx *dto.Transaction) error {
 	// Parse times
 	createdAt, err := time.Parse("2006-01-02 15:04:05", tx.CreatedAt)
 	if err != nil {
@@ -378,14 +487,17 @@ func SyncTransactionToDatabase(tx *dto.Transaction) error {
 
 	// Create database transaction model
 	dbTx := models.Transaction{
-		ID:        tx.ID,
-		UserID:    tx.UserID,
-		Username:  tx.Username,
-		Amount:    tx.Amount,
-		Status:    tx.Status,
-		QRISCode:  tx.QRISCode,
-		CreatedAt: createdAt,
-		ExpiredAt: expiredAt,
+		ID:           tx.ID,
+		UserID:       tx.UserID,
+		Username:     tx.Username,
+		Amount:       tx.Amount,
+		Status:       tx.Status,
+		QRISCode:     tx.QRISCode,
+		CreatedAt:    createdAt,
+		ExpiredAt:    expiredAt,
+		VoucherCode:  tx.VoucherCode,
+		BonusAmount:  tx.BonusAmount,
+		RejectReason: tx.RejectReason,
 	}
 
 	// Set approved fields if available
@@ -401,7 +513,7 @@ func SyncTransactionToDatabase(tx *dto.Transaction) error {
 	}
 
 	// Save to database (upsert)
-	return config.DB.Save(&dbTx).Error
+	return db.Save(&dbTx).Error
 }
 
 // LoadTransactionsFromDatabase memuat transaksi dari database ke in-memory
@@ -421,14 +533,17 @@ func LoadTransactionsFromDatabase() error {
 	// Load from database
 	for _, dbTx := range dbTransactions {
 		tx := &dto.Transaction{
-			ID:        dbTx.ID,
-			UserID:    dbTx.UserID,
-			Username:  dbTx.Username,
-			Amount:    dbTx.Amount,
-			Status:    dbTx.Status,
-			QRISCode:  dbTx.QRISCode,
-			CreatedAt: dbTx.CreatedAt.Format("2006-01-02 15:04:05"),
-			ExpiredAt: dbTx.ExpiredAt.Format("2006-01-02 15:04:05"),
+			ID:           dbTx.ID,
+			UserID:       dbTx.UserID,
+			Username:     dbTx.Username,
+			Amount:       dbTx.Amount,
+			Status:       dbTx.Status,
+			QRISCode:     dbTx.QRISCode,
+			CreatedAt:    dbTx.CreatedAt.Format("2006-01-02 15:04:05"),
+			ExpiredAt:    dbTx.ExpiredAt.Format("2006-01-02 15:04:05"),
+			VoucherCode:  dbTx.VoucherCode,
+			BonusAmount:  dbTx.BonusAmount,
+			RejectReason: dbTx.RejectReason,
 		}
 
 		if dbTx.ApprovedBy != nil {
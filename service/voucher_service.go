@@ -0,0 +1,462 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"gorm.io/gorm"
+)
+
+// Voucher scopes: what a voucher can be applied to
+const (
+	VoucherScopePackage = "package"
+	VoucherScopeVPN     = "vpn"
+	VoucherScopeTopUp   = "topup"
+)
+
+// voucherCodePattern keeps codes easy to type in chat
+var voucherCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// VoucherReport summarizes how often a voucher was used and what it cost
+type VoucherReport struct {
+	models.Voucher
+	Users         int64 `json:"users"`
+	Redemptions   int64 `json:"redemptions"`
+	TotalDiscount int64 `json:"total_discount"`
+	Revenue       int64 `json:"revenue"` // Amount paid (or topped up) in redeemed transactions
+}
+
+// NormalizeVoucherCode uppercases and trims a code typed by a user
+func NormalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// VoucherScopeName returns the Indonesian label of a scope
+func VoucherScopeName(scope string) string {
+	switch scope {
+	case VoucherScopePackage:
+		return "paket data"
+	case VoucherScopeVPN:
+		return "VPN"
+	case VoucherScopeTopUp:
+		return "bonus top up"
+	}
+	return scope
+}
+
+// LookupVoucher checks everything about a voucher that does not depend on the amount:
+// scope, active flag, validity window, usage caps and eligible products.
+// productCode may be empty when the product is not chosen yet (top-ups).
+func LookupVoucher(code string, userID int64, scope, productCode string) (*models.Voucher, error) {
+	return lookupVoucher(config.DB, NormalizeVoucherCode(code), userID, scope, productCode)
+}
+
+func lookupVoucher(db *gorm.DB, code string, userID int64, scope, productCode string) (*models.Voucher, error) {
+	var voucher models.Voucher
+	if err := db.Where("code = ?", code).First(&voucher).Error; err != nil {
+		return nil, fmt.Errorf("kode voucher %s tidak ditemukan", code)
+	}
+
+	if !voucher.Active {
+		return nil, fmt.Errorf("voucher %s sudah tidak aktif", code)
+	}
+	if voucher.Scope != scope {
+		return nil, fmt.Errorf("voucher %s hanya berlaku untuk %s", code, VoucherScopeName(voucher.Scope))
+	}
+
+	now := time.Now()
+	if voucher.StartsAt != nil && now.Before(*voucher.StartsAt) {
+		return nil, fmt.Errorf("voucher %s baru berlaku mulai %s", code, voucher.StartsAt.Format("02/01/2006"))
+	}
+	if voucher.ExpiresAt != nil && now.After(*voucher.ExpiresAt) {
+		return nil, fmt.Errorf("voucher %s sudah kedaluwarsa", code)
+	}
+
+	if voucher.MaxUses > 0 && voucher.UsedCount >= voucher.MaxUses {
+		return nil, fmt.Errorf("kuota voucher %s sudah habis", code)
+	}
+
+	if voucher.MaxUsesPerUser > 0 {
+		var used int64
+		if err := db.Model(&models.VoucherRedemption{}).
+			Where("voucher_code = ? AND user_id = ?", code, userID).
+			Count(&used).Error; err != nil {
+			return nil, err
+		}
+		if used >= int64(voucher.MaxUsesPerUser) {
+			return nil, fmt.Errorf("Anda sudah memakai voucher %s", code)
+		}
+	}
+
+	if productCode != "" && !voucherCoversProduct(&voucher, productCode) {
+		return nil, fmt.Errorf("voucher %s tidak berlaku untuk produk ini", code)
+	}
+
+	return &voucher, nil
+}
+
+// CheckVoucher validates a voucher for a concrete amount and returns the discount
+// (or, for top-up vouchers, the bonus) it would give
+func CheckVoucher(code string, userID int64, scope, productCode string, amount int64) (*models.Voucher, int64, error) {
+	voucher, err := LookupVoucher(code, userID, scope, productCode)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	discount, err := voucherDiscount(voucher, amount)
+	if err != nil {
+		return nil, 0, err
+	}
+	return voucher, discount, nil
+}
+
+func voucherDiscount(voucher *models.Voucher, amount int64) (int64, error) {
+	if amount < voucher.MinSpend {
+		return 0, fmt.Errorf("voucher %s berlaku untuk transaksi minimal %s", voucher.Code, formatRupiah(voucher.MinSpend))
+	}
+	return CalculateVoucherDiscount(voucher, amount), nil
+}
+
+// CalculateVoucherDiscount applies the voucher to an amount. Discounts never exceed
+// the amount itself; top-up bonuses are only bounded by MaxDiscount.
+func CalculateVoucherDiscount(voucher *models.Voucher, amount int64) int64 {
+	var discount int64
+	if voucher.DiscountType == MarkupPercent {
+		discount = int64(math.Floor(float64(amount) * voucher.DiscountValue / 100))
+	} else {
+		discount = int64(voucher.DiscountValue)
+	}
+
+	if voucher.MaxDiscount > 0 && discount > voucher.MaxDiscount {
+		discount = voucher.MaxDiscount
+	}
+	if voucher.Scope != VoucherScopeTopUp && discount > amount {
+		discount = amount
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	return discount
+}
+
+// ReserveVoucher claims one use of a voucher before the transaction is sent upstream.
+// The use counts against the caps straight away; call ConfirmVoucherRedemption when the
+// transaction succeeds or CancelVoucherRedemption when it fails.
+func ReserveVoucher(code string, userID int64, scope, productCode string, amount int64) (*models.VoucherRedemption, error) {
+	code = NormalizeVoucherCode(code)
+	var redemption *models.VoucherRedemption
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		voucher, err := lookupVoucher(tx, code, userID, scope, productCode)
+		if err != nil {
+			return err
+		}
+
+		discount, err := voucherDiscount(voucher, amount)
+		if err != nil {
+			return err
+		}
+
+		// The conditional update keeps concurrent redemptions within the global cap
+		result := tx.Model(&models.Voucher{}).
+			Where("code = ? AND (max_uses = 0 OR used_count < max_uses)", code).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("kuota voucher %s sudah habis", code)
+		}
+
+		redemption = &models.VoucherRedemption{
+			VoucherCode: code,
+			UserID:      userID,
+			Scope:       scope,
+			ProductCode: productCode,
+			BaseAmount:  amount,
+			Discount:    discount,
+			CreatedAt:   time.Now(),
+		}
+		return tx.Create(redemption).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// ConfirmVoucherRedemption links a reserved redemption to the transaction that used it
+func ConfirmVoucherRedemption(redemption *models.VoucherRedemption, sourceID string) {
+	redemption.SourceID = sourceID
+	if err := config.DB.Model(redemption).Update("source_id", sourceID).Error; err != nil {
+		log.Printf("Warning: failed to confirm voucher redemption %d: %v", redemption.ID, err)
+	}
+}
+
+// CancelVoucherRedemption gives a reserved use back to the voucher
+func CancelVoucherRedemption(redemption *models.VoucherRedemption) {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.VoucherRedemption{}, redemption.ID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Voucher{}).
+			Where("code = ? AND used_count > 0", redemption.VoucherCode).
+			Update("used_count", gorm.Expr("used_count - 1")).Error
+	})
+	if err != nil {
+		log.Printf("Warning: failed to cancel voucher redemption %d: %v", redemption.ID, err)
+	}
+}
+
+// redeemTopUpVoucher credits the bonus of the voucher attached to a confirmed top-up
+func redeemTopUpVoucher(userID int64, voucherCode, transactionID string, amount int64) (int64, error) {
+	redemption, err := ReserveVoucher(voucherCode, userID, VoucherScopeTopUp, "", amount)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := AddUserBalance(userID, redemption.Discount); err != nil {
+		CancelVoucherRedemption(redemption)
+		return 0, err
+	}
+
+	ConfirmVoucherRedemption(redemption, transactionID)
+	return redemption.Discount, nil
+}
+
+func voucherCoversProduct(voucher *models.Voucher, productCode string) bool {
+	if strings.TrimSpace(voucher.EligibleProducts) == "" {
+		return true
+	}
+	for _, code := range strings.Split(voucher.EligibleProducts, ",") {
+		if strings.EqualFold(strings.TrimSpace(code), productCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseVoucherSpec builds a voucher from admin command arguments:
+// <code> <package|vpn|topup> <value> [min=..] [maks=..] [kuota=..] [peruser=..] [produk=A,B] [mulai=YYYY-MM-DD] [sampai=YYYY-MM-DD].
+// A value ending in "%" is a percentage, anything else a fixed rupiah amount.
+func ParseVoucherSpec(args []string) (*models.Voucher, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("format: <kode> <package|vpn|topup> <nilai> [opsi]")
+	}
+
+	voucher := &models.Voucher{
+		Code:           NormalizeVoucherCode(args[0]),
+		Scope:          strings.ToLower(args[1]),
+		DiscountType:   MarkupFixed,
+		MaxUsesPerUser: 1,
+		Active:         true,
+	}
+
+	value := args[2]
+	if strings.HasSuffix(value, "%") {
+		voucher.DiscountType = MarkupPercent
+		value = strings.TrimSuffix(value, "%")
+	}
+	discountValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("nilai voucher tidak valid: %s", args[2])
+	}
+	voucher.DiscountValue = discountValue
+
+	for _, option := range args[3:] {
+		key, raw, found := strings.Cut(option, "=")
+		if !found {
+			return nil, fmt.Errorf("opsi tidak valid: %s", option)
+		}
+
+		switch strings.ToLower(key) {
+		case "min":
+			voucher.MinSpend = parseSearchPrice(raw)
+		case "maks", "max":
+			voucher.MaxDiscount = parseSearchPrice(raw)
+		case "kuota":
+			voucher.MaxUses, err = strconv.Atoi(raw)
+		case "peruser":
+			voucher.MaxUsesPerUser, err = strconv.Atoi(raw)
+		case "produk":
+			voucher.EligibleProducts = raw
+		case "mulai":
+			var t time.Time
+			t, err = time.ParseInLocation("2006-01-02", raw, time.Local)
+			voucher.StartsAt = &t
+		case "sampai":
+			var t time.Time
+			t, err = time.ParseInLocation("2006-01-02", raw, time.Local)
+			end := t.Add(24*time.Hour - time.Second)
+			voucher.ExpiresAt = &end
+		case "ket":
+			voucher.Description = strings.ReplaceAll(raw, "_", " ")
+		default:
+			return nil, fmt.Errorf("opsi tidak dikenal: %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("opsi %s tidak valid: %s", key, raw)
+		}
+	}
+
+	return voucher, nil
+}
+
+func validateVoucher(voucher *models.Voucher) error {
+	voucher.Code = NormalizeVoucherCode(voucher.Code)
+	if !voucherCodePattern.MatchString(voucher.Code) {
+		return fmt.Errorf("kode voucher hanya boleh huruf, angka, _ atau - (3-32 karakter)")
+	}
+
+	switch voucher.Scope {
+	case VoucherScopePackage, VoucherScopeVPN, VoucherScopeTopUp:
+	default:
+		return fmt.Errorf("jenis voucher harus package, vpn atau topup")
+	}
+
+	switch voucher.DiscountType {
+	case MarkupFixed:
+	case MarkupPercent:
+		if voucher.DiscountValue > 100 && voucher.Scope != VoucherScopeTopUp {
+			return fmt.Errorf("diskon persen maksimal 100%%")
+		}
+	default:
+		return fmt.Errorf("tipe diskon harus fixed atau percent")
+	}
+
+	if voucher.DiscountValue <= 0 {
+		return fmt.Errorf("nilai voucher harus lebih dari 0")
+	}
+	if voucher.MaxUses < 0 || voucher.MaxUsesPerUser < 0 || voucher.MinSpend < 0 || voucher.MaxDiscount < 0 {
+		return fmt.Errorf("batas voucher tidak boleh negatif")
+	}
+	if voucher.StartsAt != nil && voucher.ExpiresAt != nil && voucher.ExpiresAt.Before(*voucher.StartsAt) {
+		return fmt.Errorf("tanggal berakhir harus setelah tanggal mulai")
+	}
+	return nil
+}
+
+// CreateVoucher validates and stores a new voucher
+func CreateVoucher(voucher *models.Voucher) error {
+	if err := validateVoucher(voucher); err != nil {
+		return err
+	}
+
+	voucher.UsedCount = 0
+	if err := config.DB.Create(voucher).Error; err != nil {
+		return fmt.Errorf("voucher %s sudah ada", voucher.Code)
+	}
+	return nil
+}
+
+// UpdateVoucher loads a voucher, applies fn and saves it after validation
+func UpdateVoucher(code string, fn func(*models.Voucher)) (*models.Voucher, error) {
+	var voucher models.Voucher
+	if err := config.DB.Where("code = ?", NormalizeVoucherCode(code)).First(&voucher).Error; err != nil {
+		return nil, fmt.Errorf("voucher tidak ditemukan")
+	}
+
+	fn(&voucher)
+	voucher.Code = NormalizeVoucherCode(code)
+
+	if err := validateVoucher(&voucher); err != nil {
+		return nil, err
+	}
+	if err := config.DB.Save(&voucher).Error; err != nil {
+		return nil, err
+	}
+	return &voucher, nil
+}
+
+// DeleteVoucher removes a voucher; its redemption history is kept for reporting
+func DeleteVoucher(code string) error {
+	result := config.DB.Where("code = ?", NormalizeVoucherCode(code)).Delete(&models.Voucher{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("voucher tidak ditemukan")
+	}
+	return nil
+}
+
+// GetVouchers returns all vouchers, newest first
+func GetVouchers() ([]models.Voucher, error) {
+	var vouchers []models.Voucher
+	err := config.DB.Order("created_at DESC").Find(&vouchers).Error
+	return vouchers, err
+}
+
+// GetVoucherReports returns usage numbers for every voucher
+func GetVoucherReports() ([]VoucherReport, error) {
+	vouchers, err := GetVouchers()
+	if err != nil {
+		return nil, err
+	}
+
+	var totals []struct {
+		VoucherCode   string
+		Users         int64
+		Redemptions   int64
+		TotalDiscount int64
+		Revenue       int64
+	}
+	err = config.DB.Model(&models.VoucherRedemption{}).
+		Select(`voucher_code,
+			COUNT(DISTINCT user_id) AS users,
+			COUNT(*) AS redemptions,
+			COALESCE(SUM(discount), 0) AS total_discount,
+			COALESCE(SUM(CASE WHEN scope = ? THEN base_amount ELSE base_amount - discount END), 0) AS revenue`, VoucherScopeTopUp).
+		Where("source_id <> ''").
+		Group("voucher_code").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]VoucherReport, 0, len(vouchers))
+	for _, voucher := range vouchers {
+		report := VoucherReport{Voucher: voucher}
+		for _, total := range totals {
+			if total.VoucherCode == voucher.Code {
+				report.Users = total.Users
+				report.Redemptions = total.Redemptions
+				report.TotalDiscount = total.TotalDiscount
+				report.Revenue = total.Revenue
+				break
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// GetVoucherRedemptions returns the latest redemptions of a voucher
+func GetVoucherRedemptions(code string, limit int) ([]models.VoucherRedemption, error) {
+	var redemptions []models.VoucherRedemption
+	err := config.DB.Where("voucher_code = ?", NormalizeVoucherCode(code)).
+		Order("created_at DESC").Limit(limit).Find(&redemptions).Error
+	return redemptions, err
+}
+
+// FormatVoucherValue describes the value of a voucher, e.g. "10% (maks Rp 5.000)"
+func FormatVoucherValue(voucher *models.Voucher) string {
+	var value string
+	if voucher.DiscountType == MarkupPercent {
+		value = fmt.Sprintf("%g%%", voucher.DiscountValue)
+		if voucher.MaxDiscount > 0 {
+			value += " (maks " + formatRupiah(voucher.MaxDiscount) + ")"
+		}
+	} else {
+		value = formatRupiah(int64(voucher.DiscountValue))
+	}
+	return value
+}
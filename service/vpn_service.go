@@ -85,6 +85,11 @@ func CalculateVPNPrice(days int) int64 {
 	return int64(float64(days) * VPN_PRICE_PER_DAY)
 }
 
+// CalculateVPNCost menghitung modal VPN dari panel berdasarkan jumlah hari (VPN_COST_PER_DAY)
+func CalculateVPNCost(days int) int64 {
+	return int64(days) * config.GetVPNCostPerDay()
+}
+
 // getVPNToken mendapatkan token VPN yang valid
 func getVPNToken() (string, error) {
 	// Check if current token is still valid (with 5 minute buffer)
@@ -157,8 +162,8 @@ func getVPNToken() (string, error) {
 	return currentVPNToken, nil
 }
 
-// CreateVPNUser membuat user VPN baru
-func CreateVPNUser(userID int64, username, email, password, protocol string, days int) (*models.VPNTransaction, error) {
+// CreateVPNUser membuat user VPN baru; voucherCode opsional untuk diskon harga
+func CreateVPNUser(userID int64, username, email, password, protocol string, days int, voucherCode string) (*models.VPNTransaction, error) {
 	db := config.DB
 	
 	// Validasi input
@@ -173,6 +178,23 @@ func CreateVPNUser(userID int64, username, email, password, protocol string, day
 	// Hitung harga
 	price := CalculateVPNPrice(days)
 	
+	// Reserve voucher sebelum memanggil API VPN, dikembalikan jika pembuatan gagal
+	var redemption *models.VoucherRedemption
+	if voucherCode != "" {
+		var err error
+		redemption, err = ReserveVoucher(voucherCode, userID, VoucherScopeVPN, protocol, price)
+		if err != nil {
+			return nil, err
+		}
+		price -= redemption.Discount
+	}
+	created := false
+	defer func() {
+		if redemption != nil && !created {
+			CancelVoucherRedemption(redemption)
+		}
+	}()
+	
 	// Cek saldo user
 	balance := GetUserBalance(userID)
 	if balance.Balance < VPN_MIN_BALANCE {
@@ -190,15 +212,20 @@ func CreateVPNUser(userID int64, username, email, password, protocol string, day
 	// Create transaction record
 	txID := generateTransactionID()
 	vpnTx := &models.VPNTransaction{
-		ID:       txID,
-		UserID:   userID,
-		Username: vpnUsername,
-		Email:    email,
-		Password: password,
-		Protocol: protocol,
-		Days:     days,
-		Price:    price,
-		Status:   "pending",
+		ID:        txID,
+		UserID:    userID,
+		Username:  vpnUsername,
+		Email:     email,
+		Password:  password,
+		Protocol:  protocol,
+		Days:      days,
+		Price:     price,
+		CostPrice: CalculateVPNCost(days),
+		Status:    "pending",
+	}
+	if redemption != nil {
+		vpnTx.VoucherCode = redemption.VoucherCode
+		vpnTx.Discount = redemption.Discount
 	}
 	
 	if err := db.Create(vpnTx).Error; err != nil {
@@ -231,6 +258,12 @@ func CreateVPNUser(userID int64, username, email, password, protocol string, day
 		db.Save(vpnTx)
 		return nil, fmt.Errorf("gagal memotong saldo: %v", err)
 	}
+	created = true
+	if redemption != nil {
+		ConfirmVoucherRedemption(redemption, vpnTx.ID)
+	}
+	creditReferral(userID, ReferralSourceVPN, vpnTx.ID, price)
+	promoteTierIfEligible(userID)
 	
 	// Save VPN user data
 	configData, _ := json.Marshal(apiResp.Data.Config)
@@ -257,6 +290,16 @@ func CreateVPNUser(userID int64, username, email, password, protocol string, day
 	vpnTx.ResponseData = string(responseData)
 	db.Save(vpnTx)
 	
+	PublishEvent(EventVPNCreated, map[string]interface{}{
+		"transaction_id": vpnTx.ID,
+		"user_id":        userID,
+		"vpn_username":   vpnUsername,
+		"protocol":       protocol,
+		"days":           days,
+		"price":          price,
+		"expired_at":     vpnUser.ExpiredAt,
+	})
+	
 	return vpnTx, nil
 }
 
@@ -315,21 +358,34 @@ func ExtendVPNUser(userID int64, vpnUsername string, days int) error {
 	// Create transaction record for extension
 	txID := generateTransactionID()
 	vpnTx := &models.VPNTransaction{
-		ID:       txID,
-		UserID:   userID,
-		Username: vpnUsername,
-		Email:    "extend",
-		Password: "extend",
-		Protocol: vpnUser.Protocol,
-		Days:     days,
-		Price:    price,
-		Status:   "success",
+		ID:        txID,
+		UserID:    userID,
+		Username:  vpnUsername,
+		Email:     "extend",
+		Password:  "extend",
+		Protocol:  vpnUser.Protocol,
+		Days:      days,
+		Price:     price,
+		CostPrice: CalculateVPNCost(days),
+		Status:    "success",
 	}
 	
 	if err := db.Create(vpnTx).Error; err != nil {
 		log.Printf("Error saving VPN extend transaction: %v", err)
 		// Continue anyway
 	}
+	creditReferral(userID, ReferralSourceVPN, vpnTx.ID, price)
+	promoteTierIfEligible(userID)
+	
+	PublishEvent(EventVPNExtended, map[string]interface{}{
+		"transaction_id": vpnTx.ID,
+		"user_id":        userID,
+		"vpn_username":   vpnUsername,
+		"protocol":       vpnUser.Protocol,
+		"days":           days,
+		"price":          price,
+		"expired_at":     vpnUser.ExpiredAt,
+	})
 	
 	return nil
 }
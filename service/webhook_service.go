@@ -0,0 +1,374 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+)
+
+// Webhook event types
+const (
+	EventTopupConfirmed  = "topup.confirmed"
+	EventPurchaseSuccess = "purchase.success"
+	EventPurchaseFailed  = "purchase.failed"
+	EventVPNCreated      = "vpn.created"
+	EventVPNExtended     = "vpn.extended"
+	EventBalanceAdjusted = "balance.adjusted"
+)
+
+// WebhookEventTypes lists every event a subscription can ask for
+var WebhookEventTypes = []string{
+	EventTopupConfirmed,
+	EventPurchaseSuccess,
+	EventPurchaseFailed,
+	EventVPNCreated,
+	EventVPNExtended,
+	EventBalanceAdjusted,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookPending = "pending"
+	WebhookSent    = "sent"
+	WebhookFailed  = "failed"
+)
+
+const (
+	webhookBaseBackoff    = 30 * time.Second
+	webhookMaxBackoff     = 6 * time.Hour
+	webhookTimeout        = 10 * time.Second
+	webhookWorkerInterval = 15 * time.Second
+	webhookBatchLimit     = 50
+)
+
+// WebhookEvent is the JSON body posted to subscribers
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// PublishEvent records one delivery per matching active subscription and tries
+// to deliver them right away. Failed deliveries are retried by the dispatcher.
+// The event also goes to the live admin feed.
+func PublishEvent(eventType string, data interface{}) {
+	PublishAdminEvent(eventType, data)
+
+	if config.DB == nil {
+		return
+	}
+
+	var subscriptions []models.WebhookSubscription
+	if err := config.DB.Where("active = ?", true).Find(&subscriptions).Error; err != nil {
+		log.Printf("Warning: failed to load webhook subscriptions: %v", err)
+		return
+	}
+
+	var matching []models.WebhookSubscription
+	for _, sub := range subscriptions {
+		if webhookSubscribed(sub.EventTypes, eventType) {
+			matching = append(matching, sub)
+		}
+	}
+	if len(matching) == 0 {
+		return
+	}
+
+	eventID, err := randomToken(16)
+	if err != nil {
+		log.Printf("Warning: failed to generate webhook event ID: %v", err)
+		return
+	}
+
+	payload, err := json.Marshal(WebhookEvent{ID: eventID, Type: eventType, CreatedAt: time.Now(), Data: data})
+	if err != nil {
+		log.Printf("Warning: failed to encode %s webhook: %v", eventType, err)
+		return
+	}
+
+	now := time.Now()
+	deliveries := make([]models.WebhookDelivery, 0, len(matching))
+	for _, sub := range matching {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        string(payload),
+			Status:         WebhookPending,
+			NextAttemptAt:  &now,
+		})
+	}
+	if err := config.DB.Create(&deliveries).Error; err != nil {
+		log.Printf("Warning: failed to record %s webhook deliveries: %v", eventType, err)
+		return
+	}
+
+	go func() {
+		for i := range deliveries {
+			deliverWebhookIfDue(deliveries[i].ID)
+		}
+	}()
+}
+
+func webhookSubscribed(eventTypes, eventType string) bool {
+	for _, t := range strings.Split(eventTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhookIfDue reloads a delivery and sends it when it is still pending and due,
+// so the immediate attempt and the dispatcher don't both send it
+func deliverWebhookIfDue(id uint) {
+	now := time.Now()
+	next := now.Add(webhookTimeout * 2)
+
+	// Claim the delivery by pushing its next attempt out; whoever updates the row sends it
+	result := config.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, WebhookPending, now).
+		Update("next_attempt_at", next)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := config.DB.First(&delivery, id).Error; err != nil {
+		return
+	}
+	if err := DeliverWebhook(&delivery); err != nil {
+		log.Printf("Webhook delivery %d (%s) failed, attempt %d: %v", delivery.ID, delivery.EventType, delivery.Attempts, err)
+	}
+}
+
+// DeliverWebhook posts a delivery to its subscription and records the outcome.
+// Failures are retried with exponential backoff until WEBHOOK_MAX_ATTEMPTS is reached.
+func DeliverWebhook(delivery *models.WebhookDelivery) error {
+	var sub models.WebhookSubscription
+	err := config.DB.First(&sub, delivery.SubscriptionID).Error
+	if err == nil {
+		delivery.ResponseCode, err = postWebhook(&sub, delivery)
+	}
+	delivery.Attempts++
+
+	if err == nil {
+		now := time.Now()
+		delivery.Status = WebhookSent
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= config.GetWebhookMaxAttempts() {
+			delivery.Status = WebhookFailed
+			delivery.NextAttemptAt = nil
+		} else {
+			next := time.Now().Add(WebhookBackoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+	}
+
+	if saveErr := config.DB.Save(delivery).Error; saveErr != nil {
+		log.Printf("Warning: failed to save webhook delivery %d: %v", delivery.ID, saveErr)
+	}
+	return err
+}
+
+// WebhookBackoff returns the wait after the given number of failed attempts:
+// 30s, 1m, 2m, 4m, ... capped at 6 hours
+func WebhookBackoff(attempts int) time.Duration {
+	return exponentialBackoff(webhookBaseBackoff, webhookMaxBackoff, attempts)
+}
+
+func postWebhook(sub *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest("POST", sub.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", SignPayload(sub.Secret, body))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// RunWebhookDispatcher sends every pending delivery whose next attempt is due
+func RunWebhookDispatcher() {
+	var due []models.WebhookDelivery
+	config.DB.Select("id").
+		Where("status = ? AND next_attempt_at <= ?", WebhookPending, time.Now()).
+		Order("next_attempt_at ASC").Limit(webhookBatchLimit).Find(&due)
+
+	for _, delivery := range due {
+		deliverWebhookIfDue(delivery.ID)
+	}
+}
+
+// StartWebhookDispatcher runs RunWebhookDispatcher in the background
+func StartWebhookDispatcher() {
+	go func() {
+		ticker := time.NewTicker(webhookWorkerInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if config.DB != nil {
+				RunWebhookDispatcher()
+			}
+		}
+	}()
+}
+
+// ReplayWebhookDelivery queues a delivery again with a fresh attempt budget
+func ReplayWebhookDelivery(id uint) error {
+	now := time.Now()
+	result := config.DB.Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          WebhookPending,
+		"attempts":        0,
+		"next_attempt_at": &now,
+		"last_error":      "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("pengiriman webhook tidak ditemukan")
+	}
+
+	go deliverWebhookIfDue(id)
+	return nil
+}
+
+// CreateWebhookSubscription stores a subscription and returns its signing secret
+func CreateWebhookSubscription(sub *models.WebhookSubscription) (string, error) {
+	if err := validateWebhookSubscription(sub); err != nil {
+		return "", err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	sub.Secret = secret
+
+	if err := config.DB.Create(sub).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// UpdateWebhookSubscription loads a subscription, applies fn and saves it
+func UpdateWebhookSubscription(id uint, fn func(*models.WebhookSubscription)) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	if err := config.DB.First(&sub, id).Error; err != nil {
+		return nil, fmt.Errorf("webhook tidak ditemukan")
+	}
+
+	fn(&sub)
+	sub.ID = id
+
+	if err := validateWebhookSubscription(&sub); err != nil {
+		return nil, err
+	}
+	if err := config.DB.Save(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// DeleteWebhookSubscription removes a subscription; its delivery log is kept
+func DeleteWebhookSubscription(id uint) error {
+	result := config.DB.Delete(&models.WebhookSubscription{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("webhook tidak ditemukan")
+	}
+
+	// Pending deliveries have nowhere to go anymore
+	config.DB.Model(&models.WebhookDelivery{}).
+		Where("subscription_id = ? AND status = ?", id, WebhookPending).
+		Updates(map[string]interface{}{"status": WebhookFailed, "last_error": "subscription deleted", "next_attempt_at": nil})
+	return nil
+}
+
+// GetWebhookSubscriptions returns all subscriptions
+func GetWebhookSubscriptions() ([]models.WebhookSubscription, error) {
+	var subs []models.WebhookSubscription
+	err := config.DB.Order("id ASC").Find(&subs).Error
+	return subs, err
+}
+
+// GetWebhookDeliveries returns the latest deliveries, optionally filtered by subscription and status
+func GetWebhookDeliveries(subscriptionID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := config.DB.Order("id DESC").Limit(limit)
+	if subscriptionID != 0 {
+		query = query.Where("subscription_id = ?", subscriptionID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	err := query.Find(&deliveries).Error
+	return deliveries, err
+}
+
+func validateWebhookSubscription(sub *models.WebhookSubscription) error {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url webhook tidak valid")
+	}
+
+	var types []string
+	for _, t := range strings.Split(sub.EventTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if t != "*" && !isWebhookEventType(t) {
+			return fmt.Errorf("tipe event tidak dikenal: %s", t)
+		}
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return fmt.Errorf("event_types wajib diisi")
+	}
+	sub.EventTypes = strings.Join(types, ",")
+	return nil
+}
+
+func isWebhookEventType(eventType string) bool {
+	for _, t := range WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -7,9 +7,9 @@ import (
 	"log"
 	"net/http"
 	"time"
-)
 
-const whatsappAPIURL = "http://128.199.109.211:25120/send-message"
+	"github.com/nabilulilalbab/bottele/config"
+)
 
 // SendWhatsAppMessage sends a message via WhatsApp API
 func SendWhatsAppMessage(phoneNumber, message string) error {
@@ -23,7 +23,7 @@ func SendWhatsAppMessage(phoneNumber, message string) error {
 		return fmt.Errorf("error marshaling WhatsApp payload: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", whatsappAPIURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", config.GetWhatsAppAPIURL(), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return fmt.Errorf("error creating WhatsApp request: %v", err)
 	}
@@ -0,0 +1,11 @@
+// Package templates holds the default bot messages, one directory per language.
+// Every .tmpl file defines messages with {{define "key"}} using Go text/template;
+// admins can override a key at runtime without a redeploy.
+package templates
+
+import "embed"
+
+// FS contains <language>/<name>.tmpl
+//
+//go:embed */*.tmpl
+var FS embed.FS
@@ -0,0 +1,221 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/api"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextAdminEvent waits for the next event of the given type, skipping events published
+// by other parts of the service
+func nextAdminEvent(t *testing.T, sub *service.AdminEventSubscription, eventType string) service.AdminEvent {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event, ok := <-sub.Events:
+			require.True(t, ok, "subscription closed")
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+}
+
+func TestAdminEvents(t *testing.T) {
+	t.Setenv("ADMIN_EVENT_BUFFER", "3")
+
+	sub := service.SubscribeAdminEvents(0)
+	defer sub.Close()
+	assert.False(t, sub.Reset)
+	assert.Empty(t, sub.Backlog)
+
+	var ids []uint64
+	for i := 0; i < 4; i++ {
+		service.PublishAdminEvent("test.event", map[string]interface{}{"n": i})
+		ids = append(ids, nextAdminEvent(t, sub, "test.event").ID)
+	}
+
+	// Resuming replays the buffered events after Last-Event-ID
+	resumed := service.SubscribeAdminEvents(ids[1])
+	resumed.Close()
+	assert.False(t, resumed.Reset)
+	require.Len(t, resumed.Backlog, 2)
+	assert.Equal(t, ids[2], resumed.Backlog[0].ID)
+	assert.Equal(t, ids[3], resumed.Backlog[1].ID)
+
+	// The buffer holds the last 3 events, so resuming from the first still loses nothing
+	resumed = service.SubscribeAdminEvents(ids[0])
+	resumed.Close()
+	assert.False(t, resumed.Reset)
+	assert.Len(t, resumed.Backlog, 3)
+
+	// Older or unknown IDs, e.g. from before a restart, ask the client to reload
+	for _, id := range []uint64{ids[0] - 1, ids[3] + 100} {
+		resumed = service.SubscribeAdminEvents(id)
+		resumed.Close()
+		assert.True(t, resumed.Reset)
+		assert.Empty(t, resumed.Backlog)
+	}
+
+	// A subscriber that stops reading is dropped instead of blocking publishers
+	lagging := service.SubscribeAdminEvents(0)
+	for i := 0; i < 100; i++ {
+		service.PublishAdminEvent("test.flood", nil)
+	}
+	received := 0
+	for range lagging.Events {
+		received++
+	}
+	assert.Less(t, received, 100)
+	lagging.Close()
+}
+
+func TestAdminEventStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.SetupRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func(ctx context.Context, token string, lastEventID uint64) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/admin/events", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if lastEventID != 0 {
+			req.Header.Set("Last-Event-ID", strconv.FormatUint(lastEventID, 10))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Setenv("ADMIN_API_TOKEN", "")
+	resp := get(context.Background(), "secret", 0)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+	resp = get(context.Background(), "wrong", 0)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// Resuming from before an event replays it, then new events follow live
+	sub := service.SubscribeAdminEvents(0)
+	service.PublishAdminEvent(service.EventTopupPending, map[string]interface{}{"transaction_id": "TXN_SSE_1"})
+	missed := nextAdminEvent(t, sub, service.EventTopupPending)
+	sub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp = get(ctx, "secret", missed.ID-1)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func(eventType string) string {
+		var block []string
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimRight(line, "\n")
+			if line != "" {
+				block = append(block, line)
+				continue
+			}
+			// A blank line ends an event
+			if text := strings.Join(block, "\n"); strings.Contains(text, "event: "+eventType+"\n") {
+				return text
+			}
+			block = nil
+		}
+	}
+
+	replayed := readEvent(service.EventTopupPending)
+	assert.Contains(t, replayed, "id: "+strconv.FormatUint(missed.ID, 10))
+	assert.Contains(t, replayed, `"transaction_id":"TXN_SSE_1"`)
+
+	service.PublishAdminEvent(service.EventTopupRejected, map[string]interface{}{"transaction_id": "TXN_SSE_1", "reason": "Nominal tidak sesuai"})
+	live := readEvent(service.EventTopupRejected)
+	assert.Contains(t, live, `"reason":"Nominal tidak sesuai"`)
+}
+
+func TestPurchaseEventsOnlyForFinalStatus(t *testing.T) {
+	db := useTestDatabase(t)
+	require.NoError(t, db.Create(&models.PurchaseTransaction{
+		ID: "TRX-EVT-1", UserID: 3101, PackageCode: "X", PackageName: "X", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 20000, Status: "pending",
+	}).Error)
+
+	sub := service.SubscribeAdminEvents(0)
+	defer sub.Close()
+
+	service.UpdatePurchaseStatus("TRX-EVT-1", &dto.TransactionCheckResponse{Success: true, Data: dto.TransactionCheckData{Status: 0}})
+	service.UpdatePurchaseStatus("TRX-EVT-1", &dto.TransactionCheckResponse{Success: true, Data: dto.TransactionCheckData{Status: 1, RC: "00"}})
+
+	// The first event is the success; the still-processing check published nothing
+	select {
+	case event := <-sub.Events:
+		assert.Equal(t, service.EventPurchaseSuccess, event.Type)
+	case <-time.After(time.Second):
+		t.Fatal("no purchase event")
+	}
+}
+
+func TestAdminTokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	var logged bytes.Buffer
+	defaultWriter := gin.DefaultWriter
+	gin.DefaultWriter = &logged
+	t.Cleanup(func() { gin.DefaultWriter = defaultWriter })
+
+	router := gin.New()
+	router.Use(api.RequestLogger())
+	router.GET("/check", api.AdminTokenAuth(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	status := func(path, authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The bearer scheme is case-insensitive
+	assert.Equal(t, http.StatusNoContent, status("/check", "Bearer secret"))
+	assert.Equal(t, http.StatusNoContent, status("/check", "bearer secret"))
+	assert.Equal(t, http.StatusNoContent, status("/check", "BEARER  secret"))
+	assert.Equal(t, http.StatusUnauthorized, status("/check", "Basic secret"))
+	assert.Equal(t, http.StatusUnauthorized, status("/check", "secret"))
+
+	// The query token works for EventSource but never shows up in the request log
+	assert.Equal(t, http.StatusNoContent, status("/check?token=secret&last_event_id=4", ""))
+	assert.NotContains(t, logged.String(), "secret")
+	assert.Contains(t, logged.String(), "token=REDACTED")
+	assert.Contains(t, logged.String(), "last_event_id=4")
+
+	assert.Equal(t, "/api/admin/events", api.RedactTokenQuery("/api/admin/events"))
+	assert.Equal(t, "/x?page=2", api.RedactTokenQuery("/x?page=2"))
+	assert.Equal(t, "/x?REDACTED", api.RedactTokenQuery("/x?token=%zz"))
+}
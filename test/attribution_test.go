@@ -0,0 +1,102 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// useTestDatabase points config.DB at a fresh, fully migrated in-memory database
+func useTestDatabase(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.AutoMigrate(db))
+
+	// Every new connection would open another empty in-memory database, so background
+	// goroutines must share the one that was migrated
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	// Caches loaded from another test's database must not leak into this one
+	previous := config.DB
+	config.DB = db
+	service.ResetCaches()
+	t.Cleanup(func() {
+		config.DB = previous
+		service.ResetCaches()
+	})
+
+	return db
+}
+
+func TestStartAttribution(t *testing.T) {
+	db := useTestDatabase(t)
+
+	const referrerID = int64(1001)
+	const newUserID = int64(2002)
+
+	require.NoError(t, service.AddActiveUserToDB(referrerID))
+
+	t.Run("Self referral is rejected", func(t *testing.T) {
+		assert.Error(t, service.RecordReferral(referrerID, referrerID))
+	})
+
+	t.Run("New user is attributed to the referrer", func(t *testing.T) {
+		require.NoError(t, service.RecordReferral(newUserID, referrerID))
+
+		var user models.ActiveUser
+		require.NoError(t, db.First(&user, "user_id = ?", newUserID).Error)
+		assert.Equal(t, referrerID, user.ReferredBy)
+	})
+
+	t.Run("Existing user cannot be re-referred", func(t *testing.T) {
+		assert.Error(t, service.RecordReferral(newUserID, int64(3003)))
+	})
+
+	t.Run("Interaction tracking keeps attribution", func(t *testing.T) {
+		require.NoError(t, service.AddActiveUserToDB(newUserID))
+
+		var user models.ActiveUser
+		require.NoError(t, db.First(&user, "user_id = ?", newUserID).Error)
+		assert.Equal(t, referrerID, user.ReferredBy)
+	})
+
+	t.Run("Unknown campaign is ignored", func(t *testing.T) {
+		assert.Error(t, service.RecordCampaign(newUserID, "nope"))
+	})
+
+	t.Run("First campaign wins and shows up in the report", func(t *testing.T) {
+		_, err := service.CreateCampaign("promo_a", "Promo A", referrerID)
+		require.NoError(t, err)
+		_, err = service.CreateCampaign("promo_b", "Promo B", referrerID)
+		require.NoError(t, err)
+
+		require.NoError(t, service.RecordCampaign(newUserID, "promo_a"))
+		require.NoError(t, service.RecordCampaign(newUserID, "promo_b"))
+
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: "trx-1", UserID: newUserID, PackageCode: "X", PackageName: "X",
+			PaymentMethod: "BALANCE", PhoneNumber: "0877", Price: 12000, Status: "success",
+		}).Error)
+
+		reports, err := service.GetCampaignReports()
+		require.NoError(t, err)
+
+		byCode := make(map[string]service.CampaignReport)
+		for _, report := range reports {
+			byCode[report.Code] = report
+		}
+
+		assert.Equal(t, int64(1), byCode["promo_a"].Users)
+		assert.Equal(t, int64(1), byCode["promo_a"].Buyers)
+		assert.Equal(t, int64(12000), byCode["promo_a"].PurchaseRevenue)
+		assert.Equal(t, int64(0), byCode["promo_b"].Users)
+	})
+}
@@ -0,0 +1,391 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chatSender fails sends to particular chats with the queued errors and records the rest
+type chatSender struct {
+	errs  map[int64][]error
+	sent  []int64
+	edits int
+}
+
+func (f *chatSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var chatID int64
+	switch msg := c.(type) {
+	case tgbotapi.MessageConfig:
+		chatID = msg.ChatID
+	case tgbotapi.PhotoConfig:
+		chatID = msg.ChatID
+	case tgbotapi.DocumentConfig:
+		chatID = msg.ChatID
+	default:
+		f.edits++
+		return tgbotapi.Message{}, nil
+	}
+	if errs := f.errs[chatID]; len(errs) > 0 {
+		f.errs[chatID] = errs[1:]
+		return tgbotapi.Message{}, errs[0]
+	}
+	f.sent = append(f.sent, chatID)
+	return tgbotapi.Message{MessageID: len(f.sent)}, nil
+}
+
+func useFastBroadcasts(t *testing.T) {
+	t.Setenv("BROADCAST_RATE", "1000")
+	t.Setenv("BROADCAST_CHAT_INTERVAL_MS", "0")
+}
+
+func TestBroadcastJob(t *testing.T) {
+	useFastBroadcasts(t)
+
+	t.Run("sends to every user and flags users who blocked the bot", func(t *testing.T) {
+		db := useTestDatabase(t)
+		for _, id := range []int64{1, 2, 3} {
+			require.NoError(t, service.AddActiveUserToDB(id))
+		}
+
+		job, err := service.CreateBroadcastJob("Promo *hari ini*", service.ParseModeMarkdown, 99, []int64{1, 2, 3, 2, 0})
+		require.NoError(t, err)
+		assert.Equal(t, 3, job.Total)
+		require.NoError(t, service.SetBroadcastProgressMessage(job.ID, 99, 7))
+
+		sender := &chatSender{errs: map[int64][]error{
+			2: {&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}},
+		}}
+		require.NoError(t, service.RunBroadcastJob(sender, job.ID))
+
+		job, err = service.GetBroadcastJob(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, service.BroadcastCompleted, job.Status)
+		assert.Equal(t, 2, job.Sent)
+		assert.Equal(t, 1, job.Blocked)
+		assert.NotNil(t, job.FinishedAt)
+		assert.Equal(t, []int64{1, 3}, sender.sent)
+		assert.Greater(t, sender.edits, 0, "progress message is edited")
+
+		var blocked models.ActiveUser
+		require.NoError(t, db.Where("user_id = ?", 2).First(&blocked).Error)
+		assert.NotNil(t, blocked.BlockedAt)
+
+		// Blocked users are skipped by the next broadcast until they talk to the bot again
+		next, err := service.CreateBroadcastJob("Lagi", "", 99, []int64{1, 2, 3})
+		require.NoError(t, err)
+		assert.Equal(t, 2, next.Total)
+
+		require.NoError(t, service.AddActiveUserToDB(2))
+		var unblocked models.ActiveUser
+		require.NoError(t, db.Where("user_id = ?", 2).First(&unblocked).Error)
+		assert.Nil(t, unblocked.BlockedAt)
+	})
+
+	t.Run("waits out flood control and retries other errors later", func(t *testing.T) {
+		db := useTestDatabase(t)
+
+		job, err := service.CreateBroadcastJob("Halo", "", 0, []int64{10, 11, 12})
+		require.NoError(t, err)
+
+		sender := &chatSender{errs: map[int64][]error{
+			10: {&tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}}},
+			11: {&tgbotapi.Error{Code: 500, Message: "Internal Server Error"}},
+		}}
+		start := time.Now()
+		require.NoError(t, service.RunBroadcastJob(sender, job.ID))
+		assert.GreaterOrEqual(t, time.Since(start), time.Second, "retry_after holds every send")
+
+		var recipients []models.BroadcastRecipient
+		require.NoError(t, db.Where("job_id = ?", job.ID).Order("chat_id").Find(&recipients).Error)
+		require.Len(t, recipients, 3)
+
+		// The flood-limited recipient is sent once retry_after has passed, without counting the 429
+		assert.Equal(t, service.RecipientSent, recipients[0].Status)
+		assert.Equal(t, 1, recipients[0].Attempts)
+
+		// Other errors back off, so the job stays running with that recipient pending
+		assert.Equal(t, service.RecipientPending, recipients[1].Status)
+		assert.Equal(t, 1, recipients[1].Attempts)
+		require.NotNil(t, recipients[1].NextAttemptAt)
+		assert.True(t, recipients[1].NextAttemptAt.After(time.Now()))
+
+		assert.Equal(t, service.RecipientSent, recipients[2].Status)
+
+		job, err = service.GetBroadcastJob(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, service.BroadcastRunning, job.Status)
+
+		// The job resumes where it left off once the retry is due
+		past := time.Now().Add(-time.Second)
+		require.NoError(t, db.Model(&models.BroadcastRecipient{}).Where("id = ?", recipients[1].ID).Update("next_attempt_at", &past).Error)
+		require.NoError(t, service.RunBroadcastJob(sender, job.ID))
+
+		job, err = service.GetBroadcastJob(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, service.BroadcastCompleted, job.Status)
+		assert.Equal(t, 3, job.Sent)
+		assert.Equal(t, []int64{12, 10, 11}, sender.sent)
+	})
+
+	t.Run("pause, resume and cancel", func(t *testing.T) {
+		useTestDatabase(t)
+
+		job, err := service.CreateBroadcastJob("Halo", "", 0, []int64{20, 21})
+		require.NoError(t, err)
+
+		require.NoError(t, service.PauseBroadcastJob(job.ID))
+		assert.Error(t, service.PauseBroadcastJob(job.ID))
+
+		sender := &chatSender{}
+		require.NoError(t, service.RunBroadcastJob(sender, job.ID))
+		assert.Empty(t, sender.sent, "a paused job sends nothing")
+
+		require.NoError(t, service.ResumeBroadcastJob(job.ID))
+		require.NoError(t, service.CancelBroadcastJob(job.ID))
+		require.NoError(t, service.RunBroadcastJob(sender, job.ID))
+		assert.Empty(t, sender.sent, "a cancelled job sends nothing")
+
+		assert.Error(t, service.ResumeBroadcastJob(job.ID))
+		assert.Error(t, service.CancelBroadcastJob(job.ID))
+
+		job, err = service.GetBroadcastJob(job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, service.BroadcastCancelled, job.Status)
+	})
+
+	t.Run("rejects an empty broadcast", func(t *testing.T) {
+		useTestDatabase(t)
+
+		_, err := service.CreateBroadcastJob("  ", "", 0, []int64{1})
+		assert.Error(t, err)
+		_, err = service.CreateBroadcastJob("Halo", "", 0, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestBroadcastSegment(t *testing.T) {
+	db := useTestDatabase(t)
+	now := time.Now()
+
+	for id := int64(1); id <= 7; id++ {
+		require.NoError(t, service.AddActiveUserToDB(id))
+	}
+	recent, old := now.AddDate(0, 0, -3), now.AddDate(0, 0, -60)
+	require.NoError(t, db.Create(&models.Transaction{ID: "TOPUP-1", UserID: 1, Username: "a", Amount: 10000, Status: "confirmed", ApprovedAt: &recent}).Error)
+	require.NoError(t, db.Create(&models.Transaction{ID: "TOPUP-2", UserID: 2, Username: "b", Amount: 10000, Status: "confirmed", ApprovedAt: &old}).Error)
+	require.NoError(t, db.Create(&models.UserBalance{UserID: 3, Balance: 60000}).Error)
+	require.NoError(t, db.Create(&models.UserBalance{UserID: 4, Balance: 10000}).Error)
+	require.NoError(t, db.Create(&models.VPNUser{UserID: 5, VPNUsername: "vpn5", Protocol: "ssh", Server: "s", Port: 22, ExpiredAt: now.AddDate(0, 0, 3)}).Error)
+	require.NoError(t, db.Create(&models.VPNUser{UserID: 6, VPNUsername: "vpn6", Protocol: "ssh", Server: "s", Port: 22, ExpiredAt: now.AddDate(0, 0, 20)}).Error)
+	require.NoError(t, db.Create(&models.UserTier{UserID: 2, Tier: service.TierReseller}).Error)
+	require.NoError(t, db.Create(&models.PurchaseTransaction{
+		ID: "TRX-SEG-1", UserID: 1, PackageCode: "X", PackageName: "X", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 1000, Status: "success",
+	}).Error)
+	require.NoError(t, db.Create(&models.PurchaseTransaction{
+		ID: "TRX-SEG-3", UserID: 3, PackageCode: "X", PackageName: "X", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 1000, Status: "failed",
+	}).Error)
+	require.NoError(t, db.Create(&models.VPNTransaction{UserID: 5, Status: "success"}).Error)
+	// User 7 has a purchase still pending upstream and a deleted VPN that would expire soon
+	require.NoError(t, db.Create(&models.PurchaseTransaction{
+		ID: "TRX-SEG-7", UserID: 7, PackageCode: "X", PackageName: "X", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 1000, Status: "pending",
+	}).Error)
+	deletedVPN := &models.VPNUser{UserID: 7, VPNUsername: "vpn7", Protocol: "ssh", Server: "s", Port: 22, ExpiredAt: now.AddDate(0, 0, 3)}
+	require.NoError(t, db.Create(deletedVPN).Error)
+	require.NoError(t, db.Delete(deletedVPN).Error)
+	service.MarkUserBlocked(6)
+
+	cases := []struct {
+		spec string
+		want []int64
+	}{
+		{"topup:30", []int64{1}},
+		{"topup:90", []int64{1, 2}},
+		{"balance:50000", []int64{3}},
+		{"vpn:7", []int64{5}},
+		{"vpn:30", []int64{5}}, // user 6 blocked the bot
+		{"tier:reseller", []int64{2}},
+		{"tier:retail", []int64{1, 3, 4, 5, 7}},
+		{"nopurchase", []int64{2, 3, 4}},
+		{"topup:90 nopurchase", []int64{2}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.spec, func(t *testing.T) {
+			segment, err := service.ParseBroadcastSegment(tc.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tc.spec, segment.String())
+
+			userIDs, err := service.ResolveBroadcastSegment(segment)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, userIDs)
+
+			count, err := service.CountBroadcastSegment(segment)
+			require.NoError(t, err)
+			assert.Equal(t, len(tc.want), count)
+		})
+	}
+
+	t.Run("invalid specs are rejected", func(t *testing.T) {
+		for _, spec := range []string{"topup:x", "balance:-5", "tier:vip", "spender"} {
+			_, err := service.ParseBroadcastSegment(spec)
+			assert.Error(t, err, spec)
+		}
+	})
+
+	t.Run("a segment broadcast only queues its users", func(t *testing.T) {
+		t.Setenv("BROADCAST_RATE", "1000")
+
+		segment, err := service.ParseBroadcastSegment("nopurchase")
+		require.NoError(t, err)
+		job, err := service.CreateSegmentBroadcastJob(service.BroadcastContent{Message: "Yuk belanja"}, 0, segment)
+		require.NoError(t, err)
+		assert.Equal(t, 3, job.Total)
+		assert.Equal(t, "nopurchase", job.Segment)
+
+		text, _ := service.BroadcastProgressMessage(job)
+		assert.Contains(t, text, "belum pernah beli")
+
+		_, err = service.CreateSegmentBroadcastJob(service.BroadcastContent{Message: "Halo"}, 0, service.BroadcastSegment{MinBalance: 1000000})
+		assert.Error(t, err)
+	})
+}
+
+func TestBroadcastContent(t *testing.T) {
+	t.Run("photo with buttons", func(t *testing.T) {
+		buttons, err := service.ParseBroadcastButtons("Beli sekarang | product:AKRAB_L\n\nInfo | https://example.com/promo")
+		require.NoError(t, err)
+		assert.Equal(t, []service.BroadcastButton{
+			{Text: "Beli sekarang", Product: "AKRAB_L"},
+			{Text: "Info", URL: "https://example.com/promo"},
+		}, buttons)
+
+		content := service.BroadcastContent{
+			Message:   "*Promo*",
+			ParseMode: service.ParseModeMarkdown,
+			MediaType: service.BroadcastMediaPhoto,
+			Media:     "AgACAgIAAxkBAAI",
+			Buttons:   buttons,
+		}
+		require.NoError(t, content.Validate())
+
+		photo, ok := content.Chattable(42).(tgbotapi.PhotoConfig)
+		require.True(t, ok)
+		assert.Equal(t, "*Promo*", photo.Caption)
+		assert.Equal(t, tgbotapi.FileID("AgACAgIAAxkBAAI"), photo.File)
+		keyboard := photo.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+		require.Len(t, keyboard.InlineKeyboard, 2)
+		assert.Equal(t, "detail:AKRAB_L", *keyboard.InlineKeyboard[0][0].CallbackData)
+		assert.Equal(t, "https://example.com/promo", *keyboard.InlineKeyboard[1][0].URL)
+
+		document, ok := service.BroadcastContent{MediaType: service.BroadcastMediaDocument, Media: "https://example.com/katalog.pdf"}.Chattable(42).(tgbotapi.DocumentConfig)
+		require.True(t, ok)
+		assert.Equal(t, tgbotapi.FileURL("https://example.com/katalog.pdf"), document.File)
+	})
+
+	t.Run("invalid content is rejected", func(t *testing.T) {
+		for _, content := range []service.BroadcastContent{
+			{},
+			{MediaType: service.BroadcastMediaPhoto},
+			{MediaType: "video", Media: "x"},
+			{MediaType: service.BroadcastMediaPhoto, Media: "x", Message: strings.Repeat("a", 1025)},
+			{Message: "Halo", Buttons: []service.BroadcastButton{{Text: "Buka", URL: "javascript:alert(1)"}}},
+			{Message: "Halo", Buttons: []service.BroadcastButton{{Text: "Dua", URL: "https://x.test", Product: "X"}}},
+		} {
+			assert.Error(t, content.Validate(), "%+v", content)
+		}
+
+		_, err := service.ParseBroadcastButtons("Tanpa tujuan")
+		assert.Error(t, err)
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		next := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+		at, repeat, err := service.ParseBroadcastSchedule(next.In(service.BroadcastLocation).Format(service.BroadcastScheduleLayout) + " harian")
+		require.NoError(t, err)
+		assert.True(t, next.Equal(at))
+		assert.Equal(t, service.BroadcastRepeatDaily, repeat)
+
+		// Times are WIB whatever the server's zone
+		at, _, err = service.ParseBroadcastSchedule("2099-01-31 19:00")
+		require.NoError(t, err)
+		assert.True(t, time.Date(2099, 1, 31, 12, 0, 0, 0, time.UTC).Equal(at))
+
+		_, _, err = service.ParseBroadcastSchedule("2020-01-01 10:00")
+		assert.Error(t, err, "past times are rejected")
+		_, _, err = service.ParseBroadcastSchedule(next.Format(service.BroadcastScheduleLayout) + " tahunan")
+		assert.Error(t, err)
+		_, _, err = service.ParseBroadcastSchedule("besok")
+		assert.Error(t, err)
+	})
+}
+
+func TestScheduledBroadcast(t *testing.T) {
+	useFastBroadcasts(t)
+	db := useTestDatabase(t)
+
+	for _, id := range []int64{31, 32} {
+		require.NoError(t, service.AddActiveUserToDB(id))
+	}
+
+	content := service.BroadcastContent{
+		Message:   "Promo pagi",
+		MediaType: service.BroadcastMediaPhoto,
+		Media:     "https://example.com/promo.jpg",
+		Buttons:   []service.BroadcastButton{{Text: "Beli sekarang", Product: "AKRAB_L"}},
+	}
+	at := time.Now().Add(time.Hour)
+	job, err := service.ScheduleBroadcastJob(content, 99, service.BroadcastSegment{}, at, "daily")
+	require.NoError(t, err)
+	assert.Equal(t, service.BroadcastScheduled, job.Status)
+
+	_, err = service.ScheduleBroadcastJob(content, 99, service.BroadcastSegment{}, time.Now().Add(-time.Minute), "")
+	assert.Error(t, err)
+
+	// Not due yet: the worker leaves it alone
+	sender := &chatSender{}
+	service.RunBroadcastWorker(sender)
+	assert.Empty(t, sender.sent)
+
+	// A user who joins before the run is included, since recipients are resolved when it starts
+	require.NoError(t, service.AddActiveUserToDB(33))
+
+	due := time.Now().Add(-time.Minute)
+	require.NoError(t, db.Model(&models.BroadcastJob{}).Where("id = ?", job.ID).Update("scheduled_at", &due).Error)
+	service.RunBroadcastWorker(sender)
+
+	job, err = service.GetBroadcastJob(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, service.BroadcastCompleted, job.Status)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, 3, job.Sent)
+	var delivered []int64
+	for _, id := range sender.sent {
+		if id != 99 {
+			delivered = append(delivered, id)
+		}
+	}
+	assert.ElementsMatch(t, []int64{31, 32, 33}, delivered)
+	assert.Contains(t, sender.sent, int64(99), "the admin is shown the run starting")
+
+	// The daily repeat is scheduled for the next day at the same time
+	var repeat models.BroadcastJob
+	require.NoError(t, db.Where("status = ?", service.BroadcastScheduled).First(&repeat).Error)
+	require.NotNil(t, repeat.ScheduledAt)
+	assert.WithinDuration(t, due.Add(24*time.Hour), *repeat.ScheduledAt, time.Second)
+	assert.Equal(t, service.BroadcastRepeatDaily, repeat.Repeat)
+	assert.Equal(t, content, service.BroadcastJobContent(&repeat))
+	assert.Equal(t, job.ID, repeat.SeriesID)
+
+	// Cancelling a run still in progress stops the series, including the run already scheduled
+	require.NoError(t, db.Model(&models.BroadcastJob{}).Where("id = ?", job.ID).Update("status", service.BroadcastRunning).Error)
+	require.NoError(t, service.CancelBroadcastJob(job.ID))
+	var scheduled int64
+	require.NoError(t, db.Model(&models.BroadcastJob{}).Where("status = ?", service.BroadcastScheduled).Count(&scheduled).Error)
+	assert.Zero(t, scheduled)
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestCatalog serves packages as the upstream catalog until the test ends
+func useTestCatalog(t *testing.T, packages ...dto.Package) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(dto.ApiResponse{Success: true, Data: packages})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("PRODUCTS_API_URL", server.URL)
+	service.ResetCatalogCache()
+	t.Cleanup(service.ResetCatalogCache)
+}
+
+func TestCatalogCache(t *testing.T) {
+	var hits, failing atomic.Int32
+	var name atomic.Value
+	name.Store("Paket v1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(dto.ApiResponse{
+			Success: true,
+			Data:    []dto.Package{{PackageCode: "PKG_1", PackageName: name.Load().(string), Price: 10000}},
+		})
+	}))
+	defer server.Close()
+
+	t.Setenv("PRODUCTS_API_URL", server.URL)
+	t.Setenv("CATALOG_CACHE_TTL", "1")
+	t.Setenv("CATALOG_STALE_TTL", "60")
+	service.ResetCatalogCache()
+	t.Cleanup(service.ResetCatalogCache)
+
+	catalogName := func() string {
+		packages, err := service.GetCatalog()
+		require.NoError(t, err)
+		require.Len(t, packages, 1)
+		return packages[0].PackageName
+	}
+
+	// Fresh data is served from memory
+	assert.Equal(t, "Paket v1", catalogName())
+	assert.Equal(t, "Paket v1", catalogName())
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Expired data is still served while a background refresh fetches the new catalog
+	name.Store("Paket v2")
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, "Paket v1", catalogName())
+	assert.Eventually(t, func() bool {
+		pkg, err := service.GetCatalogPackage("PKG_1")
+		return err == nil && pkg.PackageName == "Paket v2"
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), hits.Load())
+
+	// Past the stale window the catalog is fetched synchronously, and a failing upstream
+	// still falls back to the old data
+	t.Setenv("CATALOG_STALE_TTL", "0")
+	failing.Store(1)
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, "Paket v2", catalogName())
+	assert.Equal(t, int32(3), hits.Load())
+
+	failing.Store(0)
+	name.Store("Paket v3")
+	assert.Equal(t, "Paket v3", catalogName())
+
+	// An empty cache with a failing upstream is an error
+	service.ResetCatalogCache()
+	failing.Store(1)
+	_, err := service.GetCatalog()
+	assert.Error(t, err)
+}
+
+func TestCatalogCacheTTLConfig(t *testing.T) {
+	for _, value := range []string{"0", "-5"} {
+		t.Setenv("CATALOG_CACHE_TTL", value)
+		assert.Equal(t, 300*time.Second, config.GetCatalogCacheTTL(), value)
+	}
+	t.Setenv("CATALOG_CACHE_TTL", "60")
+	assert.Equal(t, time.Minute, config.GetCatalogCacheTTL())
+
+	t.Setenv("CATALOG_STALE_TTL", "-1")
+	assert.Equal(t, time.Duration(0), config.GetCatalogStaleTTL())
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkdownToWhatsApp(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		input     string
+		expected  string
+	}{
+		{"Bold and italic are kept", service.ParseModeMarkdown, "*Top-Up Berhasil!* _terima kasih_", "*Top-Up Berhasil!* _terima kasih_"},
+		{"Inline code becomes monospace", service.ParseModeMarkdown, "ID: `TOPUP_1_2`", "ID: ```TOPUP_1_2```"},
+		{"Pre block drops the language", service.ParseModeMarkdown, "```json\n{\"a\":1}\n```", "```{\"a\":1}\n```"},
+		{"Links keep their URL", service.ParseModeMarkdown, "[Bayar](https://pay.example.com/x)", "Bayar (https://pay.example.com/x)"},
+		{"Escaped markers stay literal", service.ParseModeMarkdown, `harga\_promo 5\*`, "harga_\u200bpromo 5*\u200b"},
+		{"Legacy keeps other backslashes", service.ParseModeMarkdown, `C:\path`, `C:\path`},
+		{"V2 escapes are removed", service.ParseModeMarkdownV2, `Rp 10\.000 \(promo\)\!`, "Rp 10.000 (promo)!"},
+		{"V2 strike is kept, underline and spoiler dropped", service.ParseModeMarkdownV2, "~lama~ __baru__ ||rahasia||", "~lama~ baru rahasia"},
+		{"V2 code unescapes backticks", service.ParseModeMarkdownV2, "`a\\`b`", "```a`b```"},
+		{"V2 link URL unescapes parentheses", service.ParseModeMarkdownV2, `[wiki](https://x.test/a_\(b\))`, "wiki (https://x.test/a_(b))"},
+		{"Unclosed code is literal", service.ParseModeMarkdown, "a ` b", "a `\u200b b"},
+		{"Text without a parse mode is untouched", "", "*not bold* \\_", "*not bold* \\_"},
+		{"HTML tags become markers", service.ParseModeHTML, "<b>Top-Up</b> <i>baru</i> <s>lama</s> <u>garis</u>", "*Top-Up* _baru_ ~lama~ garis"},
+		{"HTML entities are decoded", service.ParseModeHTML, "a &lt;b&gt; &amp; 5*2", "a <b> & 5*\u200b2"},
+		{"HTML pre with language", service.ParseModeHTML, `<pre><code class="language-go">x := "&lt;b&gt;"</code></pre>`, "```x := \"<b>\"```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, service.MarkdownToWhatsApp(tt.input, tt.parseMode))
+		})
+	}
+}
+
+func TestMarkdownToPlain(t *testing.T) {
+	tests := []struct {
+		name      string
+		parseMode string
+		input     string
+		expected  string
+	}{
+		{"Markers are stripped", service.ParseModeMarkdown, "✅ *Top-Up Berhasil!*\n💰 *Nominal:* 50.000", "✅ Top-Up Berhasil!\n💰 Nominal: 50.000"},
+		{"Code content is kept verbatim", service.ParseModeMarkdown, "ID: `TOPUP_1_2`", "ID: TOPUP_1_2"},
+		{"Escaped markers are kept", service.ParseModeMarkdown, `kode\_promo`, "kode_promo"},
+		{"Link with its own URL as text", service.ParseModeMarkdown, "[https://x.test](https://x.test)", "https://x.test"},
+		{"Formatted link text", service.ParseModeMarkdownV2, "[*Bayar* sekarang](https://x.test)", "Bayar sekarang (https://x.test)"},
+		{"V2 escapes are removed", service.ParseModeMarkdownV2, `1\+1\=2 \#promo`, "1+1=2 #promo"},
+		{"HTML link", service.ParseModeHTML, `<a href="https://x.test/?a=1&amp;b=2">Bayar <b>sini</b></a>`, "Bayar sini (https://x.test/?a=1&b=2)"},
+		{"HTML unclosed tags keep their text", service.ParseModeHTML, "<b>halo <code>ID_1", "halo ID_1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, service.MarkdownToPlain(tt.input, tt.parseMode))
+		})
+	}
+}
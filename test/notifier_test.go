@@ -0,0 +1,240 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts every message and keeps it
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+func startSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &smtpStandIn{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var msg smtpMessage
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg = smtpMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestNotifyRoute(t *testing.T) {
+	assert.Equal(t, []string{service.ChannelTelegram}, service.NotifyRoute(service.NotifyError))
+	assert.Equal(t, []string{service.ChannelTelegram, service.ChannelWhatsApp}, service.NotifyRoute(service.NotifyTopupApproval))
+
+	t.Setenv("NOTIFY_ROUTES", "error = webhook ; daily_report=email,telegram; approval=")
+	assert.Equal(t, []string{service.ChannelWebhook}, service.NotifyRoute(service.NotifyError))
+	assert.Equal(t, []string{service.ChannelEmail, service.ChannelTelegram}, service.NotifyRoute(service.NotifyDailyReport))
+	assert.Empty(t, service.NotifyRoute(service.NotifyApproval), "an empty route silences a kind")
+	assert.Equal(t, []string{service.ChannelTelegram, service.ChannelWhatsApp}, service.NotifyRoute(service.NotifyTopupApproval), "unlisted kinds keep their default")
+}
+
+func TestCheckNotifyRoutes(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "1001")
+	t.Setenv("ADMIN_WHATSAPP", "")
+	t.Setenv("NOTIFY_ROUTES", "")
+	assert.Equal(t, []string{"approval → whatsapp", "topup_approval → whatsapp", "activity → whatsapp"}, service.CheckNotifyRoutes())
+
+	t.Setenv("ADMIN_WHATSAPP", "628111")
+	assert.Empty(t, service.CheckNotifyRoutes())
+
+	t.Setenv("NOTIFY_ROUTES", "activity=telegram;error=sms")
+	t.Setenv("ADMIN_CHAT_ID", "")
+	assert.Equal(t, []string{"error → sms", "approval → telegram", "topup_approval → telegram", "activity → telegram", "daily_report → telegram"}, service.CheckNotifyRoutes())
+}
+
+func TestNotifiers(t *testing.T) {
+	db := useTestDatabase(t)
+
+	smtpServer := startSMTPStandIn(t)
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", strconv.Itoa(smtpServer.port()))
+	t.Setenv("SMTP_FROM", "bot@grnstore.test")
+	t.Setenv("ADMIN_EMAIL", "owner@grnstore.test, finance@grnstore.test")
+
+	var mu sync.Mutex
+	var hookBodies [][]byte
+	var hookSignatures []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		hookBodies = append(hookBodies, body)
+		hookSignatures = append(hookSignatures, r.Header.Get("X-Signature"))
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	t.Setenv("NOTIFY_WEBHOOK_URL", hook.URL)
+	t.Setenv("NOTIFY_WEBHOOK_SECRET", "hook-secret")
+
+	t.Setenv("NOTIFY_ROUTES", "daily_report=email;error=webhook")
+
+	queuedChannels := func() []string {
+		var messages []models.OutboxMessage
+		require.NoError(t, db.Where("status = ?", service.OutboxPending).Order("id ASC").Find(&messages).Error)
+		var channels []string
+		for _, msg := range messages {
+			channels = append(channels, msg.Channel)
+		}
+		return channels
+	}
+
+	t.Run("Daily report is emailed to the admins", func(t *testing.T) {
+		now := time.Now()
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: "TRX-REPORT-1", UserID: 9001, PackageCode: "AKRAB_L", PackageName: "Akrab L", PaymentMethod: "BALANCE",
+			PhoneNumber: "0812", Price: 55000, CostPrice: 50000, Status: "success", CreatedAt: now,
+		}).Error)
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: "TRX-REPORT-2", UserID: 9001, PackageCode: "AKRAB_L", PackageName: "Akrab L", PaymentMethod: "BALANCE",
+			PhoneNumber: "0812", Price: 55000, CostPrice: 50000, Status: "failed", CreatedAt: now,
+		}).Error)
+		// Paid already, waiting for the upstream result
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: "TRX-REPORT-3", UserID: 9001, PackageCode: "AKRAB_L", PackageName: "Akrab L", PaymentMethod: "BALANCE",
+			PhoneNumber: "0812", Price: 55000, CostPrice: 50000, Status: "pending", CreatedAt: now,
+		}).Error)
+
+		report, err := service.BuildDailyReport(now)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), report.PurchaseCount)
+		assert.Equal(t, int64(1), report.PurchasePending)
+		assert.Equal(t, int64(1), report.PurchaseFailed)
+		assert.Equal(t, int64(110000), report.PurchaseRevenue)
+		assert.Equal(t, int64(10000), report.PurchaseMargin)
+		assert.Contains(t, service.FormatDailyReport(report), "2 terjual (1 diproses), 1 gagal")
+
+		require.NoError(t, service.SendDailyReport(now))
+		assert.Equal(t, []string{service.ChannelEmail}, queuedChannels())
+
+		service.RunOutboxDispatcher()
+		assert.Empty(t, queuedChannels())
+
+		messages := smtpServer.received()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "bot@grnstore.test", messages[0].From)
+		assert.Equal(t, []string{"owner@grnstore.test", "finance@grnstore.test"}, messages[0].To)
+		assert.Contains(t, messages[0].Data, "Subject: Laporan Harian "+now.Format("02/01/2006"))
+		assert.Contains(t, messages[0].Data, "Margin Paket: Rp 10.000")
+		assert.NotContains(t, messages[0].Data, "*", "markdown is stripped from email")
+	})
+
+	t.Run("Errors follow their route to the webhook only", func(t *testing.T) {
+		service.NotifyAdminError(9002, "Purchase", "upstream timeout")
+		assert.Equal(t, []string{service.ChannelWebhook}, queuedChannels())
+
+		service.RunOutboxDispatcher()
+		assert.Empty(t, queuedChannels())
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, hookBodies, 1)
+		assert.Equal(t, service.SignPayload("hook-secret", hookBodies[0]), hookSignatures[0])
+
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(hookBodies[0], &payload))
+		assert.Equal(t, "System Error Alert", payload["subject"])
+		assert.Contains(t, payload["text"], "upstream timeout")
+	})
+
+	t.Run("Channels without an admin recipient are skipped", func(t *testing.T) {
+		t.Setenv("NOTIFY_ROUTES", "approval=whatsapp")
+		t.Setenv("ADMIN_WHATSAPP", "")
+
+		service.NotifyAdminApprovalNeeded(9003, "Refund", "needs a look")
+		assert.Empty(t, queuedChannels())
+	})
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, service.OutboxBackoff(1))
+	assert.Equal(t, 20*time.Second, service.OutboxBackoff(2))
+	assert.Equal(t, time.Hour, service.OutboxBackoff(30))
+}
+
+func TestOutbox(t *testing.T) {
+	db := useTestDatabase(t)
+
+	var mu sync.Mutex
+	status := http.StatusOK
+	var received []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, payload)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	t.Setenv("WHATSAPP_API_URL", server.URL)
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "2")
+
+	setStatus := func(code int) {
+		mu.Lock()
+		status = code
+		mu.Unlock()
+	}
+
+	latestMessage := func() models.OutboxMessage {
+		var msg models.OutboxMessage
+		require.NoError(t, db.Order("id DESC").First(&msg).Error)
+		return msg
+	}
+
+	t.Run("Confirming a top-up queues the user's message with the new balance", func(t *testing.T) {
+		const userID = int64(8001)
+		now := time.Now()
+		tx := &dto.Transaction{
+			ID:        "TXN_OUTBOX_1",
+			UserID:    userID,
+			Amount:    50000,
+			Status:    "pending",
+			CreatedAt: now.Format("2006-01-02 15:04:05"),
+			ExpiredAt: now.Add(30 * time.Minute).Format("2006-01-02 15:04:05"),
+		}
+		service.TxMutex.Lock()
+		service.Transactions[tx.ID] = tx
+		service.TxMutex.Unlock()
+		t.Cleanup(func() {
+			service.TxMutex.Lock()
+			delete(service.Transactions, tx.ID)
+			service.TxMutex.Unlock()
+		})
+
+		require.NoError(t, service.ConfirmTopUp(tx.ID, 1))
+
+		msg := latestMessage()
+		assert.Equal(t, service.ChannelTelegram, msg.Channel)
+		assert.Equal(t, strconv.FormatInt(userID, 10), msg.Recipient)
+		assert.Equal(t, service.OutboxPending, msg.Status)
+		assert.Contains(t, msg.Message, "TXN_OUTBOX_1")
+		assert.Contains(t, msg.Message, "50.000")
+	})
+
+	t.Run("Telegram messages wait while the bot is unavailable", func(t *testing.T) {
+		msg := latestMessage()
+		require.NoError(t, db.Model(&msg).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+
+		service.RunOutboxDispatcher()
+
+		msg = latestMessage()
+		assert.Equal(t, service.OutboxPending, msg.Status)
+		assert.Equal(t, 1, msg.Attempts)
+		assert.Contains(t, msg.LastError, "bot instance")
+		require.NoError(t, db.Delete(&msg).Error)
+	})
+
+	t.Run("WhatsApp messages are delivered", func(t *testing.T) {
+		t.Setenv("ADMIN_WHATSAPP", "628111")
+		service.NotifyAdminActivity("hello admin")
+		service.RunOutboxDispatcher()
+
+		msg := latestMessage()
+		assert.Equal(t, service.OutboxSent, msg.Status)
+		assert.NotNil(t, msg.SentAt)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, received, 1)
+		assert.Equal(t, "628111", received[0]["number"])
+		assert.Equal(t, "hello admin", received[0]["message"])
+	})
+
+	t.Run("Gateway errors are retried, then dead-lettered", func(t *testing.T) {
+		setStatus(http.StatusBadGateway)
+		require.NoError(t, service.QueueWhatsAppMessage(db, "628123", "retry me"))
+		service.RunOutboxDispatcher()
+
+		msg := latestMessage()
+		assert.Equal(t, service.OutboxPending, msg.Status)
+		assert.Equal(t, 1, msg.Attempts)
+		assert.Contains(t, msg.LastError, "502")
+		require.NotNil(t, msg.NextAttemptAt)
+		assert.WithinDuration(t, time.Now().Add(10*time.Second), *msg.NextAttemptAt, 3*time.Second)
+
+		// Not due yet
+		service.RunOutboxDispatcher()
+		assert.Equal(t, 1, latestMessage().Attempts)
+
+		require.NoError(t, db.Model(&msg).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+		service.RunOutboxDispatcher()
+
+		msg = latestMessage()
+		assert.Equal(t, service.OutboxDead, msg.Status)
+		assert.Equal(t, 2, msg.Attempts)
+		assert.Nil(t, msg.NextAttemptAt)
+
+		stats, err := service.GetOutboxStats()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Dead)
+		assert.Equal(t, int64(1), stats.Sent)
+		assert.Equal(t, int64(0), stats.Pending)
+	})
+
+	t.Run("Dead letters can be retried", func(t *testing.T) {
+		setStatus(http.StatusOK)
+		msg := latestMessage()
+		require.NoError(t, service.RetryOutboxMessage(msg.ID))
+		assert.Error(t, service.RetryOutboxMessage(msg.ID), "only dead letters can be retried")
+
+		service.RunOutboxDispatcher()
+
+		msg = latestMessage()
+		assert.Equal(t, service.OutboxSent, msg.Status)
+		assert.Equal(t, 1, msg.Attempts)
+
+		dead, err := service.GetOutboxMessages(service.OutboxDead, 10)
+		require.NoError(t, err)
+		assert.Empty(t, dead)
+	})
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/api"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartnerIPAllowed(t *testing.T) {
+	assert.True(t, service.PartnerIPAllowed("", "203.0.113.9"))
+	assert.True(t, service.PartnerIPAllowed("198.51.100.7, 203.0.113.0/24", "203.0.113.9"))
+	assert.True(t, service.PartnerIPAllowed("198.51.100.7", "198.51.100.7"))
+	assert.False(t, service.PartnerIPAllowed("198.51.100.7", "198.51.100.8"))
+	assert.False(t, service.PartnerIPAllowed("203.0.113.0/24", "not-an-ip"))
+}
+
+// adminRouteStatus sends a request through the real routes, with the bearer token when one is given
+func adminRouteStatus(t *testing.T, method, path, token string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.SetupRoutes(router)
+
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestPartnerAdminRoutesRequireToken(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	partner := &models.Partner{Name: "Mitra Jaya", UserID: 6001, Active: true}
+	_, _, err := service.CreatePartner(partner)
+	require.NoError(t, err)
+	rotatePath := fmt.Sprintf("/api/admin/partners/%d/rotate-key", partner.ID)
+
+	// Minting or rotating a key spends the partner user's balance, so it needs the admin token
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPost, "/api/admin/partners", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPost, rotatePath, "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodGet, "/api/admin/partners", ""))
+
+	var count int64
+	db.Model(&models.Partner{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	assert.Equal(t, http.StatusOK, adminRouteStatus(t, http.MethodGet, "/api/admin/partners", "secret"))
+	assert.Equal(t, http.StatusOK, adminRouteStatus(t, http.MethodPost, rotatePath, "secret"))
+}
+
+func TestPartnerAPI(t *testing.T) {
+	db := useTestDatabase(t)
+
+	partner := &models.Partner{Name: "Mitra Jaya", UserID: 6001, AllowedIPs: "10.0.0.0/8", Active: true}
+	apiKey, secret, err := service.CreatePartner(partner)
+	require.NoError(t, err)
+
+	t.Run("Keys are stored hashed", func(t *testing.T) {
+		var stored models.Partner
+		require.NoError(t, db.First(&stored, partner.ID).Error)
+		assert.NotEqual(t, apiKey, stored.APIKeyHash)
+		assert.Equal(t, service.HashPartnerKey(apiKey), stored.APIKeyHash)
+		assert.Contains(t, apiKey, stored.APIKeyPrefix)
+	})
+
+	t.Run("Authentication checks key, status and IP", func(t *testing.T) {
+		found, err := service.AuthenticatePartner(apiKey, "10.1.2.3")
+		require.NoError(t, err)
+		assert.Equal(t, partner.ID, found.ID)
+
+		_, err = service.AuthenticatePartner(apiKey, "192.168.1.1")
+		assert.Error(t, err)
+
+		_, err = service.AuthenticatePartner("h2h_wrong", "10.1.2.3")
+		assert.Error(t, err)
+
+		_, err = service.UpdatePartner(partner.ID, func(p *models.Partner) { p.Active = false })
+		require.NoError(t, err)
+		_, err = service.AuthenticatePartner(apiKey, "10.1.2.3")
+		assert.Error(t, err)
+	})
+
+	t.Run("A repeated ref ID returns the original order", func(t *testing.T) {
+		existing := &models.PartnerOrder{PartnerID: partner.ID, RefID: "INV-1", PackageCode: "AKRAB_L", Price: 25000, Status: service.PartnerOrderPending}
+		require.NoError(t, db.Create(existing).Error)
+
+		order, duplicate, err := service.PartnerPurchase(partner, "INV-1", "UNLI_7", "BALANCE")
+		require.NoError(t, err)
+		assert.True(t, duplicate)
+		assert.Equal(t, existing.ID, order.ID)
+		assert.Equal(t, "AKRAB_L", order.PackageCode)
+
+		_, _, err = service.PartnerPurchase(partner, "", "AKRAB_L", "BALANCE")
+		assert.Error(t, err)
+	})
+
+	t.Run("Callbacks are signed and retried with backoff", func(t *testing.T) {
+		fail := true
+		var received service.PartnerCallback
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, service.SignPayload(secret, body), r.Header.Get("X-Signature"))
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			require.NoError(t, json.Unmarshal(body, &received))
+		}))
+		defer server.Close()
+
+		_, err := service.UpdatePartner(partner.ID, func(p *models.Partner) { p.CallbackURL = server.URL })
+		require.NoError(t, err)
+
+		now := time.Now()
+		order := &models.PartnerOrder{
+			PartnerID: partner.ID, RefID: "INV-2", TrxID: "TRX-2", PackageCode: "AKRAB_L", Price: 25000,
+			Status: service.PartnerOrderSuccess, CallbackStatus: service.PartnerCallbackPending, NextCallbackAt: &now,
+		}
+		require.NoError(t, db.Create(order).Error)
+
+		assert.Error(t, service.DeliverPartnerCallback(order))
+		assert.Equal(t, service.PartnerCallbackPending, order.CallbackStatus)
+		assert.Equal(t, 1, order.CallbackAttempts)
+		require.NotNil(t, order.NextCallbackAt)
+		assert.True(t, order.NextCallbackAt.After(time.Now().Add(30*time.Second)))
+
+		fail = false
+		require.NoError(t, service.DeliverPartnerCallback(order))
+		assert.Equal(t, service.PartnerCallbackSent, order.CallbackStatus)
+		assert.Equal(t, "INV-2", received.RefID)
+		assert.Equal(t, service.PartnerOrderSuccess, received.Status)
+	})
+}
+
+func TestPartnerPurchaseSkipsCooldown(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestCatalog(t, dto.Package{PackageCode: "AKRAB_L", PackageName: "Akrab L", Price: 20000})
+
+	var orders atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := orders.Add(1)
+		json.NewEncoder(w).Encode(dto.PurchaseResponse{
+			Success: true,
+			Data:    dto.PurchaseData{TrxID: fmt.Sprintf("TRX-H2H-%d", n), PackageCode: "AKRAB_L", PackageName: "Akrab L"},
+		})
+	}))
+	defer upstream.Close()
+	t.Setenv("PURCHASE_API_URL", upstream.URL)
+
+	partner := &models.Partner{Name: "Mitra Cepat", UserID: 6101, Active: true}
+	_, _, err := service.CreatePartner(partner)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.User{ChatID: 6101, PhoneNumber: "0812", AccessToken: "token"}).Error)
+	require.NoError(t, db.Create(&models.UserBalance{UserID: 6101, Balance: 100000}).Error)
+
+	// A bot purchase just before must not block the partner's orders
+	service.SetUserActionTime(6101)
+
+	for _, ref := range []string{"INV-A", "INV-B"} {
+		order, duplicate, err := service.PartnerPurchase(partner, ref, "AKRAB_L", "BALANCE")
+		require.NoError(t, err, ref)
+		assert.False(t, duplicate)
+		assert.Equal(t, service.PartnerOrderPending, order.Status)
+	}
+	assert.Equal(t, int32(2), orders.Load())
+
+	quote, err := service.QuotePriceForUser(6101, "AKRAB_L", "BALANCE")
+	require.NoError(t, err)
+	assert.Equal(t, 100000-2*quote.SellPrice, service.GetUserBalance(6101).Balance)
+}
+
+func TestInterruptedPartnerOrdersFail(t *testing.T) {
+	db := useTestDatabase(t)
+
+	partner := &models.Partner{Name: "Mitra Putus", UserID: 6201, Active: true}
+	_, _, err := service.CreatePartner(partner)
+	require.NoError(t, err)
+
+	stuck := &models.PartnerOrder{PartnerID: partner.ID, RefID: "INV-STUCK", PackageCode: "AKRAB_L", Status: service.PartnerOrderProcessing}
+	inFlight := &models.PartnerOrder{PartnerID: partner.ID, RefID: "INV-LIVE", PackageCode: "AKRAB_L", Status: service.PartnerOrderProcessing}
+	require.NoError(t, db.Create(stuck).Error)
+	require.NoError(t, db.Create(inFlight).Error)
+	require.NoError(t, db.Model(stuck).UpdateColumn("updated_at", time.Now().Add(-10*time.Minute)).Error)
+
+	service.RunPartnerWork()
+
+	require.NoError(t, db.First(stuck, stuck.ID).Error)
+	assert.Equal(t, service.PartnerOrderFailed, stuck.Status)
+	require.NoError(t, db.First(inFlight, inFlight.ID).Error)
+	assert.Equal(t, service.PartnerOrderProcessing, inFlight.Status)
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPNG returns a distinct PNG image for each seed
+func testPNG(t *testing.T, seed uint8) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(0, 0, color.RGBA{R: seed, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// pendingTopUp adds a pending in-memory top up for the user
+func pendingTopUp(t *testing.T, id string, userID int64, expiresIn time.Duration) {
+	now := time.Now()
+	tx := &dto.Transaction{
+		ID:        id,
+		UserID:    userID,
+		Username:  "Budi",
+		Amount:    50000,
+		Status:    "pending",
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		ExpiredAt: now.Add(expiresIn).Format("2006-01-02 15:04:05"),
+	}
+	service.TxMutex.Lock()
+	service.Transactions[tx.ID] = tx
+	service.TxMutex.Unlock()
+	t.Cleanup(func() {
+		service.TxMutex.Lock()
+		delete(service.Transactions, tx.ID)
+		service.TxMutex.Unlock()
+	})
+}
+
+func TestPaymentProof(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "100")
+	t.Setenv("ADMIN_CHAT_IDS", "200")
+	t.Setenv("PAYMENT_PROOF_DIR", t.TempDir())
+	db := useTestDatabase(t)
+	sender := &fakeSender{}
+
+	_, err := service.SubmitPaymentProof(sender, 4001, "f0", testPNG(t, 0))
+	assert.Error(t, err, "no pending top up")
+
+	pendingTopUp(t, "TXN_PROOF_1", 4001, 30*time.Minute)
+
+	_, err = service.SubmitPaymentProof(sender, 4001, "f1", []byte("bukan gambar"))
+	assert.Error(t, err)
+
+	// The proof is stored and forwarded to every admin with approve/reject buttons
+	screenshot := testPNG(t, 1)
+	proof, err := service.SubmitPaymentProof(sender, 4001, "f1", screenshot)
+	require.NoError(t, err)
+	assert.Equal(t, "TXN_PROOF_1", proof.TransactionID)
+	stored, err := os.ReadFile(proof.Path)
+	require.NoError(t, err)
+	assert.Equal(t, screenshot, stored)
+	assert.True(t, service.HasPaymentProof("TXN_PROOF_1"))
+
+	require.Equal(t, []int64{100, 200}, sentTo(sender, 0))
+	photo := sender.sent[0].(tgbotapi.PhotoConfig)
+	assert.Contains(t, photo.Caption, "`TXN_PROOF_1`")
+	keyboard := photo.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	assert.Equal(t, "approve_tx:TXN_PROOF_1", *keyboard.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "reject_tx:TXN_PROOF_1", *keyboard.InlineKeyboard[0][1].CallbackData)
+
+	// The same image cannot be sent again, for this or any other top up
+	_, err = service.SubmitPaymentProof(sender, 4001, "f1", screenshot)
+	assert.ErrorContains(t, err, "sudah dikirim")
+
+	pendingTopUp(t, "TXN_PROOF_2", 4002, 30*time.Minute)
+	_, err = service.SubmitPaymentProof(sender, 4002, "f2", screenshot)
+	assert.ErrorContains(t, err, "sudah pernah dipakai")
+
+	// A second, different screenshot is kept alongside the first
+	_, err = service.SubmitPaymentProof(sender, 4001, "f3", testPNG(t, 3))
+	require.NoError(t, err)
+	proofs, err := service.GetPaymentProofs("TXN_PROOF_1")
+	require.NoError(t, err)
+	assert.Len(t, proofs, 2)
+
+	pendingTopUp(t, "TXN_PROOF_3", 4003, -time.Minute)
+	_, err = service.SubmitPaymentProof(sender, 4003, "f4", testPNG(t, 4))
+	assert.ErrorContains(t, err, "expired")
+
+	// Retention deletes the images but keeps the hashes
+	old := time.Now().AddDate(0, 0, -100)
+	require.NoError(t, db.Model(&models.PaymentProof{}).Where("id = ?", proof.ID).Update("created_at", old).Error)
+	purged, err := service.PurgePaymentProofs(time.Now().AddDate(0, 0, -90))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = os.Stat(proof.Path)
+	assert.True(t, os.IsNotExist(err))
+
+	var kept models.PaymentProof
+	require.NoError(t, db.First(&kept, proof.ID).Error)
+	assert.Empty(t, kept.Path)
+	assert.NotNil(t, kept.PurgedAt)
+	_, err = service.SubmitPaymentProof(sender, 4001, "f1", screenshot)
+	assert.Error(t, err, "a purged proof is still recognised")
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nabilulilalbab/bottele/api"
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestApplyMarkup(t *testing.T) {
+	t.Run("Fixed markup", func(t *testing.T) {
+		rule := models.PricingRule{MarkupType: service.MarkupFixed, MarkupValue: 1500}
+		assert.Equal(t, int64(11500), service.ApplyMarkup(10000, rule))
+	})
+
+	t.Run("Percent markup", func(t *testing.T) {
+		rule := models.PricingRule{MarkupType: service.MarkupPercent, MarkupValue: 10}
+		assert.Equal(t, int64(27500), service.ApplyMarkup(25000, rule))
+	})
+
+	t.Run("Rounds up to the nearest multiple", func(t *testing.T) {
+		rule := models.PricingRule{MarkupType: service.MarkupPercent, MarkupValue: 5, RoundTo: 500}
+		// 12345 + 617 = 12962 -> 13000
+		assert.Equal(t, int64(13000), service.ApplyMarkup(12345, rule))
+	})
+
+	t.Run("Already rounded price is unchanged", func(t *testing.T) {
+		rule := models.PricingRule{MarkupType: service.MarkupFixed, MarkupValue: 500, RoundTo: 1000}
+		assert.Equal(t, int64(11000), service.ApplyMarkup(10500, rule))
+	})
+}
+
+func TestSelectPricingRule(t *testing.T) {
+	pkg := &dto.Package{
+		PackageCode: testPackageCode,
+		PackageName: "[Metode Pulsa] Pengelola Akrab L Kuber 75GB",
+	}
+
+	rules := []models.PricingRule{
+		{ID: 1, MarkupType: service.MarkupFixed, MarkupValue: 1000, IsActive: true},
+		{ID: 2, Category: "akrab", MarkupType: service.MarkupFixed, MarkupValue: 2000, IsActive: true},
+		{ID: 3, NamePattern: "kuber", MarkupType: service.MarkupFixed, MarkupValue: 3000, IsActive: true},
+		{ID: 4, PaymentMethod: "QRIS", MarkupType: service.MarkupFixed, MarkupValue: 4000, IsActive: true},
+		{ID: 5, PackageCode: testPackageCode, MarkupType: service.MarkupFixed, MarkupValue: 5000, IsActive: false},
+	}
+
+	t.Run("Name pattern beats category and payment method", func(t *testing.T) {
+		rule := service.SelectPricingRule(rules, pkg, "akrab", "QRIS")
+		assert.NotNil(t, rule)
+		assert.Equal(t, uint(3), rule.ID)
+	})
+
+	t.Run("Inactive rules are ignored", func(t *testing.T) {
+		rule := service.SelectPricingRule(rules, pkg, "akrab", "DANA")
+		assert.NotNil(t, rule)
+		assert.NotEqual(t, uint(5), rule.ID)
+	})
+
+	t.Run("Priority breaks ties", func(t *testing.T) {
+		tied := []models.PricingRule{
+			{ID: 10, Category: "akrab", Priority: 1, IsActive: true},
+			{ID: 11, Category: "akrab", Priority: 5, IsActive: true},
+		}
+		rule := service.SelectPricingRule(tied, pkg, "akrab", "")
+		assert.NotNil(t, rule)
+		assert.Equal(t, uint(11), rule.ID)
+	})
+
+	t.Run("No match returns nil", func(t *testing.T) {
+		scoped := []models.PricingRule{
+			{ID: 20, PaymentMethod: "QRIS", IsActive: true},
+		}
+		assert.Nil(t, service.SelectPricingRule(scoped, pkg, "akrab", "DANA"))
+	})
+
+	t.Run("Category is inferred from the package name", func(t *testing.T) {
+		assert.Equal(t, "Akrab", service.PackageCategory(*pkg))
+	})
+}
+
+func TestUpdatePricingRuleAPI(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api.SetupRoutes(router)
+
+	rule := models.PricingRule{Name: "Akrab", MarkupType: service.MarkupFixed, MarkupValue: 1000, IsActive: true}
+	require.NoError(t, db.Create(&rule).Error)
+
+	put := func(path string) int {
+		body := `{"name":"Akrab QRIS","markup_type":"percent","markup_value":5}`
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// An unknown ID is not created
+	assert.Equal(t, http.StatusNotFound, put("/api/admin/pricing/rules/999"))
+	var count int64
+	db.Model(&models.PricingRule{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	assert.Equal(t, http.StatusOK, put("/api/admin/pricing/rules/"+strconv.FormatUint(uint64(rule.ID), 10)))
+	var stored models.PricingRule
+	require.NoError(t, db.First(&stored, rule.ID).Error)
+	assert.Equal(t, "Akrab QRIS", stored.Name)
+	assert.Equal(t, service.MarkupPercent, stored.MarkupType)
+	assert.True(t, stored.IsActive)
+
+	del := func(path string) int {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, del("/api/admin/pricing/rules/999"))
+
+	// A failing database is a server error, not a missing rule
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:fail_query", func(tx *gorm.DB) {
+		tx.AddError(errors.New("database is locked"))
+	}))
+	t.Cleanup(func() { db.Callback().Query().Remove("test:fail_query") })
+	assert.Equal(t, http.StatusInternalServerError, put("/api/admin/pricing/rules/"+strconv.FormatUint(uint64(rule.ID), 10)))
+}
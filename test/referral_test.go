@@ -0,0 +1,171 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferralCommission(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("REFERRAL_COMMISSION_TYPE", "percent")
+	t.Setenv("REFERRAL_COMMISSION_VALUE", "10")
+	t.Setenv("REFERRAL_MAX_REWARDED_EVENTS", "2")
+	t.Setenv("REFERRAL_MAX_PER_HOUR", "2")
+
+	const referrerID = int64(1001)
+	const friendID = int64(2002)
+
+	require.NoError(t, service.AddActiveUserToDB(referrerID))
+	require.NoError(t, service.RecordReferral(friendID, referrerID))
+
+	t.Run("Only the first N events earn commission", func(t *testing.T) {
+		amount, err := service.CreditReferralCommission(friendID, service.ReferralSourcePurchase, "trx-1", 50000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5000), amount)
+
+		amount, err = service.CreditReferralCommission(friendID, service.ReferralSourceTopUp, "topup-1", 20000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2000), amount)
+
+		amount, err = service.CreditReferralCommission(friendID, service.ReferralSourcePurchase, "trx-2", 50000)
+		require.NoError(t, err)
+		assert.Zero(t, amount)
+
+		assert.Equal(t, int64(7000), service.GetUserBalance(referrerID).Balance)
+	})
+
+	t.Run("The same event is not credited twice", func(t *testing.T) {
+		const otherFriendID = int64(2003)
+		require.NoError(t, service.RecordReferral(otherFriendID, referrerID))
+
+		amount, err := service.CreditReferralCommission(otherFriendID, service.ReferralSourcePurchase, "trx-1", 50000)
+		require.NoError(t, err)
+		assert.Zero(t, amount)
+	})
+
+	t.Run("Rapid referrals are blocked", func(t *testing.T) {
+		require.NoError(t, service.RecordReferral(int64(2004), referrerID))
+
+		var referral models.Referral
+		require.NoError(t, db.First(&referral, "referee_id = ?", int64(2004)).Error)
+		assert.Equal(t, service.ReferralBlocked, referral.Status)
+		assert.Equal(t, service.ReferralBlockRapidChurn, referral.BlockReason)
+
+		amount, err := service.CreditReferralCommission(int64(2004), service.ReferralSourcePurchase, "trx-3", 50000)
+		require.NoError(t, err)
+		assert.Zero(t, amount)
+	})
+
+	t.Run("Same phone number blocks the referral", func(t *testing.T) {
+		const otherReferrerID = int64(3001)
+		const sockPuppetID = int64(3002)
+		require.NoError(t, service.AddActiveUserToDB(otherReferrerID))
+		require.NoError(t, service.RecordReferral(sockPuppetID, otherReferrerID))
+		require.NoError(t, db.Create(&models.User{ChatID: otherReferrerID, PhoneNumber: "6287700000000"}).Error)
+		require.NoError(t, db.Create(&models.User{ChatID: sockPuppetID, PhoneNumber: "6287700000000"}).Error)
+
+		amount, err := service.CreditReferralCommission(sockPuppetID, service.ReferralSourcePurchase, "trx-4", 50000)
+		require.NoError(t, err)
+		assert.Zero(t, amount)
+
+		var referral models.Referral
+		require.NoError(t, db.First(&referral, "referee_id = ?", sockPuppetID).Error)
+		assert.Equal(t, service.ReferralBlockSamePhone, referral.BlockReason)
+	})
+
+	t.Run("Report totals", func(t *testing.T) {
+		summary, err := service.GetReferralSummary(referrerID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), summary.Referred)
+		assert.Equal(t, int64(1), summary.Blocked)
+		assert.Equal(t, int64(7000), summary.TotalCommission)
+
+		reports, err := service.GetReferralReport()
+		require.NoError(t, err)
+		require.Len(t, reports, 2)
+		assert.Equal(t, referrerID, reports[0].ReferrerID)
+	})
+}
+
+func TestReferralCommissionOnPurchaseSuccess(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("REFERRAL_COMMISSION_TYPE", "percent")
+	t.Setenv("REFERRAL_COMMISSION_VALUE", "10")
+	t.Setenv("REFERRAL_MAX_REWARDED_EVENTS", "3")
+
+	const referrerID = int64(3001)
+	const friendID = int64(3002)
+	require.NoError(t, service.AddActiveUserToDB(referrerID))
+	require.NoError(t, service.RecordReferral(friendID, referrerID))
+
+	for _, id := range []string{"TRX-REF-FAIL", "TRX-REF-OK"} {
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: id, UserID: friendID, PackageCode: "X", PackageName: "X", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 50000, Status: "pending",
+		}).Error)
+	}
+
+	// Nothing is paid while the purchase is pending or when it fails
+	assert.Zero(t, service.GetUserBalance(referrerID).Balance)
+
+	// Upstream has not answered yet: the purchase stays pending
+	service.UpdatePurchaseStatus("TRX-REF-FAIL", &dto.TransactionCheckResponse{Success: true, Data: dto.TransactionCheckData{Status: 0, RC: ""}})
+	purchase, err := service.GetPurchaseTransaction("TRX-REF-FAIL")
+	require.NoError(t, err)
+	assert.Equal(t, "pending", purchase.Status)
+
+	service.UpdatePurchaseStatus("TRX-REF-FAIL", &dto.TransactionCheckResponse{Success: true, Data: dto.TransactionCheckData{Status: 0, RC: "14"}})
+	assert.Zero(t, service.GetUserBalance(referrerID).Balance)
+
+	// A successful purchase is paid once, however often it is checked
+	success := &dto.TransactionCheckResponse{Success: true, Data: dto.TransactionCheckData{Status: 1, RC: "00"}}
+	service.UpdatePurchaseStatus("TRX-REF-OK", success)
+	service.UpdatePurchaseStatus("TRX-REF-OK", success)
+	assert.Equal(t, int64(5000), service.GetUserBalance(referrerID).Balance)
+
+	purchase, err = service.GetPurchaseTransaction("TRX-REF-FAIL")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", purchase.Status)
+
+	var commissions int64
+	db.Model(&models.ReferralCommission{}).Where("referrer_id = ?", referrerID).Count(&commissions)
+	assert.Equal(t, int64(1), commissions)
+}
+
+func TestReferralCommissionOnTopUp(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("REFERRAL_COMMISSION_TYPE", "percent")
+	t.Setenv("REFERRAL_COMMISSION_VALUE", "10")
+
+	const referrerID = int64(3101)
+	const friendID = int64(3102)
+	require.NoError(t, service.AddActiveUserToDB(referrerID))
+	require.NoError(t, service.RecordReferral(friendID, referrerID))
+
+	now := time.Now()
+	tx := &dto.Transaction{
+		ID:        "TXN_REF_TOPUP",
+		UserID:    friendID,
+		Amount:    20000,
+		Status:    "pending",
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		ExpiredAt: now.Add(30 * time.Minute).Format("2006-01-02 15:04:05"),
+	}
+	service.TxMutex.Lock()
+	service.Transactions[tx.ID] = tx
+	service.TxMutex.Unlock()
+	t.Cleanup(func() {
+		service.TxMutex.Lock()
+		delete(service.Transactions, tx.ID)
+		service.TxMutex.Unlock()
+	})
+
+	// The commission is paid before the confirmation returns
+	require.NoError(t, service.ConfirmTopUp(tx.ID, 1))
+	assert.Equal(t, int64(2000), service.GetUserBalance(referrerID).Balance)
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	db := useTestDatabase(t)
+	day := func(d, hour int) time.Time { return time.Date(2025, 3, d, hour, 0, 0, 0, time.Local) }
+	approvedAt := func(t time.Time) *time.Time { return &t }
+
+	for _, tx := range []models.Transaction{
+		{ID: "TXN_R1", UserID: 1, Username: "a", Amount: 50000, BonusAmount: 5000, Status: "confirmed", CreatedAt: day(3, 9), ApprovedAt: approvedAt(day(3, 10)), ExpiredAt: day(3, 10)},
+		{ID: "TXN_R2", UserID: 2, Username: "b", Amount: 100000, Status: "confirmed", CreatedAt: day(9, 23), ApprovedAt: approvedAt(day(10, 8)), ExpiredAt: day(10, 0)},
+		// Approved before the range
+		{ID: "TXN_R3", UserID: 9, Username: "c", Amount: 70000, Status: "confirmed", CreatedAt: day(1, 9).AddDate(0, 0, -10), ApprovedAt: approvedAt(day(1, 9).AddDate(0, 0, -9)), ExpiredAt: day(1, 9)},
+		{ID: "TXN_R4", UserID: 5, Username: "d", Amount: 20000, Status: "rejected", CreatedAt: day(5, 9), ExpiredAt: day(5, 10)},
+		// Still "pending" in the database but past its expiry
+		{ID: "TXN_R5", UserID: 5, Username: "d", Amount: 20000, Status: "pending", CreatedAt: day(6, 9), ExpiredAt: day(6, 10)},
+		{ID: "TXN_R6", UserID: 6, Username: "e", Amount: 20000, Status: "pending", CreatedAt: day(12, 9), ExpiredAt: time.Now().Add(time.Hour)},
+	} {
+		require.NoError(t, db.Create(&tx).Error)
+	}
+	for _, p := range []models.PurchaseTransaction{
+		{ID: "TRX-R1", UserID: 1, PackageCode: "PKG_A", PackageName: "Paket A", PaymentMethod: "QRIS", PhoneNumber: "0812", Price: 20000, CostPrice: 15000, Status: "success", CreatedAt: day(3, 11)},
+		{ID: "TRX-R2", UserID: 3, PackageCode: "PKG_A", PackageName: "Paket A", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 20000, CostPrice: 15000, Discount: 2000, Status: "success", CreatedAt: day(11, 11)},
+		{ID: "TRX-R3", UserID: 3, PackageCode: "PKG_B", PackageName: "Paket B", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 10000, CostPrice: 9000, Status: "success", CreatedAt: day(11, 12)},
+		{ID: "TRX-R4", UserID: 7, PackageCode: "PKG_B", PackageName: "Paket B", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 10000, CostPrice: 9000, Status: "failed", CreatedAt: day(4, 12)},
+		// Paid, still waiting for the upstream result: counted as sold
+		{ID: "TRX-R5", UserID: 8, PackageCode: "PKG_B", PackageName: "Paket B", PaymentMethod: "BALANCE", PhoneNumber: "0812", Price: 10000, CostPrice: 9000, Status: "pending", CreatedAt: day(12, 12)},
+	} {
+		require.NoError(t, db.Create(&p).Error)
+	}
+	require.NoError(t, db.Create(&models.VPNTransaction{
+		ID: "VPN-R1", UserID: 4, Protocol: "ssh", Days: 30, Price: 30000, CostPrice: 10000, Status: "success", CreatedAt: day(10, 15),
+	}).Error)
+
+	r, err := service.NewReportRange("2025-03-01", "2025-03-14", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, day(15, 0), r.To)
+
+	report, err := service.BuildReport(r, service.ReportWeek, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, service.TopupReport{Count: 2, Amount: 150000, Bonus: 5000, Pending: 1, Rejected: 1, Expired: 1}, report.Topups)
+	assert.Equal(t, service.SalesReport{Count: 4, Pending: 1, Failed: 1, Revenue: 60000, Cost: 48000, Margin: 12000, Discount: 2000}, report.Packages)
+	assert.Equal(t, service.SalesReport{Count: 1, Revenue: 30000, Cost: 10000, Margin: 20000}, report.VPN)
+	assert.Equal(t, int64(90000), report.Revenue)
+	assert.Equal(t, int64(32000), report.Margin)
+
+	require.Len(t, report.TopProducts, 3)
+	assert.Equal(t, service.ProductSales{Code: "PKG_A", Name: "Paket A", Count: 2, Revenue: 40000, Cost: 30000, Margin: 10000}, report.TopProducts[0])
+	assert.Equal(t, service.ProductSales{Code: "PKG_B", Name: "Paket B", Count: 2, Revenue: 20000, Cost: 18000, Margin: 2000}, report.TopProducts[1])
+	assert.Equal(t, "vpn:ssh", report.TopProducts[2].Code)
+
+	// VPN is paid from the balance
+	require.Len(t, report.PaymentMethods, 2)
+	assert.Equal(t, "BALANCE", report.PaymentMethods[0].Method)
+	assert.Equal(t, int64(4), report.PaymentMethods[0].Count)
+	assert.Equal(t, int64(70000), report.PaymentMethods[0].Amount)
+	assert.InDelta(t, 77.78, report.PaymentMethods[0].Percent, 0.01)
+	assert.Equal(t, "QRIS", report.PaymentMethods[1].Method)
+
+	// Users 1-4 and 8 topped up or bought something; the range starts mid-week
+	assert.Equal(t, int64(5), report.ActiveUsers)
+	var weeks []string
+	var users []int64
+	for _, p := range report.ActivePeriods {
+		weeks = append(weeks, p.Period)
+		users = append(users, p.Users)
+	}
+	assert.Equal(t, []string{"2025-W09", "2025-W10", "2025-W11"}, weeks)
+	assert.Equal(t, []int64{0, 1, 4}, users)
+
+	total, days, err := service.GetActiveUsers(r, service.ReportDay)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	require.Len(t, days, 14)
+	assert.Equal(t, "2025-03-03", days[2].Period)
+	assert.Equal(t, int64(1), days[2].Users)
+
+	text := service.FormatReport(report)
+	assert.Contains(t, text, "01/03/2025 - 14/03/2025")
+	assert.Contains(t, text, "Margin:* Rp 32.000")
+	assert.Contains(t, text, "4 terjual, 1 gagal (1 masih diproses)")
+}
+
+func TestParseReportArgs(t *testing.T) {
+	now := time.Date(2025, 3, 13, 15, 0, 0, 0, time.Local) // a Thursday
+	date := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 0, 0, 0, 0, time.Local) }
+
+	cases := []struct {
+		args     string
+		from, to time.Time
+	}{
+		{"", date(2, 12), date(3, 14)},
+		{"hari", date(3, 13), date(3, 14)},
+		{"minggu", date(3, 10), date(3, 14)},
+		{"bulan", date(3, 1), date(3, 14)},
+		{"7d", date(3, 7), date(3, 14)},
+		{"2025-01-01 2025-01-31", date(1, 1), date(2, 1)},
+		{"2024-03-13 2025-03-13", time.Date(2024, 3, 13, 0, 0, 0, 0, time.Local), date(3, 14)},
+	}
+	for _, c := range cases {
+		r, err := service.ParseReportArgs(c.args, now)
+		require.NoError(t, err, c.args)
+		assert.Equal(t, c.from, r.From, c.args)
+		assert.Equal(t, c.to, r.To, c.args)
+	}
+
+	for _, args := range []string{"kemarin", "0d", "367d", "2025-02-01 2025-01-01", "2025-13-01 2025-13-02", "0001-01-01 9999-12-31"} {
+		_, err := service.ParseReportArgs(args, now)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestReportAPIRejectsLongRanges(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	// Every period of the range is a query, so the range is capped
+	assert.Equal(t, http.StatusBadRequest, adminRouteStatus(t, http.MethodGet, "/api/admin/reports?from=0001-01-01&to=9999-12-31&period=day", "secret"))
+	assert.Equal(t, http.StatusBadRequest, adminRouteStatus(t, http.MethodGet, "/api/admin/reports/active-users?from=2020-01-01&to=2025-01-01", "secret"))
+	assert.Equal(t, http.StatusOK, adminRouteStatus(t, http.MethodGet, "/api/admin/reports?from=2024-01-01&to=2024-12-31", "secret"))
+}
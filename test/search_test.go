@@ -0,0 +1,169 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSearchEntry(code, name, category string, price int64, methods ...string) service.CatalogEntry {
+	pkg := dto.Package{
+		PackageCode: code,
+		PackageName: name,
+		Price:       price,
+	}
+	for _, method := range methods {
+		pkg.AvailablePaymentMethods = append(pkg.AvailablePaymentMethods, dto.PaymentMethod{PaymentMethod: method})
+	}
+
+	return service.CatalogEntry{
+		Package:     pkg,
+		DisplayName: name,
+		Category:    category,
+	}
+}
+
+func newTestSearchIndex() *service.SearchIndex {
+	return service.NewSearchIndex([]service.CatalogEntry{
+		newSearchEntry("AKRAB_L", "Pengelola Akrab L Kuber 75GB", "Akrab", 75000, "BALANCE", "QRIS"),
+		newSearchEntry("AKRAB_M", "Pengelola Akrab M Kuber 50GB", "Akrab", 55000, "BALANCE"),
+		newSearchEntry("UNLI_7", "Xtra Unlimited Turbo 7 Hari", "Unlimited", 25000, "DANA"),
+		newSearchEntry("MASA_AKTIF", "Masa Aktif 30 Hari", "Masa Aktif", 5000, "BALANCE"),
+	})
+}
+
+func searchCodes(results []service.CatalogEntry) []string {
+	var codes []string
+	for _, entry := range results {
+		codes = append(codes, entry.Package.PackageCode)
+	}
+	return codes
+}
+
+func TestNormalizeSearchText(t *testing.T) {
+	assert.Equal(t, []string{"kuota", "75", "gb", "unlimited"}, service.NormalizeSearchText("Kuota 75GB Unli"))
+	assert.Equal(t, []string{"10", "gb", "30", "hari"}, service.NormalizeSearchText("10 giga / 30hr"))
+}
+
+func TestSearchIndex(t *testing.T) {
+	idx := newTestSearchIndex()
+
+	t.Run("Synonyms and digit splitting", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "75 giga"})
+		assert.Equal(t, []string{"AKRAB_L"}, searchCodes(results))
+	})
+
+	t.Run("Unli finds unlimited packages", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "paket unli"})
+		assert.Equal(t, []string{"UNLI_7"}, searchCodes(results))
+	})
+
+	t.Run("Typo tolerance", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "akarb"})
+		assert.ElementsMatch(t, []string{"AKRAB_L", "AKRAB_M"}, searchCodes(results))
+	})
+
+	t.Run("Numbers must match exactly", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "akrab 5"})
+		assert.Empty(t, results)
+	})
+
+	t.Run("Price filter", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "akrab", MaxPrice: 60000})
+		assert.Equal(t, []string{"AKRAB_M"}, searchCodes(results))
+	})
+
+	t.Run("Payment method filter", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{PaymentMethod: "qris"})
+		assert.Equal(t, []string{"AKRAB_L"}, searchCodes(results))
+	})
+
+	t.Run("Equal scores are ordered by price", func(t *testing.T) {
+		results := idx.Search(dto.SearchRequest{Query: "hari"})
+		assert.Equal(t, []string{"MASA_AKTIF", "UNLI_7"}, searchCodes(results))
+	})
+}
+
+func TestSearchFiltersOnViewerTierPrice(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("DEFAULT_MARKUP_TYPE", "fixed")
+	t.Setenv("DEFAULT_MARKUP_VALUE", "10000")
+
+	const resellerID = int64(6001)
+	require.NoError(t, service.SetUserTier(resellerID, service.TierReseller, 0))
+	require.NoError(t, service.SaveTierPrice(&models.TierPrice{Tier: service.TierReseller, DiscountType: service.MarkupFixed, DiscountValue: 10000, IsActive: true}))
+
+	idx := newTestSearchIndex()
+
+	// AKRAB_M sells for 65.000 at retail and 55.000 to resellers
+	assert.Empty(t, idx.Search(dto.SearchRequest{Query: "akrab", MaxPrice: 60000}))
+	assert.Equal(t, []string{"AKRAB_M"}, searchCodes(idx.Search(dto.SearchRequest{Query: "akrab", MaxPrice: 60000, UserID: resellerID})))
+	assert.Equal(t, []string{"AKRAB_M"}, searchCodes(idx.Search(dto.SearchRequest{Query: "akrab", MaxPrice: 60000, PaymentMethod: "BALANCE", UserID: resellerID})))
+}
+
+func TestSearchCacheFollowsPricing(t *testing.T) {
+	useTestDatabase(t)
+	useTestCatalog(t,
+		dto.Package{PackageCode: "AKRAB_M", PackageName: "Pengelola Akrab M Kuber 50GB", Price: 55000},
+		dto.Package{PackageCode: "AKRAB_S", PackageName: "Pengelola Akrab S Kuber 25GB", Price: 30000},
+	)
+
+	results, err := service.SearchCatalogCached("akrab max:60rb", 0, time.Minute)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"AKRAB_M", "AKRAB_S"}, searchCodes(results))
+
+	// A new rule pushes AKRAB_M over the limit; the cached result must not survive it
+	require.NoError(t, service.SavePricingRule(&models.PricingRule{PackageCode: "AKRAB_M", MarkupType: service.MarkupFixed, MarkupValue: 10000, IsActive: true}))
+	results, err = service.SearchCatalogCached("akrab max:60rb", 0, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AKRAB_S"}, searchCodes(results))
+
+	// Same for a tier price seen by a reseller
+	const resellerID = int64(6002)
+	require.NoError(t, service.SetUserTier(resellerID, service.TierReseller, 0))
+	results, err = service.SearchCatalogCached("akrab max:60rb", resellerID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"AKRAB_S"}, searchCodes(results))
+
+	require.NoError(t, service.SaveTierPrice(&models.TierPrice{Tier: service.TierReseller, DiscountType: service.MarkupFixed, DiscountValue: 10000, IsActive: true}))
+	results, err = service.SearchCatalogCached("akrab max:60rb", resellerID, time.Minute)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"AKRAB_M", "AKRAB_S"}, searchCodes(results))
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	req := service.ParseSearchQuery("akrab max:60rb min:10.000 bayar:qris")
+	assert.Equal(t, "akrab", req.Query)
+	assert.Equal(t, int64(60000), req.MaxPrice)
+	assert.Equal(t, int64(10000), req.MinPrice)
+	assert.Equal(t, "QRIS", req.PaymentMethod)
+}
+
+func TestProductStartPayload(t *testing.T) {
+	longCode := "PAKET_" + strings.Repeat("SANGAT_PANJANG_", 5) + "30HARI"
+	oddCode := "XL/10GB 30H"
+	longOddCode := strings.Repeat("Kuota Besar/", 5)
+	useTestCatalog(t,
+		dto.Package{PackageCode: longCode, PackageName: "Panjang"},
+		dto.Package{PackageCode: longOddCode, PackageName: "Panjang Aneh"},
+	)
+
+	for _, code := range []string{"AKRAB_L", oddCode, longCode, longOddCode} {
+		payload := service.EncodeProductStartPayload(code)
+		assert.LessOrEqual(t, len(payload), 64, code)
+		assert.Regexp(t, `^[A-Za-z0-9_-]+$`, payload, code)
+
+		decoded, ok := service.DecodeProductStartPayload(payload)
+		assert.True(t, ok, code)
+		assert.Equal(t, code, decoded)
+	}
+
+	_, ok := service.DecodeProductStartPayload("ref_123")
+	assert.False(t, ok)
+}
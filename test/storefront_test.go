@@ -0,0 +1,80 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorefrontOverrides(t *testing.T) {
+	db := useTestDatabase(t)
+	useTestCatalog(t,
+		dto.Package{PackageCode: "AKRAB_L", PackageName: "Pengelola Akrab L", Price: 75000},
+		dto.Package{PackageCode: "AKRAB_M", PackageName: "Pengelola Akrab M", Price: 55000},
+		dto.Package{PackageCode: "BROKEN", PackageName: "Akrab Rusak", Price: 10000},
+		dto.Package{PackageCode: "UNLI_7", PackageName: "Xtra Unlimited 7 Hari", Price: 25000},
+	)
+
+	// A long multibyte category name chosen by an admin
+	longCategory := "🔥 Paket Spesial Ramadhan – Kuota Besar Harga Hemat Untuk Semua 🔥"
+	for _, override := range []models.CatalogOverride{
+		{PackageCode: "AKRAB_M", DisplayName: "Akrab M Best Seller", Featured: true},
+		{PackageCode: "BROKEN", Hidden: true},
+		{PackageCode: "UNLI_7", Category: longCategory, SortWeight: 5},
+		// Same category as the inferred "Akrab", typed in another case
+		{PackageCode: "AKRAB_L", Category: "akrab"},
+	} {
+		require.NoError(t, db.Create(&override).Error)
+	}
+	require.NoError(t, service.ReloadCatalogOverrides())
+
+	entries, err := service.GetStorefront()
+	require.NoError(t, err)
+	var codes []string
+	for _, entry := range entries {
+		codes = append(codes, entry.Package.PackageCode)
+	}
+	// Hidden packages are left out, featured first, then by sort weight
+	assert.Equal(t, []string{"AKRAB_M", "UNLI_7", "AKRAB_L"}, codes)
+	assert.Equal(t, "Akrab M Best Seller", entries[0].DisplayName)
+
+	_, err = service.GetStorefrontEntry("BROKEN")
+	assert.Error(t, err)
+	assert.True(t, service.IsPackageHidden("BROKEN"))
+
+	categories, err := service.GetStorefrontCategories()
+	require.NoError(t, err)
+	require.Len(t, categories, 2)
+	assert.Equal(t, "Akrab", categories[0].Name)
+	assert.Equal(t, 2, categories[0].Count)
+	assert.Equal(t, longCategory, categories[1].Name)
+
+	// The callback data of the category buttons and their pages fits Telegram's limit
+	for _, category := range categories {
+		assert.LessOrEqual(t, len("cat:"+category.Key+":999"), 64)
+		name, found, err := service.FindStorefrontCategory(category.Key)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, category.Name, name)
+	}
+	_, found, err := service.FindStorefrontCategory("unknown")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	inCategory, err := service.GetStorefrontByCategory(longCategory)
+	require.NoError(t, err)
+	require.Len(t, inCategory, 1)
+	assert.Equal(t, "UNLI_7", inCategory[0].Package.PackageCode)
+
+	inCategory, err = service.GetStorefrontByCategory("Akrab")
+	require.NoError(t, err)
+	assert.Len(t, inCategory, 2)
+
+	// XL packages without a more specific keyword are grouped by brand
+	assert.Equal(t, "XL", service.PackageCategory(dto.Package{PackageCode: "XL_10", PackageName: "XL Reguler 10GB 30 Hari"}))
+	assert.Equal(t, "Axis", service.PackageCategory(dto.Package{PackageCode: "AXIS_5", PackageName: "Axis Bronet 5GB"}))
+}
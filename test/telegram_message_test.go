@@ -0,0 +1,134 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender records sent messages and fails the first sends with the queued errors
+type fakeSender struct {
+	errs []error
+	sent []tgbotapi.Chattable
+}
+
+func (f *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.sent = append(f.sent, c)
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return tgbotapi.Message{}, err
+	}
+	return tgbotapi.Message{MessageID: len(f.sent)}, nil
+}
+
+func TestMessageBuilder(t *testing.T) {
+	t.Run("MarkdownV2 escapes user text", func(t *testing.T) {
+		b := service.NewMessageBuilder(service.ParseModeMarkdownV2).
+			Field("👤", "User", "john_doe (*VIP*)").
+			Text("Harga 10.000!").Raw("\n").
+			Code("a`b\\c").Raw(" ").
+			Link("Bayar [sini]", "https://x.test/a_(b)")
+
+		assert.Equal(t, "👤 *User:* john\\_doe \\(\\*VIP\\*\\)\n"+
+			"Harga 10\\.000\\!\n"+
+			"`a\\`b\\\\c` "+
+			"[Bayar \\[sini\\]](https://x.test/a_(b\\))", b.String())
+		assert.Equal(t, service.ParseModeMarkdownV2, b.Message(1).ParseMode)
+	})
+
+	t.Run("HTML escapes user text", func(t *testing.T) {
+		b := service.NewMessageBuilder(service.ParseModeHTML).
+			Bold("<script>").Text(" & ").Code("x<y").Raw(" ").
+			Link("Tom & Jerry", `https://x.test/?a=1&b="2"`)
+
+		assert.Equal(t, `<b>&lt;script&gt;</b> &amp; <code>x&lt;y</code> `+
+			`<a href="https://x.test/?a=1&amp;b=&#34;2&#34;">Tom &amp; Jerry</a>`, b.String())
+		assert.Equal(t, service.ParseModeHTML, b.Message(1).ParseMode)
+	})
+
+	t.Run("Unknown parse mode falls back to MarkdownV2", func(t *testing.T) {
+		assert.Equal(t, service.ParseModeMarkdownV2, service.NewMessageBuilder("Markdown").ParseMode())
+	})
+
+	t.Run("Table pads columns", func(t *testing.T) {
+		b := service.NewMessageBuilder(service.ParseModeMarkdownV2).
+			Table([]string{"Paket", "Harga"}, [][]string{{"XL 10GB", "50.000"}, {"Tri", "5.000"}})
+
+		assert.Equal(t, "```\nPaket    Harga\n-------  ------\nXL 10GB  50.000\nTri      5.000\n```\n", b.String())
+	})
+
+	t.Run("Built messages convert back to plain text", func(t *testing.T) {
+		for _, mode := range []string{service.ParseModeMarkdownV2, service.ParseModeHTML} {
+			b := service.NewMessageBuilder(mode).
+				Field("📦", "Produk", "XL_Combo *10GB* <promo>").
+				Code("TOPUP_1_2")
+			assert.Equal(t, "📦 Produk: XL_Combo *10GB* <promo>\nTOPUP_1_2", service.MarkdownToPlain(b.String(), mode), mode)
+		}
+	})
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	assert.Equal(t, "john\\_doe \\*vip\\* \\`x\\` \\[a]", service.EscapeMarkdown("john_doe *vip* `x` [a]"))
+	assert.Equal(t, "TOPUP_1", service.MarkdownToPlain(service.EscapeMarkdown("TOPUP_1"), service.ParseModeMarkdown))
+	assert.Equal(t, "a\\.b\\-c\\\\", service.EscapeMarkdownV2("a.b-c\\"))
+}
+
+func TestSendWithFallback(t *testing.T) {
+	parseErr := &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 10"}
+
+	t.Run("Parse error resends as plain text", func(t *testing.T) {
+		sender := &fakeSender{errs: []error{parseErr}}
+		msg := tgbotapi.NewMessage(42, "*Produk:* XL_Combo")
+		msg.ParseMode = service.ParseModeMarkdown
+
+		sent, err := service.SendWithFallback(sender, msg)
+		require.NoError(t, err)
+		assert.Equal(t, 2, sent.MessageID)
+		require.Len(t, sender.sent, 2)
+
+		retry := sender.sent[1].(tgbotapi.MessageConfig)
+		assert.Equal(t, "", retry.ParseMode)
+		assert.Equal(t, "Produk: XL_Combo", retry.Text)
+		assert.Equal(t, int64(42), retry.ChatID)
+	})
+
+	t.Run("Edited captions are resent as plain text", func(t *testing.T) {
+		sender := &fakeSender{errs: []error{parseErr}}
+		edit := tgbotapi.NewEditMessageCaption(42, 7, "<b>Bukti</b> dari <i>budi")
+		edit.ParseMode = service.ParseModeHTML
+
+		_, err := service.SendWithFallback(sender, edit)
+		require.NoError(t, err)
+		require.Len(t, sender.sent, 2)
+		assert.Equal(t, "Bukti dari budi", sender.sent[1].(tgbotapi.EditMessageCaptionConfig).Caption)
+	})
+
+	t.Run("Other errors are returned", func(t *testing.T) {
+		for _, sendErr := range []error{
+			&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"},
+			&tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"},
+			errors.New("connection reset"),
+		} {
+			sender := &fakeSender{errs: []error{sendErr}}
+			msg := tgbotapi.NewMessage(42, "*halo*")
+			msg.ParseMode = service.ParseModeMarkdown
+
+			_, err := service.SendWithFallback(sender, msg)
+			assert.Equal(t, sendErr, err)
+			assert.Len(t, sender.sent, 1)
+		}
+	})
+
+	t.Run("Plain messages are not resent", func(t *testing.T) {
+		sender := &fakeSender{errs: []error{parseErr}}
+
+		_, err := service.SendWithFallback(sender, tgbotapi.NewMessage(42, "halo"))
+		assert.Equal(t, parseErr, err)
+		assert.Len(t, sender.sent, 1)
+	})
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+	}{
+		{"id", "id"},
+		{"en", "en"},
+		{"en-US", "en"},
+		{"EN_gb", "en"},
+		{"pt-br", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, service.DetectLanguage(tt.code), tt.code)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("DEFAULT_LANGUAGE", "id")
+
+	t.Run("Renders in the requested language", func(t *testing.T) {
+		assert.Contains(t, service.RenderTemplate("id", "help", nil), "*Bantuan - GRN Store*")
+		assert.Contains(t, service.RenderTemplate("en", "help", nil), "*Help - GRN Store*")
+		assert.Equal(t, "❌ Cancel", service.RenderTemplate("en", "button_cancel", nil))
+	})
+
+	t.Run("Template data and functions", func(t *testing.T) {
+		text := service.RenderTemplate("en", "topup_request", map[string]interface{}{
+			"VoucherCode": "HEMAT10",
+			"BonusTiers":  []string{"Top up 100.000 bonus 5.000"},
+			"MinAmount":   int64(10000),
+			"MaxAmount":   int64(1000000),
+		})
+		assert.True(t, strings.HasPrefix(text, "🎟️ *Voucher* `HEMAT10` *active*"), text)
+		assert.Contains(t, text, "• Top up 100.000 bonus 5.000\n")
+		assert.Contains(t, text, "Minimum: Rp 10.000")
+		assert.Contains(t, text, "Maximum: Rp 1.000.000")
+
+		plain := service.RenderTemplate("en", "topup_request", map[string]interface{}{"MinAmount": int64(10000), "MaxAmount": int64(1000000)})
+		assert.True(t, strings.HasPrefix(plain, "╔"), plain)
+	})
+
+	t.Run("Unsupported language falls back to the default", func(t *testing.T) {
+		assert.Equal(t, service.RenderTemplate("id", "main_menu", nil), service.RenderTemplate("fr", "main_menu", nil))
+	})
+
+	t.Run("Unknown key is returned as is", func(t *testing.T) {
+		assert.Equal(t, "no_such_key", service.RenderTemplate("en", "no_such_key", nil))
+	})
+}
+
+func TestMessageTemplates(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("DEFAULT_LANGUAGE", "id")
+	t.Cleanup(func() {
+		service.ResetMessageTemplate("en", "help")
+		service.ResetMessageTemplate("id", "rules")
+	})
+
+	t.Run("Every language has the same keys", func(t *testing.T) {
+		keys := func(language string) []string {
+			entries, err := service.GetMessageTemplates(language)
+			require.NoError(t, err)
+			var keys []string
+			for _, entry := range entries {
+				keys = append(keys, entry.Key)
+			}
+			return keys
+		}
+		assert.ElementsMatch(t, []string{"en", "id"}, service.SupportedLanguages())
+		assert.Equal(t, keys("id"), keys("en"))
+		assert.Contains(t, keys("id"), "topup_request")
+	})
+
+	t.Run("Admin edit overrides the bundled text", func(t *testing.T) {
+		require.NoError(t, service.SetMessageTemplate("en", "help", "Need help? {{template \"button_contact_admin\"}}", 99))
+		assert.Equal(t, "Need help? 👨‍💼 Contact Admin", service.RenderTemplate("en", "help", nil))
+		assert.Contains(t, service.RenderTemplate("id", "help", nil), "Bantuan", "other languages keep their text")
+
+		entries, err := service.GetMessageTemplates("en")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			if entry.Key == "help" {
+				assert.True(t, entry.Overridden)
+				assert.Contains(t, entry.Default, "*Help - GRN Store*")
+				assert.NotNil(t, entry.UpdatedAt)
+			}
+		}
+
+		require.NoError(t, service.SetMessageTemplate("en", "help", "Edited again", 99))
+		assert.Equal(t, "Edited again", service.RenderTemplate("en", "help", nil))
+
+		require.NoError(t, service.ResetMessageTemplate("en", "help"))
+		assert.Contains(t, service.RenderTemplate("en", "help", nil), "*Help - GRN Store*")
+		assert.Error(t, service.ResetMessageTemplate("en", "help"), "nothing left to reset")
+	})
+
+	t.Run("Default language edits reach languages without the key", func(t *testing.T) {
+		require.NoError(t, service.SetMessageTemplate("id", "rules", "Aturan baru", 99))
+		assert.Equal(t, "Aturan baru", service.RenderTemplate("fr", "rules", nil))
+	})
+
+	t.Run("Invalid edits are rejected", func(t *testing.T) {
+		assert.Error(t, service.SetMessageTemplate("en", "help", "{{if}}", 99))
+		assert.Error(t, service.SetMessageTemplate("en", "no_such_key", "text", 99))
+		assert.Error(t, service.SetMessageTemplate("fr", "help", "text", 99))
+		assert.Error(t, service.SetMessageTemplate("en", "help", "  ", 99))
+	})
+
+	t.Run("Edit failing at render time falls back to the bundled text", func(t *testing.T) {
+		require.NoError(t, service.SetMessageTemplate("en", "help", "{{rupiah .MinAmount}}", 99))
+		assert.Contains(t, service.RenderTemplate("en", "help", nil), "*Help - GRN Store*")
+		require.NoError(t, service.ResetMessageTemplate("en", "help"))
+	})
+}
+
+func TestUserLanguage(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("DEFAULT_LANGUAGE", "id")
+
+	const userID = int64(5005)
+
+	assert.Equal(t, "id", service.GetUserLanguage(userID), "unknown users get the default")
+
+	require.NoError(t, service.AddActiveUserToDB(userID))
+	require.NoError(t, service.RecordLanguageCode(userID, "en-US"))
+	assert.Equal(t, "en", service.GetUserLanguage(userID), "detected from the Telegram client")
+
+	require.NoError(t, service.RecordLanguageCode(userID, "pt-br"))
+	assert.Equal(t, "id", service.GetUserLanguage(userID), "unsupported client language")
+
+	require.NoError(t, service.SetUserLanguage(userID, "en"))
+	require.NoError(t, service.RecordLanguageCode(userID, "id"))
+	assert.Equal(t, "en", service.GetUserLanguage(userID), "/language wins over the client language")
+	assert.Contains(t, service.RenderUserTemplate(userID, "main_menu", nil), "Main Menu")
+
+	assert.Error(t, service.SetUserLanguage(userID, "fr"))
+
+	require.NoError(t, service.SetUserLanguage(6006, "en"), "users without an active_users row yet")
+	assert.Equal(t, "en", service.GetUserLanguage(6006))
+}
+
+func TestTemplateAdminRoutesRequireToken(t *testing.T) {
+	useTestDatabase(t)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	// Templates reach every user, so editing them needs the admin token
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPut, "/api/admin/templates/en/help", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPut, "/api/admin/templates/en/help", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodDelete, "/api/admin/templates/en/help", ""))
+	assert.Contains(t, service.RenderTemplate("en", "help", nil), "*Help - GRN Store*")
+
+	assert.Equal(t, http.StatusOK, adminRouteStatus(t, http.MethodGet, "/api/admin/templates", "secret"))
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/config"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// sentTo returns the chat IDs of the messages a fakeSender sent, from the given index
+func sentTo(f *fakeSender, from int) []int64 {
+	var chatIDs []int64
+	for _, c := range f.sent[from:] {
+		switch msg := c.(type) {
+		case tgbotapi.MessageConfig:
+			chatIDs = append(chatIDs, msg.ChatID)
+		case tgbotapi.PhotoConfig:
+			chatIDs = append(chatIDs, msg.ChatID)
+		}
+	}
+	return chatIDs
+}
+
+func TestAdminChatIDs(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "100")
+	t.Setenv("ADMIN_CHAT_IDS", "200, 100,abc")
+
+	assert.Equal(t, []int64{100, 200}, config.GetAdminChatIDs())
+	assert.True(t, config.IsAdmin(100))
+	assert.True(t, config.IsAdmin(200))
+	assert.False(t, config.IsAdmin(300))
+	assert.False(t, config.IsAdmin(0))
+}
+
+func TestTicket(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "100")
+	t.Setenv("ADMIN_CHAT_IDS", "200")
+	db := useTestDatabase(t)
+	sender := &fakeSender{}
+	user := &tgbotapi.User{ID: 7, FirstName: "John", UserName: "john_doe"}
+
+	_, err := service.OpenTicket(sender, user, "  ", "")
+	assert.Error(t, err)
+
+	// A new ticket goes to every admin, with the user's details escaped
+	ticket, err := service.OpenTicket(sender, user, "Paket belum masuk *padahal* sudah bayar", "")
+	require.NoError(t, err)
+	assert.Equal(t, service.TicketOpen, ticket.Status)
+	assert.Equal(t, []int64{100, 200}, sentTo(sender, 0))
+	notice := sender.sent[1].(tgbotapi.MessageConfig)
+	assert.Contains(t, notice.Text, "john\\_doe")
+	assert.Contains(t, notice.Text, "\\*padahal\\*")
+
+	// Replying to the notification in either admin chat finds the ticket
+	id, ok := service.TicketForAdminMessage(200, 2)
+	assert.True(t, ok)
+	assert.Equal(t, ticket.ID, id)
+	_, ok = service.TicketForAdminMessage(100, 2)
+	assert.False(t, ok)
+
+	// The first admin to reply takes the ticket
+	sent := len(sender.sent)
+	_, err = service.ReplyTicket(sender, ticket.ID, 200, "Sedang kami cek", "")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{7}, sentTo(sender, sent))
+	ticket, err = service.GetTicket(ticket.ID)
+	require.NoError(t, err)
+	assert.Equal(t, service.TicketPending, ticket.Status)
+	assert.Equal(t, int64(200), ticket.AssignedTo)
+
+	// Follow-ups with a photo only reach the assigned admin
+	sent = len(sender.sent)
+	_, err = service.AddUserTicketMessage(sender, ticket.ID, 7, "Ini buktinya", "photo-file-id")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{200}, sentTo(sender, sent))
+	photo, ok := sender.sent[sent].(tgbotapi.PhotoConfig)
+	require.True(t, ok)
+	assert.Equal(t, tgbotapi.FileID("photo-file-id"), photo.File)
+	assert.Contains(t, photo.Caption, "Ini buktinya")
+	ticket, _ = service.GetTicket(ticket.ID)
+	assert.Equal(t, service.TicketOpen, ticket.Status)
+
+	_, err = service.AddUserTicketMessage(sender, ticket.ID, 8, "bukan tiket saya", "")
+	assert.Error(t, err)
+
+	// Handing the ticket to the other admin sends them the latest message
+	_, err = service.AssignTicket(sender, ticket.ID, 300)
+	assert.Error(t, err, "only admins can be assigned")
+	sent = len(sender.sent)
+	_, err = service.AssignTicket(sender, ticket.ID, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{100}, sentTo(sender, sent))
+
+	messages, err := service.GetTicketMessages(ticket.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	assert.False(t, messages[0].FromAdmin)
+	assert.True(t, messages[1].FromAdmin)
+	assert.Equal(t, "photo-file-id", messages[2].PhotoID)
+
+	// Closing tells the user; a closed ticket takes no replies until the user writes again
+	sent = len(sender.sent)
+	_, err = service.CloseTicket(sender, ticket.ID, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{7}, sentTo(sender, sent))
+	_, err = service.ReplyTicket(sender, ticket.ID, 100, "halo", "")
+	assert.Error(t, err)
+
+	_, err = service.AddUserTicketMessage(sender, ticket.ID, 7, "Masih belum masuk", "")
+	require.NoError(t, err)
+	var reopened models.Ticket
+	require.NoError(t, db.First(&reopened, ticket.ID).Error)
+	assert.Equal(t, service.TicketOpen, reopened.Status)
+	assert.Nil(t, reopened.ClosedAt)
+
+	tickets, err := service.GetUserTickets(7, 10)
+	require.NoError(t, err)
+	assert.Len(t, tickets, 1)
+	tickets, err = service.GetTickets(service.TicketClosed, 10)
+	require.NoError(t, err)
+	assert.Empty(t, tickets)
+}
+
+func TestAssignTicketConflict(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "100")
+	t.Setenv("ADMIN_CHAT_IDS", "200")
+	db := useTestDatabase(t)
+	sender := &fakeSender{}
+
+	ticket, err := service.OpenTicket(sender, &tgbotapi.User{ID: 7, FirstName: "John"}, "Saldo belum masuk", "")
+	require.NoError(t, err)
+
+	// Admin 200 takes the ticket between admin 100 reading it and assigning it
+	raced := false
+	require.NoError(t, db.Callback().Update().Before("gorm:begin_transaction").Register("test:race_assign", func(tx *gorm.DB) {
+		if !raced {
+			raced = true
+			db.Exec("UPDATE tickets SET assigned_to = ? WHERE id = ?", 200, ticket.ID)
+		}
+	}))
+	t.Cleanup(func() { db.Callback().Update().Remove("test:race_assign") })
+
+	sent := len(sender.sent)
+	_, err = service.AssignTicket(sender, ticket.ID, 100)
+	assert.ErrorIs(t, err, service.ErrTicketAssignConflict)
+	assert.Contains(t, err.Error(), "admin 200")
+	assert.Empty(t, sentTo(sender, sent))
+
+	var stored models.Ticket
+	require.NoError(t, db.First(&stored, ticket.ID).Error)
+	assert.Equal(t, int64(200), stored.AssignedTo)
+
+	// Trying again with the fresh assignee goes through
+	_, err = service.AssignTicket(sender, ticket.ID, 100)
+	require.NoError(t, err)
+	require.NoError(t, db.First(&stored, ticket.ID).Error)
+	assert.Equal(t, int64(100), stored.AssignedTo)
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTierPrice(t *testing.T) {
+	useTestDatabase(t)
+
+	require.NoError(t, service.SaveTierPrice(&models.TierPrice{Tier: "reseller", DiscountType: service.MarkupPercent, DiscountValue: 10, IsActive: true}))
+	require.NoError(t, service.SaveTierPrice(&models.TierPrice{Tier: "agen", PackageCode: "AKRAB_L", Price: 21000, IsActive: true}))
+	require.NoError(t, service.SaveTierPrice(&models.TierPrice{Tier: "agent", DiscountType: service.MarkupFixed, DiscountValue: 5000, IsActive: true}))
+
+	quote := func(code string) *service.PriceQuote {
+		return &service.PriceQuote{PackageCode: code, CostPrice: 20000, SellPrice: 25000}
+	}
+
+	t.Run("Retail keeps the sell price", func(t *testing.T) {
+		q := quote("AKRAB_L")
+		service.ApplyTierPrice(q, service.TierRetail)
+		assert.Equal(t, int64(25000), q.SellPrice)
+	})
+
+	t.Run("Tier-wide discount", func(t *testing.T) {
+		q := quote("AKRAB_L")
+		service.ApplyTierPrice(q, service.TierReseller)
+		assert.Equal(t, int64(22500), q.SellPrice)
+		assert.Equal(t, int64(25000), q.RetailPrice)
+	})
+
+	t.Run("Package price beats the tier-wide discount", func(t *testing.T) {
+		q := quote("AKRAB_L")
+		service.ApplyTierPrice(q, service.TierAgent)
+		assert.Equal(t, int64(21000), q.SellPrice)
+
+		q = quote("AKRAB_M")
+		service.ApplyTierPrice(q, service.TierAgent)
+		assert.Equal(t, int64(20000), q.SellPrice, "never below cost")
+	})
+
+	t.Run("Invalid entries are rejected", func(t *testing.T) {
+		assert.Error(t, service.SaveTierPrice(&models.TierPrice{Tier: "retail", DiscountType: service.MarkupFixed, DiscountValue: 1000}))
+		assert.Error(t, service.SaveTierPrice(&models.TierPrice{Tier: "reseller", Price: 10000}), "fixed price needs a package")
+		assert.Error(t, service.SaveTierPrice(&models.TierPrice{Tier: "reseller", DiscountType: service.MarkupPercent, DiscountValue: 150}))
+	})
+}
+
+func TestTierPromotion(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("TIER_RESELLER_MONTHLY_SPEND", "100000")
+	t.Setenv("TIER_AGENT_MONTHLY_SPEND", "500000")
+
+	const userID = int64(5001)
+	assert.Equal(t, service.TierRetail, service.GetUserTier(userID))
+
+	addPurchase := func(id string, price int64, status string) {
+		require.NoError(t, db.Create(&models.PurchaseTransaction{
+			ID: id, UserID: userID, PackageCode: "AKRAB_L", Price: price, Status: status, CreatedAt: time.Now(),
+		}).Error)
+	}
+
+	addPurchase("trx-tier-1", 60000, "success")
+	addPurchase("trx-tier-2", 90000, "failed")
+	tier, err := service.CheckTierPromotion(userID)
+	require.NoError(t, err)
+	assert.Empty(t, tier, "failed purchases do not count")
+
+	addPurchase("trx-tier-3", 50000, "pending")
+	tier, err = service.CheckTierPromotion(userID)
+	require.NoError(t, err)
+	assert.Equal(t, service.TierReseller, tier)
+	assert.Equal(t, service.TierReseller, service.GetUserTier(userID))
+
+	t.Run("Admin tiers are never lowered automatically", func(t *testing.T) {
+		require.NoError(t, service.SetUserTier(userID, "agent", 1))
+		tier, err := service.CheckTierPromotion(userID)
+		require.NoError(t, err)
+		assert.Empty(t, tier)
+		assert.Equal(t, service.TierAgent, service.GetUserTier(userID))
+
+		members, err := service.GetTierMembers()
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.False(t, members[0].AutoPromoted)
+		assert.Equal(t, int64(110000), members[0].MonthlySpend)
+	})
+}
+
+func TestChargePurchasePromotesTier(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("TIER_RESELLER_MONTHLY_SPEND", "100000")
+
+	const userID = int64(5002)
+	require.NoError(t, service.AddUserBalance(userID, 200000))
+	require.NoError(t, db.Create(&models.PurchaseTransaction{
+		ID: "trx-tier-charge", UserID: userID, PackageCode: "AKRAB_L", Price: 120000, Status: "success", CreatedAt: time.Now(),
+	}).Error)
+
+	// The promotion is settled before ChargePurchase returns
+	purchaseResp := &dto.PurchaseResponse{Success: true}
+	purchaseResp.Data.TrxID = "trx-tier-charge"
+	purchaseResp.Data.Price = 120000
+	require.NoError(t, service.ChargePurchase(userID, purchaseResp))
+	assert.Equal(t, service.TierReseller, service.GetUserTier(userID))
+}
+
+func TestCachesFollowTestDatabase(t *testing.T) {
+	t.Run("first database", func(t *testing.T) {
+		useTestDatabase(t)
+		require.NoError(t, service.SetUserTier(4242, service.TierAgent, 0))
+		assert.Equal(t, service.TierAgent, service.GetUserTier(4242))
+	})
+
+	t.Run("second database", func(t *testing.T) {
+		// The tier cached from the first database is gone
+		useTestDatabase(t)
+		assert.Equal(t, service.TierRetail, service.GetUserTier(4242))
+	})
+}
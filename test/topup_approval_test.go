@@ -0,0 +1,102 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopupApprovalNotices(t *testing.T) {
+	t.Setenv("ADMIN_CHAT_ID", "100")
+	t.Setenv("ADMIN_CHAT_IDS", "200")
+	t.Setenv("PAYMENT_PROOF_DIR", t.TempDir())
+	db := useTestDatabase(t)
+	sender := &fakeSender{}
+
+	t.Run("rejection with a reason", func(t *testing.T) {
+		pendingTopUp(t, "TXN_APPROVAL_1", 7, time.Hour)
+		sent := len(sender.sent)
+		require.NoError(t, service.SendTopupApprovalNotices(sender, "TXN_APPROVAL_1"))
+		assert.Equal(t, []int64{100, 200}, sentTo(sender, sent))
+
+		notice := sender.sent[sent].(tgbotapi.MessageConfig)
+		assert.Contains(t, notice.Text, "`TXN_APPROVAL_1`")
+		keyboard := notice.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+		var actions []string
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				actions = append(actions, *button.CallbackData)
+			}
+		}
+		assert.Equal(t, []string{"approve_tx:TXN_APPROVAL_1", "reject_tx:TXN_APPROVAL_1", "askproof_tx:TXN_APPROVAL_1"}, actions)
+
+		require.NoError(t, service.RejectTopUp("TXN_APPROVAL_1", 100, " Nominal transfer tidak sesuai "))
+
+		var stored models.Transaction
+		require.NoError(t, db.First(&stored, "id = ?", "TXN_APPROVAL_1").Error)
+		assert.Equal(t, "rejected", stored.Status)
+		assert.Equal(t, "Nominal transfer tidak sesuai", stored.RejectReason)
+
+		// The user gets the reason through the outbox
+		var queued models.OutboxMessage
+		require.NoError(t, db.Where("recipient = ?", "7").Last(&queued).Error)
+		assert.Contains(t, queued.Message, "Ditolak")
+		assert.Contains(t, queued.Message, "Nominal transfer tidak sesuai")
+
+		// Both admin messages are edited in place, without their buttons
+		sent = len(sender.sent)
+		service.RefreshTopupNotices(sender, "TXN_APPROVAL_1")
+		require.Len(t, sender.sent, sent+2)
+		for i, chatID := range []int64{100, 200} {
+			edit, ok := sender.sent[sent+i].(tgbotapi.EditMessageTextConfig)
+			require.True(t, ok)
+			assert.Equal(t, chatID, edit.ChatID)
+			assert.Nil(t, edit.ReplyMarkup)
+			assert.Contains(t, edit.Text, "Ditolak")
+			assert.Contains(t, edit.Text, "admin 100")
+			assert.Contains(t, edit.Text, "Nominal transfer tidak sesuai")
+		}
+
+		// The second admin can no longer process it, and the notices are edited only once
+		assert.Error(t, service.ConfirmTopUp("TXN_APPROVAL_1", 200))
+		assert.Error(t, service.RejectTopUp("TXN_APPROVAL_1", 200, ""))
+		_, err := service.RequestPaymentProof(sender, "TXN_APPROVAL_1")
+		assert.Error(t, err)
+		sent = len(sender.sent)
+		service.RefreshTopupNotices(sender, "TXN_APPROVAL_1")
+		assert.Len(t, sender.sent, sent)
+	})
+
+	t.Run("approval updates forwarded proofs", func(t *testing.T) {
+		pendingTopUp(t, "TXN_APPROVAL_2", 8, time.Hour)
+
+		sent := len(sender.sent)
+		userID, err := service.RequestPaymentProof(sender, "TXN_APPROVAL_2")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), userID)
+		assert.Equal(t, []int64{8}, sentTo(sender, sent))
+
+		_, err = service.SubmitPaymentProof(sender, 8, "proof-file-id", testPNG(t, 42))
+		require.NoError(t, err)
+
+		// Still pending: nothing is edited yet
+		sent = len(sender.sent)
+		service.RefreshTopupNotices(sender, "TXN_APPROVAL_2")
+		assert.Len(t, sender.sent, sent)
+
+		require.NoError(t, service.ConfirmTopUp("TXN_APPROVAL_2", 0))
+		service.RefreshTopupNotices(sender, "TXN_APPROVAL_2")
+		require.Len(t, sender.sent, sent+2)
+		for _, c := range sender.sent[sent:] {
+			edit, ok := c.(tgbotapi.EditMessageCaptionConfig)
+			require.True(t, ok)
+			assert.Contains(t, edit.Caption, "Di\\-approve")
+			assert.Contains(t, edit.Caption, "oleh API")
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/dto"
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopupBonusSpec(t *testing.T) {
+	tier, err := service.ParseTopupBonusSpec([]string{"100rb", "5%", "maks=20rb", "sampai=2030-01-31", "nama=Promo_Gajian"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(100000), tier.MinAmount)
+	assert.Equal(t, service.MarkupPercent, tier.BonusType)
+	assert.Equal(t, 5.0, tier.BonusValue)
+	assert.Equal(t, int64(20000), tier.MaxBonus)
+	assert.Equal(t, "Promo Gajian", tier.Name)
+	assert.True(t, tier.Active)
+	require.NotNil(t, tier.EndsAt)
+	assert.Equal(t, 31, tier.EndsAt.Day())
+
+	fixed, err := service.ParseTopupBonusSpec([]string{"50000", "2000"})
+	require.NoError(t, err)
+	assert.Equal(t, service.MarkupFixed, fixed.BonusType)
+	assert.Equal(t, int64(2000), service.CalculateTopupBonus(fixed, 50000))
+
+	_, err = service.ParseTopupBonusSpec([]string{"50000", "x%"})
+	assert.Error(t, err)
+}
+
+func TestTopupBonusTiers(t *testing.T) {
+	db := useTestDatabase(t)
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+	for _, tier := range []*models.TopupBonusTier{
+		{MinAmount: 50000, BonusType: service.MarkupFixed, BonusValue: 2000, Active: true},
+		{MinAmount: 100000, BonusType: service.MarkupPercent, BonusValue: 5, MaxBonus: 10000, Active: true},
+		{MinAmount: 100000, BonusType: service.MarkupFixed, BonusValue: 50000, EndsAt: &yesterday, Active: true},
+		{MinAmount: 100000, BonusType: service.MarkupFixed, BonusValue: 50000, StartsAt: &tomorrow, Active: true},
+	} {
+		require.NoError(t, service.SaveTopupBonusTier(tier))
+	}
+
+	t.Run("The largest running tier wins", func(t *testing.T) {
+		_, bonus, err := service.GetTopupBonus(20000)
+		require.NoError(t, err)
+		assert.Zero(t, bonus)
+
+		_, bonus, err = service.GetTopupBonus(60000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2000), bonus)
+
+		_, bonus, err = service.GetTopupBonus(150000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(7500), bonus)
+
+		_, bonus, err = service.GetTopupBonus(500000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10000), bonus, "percent bonus is capped")
+	})
+
+	t.Run("Invalid tiers are rejected", func(t *testing.T) {
+		assert.Error(t, service.SaveTopupBonusTier(&models.TopupBonusTier{MinAmount: 0, BonusType: service.MarkupFixed, BonusValue: 1000}))
+		assert.Error(t, service.SaveTopupBonusTier(&models.TopupBonusTier{MinAmount: 10000, BonusType: "double", BonusValue: 1000}))
+	})
+
+	t.Run("Confirmation credits the locked bonus", func(t *testing.T) {
+		const userID = int64(4001)
+		now := time.Now()
+		tx := &dto.Transaction{
+			ID:          "TXN_BONUS_1",
+			UserID:      userID,
+			Amount:      100000,
+			Status:      "pending",
+			CreatedAt:   now.Format("2006-01-02 15:04:05"),
+			ExpiredAt:   now.Add(30 * time.Minute).Format("2006-01-02 15:04:05"),
+			BonusAmount: 5000,
+		}
+		service.TxMutex.Lock()
+		service.Transactions[tx.ID] = tx
+		service.TxMutex.Unlock()
+		t.Cleanup(func() {
+			service.TxMutex.Lock()
+			delete(service.Transactions, tx.ID)
+			service.TxMutex.Unlock()
+		})
+
+		require.NoError(t, service.ConfirmTopUp(tx.ID, 1))
+		assert.Equal(t, int64(105000), service.GetUserBalance(userID).Balance)
+
+		var stored models.Transaction
+		require.NoError(t, db.First(&stored, "id = ?", tx.ID).Error)
+		assert.Equal(t, int64(5000), stored.BonusAmount)
+	})
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVoucherSpec(t *testing.T) {
+	voucher, err := service.ParseVoucherSpec([]string{"hemat10", "package", "10%", "maks=5rb", "min=20000", "kuota=50", "produk=AKRAB_L,AKRAB_M", "sampai=2030-01-31"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "HEMAT10", voucher.Code)
+	assert.Equal(t, service.VoucherScopePackage, voucher.Scope)
+	assert.Equal(t, service.MarkupPercent, voucher.DiscountType)
+	assert.Equal(t, 10.0, voucher.DiscountValue)
+	assert.Equal(t, int64(5000), voucher.MaxDiscount)
+	assert.Equal(t, int64(20000), voucher.MinSpend)
+	assert.Equal(t, 50, voucher.MaxUses)
+	assert.Equal(t, 1, voucher.MaxUsesPerUser)
+	assert.Equal(t, "AKRAB_L,AKRAB_M", voucher.EligibleProducts)
+	require.NotNil(t, voucher.ExpiresAt)
+	assert.Equal(t, 31, voucher.ExpiresAt.Day())
+
+	_, err = service.ParseVoucherSpec([]string{"X", "package", "abc"})
+	assert.Error(t, err)
+}
+
+func TestCalculateVoucherDiscount(t *testing.T) {
+	percent := &models.Voucher{Scope: service.VoucherScopePackage, DiscountType: service.MarkupPercent, DiscountValue: 10, MaxDiscount: 3000}
+	assert.Equal(t, int64(2000), service.CalculateVoucherDiscount(percent, 20000))
+	assert.Equal(t, int64(3000), service.CalculateVoucherDiscount(percent, 50000))
+
+	fixed := &models.Voucher{Scope: service.VoucherScopeVPN, DiscountType: service.MarkupFixed, DiscountValue: 5000}
+	assert.Equal(t, int64(4000), service.CalculateVoucherDiscount(fixed, 4000), "a discount never exceeds the price")
+
+	bonus := &models.Voucher{Scope: service.VoucherScopeTopUp, DiscountType: service.MarkupFixed, DiscountValue: 5000}
+	assert.Equal(t, int64(5000), service.CalculateVoucherDiscount(bonus, 4000), "a top-up bonus is not bounded by the amount")
+}
+
+func TestVoucherRedemption(t *testing.T) {
+	db := useTestDatabase(t)
+
+	require.NoError(t, service.CreateVoucher(&models.Voucher{
+		Code:             "AKRAB5K",
+		Scope:            service.VoucherScopePackage,
+		DiscountType:     service.MarkupFixed,
+		DiscountValue:    5000,
+		MinSpend:         20000,
+		EligibleProducts: "AKRAB_L",
+		MaxUses:          2,
+		MaxUsesPerUser:   1,
+		Active:           true,
+	}))
+
+	t.Run("Scope, product and minimum spend are enforced", func(t *testing.T) {
+		_, _, err := service.CheckVoucher("akrab5k", 1, service.VoucherScopeVPN, "ssh", 50000)
+		assert.Error(t, err)
+
+		_, _, err = service.CheckVoucher("akrab5k", 1, service.VoucherScopePackage, "UNLI_7", 50000)
+		assert.Error(t, err)
+
+		_, _, err = service.CheckVoucher("akrab5k", 1, service.VoucherScopePackage, "AKRAB_L", 10000)
+		assert.Error(t, err)
+
+		_, discount, err := service.CheckVoucher("akrab5k", 1, service.VoucherScopePackage, "AKRAB_L", 50000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5000), discount)
+	})
+
+	t.Run("Per-user cap", func(t *testing.T) {
+		redemption, err := service.ReserveVoucher("AKRAB5K", 1, service.VoucherScopePackage, "AKRAB_L", 50000)
+		require.NoError(t, err)
+		service.ConfirmVoucherRedemption(redemption, "trx-1")
+
+		_, err = service.ReserveVoucher("AKRAB5K", 1, service.VoucherScopePackage, "AKRAB_L", 50000)
+		assert.Error(t, err)
+	})
+
+	t.Run("Cancelled reservations give the use back", func(t *testing.T) {
+		redemption, err := service.ReserveVoucher("AKRAB5K", 2, service.VoucherScopePackage, "AKRAB_L", 50000)
+		require.NoError(t, err)
+
+		_, err = service.ReserveVoucher("AKRAB5K", 3, service.VoucherScopePackage, "AKRAB_L", 50000)
+		assert.Error(t, err, "global cap of 2 is reached")
+
+		service.CancelVoucherRedemption(redemption)
+
+		_, err = service.ReserveVoucher("AKRAB5K", 3, service.VoucherScopePackage, "AKRAB_L", 50000)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired and inactive vouchers are rejected", func(t *testing.T) {
+		yesterday := time.Now().Add(-24 * time.Hour)
+		require.NoError(t, service.CreateVoucher(&models.Voucher{
+			Code: "LAMA", Scope: service.VoucherScopeTopUp, DiscountType: service.MarkupFixed,
+			DiscountValue: 1000, ExpiresAt: &yesterday, Active: true,
+		}))
+		_, err := service.LookupVoucher("LAMA", 1, service.VoucherScopeTopUp, "")
+		assert.Error(t, err)
+
+		_, err = service.UpdateVoucher("LAMA", func(v *models.Voucher) {
+			v.ExpiresAt = nil
+			v.Active = false
+		})
+		require.NoError(t, err)
+		_, err = service.LookupVoucher("LAMA", 1, service.VoucherScopeTopUp, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Report counts confirmed redemptions", func(t *testing.T) {
+		reports, err := service.GetVoucherReports()
+		require.NoError(t, err)
+
+		var report service.VoucherReport
+		for _, r := range reports {
+			if r.Code == "AKRAB5K" {
+				report = r
+			}
+		}
+		assert.Equal(t, 2, report.UsedCount)
+		assert.Equal(t, int64(1), report.Redemptions)
+		assert.Equal(t, int64(5000), report.TotalDiscount)
+		assert.Equal(t, int64(45000), report.Revenue)
+
+		var voucher models.Voucher
+		require.NoError(t, db.First(&voucher, "code = ?", "AKRAB5K").Error)
+		assert.Equal(t, 2, voucher.UsedCount)
+	})
+}
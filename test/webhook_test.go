@@ -0,0 +1,196 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nabilulilalbab/bottele/models"
+	"github.com/nabilulilalbab/bottele/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, service.WebhookBackoff(1))
+	assert.Equal(t, time.Minute, service.WebhookBackoff(2))
+	assert.Equal(t, 4*time.Minute, service.WebhookBackoff(4))
+	assert.Equal(t, 6*time.Hour, service.WebhookBackoff(20))
+}
+
+func TestWebhooks(t *testing.T) {
+	db := useTestDatabase(t)
+
+	var mu sync.Mutex
+	fail := false
+	var received []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	setFail := func(value bool) {
+		mu.Lock()
+		fail = value
+		mu.Unlock()
+	}
+
+	waitForDelivery := func(id uint, check func(d *models.WebhookDelivery) bool) *models.WebhookDelivery {
+		var delivery models.WebhookDelivery
+		require.Eventually(t, func() bool {
+			delivery = models.WebhookDelivery{}
+			return db.First(&delivery, id).Error == nil && check(&delivery)
+		}, 2*time.Second, 10*time.Millisecond)
+		return &delivery
+	}
+
+	sub := &models.WebhookSubscription{Name: "ERP", URL: server.URL, EventTypes: "balance.adjusted, topup.confirmed", Active: true}
+	secret, err := service.CreateWebhookSubscription(sub)
+	require.NoError(t, err)
+	require.NotEmpty(t, secret)
+
+	t.Run("Invalid subscriptions are rejected", func(t *testing.T) {
+		_, err := service.CreateWebhookSubscription(&models.WebhookSubscription{URL: "ftp://example.com", EventTypes: "*"})
+		assert.Error(t, err)
+		_, err = service.CreateWebhookSubscription(&models.WebhookSubscription{URL: server.URL, EventTypes: "order.shipped"})
+		assert.Error(t, err)
+		_, err = service.CreateWebhookSubscription(&models.WebhookSubscription{URL: server.URL})
+		assert.Error(t, err)
+	})
+
+	t.Run("Events are signed and delivered to matching subscriptions", func(t *testing.T) {
+		require.NoError(t, service.AddUserBalance(7001, 50000))
+
+		var deliveries []models.WebhookDelivery
+		require.NoError(t, db.Where("subscription_id = ?", sub.ID).Find(&deliveries).Error)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, service.EventBalanceAdjusted, deliveries[0].EventType)
+
+		delivery := waitForDelivery(deliveries[0].ID, func(d *models.WebhookDelivery) bool { return d.Status == service.WebhookSent })
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusOK, delivery.ResponseCode)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, received, 1)
+		assert.Equal(t, service.SignPayload(secret, bodies[0]), received[0].Header.Get("X-Signature"))
+		assert.Equal(t, service.EventBalanceAdjusted, received[0].Header.Get("X-Webhook-Event"))
+		assert.Equal(t, delivery.EventID, received[0].Header.Get("X-Webhook-ID"))
+
+		var event struct {
+			Type string                 `json:"type"`
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(bodies[0], &event))
+		assert.Equal(t, service.EventBalanceAdjusted, event.Type)
+		assert.Equal(t, float64(7001), event.Data["user_id"])
+		assert.Equal(t, float64(50000), event.Data["delta"])
+		assert.Equal(t, float64(50000), event.Data["balance"])
+	})
+
+	t.Run("Unsubscribed events are not recorded", func(t *testing.T) {
+		var before int64
+		db.Model(&models.WebhookDelivery{}).Count(&before)
+
+		service.PublishEvent(service.EventVPNCreated, map[string]interface{}{"user_id": 7001})
+
+		var after int64
+		db.Model(&models.WebhookDelivery{}).Count(&after)
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("Failed deliveries are retried with backoff", func(t *testing.T) {
+		setFail(true)
+		require.NoError(t, service.DeductUserBalance(7001, 10000))
+
+		var latest models.WebhookDelivery
+		require.NoError(t, db.Order("id DESC").First(&latest).Error)
+		delivery := waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return d.Attempts == 1 })
+		assert.Equal(t, service.WebhookPending, delivery.Status)
+		assert.Equal(t, http.StatusInternalServerError, delivery.ResponseCode)
+		assert.NotEmpty(t, delivery.LastError)
+		require.NotNil(t, delivery.NextAttemptAt)
+		assert.WithinDuration(t, time.Now().Add(30*time.Second), *delivery.NextAttemptAt, 5*time.Second)
+
+		// Not due yet, so the dispatcher leaves it alone
+		service.RunWebhookDispatcher()
+		delivery = waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return true })
+		assert.Equal(t, 1, delivery.Attempts)
+
+		setFail(false)
+		require.NoError(t, db.Model(delivery).Update("next_attempt_at", time.Now().Add(-time.Second)).Error)
+		service.RunWebhookDispatcher()
+
+		delivery = waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return d.Status == service.WebhookSent })
+		assert.Equal(t, 2, delivery.Attempts)
+		assert.Empty(t, delivery.LastError)
+	})
+
+	t.Run("Exhausted deliveries fail and can be replayed", func(t *testing.T) {
+		t.Setenv("WEBHOOK_MAX_ATTEMPTS", "1")
+		setFail(true)
+		require.NoError(t, service.AddUserBalance(7001, 5000))
+
+		var latest models.WebhookDelivery
+		require.NoError(t, db.Order("id DESC").First(&latest).Error)
+		delivery := waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return d.Status == service.WebhookFailed })
+		assert.Nil(t, delivery.NextAttemptAt)
+
+		setFail(false)
+		require.NoError(t, service.ReplayWebhookDelivery(latest.ID))
+		delivery = waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return d.Status == service.WebhookSent })
+		assert.Equal(t, 1, delivery.Attempts)
+
+		assert.Error(t, service.ReplayWebhookDelivery(999999))
+	})
+
+	t.Run("Deleting a subscription stops its pending deliveries", func(t *testing.T) {
+		setFail(true)
+		require.NoError(t, service.AddUserBalance(7001, 1000))
+
+		var latest models.WebhookDelivery
+		require.NoError(t, db.Order("id DESC").First(&latest).Error)
+		waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return d.Attempts == 1 })
+
+		require.NoError(t, service.DeleteWebhookSubscription(sub.ID))
+		delivery := waitForDelivery(latest.ID, func(d *models.WebhookDelivery) bool { return true })
+		assert.Equal(t, service.WebhookFailed, delivery.Status)
+
+		deliveries, err := service.GetWebhookDeliveries(sub.ID, "", 50)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 4)
+	})
+}
+
+func TestWebhookAdminRoutesRequireToken(t *testing.T) {
+	db := useTestDatabase(t)
+	t.Setenv("ADMIN_API_TOKEN", "secret")
+
+	// Webhooks receive every business event, and a replay resends a signed payload
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodGet, "/api/admin/webhooks", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPost, "/api/admin/webhooks", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPut, "/api/admin/webhooks/1", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodDelete, "/api/admin/webhooks/1", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodGet, "/api/admin/webhooks/deliveries", ""))
+	assert.Equal(t, http.StatusUnauthorized, adminRouteStatus(t, http.MethodPost, "/api/admin/webhooks/deliveries/1/replay", ""))
+
+	var count int64
+	db.Model(&models.WebhookSubscription{}).Count(&count)
+	assert.Zero(t, count)
+
+	assert.Equal(t, http.StatusOK, adminRouteStatus(t, http.MethodGet, "/api/admin/webhooks", "secret"))
+}